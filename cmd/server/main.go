@@ -1,12 +1,17 @@
 package main
 
 import (
+	"crypto/tls"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/rag"
 	serverpkg "github.com/kiali/kiali-ai/kiali_ai_mcp/internal/server"
 )
 
@@ -14,6 +19,22 @@ func main() {
 	_ = godotenv.Load()
 	addr := getEnv("SERVER_ADDR", ":8080")
 
+	if config.GetBool("AUTO_INGEST_ON_START", false) {
+		rag.StartAutoIngest(rag.DefaultEngine())
+	}
+	// SIGHUP re-reads the <NAME>_FILE secrets, e.g. after a rotation.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			config.ReloadSecrets()
+			serverpkg.ReloadAPIKeys()
+			log.Printf("secrets reloaded")
+		}
+	}()
+	rag.StartOrphanCleanup(rag.DefaultEngine())
+	rag.StartCompaction(rag.DefaultEngine())
+
 	h := serverpkg.NewRouter()
 	srv := &http.Server{
 		Addr:              addr,
@@ -21,8 +42,35 @@ func main() {
 		ReadHeaderTimeout: 15 * time.Second,
 	}
 
-	log.Printf("server listening on %s", addr)
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	// TLS is optional; plain HTTP stays the default for deployments behind a proxy.
+	certFile := config.Get("TLS_CERT_FILE", "")
+	keyFile := config.Get("TLS_KEY_FILE", "")
+	if (certFile == "") != (keyFile == "") {
+		log.Fatalf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if certFile == "" {
+		log.Printf("server listening on %s%s", addr, serverpkg.BasePath())
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("server failed: %v", err)
+		}
+		return
+	}
+
+	minVersion, err := tlsMinVersion()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	srv.TLSConfig = &tls.Config{MinVersion: minVersion}
+	if redirectAddr := config.Get("TLS_REDIRECT_HTTP_ADDR", ""); redirectAddr != "" {
+		go func() {
+			log.Printf("redirecting http on %s to https", redirectAddr)
+			if err := newRedirectServer(redirectAddr, addr).ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("redirect server failed: %v", err)
+			}
+		}()
+	}
+	log.Printf("server listening on %s%s (tls)", addr, serverpkg.BasePath())
+	if err := srv.ListenAndServeTLS(certFile, keyFile); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("server failed: %v", err)
 	}
 }
@@ -32,4 +80,4 @@ func getEnv(key, def string) string {
 		return v
 	}
 	return def
-} 
\ No newline at end of file
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// tlsMinVersion maps TLS_MIN_VERSION ("1.2" or "1.3") to its crypto/tls constant.
+func tlsMinVersion() (uint16, error) {
+	switch v := strings.TrimSpace(config.Get("TLS_MIN_VERSION", "1.2")); v {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS_MIN_VERSION %q (use 1.2 or 1.3)", v)
+	}
+}
+
+// newRedirectServer serves plain HTTP on addr and redirects every request to the
+// HTTPS listener at tlsAddr, keeping the requested host name.
+func newRedirectServer(addr, tlsAddr string) *http.Server {
+	_, tlsPort, _ := net.SplitHostPort(tlsAddr)
+	return &http.Server{
+		Addr:              addr,
+		ReadHeaderTimeout: 15 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			if tlsPort != "" && tlsPort != "443" {
+				host = net.JoinHostPort(host, tlsPort)
+			}
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+		}),
+	}
+}
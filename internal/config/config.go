@@ -3,7 +3,9 @@ package config
 import (
 	"fmt"
 	"io"
+	"log"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -13,6 +15,10 @@ import (
 var (
 	loadOnce sync.Once
 	values   map[string]string
+
+	secretsMu sync.Mutex
+	// secrets holds the contents of <key>_FILE files by path, read on first use.
+	secrets = map[string]string{}
 )
 
 func load() {
@@ -50,13 +56,63 @@ func toString(v any) string {
 
 // Get returns the configuration value for key. Precedence:
 // 1) Environment variable
-// 2) config file value (config.yaml)
-// 3) provided default
+// 2) Contents of the file named by <key>_FILE (env var or config file), as mounted
+// by Docker/Kubernetes secrets; trailing newlines are trimmed
+// 3) config file value (config.yaml)
+// 4) provided default
 func Get(key, def string) string {
 	loadOnce.Do(load)
 	if v := os.Getenv(key); v != "" {
 		return v
 	}
+	if path := lookup(key + "_FILE"); path != "" {
+		v, err := readSecret(path)
+		if err != nil {
+			log.Printf("config: read %s_FILE: %v", key, err)
+			return def
+		}
+		return v
+	}
+	if v := fileValue(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// readSecret returns the contents of path without trailing newlines, from the
+// cache once read. Failed reads are not cached.
+func readSecret(path string) (string, error) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	if v, ok := secrets[path]; ok {
+		return v, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	v := strings.TrimRight(string(b), "\r\n")
+	secrets[path] = v
+	return v, nil
+}
+
+// ReloadSecrets forgets the cached <key>_FILE contents, so a rotated secret is
+// read again on its next use.
+func ReloadSecrets() {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	clear(secrets)
+}
+
+// lookup returns key from the environment or the config file, without _FILE indirection.
+func lookup(key string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fileValue(key)
+}
+
+func fileValue(key string) string {
 	// Try exact, upper, and lower keys
 	if values != nil {
 		if v, ok := values[key]; ok && v != "" {
@@ -69,5 +125,33 @@ func Get(key, def string) string {
 			return v
 		}
 	}
-	return def
+	return ""
+}
+
+// GetBool returns the boolean value for key using the same precedence as Get.
+// Unparseable values fall back to def.
+func GetBool(key string, def bool) bool {
+	v := Get(key, "")
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(v))
+	if err != nil {
+		return def
+	}
+	return b
+}
+
+// GetInt returns the integer value for key using the same precedence as Get.
+// Unparseable values fall back to def.
+func GetInt(key string, def int) int {
+	v := Get(key, "")
+	if v == "" {
+		return def
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		return def
+	}
+	return i
 }
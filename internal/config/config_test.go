@@ -0,0 +1,28 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecretFileCached(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_TOKEN_FILE", path)
+	if got := Get("TEST_TOKEN", ""); got != "first" {
+		t.Fatalf("Get = %q, want first", got)
+	}
+	if err := os.WriteFile(path, []byte("second\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := Get("TEST_TOKEN", ""); got != "first" {
+		t.Errorf("Get before reload = %q, want the cached first", got)
+	}
+	ReloadSecrets()
+	if got := Get("TEST_TOKEN", ""); got != "second" {
+		t.Errorf("Get after reload = %q, want second", got)
+	}
+}
@@ -0,0 +1,94 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// defaultFooterTemplate renders the disclaimer and a markdown list of the sources.
+const defaultFooterTemplate = `
+
+---
+{{.Disclaimer}}{{if .Sources}}
+Sources:
+{{range .Sources}}- [{{.Title}}]({{.URL}})
+{{end}}{{end}}`
+
+const defaultDisclaimer = "Based on the Kiali documentation as of {{.IndexedAt}}. Verify critical steps against the linked pages."
+
+// footerData is what ANSWER_FOOTER_TEMPLATE and ANSWER_DISCLAIMER can use.
+type footerData struct {
+	Disclaimer string
+	Sources    []Citation
+	// IndexedAt is the date of the namespace's latest ingest run, or Today when
+	// none is recorded; both are YYYY-MM-DD in UTC.
+	IndexedAt string
+	Today     string
+}
+
+// answerFooter is the parsed ANSWER_FOOTER templates.
+type answerFooter struct {
+	disclaimer *template.Template
+	footer     *template.Template
+}
+
+// loadAnswerFooter parses ANSWER_DISCLAIMER and ANSWER_FOOTER_TEMPLATE when
+// ANSWER_FOOTER is enabled. A literal "\n" in either stands for a newline, for
+// convenience in env vars. Like the crawl filters, a bad template is an error.
+func loadAnswerFooter() (*answerFooter, error) {
+	if !config.GetBool("ANSWER_FOOTER", false) {
+		return nil, nil
+	}
+	unescape := func(s string) string { return strings.ReplaceAll(s, `\n`, "\n") }
+	var f answerFooter
+	var err error
+	if f.disclaimer, err = template.New("disclaimer").Parse(unescape(config.Get("ANSWER_DISCLAIMER", defaultDisclaimer))); err != nil {
+		return nil, fmt.Errorf("ANSWER_DISCLAIMER: %w", err)
+	}
+	if f.footer, err = template.New("footer").Parse(unescape(config.Get("ANSWER_FOOTER_TEMPLATE", defaultFooterTemplate))); err != nil {
+		return nil, fmt.Errorf("ANSWER_FOOTER_TEMPLATE: %w", err)
+	}
+	return &f, nil
+}
+
+// appendFooter adds the configured footer to a free-text answer, listing each
+// cited URL once. Rendering errors are logged and leave the answer as it is.
+func (e *engine) appendFooter(ctx context.Context, ns string, res *AnswerResult) {
+	if e.footer == nil {
+		return
+	}
+	data := footerData{Today: time.Now().UTC().Format(time.DateOnly)}
+	data.IndexedAt = data.Today
+	var last string
+	if err := e.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(last_run_at), '') FROM sources WHERE namespace="+e.placeholder(1), ns).Scan(&last); err == nil && last != "" {
+		if t, err := time.Parse(time.RFC3339, last); err == nil {
+			data.IndexedAt = t.UTC().Format(time.DateOnly)
+		}
+	}
+	seen := map[string]bool{}
+	for _, c := range res.Citations {
+		if !seen[c.URL] {
+			seen[c.URL] = true
+			data.Sources = append(data.Sources, c)
+		}
+	}
+	var b bytes.Buffer
+	if err := e.footer.disclaimer.Execute(&b, data); err != nil {
+		log.Printf("answer footer: %v", err)
+		return
+	}
+	data.Disclaimer = b.String()
+	b.Reset()
+	if err := e.footer.footer.Execute(&b, data); err != nil {
+		log.Printf("answer footer: %v", err)
+		return
+	}
+	res.Answer += b.String()
+}
@@ -0,0 +1,204 @@
+package rag
+
+import (
+	"errors"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Answers are generated as markdown. FormatAnswer renders them for clients that
+// cannot: plain strips the markup and html renders the common constructs
+// (headings, paragraphs, lists, quotes, code, emphasis and links). The html
+// renderer escapes all answer text before adding its own tags, so model output
+// can never inject markup; links keep only http, https and mailto targets or
+// relative ones.
+
+// Answer formats.
+const (
+	FormatMarkdown = "markdown"
+	FormatPlain    = "plain"
+	FormatHTML     = "html"
+)
+
+// ErrUnsupportedFormat is returned by FormatAnswer for an unknown format.
+var ErrUnsupportedFormat = errors.New("unsupported format: use markdown, plain or html")
+
+// CheckFormat validates an answer format; empty means markdown.
+func CheckFormat(format string) error {
+	switch strings.ToLower(format) {
+	case "", FormatMarkdown, FormatPlain, FormatHTML:
+		return nil
+	}
+	return ErrUnsupportedFormat
+}
+
+// FormatAnswer converts a markdown answer to format.
+func FormatAnswer(answer, format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "", FormatMarkdown:
+		return answer, nil
+	case FormatPlain:
+		return plainAnswer(answer), nil
+	case FormatHTML:
+		return renderHTML(answer), nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+var (
+	mdFenceLine  = regexp.MustCompile("(?m)^\\s*(```|~~~).*$\\n?")
+	blankRuns    = regexp.MustCompile(`\n{3,}`)
+	mdOrdered    = regexp.MustCompile(`^\s*\d+[.)]\s+`)
+	mdUnordered  = regexp.MustCompile(`^\s*[-*+]\s+`)
+	mdHeadingTag = regexp.MustCompile(`^\s{0,3}(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdCodeSpan   = regexp.MustCompile("`([^`]+)`")
+	// Inline patterns run on escaped text, so link targets are already escaped.
+	mdInlineLink = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdStrong     = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	mdEm         = regexp.MustCompile(`\*([^*\s][^*]*)\*`)
+	mdStrike     = regexp.MustCompile(`~~([^~]+)~~`)
+)
+
+func plainAnswer(answer string) string {
+	text := stripMarkdownMarkers(mdFenceLine.ReplaceAllString(answer, ""))
+	return strings.TrimSpace(blankRuns.ReplaceAllString(text, "\n\n"))
+}
+
+// renderHTML renders markdown line by line into the constructs listed above.
+func renderHTML(answer string) string {
+	var b, para strings.Builder
+	list, quote := "", false
+	flushPara := func() {
+		if para.Len() > 0 {
+			b.WriteString("<p>" + para.String() + "</p>\n")
+			para.Reset()
+		}
+	}
+	closeBlocks := func() {
+		flushPara()
+		if list != "" {
+			b.WriteString("</" + list + ">\n")
+			list = ""
+		}
+		if quote {
+			b.WriteString("</blockquote>\n")
+			quote = false
+		}
+	}
+	lines := strings.Split(strings.ReplaceAll(answer, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			closeBlocks()
+			fence := trimmed[:3]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			b.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+		case trimmed == "":
+			closeBlocks()
+		case mdHorizontalHR.MatchString(line):
+			closeBlocks()
+			b.WriteString("<hr>\n")
+		case mdHeadingTag.MatchString(line):
+			closeBlocks()
+			m := mdHeadingTag.FindStringSubmatch(line)
+			tag := "h" + string(rune('0'+len(m[1])))
+			b.WriteString("<" + tag + ">" + renderInline(m[2]) + "</" + tag + ">\n")
+		case mdUnordered.MatchString(line) || mdOrdered.MatchString(line):
+			kind, marker := "ul", mdUnordered
+			if mdOrdered.MatchString(line) {
+				kind, marker = "ol", mdOrdered
+			}
+			if list != kind {
+				closeBlocks()
+				b.WriteString("<" + kind + ">\n")
+				list = kind
+			}
+			b.WriteString("<li>" + renderInline(marker.ReplaceAllString(line, "")) + "</li>\n")
+		case strings.HasPrefix(trimmed, ">"):
+			if !quote {
+				closeBlocks()
+				b.WriteString("<blockquote>\n")
+				quote = true
+			}
+			text := strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))
+			if para.Len() > 0 {
+				para.WriteString("\n")
+			}
+			para.WriteString(renderInline(text))
+		default:
+			if list != "" {
+				closeBlocks()
+			}
+			if para.Len() > 0 {
+				para.WriteString("<br>\n")
+			}
+			para.WriteString(renderInline(trimmed))
+		}
+	}
+	closeBlocks()
+	return strings.TrimSpace(b.String())
+}
+
+// renderInline escapes one line of text and renders its code spans, links and
+// emphasis. Code spans are left untouched by the other rules.
+func renderInline(text string) string {
+	var b strings.Builder
+	pos := 0
+	for _, m := range mdCodeSpan.FindAllStringSubmatchIndex(text, -1) {
+		b.WriteString(renderSpans(html.EscapeString(text[pos:m[0]])))
+		b.WriteString("<code>" + html.EscapeString(text[m[2]:m[3]]) + "</code>")
+		pos = m[1]
+	}
+	b.WriteString(renderSpans(html.EscapeString(text[pos:])))
+	return b.String()
+}
+
+// renderSpans renders links and emphasis in escaped text. Emphasis is rendered
+// around and inside links but never in their targets, where "*" and "__" are
+// plain URL characters.
+func renderSpans(escaped string) string {
+	var b strings.Builder
+	pos := 0
+	for _, m := range mdInlineLink.FindAllStringSubmatchIndex(escaped, -1) {
+		b.WriteString(renderEmphasis(escaped[pos:m[0]]))
+		label, target := renderEmphasis(escaped[m[2]:m[3]]), escaped[m[4]:m[5]]
+		if safeLinkTarget(html.UnescapeString(target)) {
+			b.WriteString(`<a href="` + target + `" rel="nofollow noopener noreferrer">` + label + "</a>")
+		} else {
+			b.WriteString(label)
+		}
+		pos = m[1]
+	}
+	b.WriteString(renderEmphasis(escaped[pos:]))
+	return b.String()
+}
+
+// renderEmphasis renders strong, emphasized and struck-through text.
+func renderEmphasis(escaped string) string {
+	escaped = mdStrong.ReplaceAllString(escaped, "<strong>$1$2</strong>")
+	escaped = mdEm.ReplaceAllString(escaped, "<em>$1</em>")
+	return mdStrike.ReplaceAllString(escaped, "<del>$1</del>")
+}
+
+// safeLinkTarget allows http, https and mailto URLs and relative references.
+func safeLinkTarget(target string) bool {
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return true
+	case "":
+		// Reject scheme-like prefixes url.Parse does not recognize, e.g. "java\tscript:".
+		return !strings.Contains(strings.SplitN(target, "/", 2)[0], ":")
+	}
+	return false
+}
@@ -0,0 +1,25 @@
+package rag
+
+import "testing"
+
+func TestRenderHTMLInline(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"emphasis", "Use **strict** mode and *mTLS*.", "<p>Use <strong>strict</strong> mode and <em>mTLS</em>.</p>"},
+		{"link", "See [the graph](https://kiali.io/docs/graph/).", `<p>See <a href="https://kiali.io/docs/graph/" rel="nofollow noopener noreferrer">the graph</a>.</p>`},
+		{"emphasis markers in a target", "Read [the __init__ docs](https://example.com/a__b__c/*x*).",
+			`<p>Read <a href="https://example.com/a__b__c/*x*" rel="nofollow noopener noreferrer">the <strong>init</strong> docs</a>.</p>`},
+		{"emphasis around a link", "**Note:** see [docs](https://kiali.io/) *first*.",
+			`<p><strong>Note:</strong> see <a href="https://kiali.io/" rel="nofollow noopener noreferrer">docs</a> <em>first</em>.</p>`},
+		{"unsafe target", "[click](javascript:void)", "<p>click</p>"},
+		{"code span", "Run `kubectl get *`.", "<p>Run <code>kubectl get *</code>.</p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderHTML(tt.in); got != tt.want {
+				t.Errorf("renderHTML(%q)\n got %s\nwant %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package rag
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrAPIKeyNotFound is returned by RevokeAPIKey for an unknown name.
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// ErrAPIKeyExists is returned by AddAPIKey when the name is taken.
+var ErrAPIKeyExists = errors.New("api key already exists")
+
+// ErrInvalidAPIKey is returned by AddAPIKey for a bad name or namespace.
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+var apiKeyNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
+
+// APIKey is a stored API key. Only a SHA-256 hash of the secret is kept, so the
+// secret itself is shown once, when the key is added. An empty Namespace means
+// the key is not confined to one.
+type APIKey struct {
+	Name      string    `json:"name"`
+	Namespace string    `json:"namespace,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func initAPIKeys(db *sql.DB) error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS api_keys (
+	name TEXT PRIMARY KEY,
+	key_hash TEXT NOT NULL UNIQUE,
+	namespace TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL
+);
+`)
+	return err
+}
+
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// AddAPIKey stores a new key under name and returns it with its generated secret.
+// A non-empty namespace confines the key to it.
+func (e *engine) AddAPIKey(ctx context.Context, name, namespace string) (APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if !apiKeyNamePattern.MatchString(name) {
+		return APIKey{}, "", fmt.Errorf("%w: name %q: use up to 64 letters, digits, '.', '-' or '_'", ErrInvalidAPIKey, name)
+	}
+	k := APIKey{Name: name, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	if strings.TrimSpace(namespace) != "" {
+		ns, err := NormalizeNamespace(namespace)
+		if err != nil {
+			return APIKey{}, "", fmt.Errorf("%w: %v", ErrInvalidAPIKey, err)
+		}
+		k.Namespace = ns
+	}
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return APIKey{}, "", err
+	}
+	secret := hex.EncodeToString(buf)
+	if e.backend != "postgres" {
+		unlock := e.lockWrites()
+		defer unlock()
+	}
+	var exists bool
+	err := e.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM api_keys WHERE name="+e.placeholder(1)+")", name).Scan(&exists)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	if exists {
+		return APIKey{}, "", fmt.Errorf("%w: %s", ErrAPIKeyExists, name)
+	}
+	_, err = e.db.ExecContext(ctx, "INSERT INTO api_keys(name, key_hash, namespace, created_at) VALUES("+e.placeholders(4)+")",
+		name, hashAPIKey(secret), k.Namespace, k.CreatedAt.Format(time.RFC3339))
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	return k, secret, nil
+}
+
+// APIKeys lists the stored keys by name.
+func (e *engine) APIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := e.db.QueryContext(ctx, "SELECT name, namespace, created_at FROM api_keys ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		var created string
+		if err := rows.Scan(&k.Name, &k.Namespace, &created); err != nil {
+			return nil, err
+		}
+		k.CreatedAt, _ = time.Parse(time.RFC3339, created)
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+// RevokeAPIKey deletes a stored key; requests using it fail from then on.
+func (e *engine) RevokeAPIKey(ctx context.Context, name string) error {
+	if e.backend != "postgres" {
+		unlock := e.lockWrites()
+		defer unlock()
+	}
+	res, err := e.db.ExecContext(ctx, "DELETE FROM api_keys WHERE name="+e.placeholder(1), strings.TrimSpace(name))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrAPIKeyNotFound, name)
+	}
+	return nil
+}
+
+// LookupAPIKey finds the stored key with the given secret.
+func (e *engine) LookupAPIKey(ctx context.Context, secret string) (APIKey, bool, error) {
+	var k APIKey
+	var created string
+	err := e.db.QueryRowContext(ctx, "SELECT name, namespace, created_at FROM api_keys WHERE key_hash="+e.placeholder(1), hashAPIKey(secret)).
+		Scan(&k.Name, &k.Namespace, &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, false, nil
+	}
+	if err != nil {
+		return APIKey{}, false, err
+	}
+	k.CreatedAt, _ = time.Parse(time.RFC3339, created)
+	return k, true, nil
+}
@@ -0,0 +1,93 @@
+package rag
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// DefaultDocsBaseURL is the crawl entry point used when none is configured.
+const DefaultDocsBaseURL = "https://kiali.io/"
+
+// DefaultDocsSeeds returns the crawl entry points used when an ingest request
+// names none: the comma-separated DOCS_BASE_URLS, or DefaultDocsBaseURL.
+func DefaultDocsSeeds() []string {
+	var seeds []string
+	for _, s := range strings.Split(config.Get("DOCS_BASE_URLS", DefaultDocsBaseURL), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			seeds = append(seeds, s)
+		}
+	}
+	if len(seeds) == 0 {
+		return []string{DefaultDocsBaseURL}
+	}
+	return seeds
+}
+
+// IngestStatus reports the progress of the startup auto-ingest.
+type IngestStatus struct {
+	State      string     `json:"state"` // disabled, checking, skipped, running, completed, failed
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Ingested   int        `json:"ingested"`
+	Skipped    int        `json:"skipped"`
+	Error      string     `json:"error,omitempty"`
+}
+
+var (
+	autoIngestMu     sync.Mutex
+	autoIngestStatus = IngestStatus{State: "disabled"}
+)
+
+// AutoIngestStatus returns a snapshot of the startup auto-ingest state.
+func AutoIngestStatus() IngestStatus {
+	autoIngestMu.Lock()
+	defer autoIngestMu.Unlock()
+	return autoIngestStatus
+}
+
+func setAutoIngestStatus(update func(s *IngestStatus)) {
+	autoIngestMu.Lock()
+	defer autoIngestMu.Unlock()
+	update(&autoIngestStatus)
+}
+
+// StartAutoIngest crawls the default docs in the background when the default
+// namespace is empty, so a fresh deployment can answer questions without a manual
+// ingest. It returns immediately and does nothing if documents already exist.
+func StartAutoIngest(eng Engine) {
+	setAutoIngestStatus(func(s *IngestStatus) { *s = IngestStatus{State: "checking"} })
+	go func() {
+		ctx := context.Background()
+		count, err := eng.DocumentCount(ctx, DefaultNamespace)
+		if err != nil {
+			log.Printf("auto-ingest: count documents: %v", err)
+			setAutoIngestStatus(func(s *IngestStatus) { s.State, s.Error = "failed", err.Error() })
+			return
+		}
+		if count > 0 {
+			log.Printf("auto-ingest: corpus has %d documents, skipping", count)
+			setAutoIngestStatus(func(s *IngestStatus) { s.State = "skipped" })
+			return
+		}
+		started := time.Now()
+		setAutoIngestStatus(func(s *IngestStatus) { s.State, s.StartedAt = "running", &started })
+		seeds := DefaultDocsSeeds()
+		log.Printf("auto-ingest: corpus empty, ingesting %s", strings.Join(seeds, ", "))
+		res, err := eng.IngestKialiDocs(ctx, seeds, IngestOptions{})
+		finished := time.Now()
+		setAutoIngestStatus(func(s *IngestStatus) {
+			s.FinishedAt, s.Ingested, s.Skipped = &finished, res.Ingested, res.Skipped
+			if err != nil {
+				s.State, s.Error = "failed", err.Error()
+				return
+			}
+			s.State = "completed"
+		})
+		log.Printf("auto-ingest: done in %s, ingested=%d skipped=%d err=%v", finished.Sub(started), res.Ingested, res.Skipped, err)
+	}()
+}
@@ -0,0 +1,162 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// ErrProviderUnavailable is returned without calling a provider whose circuit
+// breaker is open.
+var ErrProviderUnavailable = errors.New("llm provider unavailable")
+
+// Circuit breaker states.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// BreakerStatus is the circuit breaker state of one provider.
+type BreakerStatus struct {
+	Provider            string     `json:"provider"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Opens               int        `json:"opens"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+}
+
+// breakers tracks consecutive failures per provider. After threshold failures a
+// provider's circuit opens and calls fail fast for cooldown; then a single probe
+// call is let through (half-open), which closes the circuit on success or
+// reopens it on failure. A zero threshold disables the breaker.
+type breakers struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu     sync.Mutex
+	status map[string]*breakerState
+}
+
+type breakerState struct {
+	state    string
+	failures int
+	opens    int
+	openedAt time.Time
+	probing  bool
+}
+
+func loadBreakers() *breakers {
+	return &breakers{
+		threshold: config.GetInt("LLM_BREAKER_THRESHOLD", 5),
+		cooldown:  time.Duration(config.GetInt("LLM_BREAKER_COOLDOWN_SECONDS", 30)) * time.Second,
+		now:       time.Now,
+		status:    map[string]*breakerState{},
+	}
+}
+
+func (b *breakers) get(provider string) *breakerState {
+	s, ok := b.status[provider]
+	if !ok {
+		s = &breakerState{state: BreakerClosed}
+		b.status[provider] = s
+	}
+	return s
+}
+
+// allow reports whether a call to provider may proceed.
+func (b *breakers) allow(provider string) error {
+	if b.threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.get(provider)
+	switch s.state {
+	case BreakerOpen:
+		if b.now().Sub(s.openedAt) < b.cooldown {
+			return fmt.Errorf("%w: %s circuit open", ErrProviderUnavailable, provider)
+		}
+		s.state = BreakerHalfOpen
+		log.Printf("%s circuit half-open, probing", provider)
+	case BreakerHalfOpen:
+		if s.probing {
+			return fmt.Errorf("%w: %s circuit half-open", ErrProviderUnavailable, provider)
+		}
+	}
+	s.probing = s.state == BreakerHalfOpen
+	return nil
+}
+
+// record updates provider's breaker with the outcome of an allowed call. Calls
+// cut short by the caller's context say nothing about the provider and are ignored.
+func (b *breakers) record(ctx context.Context, provider string, err error) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.get(provider)
+	probe := s.probing
+	s.probing = false
+	// A safety block is an answer from a healthy provider.
+	if errors.Is(err, ErrContentBlocked) {
+		err = nil
+	}
+	if err != nil && ctx.Err() != nil {
+		if probe {
+			// Let the next call probe instead.
+			s.state = BreakerOpen
+		}
+		return
+	}
+	if err == nil {
+		if s.state != BreakerClosed {
+			log.Printf("%s circuit closed", provider)
+		}
+		s.state, s.failures = BreakerClosed, 0
+		return
+	}
+	s.failures++
+	if probe || s.failures >= b.threshold {
+		if s.state != BreakerOpen {
+			s.opens++
+			log.Printf("%s circuit open for %s after %d consecutive failures", provider, b.cooldown, s.failures)
+		}
+		s.state, s.openedAt = BreakerOpen, b.now()
+	}
+}
+
+// snapshot returns the state of the given providers, sorted by name.
+func (b *breakers) snapshot(providers []string) []BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]BreakerStatus, 0, len(providers))
+	for _, p := range providers {
+		s := b.get(p)
+		st := BreakerStatus{Provider: p, State: s.state, ConsecutiveFailures: s.failures, Opens: s.opens}
+		if s.state != BreakerClosed {
+			at := s.openedAt
+			st.OpenedAt = &at
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Provider < out[j].Provider })
+	return out
+}
+
+// ProviderStatus reports the circuit breaker of every provider the engine may call.
+func (e *engine) ProviderStatus() []BreakerStatus {
+	var providers []string
+	for _, t := range e.providerChain() {
+		providers = append(providers, t.Provider)
+	}
+	return e.breakers.snapshot(providers)
+}
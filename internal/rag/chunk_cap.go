@@ -0,0 +1,55 @@
+package rag
+
+import (
+	"log"
+	"strings"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// MAX_CHUNKS_PER_DOC (default 0: no cap) bounds the chunks embedded for one
+// document, so a single enormous page cannot dominate embedding cost or the
+// retrieval candidate pool. MAX_CHUNKS_MODE picks the chunks kept: sample
+// (default) spreads them evenly from the first chunk to the last, truncate keeps
+// the first ones. The stored document content stays whole; summary chunks are not
+// counted against the cap.
+
+// Modes selectable with MAX_CHUNKS_MODE.
+const (
+	chunkCapSample   = "sample"
+	chunkCapTruncate = "truncate"
+)
+
+// chunkCap limits the raw chunks of a document; zero max disables it.
+type chunkCap struct {
+	max  int
+	mode string
+}
+
+func loadChunkCap() chunkCap {
+	c := chunkCap{max: max(0, config.GetInt("MAX_CHUNKS_PER_DOC", 0))}
+	c.mode = strings.ToLower(strings.TrimSpace(config.Get("MAX_CHUNKS_MODE", chunkCapSample)))
+	switch c.mode {
+	case chunkCapSample, chunkCapTruncate:
+	default:
+		log.Printf("MAX_CHUNKS_MODE: unknown mode %q, using %s", c.mode, chunkCapSample)
+		c.mode = chunkCapSample
+	}
+	return c
+}
+
+// apply returns the chunks of docURL to embed and whether the cap dropped any.
+func (c chunkCap) apply(docURL string, chunks []textChunk) ([]textChunk, bool) {
+	if c.max <= 0 || len(chunks) <= c.max {
+		return chunks, false
+	}
+	log.Printf("capping %s at %d of %d chunks (MAX_CHUNKS_MODE=%s)", docURL, c.max, len(chunks), c.mode)
+	if c.mode == chunkCapTruncate || c.max == 1 {
+		return chunks[:c.max], true
+	}
+	out := make([]textChunk, c.max)
+	for i := range out {
+		out[i] = chunks[i*(len(chunks)-1)/(c.max-1)]
+	}
+	return out, true
+}
@@ -0,0 +1,71 @@
+package rag
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// Answer retrieves a pool of candidate chunks and narrows it to the chunks placed
+// in the prompt, so retrieval recall and prompt cost are tuned separately.
+// ANSWER_PROMPT_CHUNKS (default 8) is the prompt width. ANSWER_CANDIDATE_CHUNKS is
+// the pool: unset, it falls back to MMR_CANDIDATES and then to four times the
+// prompt width with MMR and the prompt width without. Without MMR the pool is
+// narrowed by score, so a larger one only matters for EMBED_ENSEMBLE fusion.
+
+// maxAnswerChunks bounds both widths of a single request.
+const maxAnswerChunks = 100
+
+func loadChunkCounts() (candidates, prompt int) {
+	candidates = config.GetInt("ANSWER_CANDIDATE_CHUNKS", config.GetInt("MMR_CANDIDATES", 0))
+	prompt = config.GetInt("ANSWER_PROMPT_CHUNKS", 8)
+	if prompt < 1 || prompt > maxAnswerChunks {
+		log.Printf("ANSWER_PROMPT_CHUNKS: want 1-%d, got %d; using 8", maxAnswerChunks, prompt)
+		prompt = 8
+	}
+	return max(0, candidates), prompt
+}
+
+// chunkCounts returns the candidate pool and prompt width of a request: its own
+// when set, the configured ones otherwise. A pool of zero is left to retrieve.
+func (o AnswerOptions) chunkCounts(defCandidates, defPrompt int) (int, int, error) {
+	candidates, prompt := defCandidates, defPrompt
+	if o.PromptChunks != 0 {
+		if o.PromptChunks < 1 || o.PromptChunks > maxAnswerChunks {
+			return 0, 0, fmt.Errorf("%w: prompt_chunks must be between 1 and %d, got %d", ErrInvalidChunkCount, maxAnswerChunks, o.PromptChunks)
+		}
+		prompt = o.PromptChunks
+	}
+	if o.CandidateChunks != 0 {
+		if o.CandidateChunks < prompt || o.CandidateChunks > maxAnswerChunks {
+			return 0, 0, fmt.Errorf("%w: candidate_chunks must be between prompt_chunks (%d) and %d, got %d", ErrInvalidChunkCount, prompt, maxAnswerChunks, o.CandidateChunks)
+		}
+		candidates = o.CandidateChunks
+	}
+	return candidates, prompt, nil
+}
+
+// defaultSearchMaxK matches the largest k the HTTP and GraphQL search accept.
+const defaultSearchMaxK = 500
+
+// loadSearchMaxK reads SEARCH_MAX_K, the most chunks a single vector search
+// returns whatever its caller asks for, so no request can make the SQLite path
+// rank and return a whole corpus.
+func loadSearchMaxK() int {
+	k := config.GetInt("SEARCH_MAX_K", defaultSearchMaxK)
+	if k < 1 {
+		log.Printf("SEARCH_MAX_K: want at least 1, got %d; using %d", k, defaultSearchMaxK)
+		k = defaultSearchMaxK
+	}
+	return k
+}
+
+// clampK bounds a search width to [1, SEARCH_MAX_K].
+func (e *engine) clampK(k int) int {
+	if k > e.searchMaxK {
+		log.Printf("search k=%d clamped to SEARCH_MAX_K=%d", k, e.searchMaxK)
+		return e.searchMaxK
+	}
+	return max(k, 1)
+}
@@ -0,0 +1,38 @@
+package rag
+
+// CitationGroup gathers the cited chunks of one document. Score is the best span
+// score; spans keep retrieval order, best first.
+type CitationGroup struct {
+	Title string      `json:"title"`
+	URL   string      `json:"url"`
+	Score float64     `json:"score"`
+	Spans []GroupSpan `json:"spans"`
+}
+
+// GroupSpan is one cited chunk of a CitationGroup. URL is the citation link,
+// which can be more precise than the document's, e.g. a video timestamp.
+type GroupSpan struct {
+	Span  string  `json:"span"`
+	URL   string  `json:"url"`
+	Score float64 `json:"score"`
+}
+
+// groupCitations groups ranked chunks, with spans[i] shown for docs[i], by
+// document URL. Groups are ordered by their best chunk, so the most relevant
+// document comes first.
+func groupCitations(docs []docChunk, spans []string) []CitationGroup {
+	groups := []CitationGroup{}
+	index := map[string]int{}
+	for j, d := range docs {
+		i, ok := index[d.URL]
+		if !ok {
+			i = len(groups)
+			index[d.URL] = i
+			groups = append(groups, CitationGroup{Title: d.Title, URL: d.URL, Score: d.Score})
+		}
+		g := &groups[i]
+		g.Score = max(g.Score, d.Score)
+		g.Spans = append(g.Spans, GroupSpan{Span: spans[j], URL: citationURL(d), Score: d.Score})
+	}
+	return groups
+}
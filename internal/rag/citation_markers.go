@@ -0,0 +1,89 @@
+package rag
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The prompt numbers each context chunk [1]..[n] in the order of the answer's
+// citations and asks the model to cite with those markers. resolveCitationMarkers
+// maps the markers in the answer back to the citation list.
+
+// citationMarker matches [3] and the list form [1, 2] some models prefer.
+var citationMarker = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// resolveCitationMarkers rewrites the citation markers of answer for n citations:
+// lists become adjacent markers ([1, 2] to [1][2]) and numbers outside 1..n,
+// which point at no citation, are dropped. It returns the rewritten answer and
+// the citations referenced, by marker, in order of first appearance. Code fences,
+// inline code, indexing such as a[1] and markdown links are left alone.
+func resolveCitationMarkers(answer string, n int) (string, []int) {
+	var cited []int
+	seen := map[int]bool{}
+	rewrite := func(prose string) string {
+		var b strings.Builder
+		last := 0
+		for _, m := range citationMarker.FindAllStringSubmatchIndex(prose, -1) {
+			start, end := m[0], m[1]
+			if start > 0 && isIdentByte(prose[start-1]) || end < len(prose) && prose[end] == '(' {
+				continue
+			}
+			var out strings.Builder
+			for _, f := range strings.Split(prose[m[2]:m[3]], ",") {
+				i, err := strconv.Atoi(strings.TrimSpace(f))
+				if err != nil || i < 1 || i > n {
+					continue
+				}
+				out.WriteString("[" + strconv.Itoa(i) + "]")
+				if !seen[i] {
+					seen[i] = true
+					cited = append(cited, i)
+				}
+			}
+			if out.Len() == 0 {
+				// Drop the space before a removed marker too: "text [9]." becomes "text.".
+				b.WriteString(strings.TrimRight(prose[last:start], " "))
+			} else {
+				b.WriteString(prose[last:start])
+				b.WriteString(out.String())
+			}
+			last = end
+		}
+		b.WriteString(prose[last:])
+		return b.String()
+	}
+
+	lines := strings.Split(answer, "\n")
+	fence := ""
+	for i, line := range lines {
+		if fence != "" {
+			if t := strings.TrimSpace(line); strings.HasPrefix(t, fence) && strings.Trim(t, fence[:1]) == "" {
+				fence = ""
+			}
+			continue
+		}
+		if m := mdFence.FindStringSubmatch(line); m != nil {
+			fence = m[1]
+			continue
+		}
+		// Odd segments between backticks are inline code.
+		parts := strings.Split(line, "`")
+		for j := 0; j < len(parts); j += 2 {
+			parts[j] = rewrite(parts[j])
+		}
+		lines[i] = strings.Join(parts, "`")
+	}
+	return strings.Join(lines, "\n"), cited
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// markCited flags the citations referenced by marker.
+func markCited(citations []Citation, markers []int) {
+	for _, i := range markers {
+		citations[i-1].Cited = true
+	}
+}
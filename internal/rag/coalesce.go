@@ -0,0 +1,119 @@
+package rag
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+)
+
+// With CHAT_COALESCE (default true) identical Answer calls that overlap share one
+// execution: the first runs embed, search and completion, the others wait for its
+// result. Calls are identical when their normalized query, Kiali context and
+// options match.
+
+// answerCall is an Answer execution shared by its waiting callers.
+type answerCall struct {
+	done    chan struct{}
+	res     AnswerResult
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// answerFlights tracks the Answer executions in progress by key.
+type answerFlights struct {
+	mu    sync.Mutex
+	calls map[string]*answerCall
+}
+
+// answerKey identifies an Answer call; ok is false when the call cannot be keyed.
+func answerKey(query string, kialiContext any, opts AnswerOptions) (string, bool) {
+	ctx, err := json.Marshal(kialiContext)
+	if err != nil {
+		return "", false
+	}
+	o, err := json.Marshal(opts)
+	if err != nil {
+		return "", false
+	}
+	h := sha256.New()
+	h.Write([]byte(strings.ToLower(strings.Join(strings.Fields(query), " "))))
+	h.Write([]byte{0})
+	h.Write(ctx)
+	h.Write([]byte{0})
+	h.Write(o)
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// joinAnswer answers query, joining an identical call already in progress. The
+// shared execution keeps the first caller's deadline but not its cancellation: it
+// is only cancelled once every caller waiting for it has gone. Joined callers get
+// the same result, which they must treat as read-only.
+func (e *engine) joinAnswer(ctx context.Context, query string, kialiContext any, opts AnswerOptions) (AnswerResult, error) {
+	if !e.coalesceAnswers {
+		return e.answer(ctx, query, kialiContext, opts)
+	}
+	key, ok := answerKey(query, kialiContext, opts)
+	if !ok {
+		return e.answer(ctx, query, kialiContext, opts)
+	}
+	f := &e.flights
+	f.mu.Lock()
+	c, joined := f.calls[key]
+	if !joined {
+		base := context.WithoutCancel(ctx)
+		var shared context.Context
+		var cancel context.CancelFunc
+		if deadline, ok := ctx.Deadline(); ok {
+			shared, cancel = context.WithDeadline(base, deadline)
+		} else {
+			shared, cancel = context.WithCancel(base)
+		}
+		c = &answerCall{done: make(chan struct{}), cancel: cancel}
+		if f.calls == nil {
+			f.calls = map[string]*answerCall{}
+		}
+		f.calls[key] = c
+		go func() {
+			c.res, c.err = e.answer(shared, query, kialiContext, opts)
+			f.mu.Lock()
+			if f.calls[key] == c {
+				delete(f.calls, key)
+			}
+			f.mu.Unlock()
+			cancel()
+			close(c.done)
+		}()
+	}
+	c.waiters++
+	f.mu.Unlock()
+	if joined {
+		log.Printf("answer: joined an identical query in progress")
+	}
+
+	select {
+	case <-c.done:
+		res := c.res
+		if joined {
+			// The tokens were spent, and are accounted, once.
+			res.Usage = TokenUsage{}
+		}
+		return res, c.err
+	case <-ctx.Done():
+		f.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			// Later identical calls start afresh rather than join a cancelled one.
+			c.cancel()
+			if f.calls[key] == c {
+				delete(f.calls, key)
+			}
+		}
+		f.mu.Unlock()
+		return AnswerResult{Models: e.models}, ctx.Err()
+	}
+}
@@ -0,0 +1,218 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// groupSmallSections groups consecutive sections of one page so that none falls
+// below minChars of content: a small section joins its predecessor, and a section
+// following a small one joins it. Each group lists indexes into secs.
+func groupSmallSections(secs []extractedSection, minChars int) [][]int {
+	var groups [][]int
+	size := 0
+	for i, sec := range secs {
+		n := len(strings.TrimSpace(sec.Content))
+		if len(groups) > 0 && minChars > 0 && (size < minChars || n < minChars) {
+			last := len(groups) - 1
+			groups[last] = append(groups[last], i)
+			size += n
+			continue
+		}
+		groups = append(groups, []int{i})
+		size = n
+	}
+	return groups
+}
+
+// combineSections merges sections into one that keeps the first title and URL;
+// later section titles are kept as headings in the content.
+func combineSections(secs []extractedSection) extractedSection {
+	out := secs[0]
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(out.Content))
+	for _, sec := range secs[1:] {
+		b.WriteString("\n\n")
+		b.WriteString(sec.Title)
+		if c := strings.TrimSpace(sec.Content); c != "" {
+			b.WriteString("\n\n")
+			b.WriteString(c)
+		}
+	}
+	out.Content = strings.TrimSpace(b.String())
+	return out
+}
+
+// mergeSmallSections applies groupSmallSections to the sections of one page and
+// reports how many sections were folded into others.
+func mergeSmallSections(secs []extractedSection, minChars int) ([]extractedSection, int) {
+	if minChars <= 0 {
+		return secs, 0
+	}
+	groups := groupSmallSections(secs, minChars)
+	out := make([]extractedSection, 0, len(groups))
+	for _, g := range groups {
+		parts := make([]extractedSection, len(g))
+		for i, idx := range g {
+			parts[i] = secs[idx]
+		}
+		out = append(out, combineSections(parts))
+	}
+	return out, len(secs) - len(out)
+}
+
+// Compact merges stored documents below COMPACT_MIN_CHARS with their neighbours
+// from the same page, re-embedding the merged text. Documents are considered in
+// ingest order, which follows their order on the page. A group whose merged text
+// moderation blocks keeps its documents. It refuses to run while an ingest of the
+// namespace is in progress, or any ingest without CORPUS_OPS_EXCLUSIVE.
+func (e *engine) Compact(ctx context.Context, namespace string) (CompactResult, error) {
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return CompactResult{}, err
+	}
+	res := CompactResult{Namespace: ns}
+	if e.compactMinChars <= 0 {
+		return res, ErrCompactionDisabled
+	}
+	done, err := e.ops.begin("compact", ns)
+	if err != nil {
+		return res, err
+	}
+	defer done()
+	// Without exclusive operations nothing else keeps ingests of the namespace
+	// out, so the whole store is locked instead.
+	if e.ops.exclusive {
+		e.corpusMu.RLock()
+		defer e.corpusMu.RUnlock()
+	} else {
+		if !e.corpusMu.TryLock() {
+			return res, ErrIngestInProgress
+		}
+		defer e.corpusMu.Unlock()
+	}
+
+	rows, err := e.db.QueryContext(ctx, "SELECT id, title, url, content FROM documents WHERE namespace="+e.placeholder(1)+" ORDER BY id", ns)
+	if err != nil {
+		return res, err
+	}
+	pages := map[string][]int{}
+	var order []string
+	var secs []extractedSection
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var sec extractedSection
+		var stored string
+		if err := rows.Scan(&id, &sec.Title, &sec.URL, &stored); err != nil {
+			rows.Close()
+			return res, err
+		}
+		if sec.Content, err = decodeContent(stored); err != nil {
+			rows.Close()
+			return res, err
+		}
+		page, _, _ := strings.Cut(sec.URL, "#")
+		if _, ok := pages[page]; !ok {
+			order = append(order, page)
+		}
+		pages[page] = append(pages[page], len(secs))
+		secs = append(secs, sec)
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return res, err
+	}
+
+	for _, page := range order {
+		pageSecs := make([]extractedSection, len(pages[page]))
+		for i, idx := range pages[page] {
+			pageSecs[i] = secs[idx]
+		}
+		for _, g := range groupSmallSections(pageSecs, e.compactMinChars) {
+			if len(g) < 2 {
+				continue
+			}
+			parts := make([]extractedSection, len(g))
+			var groupIDs []int64
+			for i, idx := range g {
+				parts[i] = pageSecs[idx]
+				groupIDs = append(groupIDs, ids[pages[page][idx]])
+			}
+			merged := combineSections(parts)
+			// Insert before deleting so a failure leaves duplicates rather than losing text.
+			out, err := e.storeDocument(ctx, ns, merged.Title, merged.URL, merged.Content)
+			if errors.Is(err, errDocumentBlocked) {
+				log.Printf("compact %s: merged text blocked by moderation, keeping %d documents", merged.URL, len(g))
+				continue
+			} else if err != nil {
+				return res, err
+			}
+			if err := e.keepContentUpdatedAt(ctx, out.ID, groupIDs); err != nil {
+				return res, err
+			}
+			if err := e.deleteDocuments(ctx, groupIDs); err != nil {
+				return res, err
+			}
+			res.MergedDocuments += len(g)
+			res.CreatedDocuments++
+		}
+	}
+	return res, nil
+}
+
+// deleteDocuments removes documents, their embeddings and keywords by id.
+func (e *engine) deleteDocuments(ctx context.Context, ids []int64) error {
+	unlock := e.lockWrites()
+	defer unlock()
+	for _, id := range ids {
+		if _, err := e.db.ExecContext(ctx, "DELETE FROM chunk_keywords WHERE document_id="+e.placeholder(1), id); err != nil {
+			return err
+		}
+		if _, err := e.db.ExecContext(ctx, "DELETE FROM embeddings WHERE document_id="+e.placeholder(1), id); err != nil {
+			return err
+		}
+		if _, err := e.db.ExecContext(ctx, "DELETE FROM documents WHERE id="+e.placeholder(1), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartCompaction runs Compact every COMPACT_INTERVAL_HOURS in the background on
+// the comma-separated COMPACT_NAMESPACES (default "default"), skipping runs that
+// find an ingest in progress. It does nothing when the interval or
+// COMPACT_MIN_CHARS is unset.
+func StartCompaction(eng Engine) {
+	hours := config.GetInt("COMPACT_INTERVAL_HOURS", 0)
+	if hours <= 0 || config.GetInt("COMPACT_MIN_CHARS", 0) <= 0 {
+		return
+	}
+	var namespaces []string
+	for _, ns := range strings.Split(config.Get("COMPACT_NAMESPACES", DefaultNamespace), ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(hours) * time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			for _, ns := range namespaces {
+				res, err := eng.Compact(context.Background(), ns)
+				switch {
+				case err != nil:
+					log.Printf("compaction of %s: %v", ns, err)
+				case res.MergedDocuments > 0:
+					log.Printf("compaction of %s: merged %d documents into %d", ns, res.MergedDocuments, res.CreatedDocuments)
+				}
+			}
+		}
+	}()
+}
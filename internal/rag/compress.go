@@ -0,0 +1,50 @@
+package rag
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"strings"
+)
+
+// compressedPrefix marks document content stored gzip-compressed and base64-encoded,
+// which keeps it valid in TEXT columns on both backends.
+const compressedPrefix = "gzip+base64:"
+
+func encodeContent(content string, compress bool) (string, error) {
+	if !compress {
+		return content, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(content)); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return compressedPrefix + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// decodeContent returns stored document content, decompressing it when needed.
+// Content written before compression was enabled is returned unchanged.
+func decodeContent(stored string) (string, error) {
+	if !strings.HasPrefix(stored, compressedPrefix) {
+		return stored, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, compressedPrefix))
+	if err != nil {
+		return "", err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,26 @@
+package rag
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStatsCountBytes(t *testing.T) {
+	e := NewMockEngine().(*engine)
+	ctx := context.Background()
+	const content = "Kiali übersetzt die Topologie des Mesh in einen Graphen."
+	if _, err := e.storeDocument(ctx, DefaultNamespace, "Graph", "https://kiali.io/docs/graph/", content); err != nil {
+		t.Fatal(err)
+	}
+	// Rows from before content_size existed are measured from the stored content.
+	if _, err := e.db.Exec("INSERT INTO documents(namespace, title, url, content) VALUES(?,?,?,?)", DefaultNamespace, "Old", "https://kiali.io/docs/old/", content); err != nil {
+		t.Fatal(err)
+	}
+	st, err := e.Stats(ctx, DefaultNamespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(2 * len(content)); st.ContentBytes != want || st.RawContentBytes != want {
+		t.Errorf("stats = %d stored, %d raw bytes, want %d", st.ContentBytes, st.RawContentBytes, want)
+	}
+}
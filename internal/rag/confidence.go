@@ -0,0 +1,37 @@
+package rag
+
+import "math"
+
+// Cosine similarities at or below confidenceFloor count as unrelated; at or above
+// confidenceCeiling as a strong match. Values in between scale linearly.
+const (
+	confidenceFloor   = 0.3
+	confidenceCeiling = 0.85
+	// supportMargin is how far below the best score a chunk may be and still
+	// count as corroborating it.
+	supportMargin = 0.1
+)
+
+// answerConfidence derives a score in [0,1] from the chunks given to the model.
+// The best similarity sets the base, scaled down when few other chunks come close
+// to it: one strong hit is less trustworthy than several agreeing ones. Without
+// any chunks the answer is ungrounded and the score is zero.
+func answerConfidence(docs []docChunk) float64 {
+	if len(docs) == 0 {
+		return 0
+	}
+	top := docs[0].Score
+	for _, d := range docs[1:] {
+		top = math.Max(top, d.Score)
+	}
+	support := 0
+	for _, d := range docs {
+		if d.Score >= top-supportMargin && d.Score > confidenceFloor {
+			support++
+		}
+	}
+	base := (top - confidenceFloor) / (confidenceCeiling - confidenceFloor)
+	base = math.Max(0, math.Min(1, base))
+	c := base * (0.7 + 0.1*float64(min(support, 3)))
+	return math.Round(c*100) / 100
+}
@@ -0,0 +1,52 @@
+package rag
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// loadContextTiers reads CONTEXT_ROUTING_MODELS, completion models of the primary
+// provider with larger context windows, smallest first.
+func loadContextTiers() []string {
+	var out []string
+	for _, m := range strings.Split(config.Get("CONTEXT_ROUTING_MODELS", ""), ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// promptTokens estimates the untrimmed prompt for query, context and chunks.
+func promptTokens(query string, kialiContext any, docs []docChunk) int {
+	var contextJSON []byte
+	if kialiContext != nil {
+		contextJSON, _ = json.Marshal(kialiContext)
+	}
+	return estimateTokens(buildPrompt(query, contextJSON, docs))
+}
+
+// routeForContext picks the first tier whose window fits a prompt of need tokens
+// plus overhead, or else the tier with the largest window if it beats budget, the
+// default model's limit. Tiers are sized by their context windows, not
+// MAX_PROMPT_TOKENS, which only caps the default model.
+func (e *engine) routeForContext(need, overhead, budget int) (model string, tierBudget int, ok bool) {
+	best, bestBudget := "", budget
+	for _, m := range e.contextTiers {
+		b := contextWindow(m) - completionReserveTokens - overhead
+		if b >= need {
+			return m, b, true
+		}
+		if b > bestBudget {
+			best, bestBudget = m, b
+		}
+	}
+	if best == "" {
+		return "", budget, false
+	}
+	log.Printf("prompt of ~%d tokens exceeds every CONTEXT_ROUTING_MODELS window; using the largest", need)
+	return best, bestBudget, true
+}
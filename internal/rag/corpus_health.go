@@ -0,0 +1,48 @@
+package rag
+
+import (
+	"context"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// CorpusHealth tells whether a namespace can support answers: Empty without
+// documents, Stale when the last successful ingest is older than
+// CORPUS_STALE_AFTER_HOURS (unset or 0 never flags staleness). LastIngestAt is
+// nil when no source has a successful last run on record.
+type CorpusHealth struct {
+	Namespace            string     `json:"namespace"`
+	Documents            int        `json:"documents"`
+	LastIngestAt         *time.Time `json:"last_ingest_at,omitempty"`
+	LastIngestAgeSeconds *int64     `json:"last_ingest_age_seconds,omitempty"`
+	Empty                bool       `json:"empty"`
+	Stale                bool       `json:"stale"`
+}
+
+// CorpusHealth reports the size and freshness of a namespace's corpus. Only a
+// source's latest run is recorded, so one whose last run failed does not count.
+func (e *engine) CorpusHealth(ctx context.Context, namespace string) (CorpusHealth, error) {
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return CorpusHealth{}, err
+	}
+	h := CorpusHealth{Namespace: ns}
+	if h.Documents, err = e.DocumentCount(ctx, ns); err != nil {
+		return h, err
+	}
+	h.Empty = h.Documents == 0
+	var last string
+	err = e.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(last_run_at), '') FROM sources WHERE namespace="+e.placeholder(1)+" AND last_status='ok'", ns).Scan(&last)
+	if err != nil {
+		return h, err
+	}
+	if t, err := time.Parse(time.RFC3339, last); err == nil {
+		age := int64(time.Since(t).Seconds())
+		h.LastIngestAt, h.LastIngestAgeSeconds = &t, &age
+	}
+	if hours := config.GetInt("CORPUS_STALE_AFTER_HOURS", 0); hours > 0 && h.LastIngestAgeSeconds != nil {
+		h.Stale = *h.LastIngestAgeSeconds > int64(hours)*3600
+	}
+	return h, nil
+}
@@ -0,0 +1,97 @@
+package rag
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// With CORPUS_OPS_EXCLUSIVE (default true) only one operation that changes a
+// namespace runs on it at a time: the ingests, clean, deduplicate, compact,
+// re-extract, re-embed and hash backfill. Operations on the whole store (vacuum,
+// orphan cleanup and a re-embed of every namespace) exclude all others. One
+// started while a conflicting one runs fails with an *OperationConflictError
+// naming the running operation, which the API answers with 409. This keeps ingest
+// counts consistent and spares SQLite the lock storms of concurrent writers; the
+// namespaces of different tenants still proceed side by side. With false, ingests
+// and the other operations may overlap as before and only vacuum and orphan
+// cleanup wait for the ingests to finish. Documents stored later by the embed
+// queue workers belong to the ingest that queued them and are not guarded.
+
+// CorpusOperation is a running corpus operation.
+type CorpusOperation struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// OperationConflictError is returned by a corpus operation refused because
+// another one is running.
+type OperationConflictError struct {
+	Running CorpusOperation
+}
+
+func (e *OperationConflictError) Error() string {
+	return fmt.Sprintf("%s %s already running since %s", e.Running.Kind, e.Running.ID, e.Running.StartedAt.Format(time.RFC3339))
+}
+
+// Is lets callers test for a conflict with errors.Is(err, ErrIngestInProgress).
+func (e *OperationConflictError) Is(target error) bool { return target == ErrIngestInProgress }
+
+// corpusOps admits one corpus operation per namespace, or one on the whole store,
+// at a time when exclusive is set.
+type corpusOps struct {
+	exclusive bool
+	mu        sync.Mutex
+	// running maps namespaces to their operation; "" is the whole store.
+	running map[string]*CorpusOperation
+}
+
+// begin registers an operation of kind on the normalized namespace, empty for
+// the whole store, and returns the function that ends it.
+func (g *corpusOps) begin(kind, namespace string) (func(), error) {
+	if !g.exclusive {
+		return func() {}, nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if op := g.conflict(namespace); op != nil {
+		return nil, &OperationConflictError{Running: *op}
+	}
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	op := &CorpusOperation{ID: hex.EncodeToString(buf), Kind: kind, Namespace: namespace, StartedAt: time.Now().UTC()}
+	if g.running == nil {
+		g.running = map[string]*CorpusOperation{}
+	}
+	g.running[namespace] = op
+	return func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.running[namespace] == op {
+			delete(g.running, namespace)
+		}
+	}, nil
+}
+
+// conflict returns the running operation that keeps one on namespace from
+// starting: a whole-store one or one on the same namespace, and for the whole
+// store the longest running of any.
+func (g *corpusOps) conflict(namespace string) *CorpusOperation {
+	if op := g.running[""]; op != nil {
+		return op
+	}
+	if namespace != "" {
+		return g.running[namespace]
+	}
+	var oldest *CorpusOperation
+	for _, op := range g.running {
+		if oldest == nil || op.StartedAt.Before(oldest.StartedAt) {
+			oldest = op
+		}
+	}
+	return oldest
+}
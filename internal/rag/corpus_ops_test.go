@@ -0,0 +1,41 @@
+package rag
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCorpusOpsScopes(t *testing.T) {
+	g := &corpusOps{exclusive: true}
+	doneA, err := g.begin("ingest-docs", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doneB, err := g.begin("clean", "b")
+	if err != nil {
+		t.Fatalf("namespace b blocked by a: %v", err)
+	}
+	var conflict *OperationConflictError
+	if _, err := g.begin("compact", "a"); !errors.As(err, &conflict) || conflict.Running.Kind != "ingest-docs" {
+		t.Errorf("second operation on a = %v, want conflict with ingest-docs", err)
+	}
+	if _, err := g.begin("vacuum", ""); !errors.Is(err, ErrIngestInProgress) {
+		t.Errorf("whole-store operation during namespace ones = %v, want conflict", err)
+	}
+	doneA()
+	doneB()
+
+	doneAll, err := g.begin("vacuum", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.begin("ingest-docs", "c"); !errors.As(err, &conflict) || conflict.Running.Kind != "vacuum" {
+		t.Errorf("namespace operation during vacuum = %v, want conflict with vacuum", err)
+	}
+	doneAll()
+	if done, err := g.begin("ingest-docs", "c"); err != nil {
+		t.Errorf("after vacuum: %v", err)
+	} else {
+		done()
+	}
+}
@@ -0,0 +1,161 @@
+package rag
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// crawlFilter holds the operator's CRAWL_INCLUDE and CRAWL_EXCLUDE patterns and
+// the INGEST_DENYLIST.
+type crawlFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	deny    denylist
+}
+
+// denylist holds the INGEST_DENYLIST entries by kind.
+type denylist struct {
+	urls     map[string]bool
+	prefixes []string
+	domains  []string
+	patterns []*regexp.Regexp
+}
+
+// loadCrawlFilter compiles CRAWL_INCLUDE and CRAWL_EXCLUDE, comma-separated regular
+// expressions matched against full URLs. An invalid pattern is an error so that
+// typos fail at startup instead of silently changing what is crawled.
+func loadCrawlFilter() (crawlFilter, error) {
+	var f crawlFilter
+	var err error
+	if f.include, err = compilePatterns("CRAWL_INCLUDE"); err != nil {
+		return f, err
+	}
+	if f.exclude, err = compilePatterns("CRAWL_EXCLUDE"); err != nil {
+		return f, err
+	}
+	f.deny, err = loadDenylist()
+	return f, err
+}
+
+// loadDenylist parses INGEST_DENYLIST, comma-separated entries of four kinds:
+// "re:<regexp>" matched against the URL, a prefix ending in "*", an exact URL
+// (containing "://"; fragment and trailing slash are ignored) or a domain, which
+// also covers its subdomains.
+func loadDenylist() (denylist, error) {
+	d := denylist{urls: map[string]bool{}}
+	for _, entry := range strings.Split(config.Get("INGEST_DENYLIST", ""), ",") {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+		case strings.HasPrefix(entry, "re:"):
+			re, err := regexp.Compile(strings.TrimPrefix(entry, "re:"))
+			if err != nil {
+				return d, fmt.Errorf("INGEST_DENYLIST: %w", err)
+			}
+			d.patterns = append(d.patterns, re)
+		case strings.HasSuffix(entry, "*"):
+			d.prefixes = append(d.prefixes, strings.TrimSuffix(entry, "*"))
+		case strings.Contains(entry, "://"):
+			d.urls[denyKey(entry)] = true
+		default:
+			d.domains = append(d.domains, strings.ToLower(strings.TrimPrefix(entry, ".")))
+		}
+	}
+	return d, nil
+}
+
+// denyKey normalizes a URL for exact denylist matches.
+func denyKey(u string) string {
+	u, _, _ = strings.Cut(u, "#")
+	return strings.TrimSuffix(u, "/")
+}
+
+// denied reports whether u must never be fetched or stored.
+func (f crawlFilter) denied(u string) bool {
+	d := f.deny
+	if d.urls[denyKey(u)] || matchesAny(d.patterns, u) {
+		return true
+	}
+	for _, p := range d.prefixes {
+		if strings.HasPrefix(u, p) {
+			return true
+		}
+	}
+	if len(d.domains) > 0 {
+		if parsed, err := url.Parse(u); err == nil {
+			host := strings.ToLower(parsed.Hostname())
+			for _, dom := range d.domains {
+				if host == dom || strings.HasSuffix(host, "."+dom) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func compilePatterns(key string) ([]*regexp.Regexp, error) {
+	var out []*regexp.Regexp
+	for _, p := range strings.Split(config.Get(key, ""), ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		out = append(out, re)
+	}
+	return out, nil
+}
+
+func matchesAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldCrawl decides whether a discovered link is followed, in this order:
+// links off kiali.io, assets and denylisted URLs are never crawled; a CRAWL_EXCLUDE match skips the
+// link; a CRAWL_INCLUDE match crawls it; otherwise the built-in rules apply
+// (the /docs/ subtree, without taxonomy pages).
+func (f crawlFilter) shouldCrawl(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	if parsed.Host == "" {
+		return false
+	}
+	if !strings.Contains(parsed.Host, "kiali.io") {
+		return false
+	}
+	// skip assets and binary files
+	lower := strings.ToLower(parsed.Path)
+	if strings.HasSuffix(lower, ".png") || strings.HasSuffix(lower, ".jpg") || strings.HasSuffix(lower, ".jpeg") || strings.HasSuffix(lower, ".gif") || strings.HasSuffix(lower, ".svg") || strings.HasSuffix(lower, ".ico") || strings.HasSuffix(lower, ".pdf") || strings.HasSuffix(lower, ".zip") {
+		return false
+	}
+	if f.denied(u) || matchesAny(f.exclude, u) {
+		return false
+	}
+	if matchesAny(f.include, u) {
+		return true
+	}
+	// focus on docs subtree
+	if !strings.Contains(parsed.Path, "/docs/") {
+		return false
+	}
+	// avoid taxonomy pages
+	if strings.Contains(lower, "/tag/") || strings.Contains(lower, "/category/") {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package rag
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// CRAWL_MAX_QUEUE caps the links waiting in a docs crawl frontier and
+// CRAWL_MAX_VISITED the URLs it remembers as seen (both default 0: no cap), so a
+// site with many or cyclic links cannot grow the crawl without bound regardless
+// of CRAWL_MAX_PAGES. When a cap is reached, CRAWL_CAP_POLICY decides what
+// happens to newly discovered links: drop (default) discards those that do not
+// fit and enqueues again once the frontier drains, stop enqueues nothing more for
+// the rest of the run and only crawls what is already queued. Either way the
+// crawl logs the first hit and reports truncated with the links it left out.
+
+// Policies selectable with CRAWL_CAP_POLICY.
+const (
+	crawlCapDrop = "drop"
+	crawlCapStop = "stop"
+)
+
+// crawlLimits bounds the memory of one docs crawl.
+type crawlLimits struct {
+	maxQueue   int
+	maxVisited int
+	policy     string
+}
+
+// loadCrawlLimits reads the caps and CRAWL_CAP_POLICY; like CRAWL_STRATEGY, an
+// unknown policy is an error.
+func loadCrawlLimits() (crawlLimits, error) {
+	l := crawlLimits{
+		maxQueue:   config.GetInt("CRAWL_MAX_QUEUE", 0),
+		maxVisited: config.GetInt("CRAWL_MAX_VISITED", 0),
+		policy:     strings.ToLower(strings.TrimSpace(config.Get("CRAWL_CAP_POLICY", crawlCapDrop))),
+	}
+	switch l.policy {
+	case crawlCapDrop, crawlCapStop:
+		return l, nil
+	}
+	return l, fmt.Errorf("CRAWL_CAP_POLICY: unknown policy %q, use drop or stop", l.policy)
+}
+
+// crawlCap applies crawlLimits to one run.
+type crawlCap struct {
+	crawlLimits
+	// hit is set once a cap was reached; with the stop policy nothing is
+	// enqueued after that.
+	hit     bool
+	dropped int
+}
+
+// admit returns the prefix of links that fits under the caps, given the current
+// frontier and visited sizes, and counts the rest as dropped.
+func (c *crawlCap) admit(links []string, queued, visited int) []string {
+	if c.hit && c.policy == crawlCapStop {
+		c.dropped += len(links)
+		return nil
+	}
+	room := len(links)
+	if c.maxQueue > 0 {
+		room = min(room, c.maxQueue-queued)
+	}
+	if c.maxVisited > 0 {
+		room = min(room, c.maxVisited-visited)
+	}
+	room = max(room, 0)
+	if room == len(links) {
+		return links
+	}
+	if !c.hit {
+		log.Printf("crawl frontier capped (CRAWL_MAX_QUEUE=%d, CRAWL_MAX_VISITED=%d, policy %s): %d links queued, %d visited",
+			c.maxQueue, c.maxVisited, c.policy, queued, visited)
+		c.hit = true
+	}
+	c.dropped += len(links) - room
+	return links[:room]
+}
+
+// report records in r whether the caps truncated the crawl.
+func (c *crawlCap) report(r *IngestResult) {
+	r.Truncated = c.dropped > 0
+	r.DroppedLinks = c.dropped
+}
@@ -0,0 +1,130 @@
+package rag
+
+import (
+	"container/heap"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// Crawl strategies selectable with CRAWL_STRATEGY.
+const (
+	crawlBFS      = "bfs"
+	crawlDFS      = "dfs"
+	crawlPriority = "priority"
+)
+
+// loadCrawlStrategy reads CRAWL_STRATEGY (default bfs). Like the crawl filters, an
+// unknown value is an error so that a typo does not silently change crawl order.
+func loadCrawlStrategy() (string, error) {
+	s := strings.ToLower(strings.TrimSpace(config.Get("CRAWL_STRATEGY", crawlBFS)))
+	switch s {
+	case crawlBFS, crawlDFS, crawlPriority:
+		return s, nil
+	}
+	return "", fmt.Errorf("CRAWL_STRATEGY: unknown strategy %q, use bfs, dfs or priority", s)
+}
+
+// crawlQueue is the docs crawl frontier. bfs visits pages in discovery order, dfs
+// follows the first link of each page before its siblings, and priority visits
+// shallow URLs (fewest path segments) first, in discovery order among equals, so
+// a CRAWL_MAX_PAGES budget is spent on top-level docs before deep subpages.
+type crawlQueue struct {
+	strategy string
+	items    crawlItems
+	seq      int
+}
+
+type crawlItem struct {
+	url   string
+	depth int
+	seq   int
+}
+
+// push adds the links of one page, or the seeds, in document order.
+func (q *crawlQueue) push(urls ...string) {
+	if q.strategy == crawlDFS {
+		// Reversed so the first link is popped first.
+		for i := len(urls) - 1; i >= 0; i-- {
+			q.items = append(q.items, crawlItem{url: urls[i]})
+		}
+		return
+	}
+	for _, u := range urls {
+		q.seq++
+		it := crawlItem{url: u, seq: q.seq}
+		if q.strategy == crawlPriority {
+			it.depth = urlDepth(u)
+			heap.Push(&q.items, it)
+			continue
+		}
+		q.items = append(q.items, it)
+	}
+}
+
+func (q *crawlQueue) pop() crawlItem {
+	var it crawlItem
+	switch q.strategy {
+	case crawlDFS:
+		it = q.items[len(q.items)-1]
+		q.items = q.items[:len(q.items)-1]
+	case crawlPriority:
+		it = heap.Pop(&q.items).(crawlItem)
+	default:
+		it = q.items[0]
+		q.items = q.items[1:]
+	}
+	return it
+}
+
+// unpop puts back popped items where they were, so they are popped next in the
+// order given.
+func (q *crawlQueue) unpop(items ...crawlItem) {
+	for i := len(items) - 1; i >= 0; i-- {
+		switch q.strategy {
+		case crawlDFS:
+			q.items = append(q.items, items[i])
+		case crawlPriority:
+			heap.Push(&q.items, items[i])
+		default:
+			q.items = append(crawlItems{items[i]}, q.items...)
+		}
+	}
+}
+
+func (q *crawlQueue) len() int { return len(q.items) }
+
+func urlDepth(u string) int {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return 0
+	}
+	depth := 0
+	for _, seg := range strings.Split(parsed.Path, "/") {
+		if seg != "" {
+			depth++
+		}
+	}
+	return depth
+}
+
+// crawlItems is a min-heap by depth, then discovery order.
+type crawlItems []crawlItem
+
+func (h crawlItems) Len() int { return len(h) }
+func (h crawlItems) Less(i, j int) bool {
+	if h[i].depth != h[j].depth {
+		return h[i].depth < h[j].depth
+	}
+	return h[i].seq < h[j].seq
+}
+func (h crawlItems) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *crawlItems) Push(x any)   { *h = append(*h, x.(crawlItem)) }
+func (h *crawlItems) Pop() any {
+	old := *h
+	it := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return it
+}
@@ -0,0 +1,25 @@
+package rag
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCrawlQueueUnpop(t *testing.T) {
+	for _, strategy := range []string{crawlBFS, crawlDFS, crawlPriority} {
+		t.Run(strategy, func(t *testing.T) {
+			q := crawlQueue{strategy: strategy}
+			q.push("https://kiali.io/docs/a/", "https://kiali.io/docs/b/", "https://kiali.io/docs/c/")
+			first, second := q.pop(), q.pop()
+			q.unpop(first, second)
+			var got []string
+			for q.len() > 0 {
+				got = append(got, q.pop().url)
+			}
+			want := []string{"https://kiali.io/docs/a/", "https://kiali.io/docs/b/", "https://kiali.io/docs/c/"}
+			if !slices.Equal(got, want) {
+				t.Errorf("order after unpop = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package rag
+
+import (
+	"container/heap"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// A docs crawl saves its frontier (the queued links, visited URLs and processed
+// pages) to the crawl_state table under a crawl id every CRAWL_CHECKPOINT_PAGES
+// fetched pages (default 25, 0 disables) and when it is interrupted. An
+// interrupted run reports the id as crawl_id; an ingest passing it back continues
+// from the saved frontier instead of the seeds, so processed pages are not fetched
+// again. A run killed outright loses at most the pages since the last save, whose
+// sections are then skipped as already stored. The state is deleted once the crawl
+// completes.
+
+// ErrCrawlNotFound is returned when resuming a crawl id without saved state.
+var ErrCrawlNotFound = errors.New("crawl not found")
+
+func initCrawlState(db *sql.DB) error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS crawl_state (
+	crawl_id TEXT PRIMARY KEY,
+	namespace TEXT NOT NULL,
+	seeds TEXT NOT NULL,
+	frontier TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+`)
+	return err
+}
+
+// crawlFrontier is the saved state of a docs crawl.
+type crawlFrontier struct {
+	Seeds    []string            `json:"-"`
+	Strategy string              `json:"strategy"`
+	Seq      int                 `json:"seq"`
+	Queue    []crawlFrontierItem `json:"queue"`
+	Visited  []string            `json:"visited"`
+	Pages    []string            `json:"pages"`
+	Fetched  int                 `json:"fetched"`
+}
+
+type crawlFrontierItem struct {
+	URL   string `json:"url"`
+	Depth int    `json:"depth,omitempty"`
+	Seq   int    `json:"seq,omitempty"`
+}
+
+// loadCrawl returns the saved frontier of crawl id in namespace.
+func (e *engine) loadCrawl(ctx context.Context, namespace, id string) (crawlFrontier, error) {
+	var f crawlFrontier
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return f, err
+	}
+	var seeds, frontier string
+	err = e.db.QueryRowContext(ctx, "SELECT seeds, frontier FROM crawl_state WHERE crawl_id="+e.placeholder(1)+" AND namespace="+e.placeholder(2), id, ns).
+		Scan(&seeds, &frontier)
+	if errors.Is(err, sql.ErrNoRows) {
+		return f, fmt.Errorf("%w: %q in namespace %s", ErrCrawlNotFound, id, ns)
+	}
+	if err != nil {
+		return f, err
+	}
+	if err := json.Unmarshal([]byte(frontier), &f); err != nil {
+		return f, fmt.Errorf("crawl %s: %w", id, err)
+	}
+	if err := json.Unmarshal([]byte(seeds), &f.Seeds); err != nil {
+		return f, fmt.Errorf("crawl %s: %w", id, err)
+	}
+	return f, nil
+}
+
+// restore rebuilds the crawl state of f. The queue keeps the strategy it was
+// saved with, so its order stays valid across a CRAWL_STRATEGY change.
+func (f crawlFrontier) restore() (queue crawlQueue, visited, pages map[string]bool, fetched int) {
+	queue = crawlQueue{strategy: f.Strategy, seq: f.Seq}
+	for _, it := range f.Queue {
+		queue.items = append(queue.items, crawlItem{url: it.URL, depth: it.Depth, seq: it.Seq})
+	}
+	if queue.strategy == crawlPriority {
+		heap.Init(&queue.items)
+	}
+	visited, pages = map[string]bool{}, map[string]bool{}
+	for _, u := range f.Visited {
+		visited[u] = true
+	}
+	for _, u := range f.Pages {
+		pages[u] = true
+	}
+	return queue, visited, pages, f.Fetched
+}
+
+// crawlCheckpoint saves the frontier of one docs crawl run.
+type crawlCheckpoint struct {
+	e     *engine
+	id    string
+	ns    string
+	seeds []string
+	every int
+	// saved is the fetched count at the last save.
+	saved int
+}
+
+// newCrawlCheckpoint starts the checkpoints of a run that has fetched pages so
+// far; id is empty for a new crawl, which gets one at its first save.
+func (e *engine) newCrawlCheckpoint(ns string, seeds []string, id string, fetched int) *crawlCheckpoint {
+	return &crawlCheckpoint{e: e, id: id, ns: ns, seeds: seeds, every: max(0, config.GetInt("CRAWL_CHECKPOINT_PAGES", 25)), saved: fetched}
+}
+
+// due reports whether enough pages were fetched since the last save.
+func (c *crawlCheckpoint) due(fetched int) bool {
+	return c.every > 0 && fetched-c.saved >= c.every
+}
+
+// save stores the frontier and returns the crawl id, empty when checkpoints are
+// off or the save failed. It runs when the crawl context may have ended already.
+func (c *crawlCheckpoint) save(q *crawlQueue, visited, pages map[string]bool, fetched int) string {
+	if c.every <= 0 {
+		return ""
+	}
+	c.saved = fetched
+	if c.id == "" {
+		buf := make([]byte, 8)
+		if _, err := rand.Read(buf); err != nil {
+			log.Printf("crawl checkpoint: %v", err)
+			return ""
+		}
+		c.id = hex.EncodeToString(buf)
+	}
+	f := crawlFrontier{Strategy: q.strategy, Seq: q.seq, Queue: []crawlFrontierItem{}, Visited: []string{}, Pages: []string{}, Fetched: fetched}
+	for _, it := range q.items {
+		f.Queue = append(f.Queue, crawlFrontierItem{URL: it.url, Depth: it.depth, Seq: it.seq})
+	}
+	for u := range visited {
+		f.Visited = append(f.Visited, u)
+	}
+	for u := range pages {
+		f.Pages = append(f.Pages, u)
+	}
+	frontier, err := json.Marshal(f)
+	if err != nil {
+		log.Printf("crawl checkpoint %s: %v", c.id, err)
+		return ""
+	}
+	seeds, _ := json.Marshal(c.seeds)
+	stmt := `INSERT INTO crawl_state(crawl_id, namespace, seeds, frontier, updated_at) VALUES(` + c.e.placeholders(5) + `)
+ON CONFLICT(crawl_id) DO UPDATE SET frontier=excluded.frontier, updated_at=excluded.updated_at`
+	unlock := c.e.lockWrites()
+	defer unlock()
+	ctx := context.Background()
+	_, err = withBusyRetries(ctx, "crawl checkpoint", func() (sql.Result, error) {
+		return c.e.db.ExecContext(ctx, stmt, c.id, c.ns, string(seeds), string(frontier), time.Now().UTC().Format(time.RFC3339))
+	})
+	if err != nil {
+		log.Printf("crawl checkpoint %s: %v", c.id, err)
+		return ""
+	}
+	return c.id
+}
+
+// finish deletes the saved state of a completed crawl.
+func (c *crawlCheckpoint) finish() {
+	if c.id == "" {
+		return
+	}
+	unlock := c.e.lockWrites()
+	defer unlock()
+	ctx := context.Background()
+	_, err := withBusyRetries(ctx, "delete crawl checkpoint", func() (sql.Result, error) {
+		return c.e.db.ExecContext(ctx, "DELETE FROM crawl_state WHERE crawl_id="+c.e.placeholder(1), c.id)
+	})
+	if err != nil {
+		log.Printf("delete crawl checkpoint %s: %v", c.id, err)
+	}
+}
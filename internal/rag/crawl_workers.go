@@ -0,0 +1,54 @@
+package rag
+
+import (
+	"context"
+	"sync"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// A docs crawl fetches and parses up to CRAWL_CONCURRENCY pages at a time
+// (default 4, 1 for one page after the other). The pages of a batch are then
+// stored and their links queued one by one in frontier order, so the crawl
+// order, the caps and resume behave as with a single worker.
+
+func loadCrawlWorkers() int {
+	return max(1, config.GetInt("CRAWL_CONCURRENCY", 4))
+}
+
+// crawledPage is a fetched docs page with the parts a crawl stores and follows.
+type crawledPage struct {
+	fetchedPage
+	err      error
+	title    string
+	sections []extractedSection
+	merged   int
+	links    []string
+}
+
+// crawlBatch fetches and parses the pages of batch in parallel, returning them
+// in batch order.
+func (e *engine) crawlBatch(ctx context.Context, batch []crawlItem, headers map[string]string) []crawledPage {
+	out := make([]crawledPage, len(batch))
+	var wg sync.WaitGroup
+	for i, it := range batch {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out[i] = e.crawlPage(ctx, it.url, headers)
+		}()
+	}
+	wg.Wait()
+	return out
+}
+
+func (e *engine) crawlPage(ctx context.Context, u string, headers map[string]string) crawledPage {
+	page, err := e.fetchPage(ctx, u, headers)
+	if err != nil {
+		return crawledPage{err: err}
+	}
+	p := crawledPage{fetchedPage: page, title: kialiPageTitle(page.Doc)}
+	p.sections, p.merged = mergeSmallSections(extractKialiSections(page.Doc, page.CanonicalURL), e.compactMinChars)
+	p.links = collectKialiLinks(page.Doc, page.FinalURL)
+	return p
+}
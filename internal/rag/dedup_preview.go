@@ -0,0 +1,64 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+)
+
+// DuplicateDocument is a document Deduplicate would remove, with the id of the
+// copy of the same URL that it keeps.
+type DuplicateDocument struct {
+	ID     int64  `json:"id"`
+	URL    string `json:"url"`
+	Title  string `json:"title"`
+	KeptID int64  `json:"kept_id"`
+}
+
+// DuplicatePreview is one page of the documents Deduplicate would remove.
+// Total counts all of them, regardless of Limit and Offset.
+type DuplicatePreview struct {
+	Total      int                 `json:"total"`
+	URLs       int                 `json:"urls"`
+	Limit      int                 `json:"limit"`
+	Offset     int                 `json:"offset"`
+	Duplicates []DuplicateDocument `json:"duplicates"`
+}
+
+// PreviewDuplicates lists what Deduplicate would remove without deleting anything,
+// ordered by URL and id.
+func (e *engine) PreviewDuplicates(ctx context.Context, namespace string, limit, offset int) (DuplicatePreview, error) {
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return DuplicatePreview{}, err
+	}
+	if limit < 0 || offset < 0 {
+		return DuplicatePreview{}, fmt.Errorf("limit and offset must not be negative")
+	}
+	out := DuplicatePreview{Limit: limit, Offset: offset, Duplicates: []DuplicateDocument{}}
+	dup := fmt.Sprintf(`FROM documents d
+		WHERE d.namespace = %s AND EXISTS (
+		  SELECT 1 FROM documents d2
+		  WHERE d2.namespace = d.namespace AND d2.url = d.url AND d2.id < d.id
+		)`, e.placeholder(1))
+	if err := e.db.QueryRowContext(ctx, "SELECT COUNT(1), COUNT(DISTINCT d.url) "+dup, ns).Scan(&out.Total, &out.URLs); err != nil {
+		return out, err
+	}
+	rows, err := e.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT d.id, d.url, COALESCE(d.title, ''),
+		  (SELECT MIN(d3.id) FROM documents d3 WHERE d3.namespace = d.namespace AND d3.url = d.url)
+		%s
+		ORDER BY d.url, d.id
+		LIMIT %s OFFSET %s`, dup, e.placeholder(2), e.placeholder(3)), ns, limit, offset)
+	if err != nil {
+		return out, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d DuplicateDocument
+		if err := rows.Scan(&d.ID, &d.URL, &d.Title, &d.KeptID); err != nil {
+			return out, err
+		}
+		out.Duplicates = append(out.Duplicates, d)
+	}
+	return out, rows.Err()
+}
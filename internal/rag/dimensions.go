@@ -0,0 +1,48 @@
+package rag
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// supportsDimensions reports whether an OpenAI embedding model accepts the
+// dimensions parameter (Matryoshka embeddings); older models reject it.
+func supportsDimensions(model string) bool {
+	return strings.HasPrefix(model, "text-embedding-3")
+}
+
+// postgresVectorDim returns the declared width of an existing embeddings.vector
+// column, or 0 when the table does not exist yet or the column has no width.
+func postgresVectorDim(db *sql.DB) (int, error) {
+	var typmod sql.NullInt64
+	err := db.QueryRow(`SELECT a.atttypmod FROM pg_attribute a WHERE a.attrelid = to_regclass('embeddings') AND a.attname = 'vector' AND NOT a.attisdropped`).Scan(&typmod)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int(max(typmod.Int64, 0)), nil
+}
+
+// resolvePostgresDim makes an existing embeddings.vector column authoritative over
+// the configured dimension, which otherwise would only fail on the first insert.
+// A disagreement is logged; with EMBEDDING_DIMENSIONS it is an error, since the
+// provider is asked for vectors of exactly that width.
+func resolvePostgresDim(db *sql.DB, configured, requested int) (int, error) {
+	stored, err := postgresVectorDim(db)
+	if err != nil {
+		return 0, fmt.Errorf("read embeddings.vector dimension: %w", err)
+	}
+	if stored == 0 || stored == configured {
+		return configured, nil
+	}
+	if requested > 0 {
+		return 0, fmt.Errorf("embeddings.vector is VECTOR(%d) but EMBEDDING_DIMENSIONS is %d; re-create the table or change EMBEDDING_DIMENSIONS", stored, requested)
+	}
+	log.Printf("embeddings.vector is VECTOR(%d) but the configured dimension is %d; using %d. Set EMBEDDING_DIM=%d and an embedding model of that width to silence this", stored, configured, stored, stored)
+	return stored, nil
+}
@@ -0,0 +1,209 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// ErrDirectoryNotAllowed is returned by IngestDirectory for paths outside
+// INGEST_DIR_ROOTS, including every path when it is unset.
+var ErrDirectoryNotAllowed = errors.New("directory not allowed: must be under INGEST_DIR_ROOTS")
+
+var directoryExtensions = map[string]bool{".md": true, ".markdown": true, ".txt": true}
+
+// IngestDirectory ingests the files under dir matching glob and records the run
+// in the sources table.
+func (e *engine) IngestDirectory(ctx context.Context, dir, glob string, opts IngestOptions) (IngestResult, error) {
+	res, err := e.ingestDirectory(ctx, dir, glob, opts)
+	res.Cancelled = err != nil && ctx.Err() != nil
+	key := filepath.Clean(dir)
+	if glob != "" {
+		key += "#" + glob
+	}
+	e.recordSource(opts.Namespace, SourceDirectory, key, res, err)
+	return res, err
+}
+
+// ingestDirectory ingests the markdown and text files under dir whose path relative
+// to dir matches glob (a pattern without '/' matches the file name; empty matches
+// all). Files over INGEST_DIR_MAX_FILE_BYTES and binary files are skipped.
+func (e *engine) ingestDirectory(ctx context.Context, dir, glob string, opts IngestOptions) (IngestResult, error) {
+	var result IngestResult
+	ns, err := NormalizeNamespace(opts.Namespace)
+	if err != nil {
+		return result, err
+	}
+	root, err := allowedDirectory(dir)
+	if err != nil {
+		return result, err
+	}
+	if glob != "" {
+		if _, err := path.Match(glob, ""); err != nil {
+			return result, fmt.Errorf("glob %q: %w", glob, err)
+		}
+	}
+	done, err := e.ops.begin("ingest-directory", ns)
+	if err != nil {
+		return result, err
+	}
+	defer done()
+	e.corpusMu.RLock()
+	defer e.corpusMu.RUnlock()
+	maxBytes := int64(config.GetInt("INGEST_DIR_MAX_FILE_BYTES", 1<<20))
+	urlBase := strings.TrimRight(config.Get("INGEST_DIR_URL_BASE", ""), "/")
+
+	visited := 0
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("ingest directory: %v", err)
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || !directoryExtensions[strings.ToLower(filepath.Ext(p))] {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		if !matchGlob(glob, rel) {
+			return nil
+		}
+		docURL := fileCitationURL(urlBase, root, rel)
+		visited++
+		opts.report(visited, docURL, result)
+		if exists, _ := e.documentExists(ctx, ns, docURL); exists {
+			result.Skipped++
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Size() > maxBytes {
+			log.Printf("ingest directory: skipping %s (not a regular file or over %d bytes)", rel, maxBytes)
+			return nil
+		}
+		raw, err := os.ReadFile(p)
+		if err != nil {
+			log.Printf("ingest directory: %v", err)
+			return nil
+		}
+		if isBinary(raw) {
+			log.Printf("ingest directory: skipping binary file %s", rel)
+			return nil
+		}
+		title, content := fileText(rel, string(raw), e.chunkSplitter == splitterAuto)
+		if !e.longEnough(SourceDirectory, content) {
+			return nil
+		}
+		out, err := e.upsertDocument(ctx, ns, title, docURL, content)
+		if err != nil {
+			log.Printf("upsert error: %v", err)
+			return nil
+		}
+		result.add(out)
+		return nil
+	})
+	return result, err
+}
+
+// allowedDirectory resolves dir and checks it lies under one of INGEST_DIR_ROOTS.
+// Symlinks are resolved first so they cannot lead outside a root.
+func allowedDirectory(dir string) (string, error) {
+	if strings.TrimSpace(dir) == "" {
+		return "", errors.New("path required")
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", err
+	}
+	for _, r := range strings.Split(config.Get("INGEST_DIR_ROOTS", ""), ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		root, err := filepath.EvalSymlinks(r)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(root, resolved); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return resolved, nil
+		}
+	}
+	return "", ErrDirectoryNotAllowed
+}
+
+func matchGlob(glob, rel string) bool {
+	if glob == "" {
+		return true
+	}
+	name := rel
+	if !strings.Contains(glob, "/") {
+		name = path.Base(rel)
+	}
+	ok, _ := path.Match(glob, name)
+	return ok
+}
+
+// fileCitationURL cites rel under INGEST_DIR_URL_BASE when set, e.g. a docs
+// repository's web view, and as a file:// URL otherwise.
+func fileCitationURL(base, root, rel string) string {
+	if base != "" {
+		return base + "/" + rel
+	}
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(root, rel))}
+	return u.String()
+}
+
+// isBinary treats content with NUL bytes or invalid UTF-8 as binary.
+func isBinary(b []byte) bool {
+	return bytes.IndexByte(b, 0) >= 0 || !utf8.Valid(b)
+}
+
+// fileText returns a title and text for a file. Markdown files are titled by their
+// first heading and lose their front matter, and their markup too unless
+// keepMarkdown is set for splitMarkdown; other files are titled by name.
+func fileText(rel, raw string, keepMarkdown bool) (string, string) {
+	title := strings.TrimSuffix(path.Base(rel), path.Ext(rel))
+	ext := strings.ToLower(path.Ext(rel))
+	if ext != ".md" && ext != ".markdown" {
+		return title, raw
+	}
+	raw = stripFrontMatter(raw)
+	for _, line := range strings.Split(raw, "\n") {
+		if h, ok := strings.CutPrefix(strings.TrimSpace(line), "# "); ok {
+			title = stripMarkdownMarkers(strings.TrimSpace(h))
+			break
+		}
+	}
+	if keepMarkdown {
+		return title, raw
+	}
+	return title, stripMarkdownMarkers(raw)
+}
+
+// stripFrontMatter drops a leading YAML front matter block delimited by "---" lines.
+func stripFrontMatter(s string) string {
+	rest, ok := strings.CutPrefix(s, "---\n")
+	if !ok {
+		return s
+	}
+	if i := strings.Index(rest, "\n---\n"); i >= 0 {
+		return rest[i+len("\n---\n"):]
+	}
+	return s
+}
@@ -0,0 +1,210 @@
+package rag
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// Documents record a hash of their content (documents.content_hash) and their
+// normalized URL (documents.url_norm) when stored, for content-based
+// deduplication, change detection and lookups that do not trip over trivial URL
+// differences. BackfillHashes computes both for documents stored before the
+// columns existed, in batches of HASH_BACKFILL_BATCH (default 500), so a corpus
+// adopts them without being re-ingested. Chunk hashes of the embedding cache are
+// not backfilled: the exact text each vector was computed from is not stored.
+
+func initDocumentHashes(db *sql.DB, backend string) error {
+	if err := ensureColumn(db, backend, "documents", "content_hash", "TEXT"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, backend, "documents", "url_norm", "TEXT"); err != nil {
+		return err
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_documents_ns_hash ON documents(namespace, content_hash)"); err != nil {
+		return err
+	}
+	_, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_documents_ns_url_norm ON documents(namespace, url_norm)")
+	return err
+}
+
+// documentHash hashes document content with runs of whitespace collapsed, so
+// re-extracting the same text with different line breaks keeps its hash.
+func documentHash(content string) string {
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(content), " ")))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeDocumentURL lowercases the scheme and host, drops default ports, a
+// trailing slash of the path and an empty query or fragment, and turns YouTube
+// embed links into watch links. Section anchors are kept: they name different
+// documents.
+func normalizeDocumentURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(normalizeYouTubeWatchURL(raw)))
+	if err != nil || !u.IsAbs() {
+		return strings.TrimSpace(raw)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		u.Host = u.Hostname()
+	}
+	if len(u.Path) > 1 {
+		u.Path = strings.TrimRight(u.Path, "/")
+		u.RawPath = ""
+	}
+	u.ForceQuery = false
+	return u.String()
+}
+
+// HashBackfillOptions tunes BackfillHashes. Recompute also rewrites documents that
+// already have hashes; Progress, when set, is called after every batch.
+type HashBackfillOptions struct {
+	Recompute bool
+	Progress  func(HashBackfillProgress)
+}
+
+// HashBackfillProgress reports the documents processed so far out of Total.
+type HashBackfillProgress struct {
+	Namespace string `json:"namespace"`
+	Total     int    `json:"total"`
+	Processed int    `json:"processed"`
+	Updated   int    `json:"updated"`
+	Failed    int    `json:"failed"`
+	Batches   int    `json:"batches"`
+}
+
+// HashBackfillResult reports a BackfillHashes run. Updated counts documents whose
+// hash or normalized URL changed, Failed those whose content could not be read.
+type HashBackfillResult struct {
+	HashBackfillProgress
+	Cancelled bool `json:"cancelled,omitempty"`
+}
+
+type hashRow struct {
+	id                   int64
+	contentHash, urlNorm string
+}
+
+// BackfillHashes computes the content hash and normalized URL of the documents of
+// namespace that lack them, or of all of them with Recompute.
+func (e *engine) BackfillHashes(ctx context.Context, namespace string, opts HashBackfillOptions) (HashBackfillResult, error) {
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return HashBackfillResult{}, err
+	}
+	res := HashBackfillResult{HashBackfillProgress: HashBackfillProgress{Namespace: ns}}
+	done, err := e.ops.begin("hash-backfill", ns)
+	if err != nil {
+		return res, err
+	}
+	defer done()
+	e.corpusMu.RLock()
+	defer e.corpusMu.RUnlock()
+
+	where := "namespace=" + e.placeholder(1)
+	if !opts.Recompute {
+		where += " AND (content_hash IS NULL OR url_norm IS NULL)"
+	}
+	if err := e.db.QueryRowContext(ctx, "SELECT COUNT(1) FROM documents WHERE "+where, ns).Scan(&res.Total); err != nil {
+		return res, err
+	}
+	batch := max(1, config.GetInt("HASH_BACKFILL_BATCH", 500))
+	var after int64
+	for res.Processed < res.Total {
+		if err := ctx.Err(); err != nil {
+			res.Cancelled = true
+			return res, err
+		}
+		updates, last, read, err := e.hashBatch(ctx, where, ns, after, batch, &res)
+		if err != nil {
+			if ctx.Err() != nil {
+				res.Cancelled = true
+			}
+			return res, err
+		}
+		if read == 0 {
+			// Documents deleted since the count.
+			break
+		}
+		// Committed batches stay; the update itself is not cancelled halfway.
+		if err := e.writeHashes(context.WithoutCancel(ctx), updates); err != nil {
+			return res, err
+		}
+		after = last
+		res.Processed += read
+		res.Updated += len(updates)
+		res.Batches++
+		if opts.Progress != nil {
+			opts.Progress(res.HashBackfillProgress)
+		}
+	}
+	log.Printf("hash backfill of %s: %d documents, %d updated, %d failed", ns, res.Processed, res.Updated, res.Failed)
+	return res, nil
+}
+
+// hashBatch reads the next batch of documents after id after and returns the
+// updates it needs, the last id read and the number of rows read.
+func (e *engine) hashBatch(ctx context.Context, where, ns string, after int64, limit int, res *HashBackfillResult) ([]hashRow, int64, int, error) {
+	q := "SELECT id, url, content, content_hash, url_norm FROM documents WHERE " + where +
+		" AND id > " + e.placeholder(2) + " ORDER BY id LIMIT " + e.placeholder(3)
+	rows, err := e.db.QueryContext(ctx, q, ns, after, limit)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer rows.Close()
+	var updates []hashRow
+	var last int64
+	read := 0
+	for rows.Next() {
+		var id int64
+		var docURL, stored string
+		var oldHash, oldURL sql.NullString
+		if err := rows.Scan(&id, &docURL, &stored, &oldHash, &oldURL); err != nil {
+			return nil, 0, 0, err
+		}
+		last = id
+		read++
+		content, err := decodeContent(stored)
+		if err != nil {
+			log.Printf("hash backfill: document %d: %v", id, err)
+			res.Failed++
+			continue
+		}
+		h, u := documentHash(content), normalizeDocumentURL(docURL)
+		if oldHash.String != h || oldURL.String != u {
+			updates = append(updates, hashRow{id: id, contentHash: h, urlNorm: u})
+		}
+	}
+	return updates, last, read, rows.Err()
+}
+
+// writeHashes stores the hashes of one batch in a single transaction.
+func (e *engine) writeHashes(ctx context.Context, updates []hashRow) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	stmt := "UPDATE documents SET content_hash=" + e.placeholder(1) + ", url_norm=" + e.placeholder(2) + " WHERE id=" + e.placeholder(3)
+	unlock := e.lockWrites()
+	defer unlock()
+	_, err := withBusyRetries(ctx, "hash backfill", func() (struct{}, error) {
+		tx, err := e.db.BeginTx(ctx, nil)
+		if err != nil {
+			return struct{}{}, err
+		}
+		defer tx.Rollback()
+		for _, u := range updates {
+			if _, err := tx.ExecContext(ctx, stmt, u.contentHash, u.urlNorm, u.id); err != nil {
+				return struct{}{}, err
+			}
+		}
+		return struct{}{}, tx.Commit()
+	})
+	return err
+}
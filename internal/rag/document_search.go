@@ -0,0 +1,130 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// documentSnippetRadius is how much text DocumentSearch shows on each side of the
+// first match.
+const documentSnippetRadius = 80
+
+// DocumentQuery selects stored documents by exact text rather than by embedding.
+// Term matches title or content case-insensitively; URLPrefix matches the start of
+// the URL. Empty fields match everything.
+type DocumentQuery struct {
+	Term      string
+	URLPrefix string
+	Limit     int
+	Offset    int
+}
+
+// DocumentMatch is a stored document found by DocumentSearch. Snippet surrounds the
+// first occurrence of the term, or starts the content when no term was given.
+type DocumentMatch struct {
+	ID      int64  `json:"id"`
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Matches int    `json:"matches"`
+	Snippet string `json:"snippet"`
+}
+
+// DocumentSearchResult is one page of matches; Total counts all of them.
+type DocumentSearchResult struct {
+	Total     int             `json:"total"`
+	Limit     int             `json:"limit"`
+	Offset    int             `json:"offset"`
+	Documents []DocumentMatch `json:"documents"`
+}
+
+// DocumentSearch looks documents up by substring for auditing the corpus, ordered
+// by id. Compressed content cannot be matched in SQL, so those rows are fetched
+// whenever a term is given and checked after decoding.
+func (e *engine) DocumentSearch(ctx context.Context, namespace string, q DocumentQuery) (DocumentSearchResult, error) {
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return DocumentSearchResult{}, err
+	}
+	if q.Limit < 0 || q.Offset < 0 {
+		return DocumentSearchResult{}, fmt.Errorf("limit and offset must not be negative")
+	}
+	out := DocumentSearchResult{Limit: q.Limit, Offset: q.Offset, Documents: []DocumentMatch{}}
+	like := "LIKE"
+	if e.backend == "postgres" {
+		like = "ILIKE"
+	}
+	where := []string{"namespace = " + e.placeholder(1)}
+	args := []any{ns}
+	if q.URLPrefix != "" {
+		args = append(args, escapeLike(q.URLPrefix)+"%")
+		where = append(where, fmt.Sprintf(`url LIKE %s ESCAPE '\'`, e.placeholder(len(args))))
+	}
+	if q.Term != "" {
+		pattern := "%" + escapeLike(q.Term) + "%"
+		args = append(args, pattern, pattern)
+		where = append(where, fmt.Sprintf(`(title %[1]s %[2]s ESCAPE '\' OR content %[1]s %[3]s ESCAPE '\' OR content LIKE '%[4]s%%')`,
+			like, e.placeholder(len(args)-1), e.placeholder(len(args)), compressedPrefix))
+	}
+	rows, err := e.db.QueryContext(ctx, "SELECT id, COALESCE(title, ''), url, content FROM documents WHERE "+strings.Join(where, " AND ")+" ORDER BY id", args...)
+	if err != nil {
+		return out, err
+	}
+	defer rows.Close()
+	term := strings.ToLower(q.Term)
+	for rows.Next() {
+		var m DocumentMatch
+		var stored string
+		if err := rows.Scan(&m.ID, &m.Title, &m.URL, &stored); err != nil {
+			return out, err
+		}
+		content, err := decodeContent(stored)
+		if err != nil {
+			return out, fmt.Errorf("decode document %d: %w", m.ID, err)
+		}
+		lower := strings.ToLower(content)
+		if term != "" {
+			m.Matches = strings.Count(lower, term)
+			if m.Matches == 0 && !strings.Contains(strings.ToLower(m.Title), term) {
+				continue
+			}
+		}
+		out.Total++
+		if out.Total <= q.Offset || len(out.Documents) >= q.Limit {
+			continue
+		}
+		m.Snippet = matchSnippet(content, lower, term)
+		out.Documents = append(out.Documents, m)
+	}
+	return out, rows.Err()
+}
+
+// escapeLike escapes LIKE wildcards so s matches literally with ESCAPE '\'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// matchSnippet returns the text around the first occurrence of term in content,
+// given lower as its lowercased form. Offsets are moved to rune boundaries.
+func matchSnippet(content, lower, term string) string {
+	at := 0
+	if term != "" && len(lower) == len(content) {
+		at = max(0, strings.Index(lower, term))
+	}
+	start, end := max(0, at-documentSnippetRadius), min(len(content), at+len(term)+documentSnippetRadius)
+	for start > 0 && !utf8.RuneStart(content[start]) {
+		start--
+	}
+	for end < len(content) && !utf8.RuneStart(content[end]) {
+		end++
+	}
+	snippet := strings.Join(strings.Fields(content[start:end]), " ")
+	if start > 0 {
+		snippet = "..." + snippet
+	}
+	if end < len(content) {
+		snippet += "..."
+	}
+	return snippet
+}
@@ -0,0 +1,95 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// defaultEgressHosts covers the LLM providers and the crawl sources the engine
+// talks to out of the box. Entries starting with "." match any subdomain.
+var defaultEgressHosts = []string{
+	"generativelanguage.googleapis.com",
+	"www.googleapis.com",
+	"api.openai.com",
+	"kiali.io",
+	".kiali.io",
+	"youtube.com",
+	".youtube.com",
+	"youtu.be",
+}
+
+type egressAllowlist struct {
+	hosts []string
+}
+
+// loadEgressAllowlist returns nil unless EGRESS_ALLOWLIST_ENABLED is set. The list
+// is the defaults plus the configured Kiali API and transcription service hosts and
+// any EGRESS_ALLOWLIST entries.
+func loadEgressAllowlist() *egressAllowlist {
+	if !config.GetBool("EGRESS_ALLOWLIST_ENABLED", false) {
+		return nil
+	}
+	hosts := append([]string{}, defaultEgressHosts...)
+	for _, key := range []string{"KIALI_API_BASE", "YOUTUBE_TRANSCRIPTION_URL"} {
+		if base := config.Get(key, ""); base != "" {
+			if u, err := url.Parse(base); err == nil && u.Hostname() != "" {
+				hosts = append(hosts, u.Hostname())
+			}
+		}
+	}
+	for _, h := range strings.Split(config.Get("EGRESS_ALLOWLIST", ""), ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	log.Printf("egress allowlist enabled: %s", strings.Join(hosts, ", "))
+	return &egressAllowlist{hosts: hosts}
+}
+
+func (a *egressAllowlist) allowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, h := range a.hosts {
+		if strings.HasPrefix(h, ".") {
+			if strings.HasSuffix(host, h) {
+				return true
+			}
+			continue
+		}
+		if host == h {
+			return true
+		}
+	}
+	return false
+}
+
+// dialContext refuses connections to hosts outside the allowlist. Checking at dial
+// time also covers redirects, which re-enter the dialer for each new host.
+func (a *egressAllowlist) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		if !a.allowed(host) {
+			return nil, fmt.Errorf("egress to %q denied: host not in allowlist", host)
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
+
+// newHTTPClient builds the client used for provider calls and crawling.
+func newHTTPClient(timeout time.Duration) *http.Client {
+	transport, dialer := newTransport()
+	if allow := loadEgressAllowlist(); allow != nil {
+		transport.DialContext = allow.dialContext(dialer)
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -0,0 +1,82 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// embedOutcome is the per-input result of embedChunks.
+type embedOutcome struct {
+	Vector []float32
+	// Model is the embedding model that produced Vector, another provider's after
+	// a fallback.
+	Model     string
+	Truncated bool
+	Err       error
+}
+
+// embedChunks embeds texts in provider batches. When a batch is rejected, its inputs
+// are retried one by one, and an input that still fails is retried once truncated to
+// half its length. Failures are reported per input rather than failing the whole set.
+func (e *engine) embedChunks(ctx context.Context, texts []string) []embedOutcome {
+	out := make([]embedOutcome, len(texts))
+	size := embedBatchSize()
+	for start := 0; start < len(texts); start += size {
+		end := min(start+size, len(texts))
+		batch := texts[start:end]
+		if len(batch) > 1 {
+			vecs, served, err := e.embedBatch(ctx, batch)
+			if err == nil && len(vecs) == len(batch) {
+				for i, v := range vecs {
+					out[start+i] = embedOutcome{Vector: v, Model: served.EmbeddingModel}
+				}
+				continue
+			}
+			if ctx.Err() != nil {
+				for i := range batch {
+					out[start+i] = embedOutcome{Err: ctx.Err()}
+				}
+				continue
+			}
+			log.Printf("embed batch of %d failed, retrying individually: %v", len(batch), err)
+		}
+		for i, text := range batch {
+			out[start+i] = e.embedSingleWithFallback(ctx, text)
+		}
+	}
+	return out
+}
+
+// embedBatchSize is EMBED_BATCH_SIZE, at least 1.
+func embedBatchSize() int {
+	return max(1, config.GetInt("EMBED_BATCH_SIZE", 32))
+}
+
+func (e *engine) embedSingleWithFallback(ctx context.Context, text string) embedOutcome {
+	v, served, err := e.embedServed(ctx, e.embeddingChain(), text)
+	if err == nil {
+		return embedOutcome{Vector: v, Model: served.EmbeddingModel}
+	}
+	runes := []rune(text)
+	if ctx.Err() != nil || len(runes) < 2 {
+		return embedOutcome{Err: err}
+	}
+	v, served, terr := e.embedServed(ctx, e.embeddingChain(), string(runes[:len(runes)/2]))
+	if terr != nil {
+		return embedOutcome{Err: fmt.Errorf("%v (truncated retry: %v)", err, terr)}
+	}
+	log.Printf("embedded chunk after truncating to %d chars: %v", len(runes)/2, err)
+	return embedOutcome{Vector: v, Model: served.EmbeddingModel, Truncated: true}
+}
+
+func checkBatchVectors(vecs [][]float32) error {
+	for i, v := range vecs {
+		if len(v) == 0 {
+			return fmt.Errorf("embed batch: empty embedding for input %d", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package rag
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"strconv"
+
+	"github.com/pgvector/pgvector-go"
+)
+
+// With EMBED_CACHE (default true) every stored chunk records a hash of its
+// embedding input, and ingests look chunks up by that hash before calling the
+// provider. Text shared between documents, such as a page reachable from several
+// seeds or a video in two playlists, is then embedded once. The hashes live on the
+// embeddings rows, so the cache needs no table of its own and shrinks with
+// clean and deduplicate.
+
+func initEmbeddingCache(db *sql.DB, backend string) error {
+	if err := ensureColumn(db, backend, "embeddings", "content_hash", "TEXT"); err != nil {
+		return err
+	}
+	_, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_embeddings_hash ON embeddings(content_hash)")
+	return err
+}
+
+// chunkHash keys a chunk by the exact input the provider would see, together with
+// the embedding model and requested dimensions, so a model change never reuses
+// vectors from another space.
+func (e *engine) chunkHash(text string) string {
+	if e.preprocessEmbeddings {
+		text = normalizeEmbeddingInput(text, e.stripMarkdown)
+	}
+	h := sha256.New()
+	h.Write([]byte(e.models.EmbeddingModel + "\x00" + strconv.Itoa(e.embedDimensions) + "\x00" + text))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cachedVectors returns stored vectors for the given hashes, skipping any whose
+// width does not match EMBEDDING_DIM.
+func (e *engine) cachedVectors(ctx context.Context, hashes []string) (map[string][]float32, error) {
+	out := map[string][]float32{}
+	if len(hashes) == 0 {
+		return out, nil
+	}
+	args := make([]any, len(hashes))
+	for i, h := range hashes {
+		args[i] = h
+	}
+	rows, err := e.db.QueryContext(ctx, "SELECT content_hash, vector FROM embeddings WHERE content_hash IN ("+e.placeholders(len(hashes))+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var h string
+		var vec []float32
+		if e.backend == "postgres" {
+			var v pgvector.Vector
+			if err := rows.Scan(&h, &v); err != nil {
+				return nil, err
+			}
+			vec = v.Slice()
+		} else {
+			var blob []byte
+			if err := rows.Scan(&h, &blob); err != nil {
+				return nil, err
+			}
+			vec = blobToFloats(blob)
+		}
+		if _, ok := out[h]; !ok && len(vec) == e.embeddingDim {
+			out[h] = vec
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := e.checkpointedVectors(ctx, hashes, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// embedChunksCached is embedChunks with the chunk cache in front of it. Identical
+// texts within the call are embedded once. It returns the hash to store with each
+// chunk, empty when the vector does not represent the full text or comes from a
+// fallback model, and how many chunks were served from the cache and how many
+// vectors were requested.
+func (e *engine) embedChunksCached(ctx context.Context, texts []string) (outcomes []embedOutcome, hashes []string, reused, computed int) {
+	if !e.embedCache {
+		outcomes = e.embedChunks(ctx, texts)
+		return outcomes, make([]string, len(texts)), 0, len(texts)
+	}
+	hashes = make([]string, len(texts))
+	var unique []string
+	seen := map[string]bool{}
+	for i, t := range texts {
+		hashes[i] = e.chunkHash(t)
+		if !seen[hashes[i]] {
+			seen[hashes[i]] = true
+			unique = append(unique, hashes[i])
+		}
+	}
+	cached, err := e.cachedVectors(ctx, unique)
+	if err != nil {
+		log.Printf("embedding cache lookup failed, embedding all chunks: %v", err)
+		cached = map[string][]float32{}
+	}
+	// Embed each missing text once and share the outcome between its copies.
+	var missTexts, missHashes []string
+	missAt := map[string]int{}
+	for i, t := range texts {
+		if _, ok := cached[hashes[i]]; ok {
+			continue
+		}
+		if _, ok := missAt[hashes[i]]; !ok {
+			missAt[hashes[i]] = len(missTexts)
+			missTexts = append(missTexts, t)
+			missHashes = append(missHashes, hashes[i])
+		}
+	}
+	fresh := e.embedChunksCheckpointed(ctx, missTexts, missHashes)
+	outcomes = make([]embedOutcome, len(texts))
+	for i := range texts {
+		if vec, ok := cached[hashes[i]]; ok {
+			outcomes[i] = embedOutcome{Vector: vec, Model: e.models.EmbeddingModel}
+			reused++
+			continue
+		}
+		outcomes[i] = fresh[missAt[hashes[i]]]
+		// The hash names the configured model's space, which a fallback
+		// provider's vector is not in.
+		if outcomes[i].Truncated || outcomes[i].Model != e.models.EmbeddingModel {
+			hashes[i] = ""
+		}
+	}
+	return outcomes, hashes, reused, len(missTexts)
+}
@@ -0,0 +1,144 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+)
+
+// With EMBED_CHECKPOINTS (default true, needs EMBED_CACHE) the vectors of a
+// document too large for one embedding batch are saved batch by batch in the
+// embed_checkpoints table, keyed by chunk hash, until the document is stored. An
+// ingest of the same document that is retried or resumed after a failure, a
+// cancellation or a restart then finds them through the chunk cache and only
+// embeds the remaining chunks. Storing a document removes the checkpoints of its
+// chunks in the same transaction; checkpoints of documents never stored are
+// dropped at startup after embedCheckpointTTL.
+
+// embedCheckpointTTL is how long a checkpoint waits for its document to be retried.
+const embedCheckpointTTL = 7 * 24 * time.Hour
+
+func initEmbedCheckpoints(db *sql.DB, backend string) error {
+	blob := "BLOB"
+	if backend == "postgres" {
+		blob = "BYTEA"
+	}
+	if _, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS embed_checkpoints (
+	content_hash TEXT PRIMARY KEY,
+	vector ` + blob + ` NOT NULL,
+	created_at TEXT NOT NULL
+);
+`); err != nil {
+		return err
+	}
+	arg := "?"
+	if backend == "postgres" {
+		arg = "$1"
+	}
+	_, err := db.Exec("DELETE FROM embed_checkpoints WHERE created_at < "+arg, time.Now().Add(-embedCheckpointTTL).UTC().Format(time.RFC3339))
+	return err
+}
+
+// embedChunksCheckpointed is embedChunks for the texts with the given chunk
+// hashes, checkpointing the vectors of each batch as it completes.
+func (e *engine) embedChunksCheckpointed(ctx context.Context, texts, hashes []string) []embedOutcome {
+	size := embedBatchSize()
+	if !e.embedCheckpoints || len(texts) <= size {
+		return e.embedChunks(ctx, texts)
+	}
+	out := make([]embedOutcome, len(texts))
+	for start := 0; start < len(texts); start += size {
+		end := min(start+size, len(texts))
+		copy(out[start:end], e.embedChunks(ctx, texts[start:end]))
+		e.saveCheckpoints(hashes[start:end], out[start:end])
+	}
+	return out
+}
+
+// saveCheckpoints stores the complete vectors among outcomes; failures are only
+// logged, since the vectors are still used for the current ingest.
+func (e *engine) saveCheckpoints(hashes []string, outcomes []embedOutcome) {
+	stmt := "INSERT INTO embed_checkpoints(content_hash, vector, created_at) VALUES(" + e.placeholders(3) + ") ON CONFLICT(content_hash) DO NOTHING"
+	now := time.Now().UTC().Format(time.RFC3339)
+	unlock := e.lockWrites()
+	defer unlock()
+	// Saved even when the ingest is being cancelled: that is when they are needed.
+	ctx := context.Background()
+	_, err := withBusyRetries(ctx, "save embed checkpoints", func() (struct{}, error) {
+		tx, err := e.db.BeginTx(ctx, nil)
+		if err != nil {
+			return struct{}{}, err
+		}
+		defer tx.Rollback()
+		for i, o := range outcomes {
+			if o.Err != nil || o.Truncated || o.Model != e.models.EmbeddingModel {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, stmt, hashes[i], floatsToBlob(o.Vector), now); err != nil {
+				return struct{}{}, err
+			}
+		}
+		return struct{}{}, tx.Commit()
+	})
+	if err != nil {
+		log.Printf("save embed checkpoints: %v", err)
+	}
+}
+
+// checkpointedVectors adds the checkpointed vectors of hashes missing from out.
+func (e *engine) checkpointedVectors(ctx context.Context, hashes []string, out map[string][]float32) error {
+	if !e.embedCheckpoints {
+		return nil
+	}
+	var args []any
+	for _, h := range hashes {
+		if _, ok := out[h]; !ok {
+			args = append(args, h)
+		}
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	rows, err := e.db.QueryContext(ctx, "SELECT content_hash, vector FROM embed_checkpoints WHERE content_hash IN ("+e.placeholders(len(args))+")", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	resumed := 0
+	for rows.Next() {
+		var h string
+		var blob []byte
+		if err := rows.Scan(&h, &blob); err != nil {
+			return err
+		}
+		if vec := blobToFloats(blob); len(vec) == e.embeddingDim {
+			out[h] = vec
+			resumed++
+		}
+	}
+	if resumed > 0 {
+		log.Printf("resumed %d chunk embeddings from checkpoints", resumed)
+	}
+	return rows.Err()
+}
+
+// clearCheckpoints removes the checkpoints of a document's chunks within the
+// transaction that stores it.
+func (e *engine) clearCheckpoints(ctx context.Context, tx *sql.Tx, hashes []sql.NullString) error {
+	if !e.embedCache || !e.embedCheckpoints {
+		return nil
+	}
+	var args []any
+	for _, h := range hashes {
+		if h.Valid {
+			args = append(args, h.String)
+		}
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, "DELETE FROM embed_checkpoints WHERE content_hash IN ("+e.placeholders(len(args))+")", args...)
+	return err
+}
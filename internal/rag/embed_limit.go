@@ -0,0 +1,176 @@
+package rag
+
+import (
+	"context"
+	"log"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// Handling of embedding inputs over the model's input limit (EMBED_LONG_INPUT).
+const (
+	longInputPool     = "pool"
+	longInputTruncate = "truncate"
+)
+
+// embeddingInputTokens lists embedding input limits by model name prefix.
+var embeddingInputTokens = []struct {
+	prefix string
+	tokens int
+}{
+	{"text-embedding-004", 2048},
+	{"gemini-embedding", 2048},
+	{"text-embedding-3", 8191},
+	{"text-embedding-ada-002", 8191},
+}
+
+// defaultEmbeddingInputTokens is assumed for models missing from embeddingInputTokens.
+const defaultEmbeddingInputTokens = 2048
+
+func loadLongInputMode() string {
+	switch m := strings.ToLower(strings.TrimSpace(config.Get("EMBED_LONG_INPUT", longInputPool))); m {
+	case longInputPool, longInputTruncate:
+		return m
+	default:
+		log.Printf("EMBED_LONG_INPUT: unknown mode %q, using %s", m, longInputPool)
+		return longInputPool
+	}
+}
+
+// embeddingInputLimit returns EMBED_MAX_INPUT_TOKENS, or the input limit of t's
+// embedding model. Zero or less disables the check.
+func embeddingInputLimit(t llmTarget) int {
+	model := t.EmbeddingModel
+	if model == "" {
+		model = providerDefaults[t.Provider].EmbeddingModel
+	}
+	def := defaultEmbeddingInputTokens
+	for _, m := range embeddingInputTokens {
+		if strings.HasPrefix(model, m.prefix) {
+			def = m.tokens
+			break
+		}
+	}
+	return config.GetInt("EMBED_MAX_INPUT_TOKENS", def)
+}
+
+// embedInput embeds one normalized input with t. An input over the model's limit
+// is either split into parts whose embeddings are averaged, weighted by length, or
+// truncated, so the provider never truncates it silently or rejects it.
+func (e *engine) embedInput(ctx context.Context, t llmTarget, text string) ([]float32, error) {
+	limit := embeddingInputLimit(t)
+	if limit <= 0 || estimateTokens(text) <= limit {
+		return e.embedVia(ctx, t, text)
+	}
+	maxChars := limit * charsPerToken
+	if e.longInputMode == longInputTruncate {
+		log.Printf("embedding input of ~%d tokens exceeds the %d token limit; truncating to %d chars", estimateTokens(text), limit, maxChars)
+		return e.embedVia(ctx, t, splitForEmbedding(text, maxChars)[0])
+	}
+	parts := splitForEmbedding(text, maxChars)
+	vecs, err := e.embedBatchVia(ctx, t, parts)
+	if err != nil {
+		return nil, err
+	}
+	weights := make([]float64, len(parts))
+	for i, p := range parts {
+		weights[i] = float64(len(p))
+	}
+	return meanPool(vecs, weights), nil
+}
+
+// embedInputs is embedBatchVia for inputs that may exceed the model's limit: the
+// ones within it share one request, the others go through embedInput.
+func (e *engine) embedInputs(ctx context.Context, t llmTarget, inputs []string) ([][]float32, error) {
+	limit := embeddingInputLimit(t)
+	var short []string
+	var shortIdx, longIdx []int
+	for i, in := range inputs {
+		if limit > 0 && estimateTokens(in) > limit {
+			longIdx = append(longIdx, i)
+		} else {
+			short, shortIdx = append(short, in), append(shortIdx, i)
+		}
+	}
+	if len(longIdx) == 0 {
+		return e.embedBatchVia(ctx, t, inputs)
+	}
+	vecs := make([][]float32, len(inputs))
+	if len(short) > 0 {
+		sv, err := e.embedBatchVia(ctx, t, short)
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range shortIdx {
+			vecs[i] = sv[j]
+		}
+	}
+	for _, i := range longIdx {
+		v, err := e.embedInput(ctx, t, inputs[i])
+		if err != nil {
+			return nil, err
+		}
+		vecs[i] = v
+	}
+	return vecs, nil
+}
+
+// splitForEmbedding cuts text into parts of at most maxChars bytes, preferring to
+// break at whitespace and never inside a UTF-8 sequence.
+func splitForEmbedding(text string, maxChars int) []string {
+	var parts []string
+	for len(text) > maxChars {
+		cut := maxChars
+		for cut > 0 && !isRuneStart(text[cut]) {
+			cut--
+		}
+		if i := strings.LastIndexFunc(text[:cut], unicode.IsSpace); i > maxChars/2 {
+			cut = i
+		}
+		if cut == 0 {
+			cut = maxChars
+		}
+		parts = append(parts, strings.TrimSpace(text[:cut]))
+		text = strings.TrimSpace(text[cut:])
+	}
+	if text != "" || len(parts) == 0 {
+		parts = append(parts, text)
+	}
+	return parts
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// meanPool averages vectors by weight and scales the result to unit length, like
+// the vectors the providers return.
+func meanPool(vecs [][]float32, weights []float64) []float32 {
+	if len(vecs) == 0 {
+		return nil
+	}
+	sum := make([]float64, len(vecs[0]))
+	for i, v := range vecs {
+		for j := range sum {
+			if j < len(v) {
+				sum[j] += weights[i] * float64(v[j])
+			}
+		}
+	}
+	var norm float64
+	for _, x := range sum {
+		norm += x * x
+	}
+	norm = math.Sqrt(norm)
+	out := make([]float32, len(sum))
+	for j, x := range sum {
+		if norm > 0 {
+			x /= norm
+		}
+		out[j] = float32(x)
+	}
+	return out
+}
@@ -0,0 +1,142 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// embedQueueMaxAttempts bounds retries of a queued document before it is dropped.
+const embedQueueMaxAttempts = 5
+
+// With EMBED_QUEUE_WORKERS set, ingests store fetched documents in the embed_queue
+// table and return without waiting for embeddings; a pool of workers embeds and
+// stores them. The table makes pending work survive restarts, and the bounded id
+// channel makes ingests wait (backpressure) once EMBED_QUEUE_SIZE documents are pending.
+
+func initEmbedQueue(db *sql.DB, backend string) error {
+	id := "INTEGER PRIMARY KEY AUTOINCREMENT"
+	if backend == "postgres" {
+		id = "BIGSERIAL PRIMARY KEY"
+	}
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS embed_queue (
+	id ` + id + `,
+	namespace TEXT NOT NULL,
+	title TEXT,
+	url TEXT,
+	content TEXT,
+	attempts INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_embed_queue_ns_url ON embed_queue(namespace, url);
+`)
+	return err
+}
+
+// startEmbedQueue starts the workers and hands them the documents left pending by
+// a previous run.
+func (e *engine) startEmbedQueue(workers, size int) error {
+	rows, err := e.db.Query("SELECT id FROM embed_queue ORDER BY id")
+	if err != nil {
+		return err
+	}
+	var pending []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	e.queue = make(chan int64, max(1, size))
+	for range workers {
+		go func() {
+			for id := range e.queue {
+				e.processQueued(id)
+			}
+		}()
+	}
+	if len(pending) > 0 {
+		log.Printf("embed queue: resuming %d pending documents", len(pending))
+		go func() {
+			for _, id := range pending {
+				e.queue <- id
+			}
+		}()
+	}
+	return nil
+}
+
+// enqueueDocument persists a document for the workers. It blocks while the queue
+// is full; a document whose wait is cancelled stays persisted and is picked up on
+// the next start.
+func (e *engine) enqueueDocument(ctx context.Context, ns, title, docURL, content string) error {
+	var id int64
+	if e.backend == "postgres" {
+		if err := e.db.QueryRowContext(ctx, "INSERT INTO embed_queue(namespace, title, url, content) VALUES($1,$2,$3,$4) RETURNING id", ns, title, docURL, content).Scan(&id); err != nil {
+			return err
+		}
+	} else {
+		unlock := e.lockWrites()
+		res, err := e.db.ExecContext(ctx, "INSERT INTO embed_queue(namespace, title, url, content) VALUES(?,?,?,?)", ns, title, docURL, content)
+		unlock()
+		if err != nil {
+			return err
+		}
+		id, _ = res.LastInsertId()
+	}
+	select {
+	case e.queue <- id:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// processQueued embeds and stores one queued document, then removes it from the
+// queue. Failures are retried with backoff up to embedQueueMaxAttempts.
+func (e *engine) processQueued(id int64) {
+	ctx := context.Background()
+	e.corpusMu.RLock()
+	defer e.corpusMu.RUnlock()
+	var ns, title, docURL, content string
+	var attempts int
+	err := e.db.QueryRowContext(ctx, "SELECT namespace, title, url, content, attempts FROM embed_queue WHERE id="+e.placeholder(1), id).
+		Scan(&ns, &title, &docURL, &content, &attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Removed by Clean while pending.
+		return
+	}
+	if err != nil {
+		log.Printf("embed queue: load %d: %v", id, err)
+		return
+	}
+	if _, err := e.storeDocument(ctx, ns, title, docURL, content); errors.Is(err, errDocumentBlocked) {
+		log.Printf("embed queue: %s blocked by moderation", docURL)
+	} else if err != nil {
+		attempts++
+		if attempts < embedQueueMaxAttempts {
+			log.Printf("embed queue: %s failed (attempt %d), retrying: %v", docURL, attempts, err)
+			e.execQueue(ctx, "UPDATE embed_queue SET attempts="+e.placeholder(1)+" WHERE id="+e.placeholder(2), attempts, id)
+			time.AfterFunc(time.Duration(attempts*attempts)*10*time.Second, func() { e.queue <- id })
+			return
+		}
+		log.Printf("embed queue: dropping %s after %d attempts: %v", docURL, attempts, err)
+	}
+	e.execQueue(ctx, "DELETE FROM embed_queue WHERE id="+e.placeholder(1), id)
+}
+
+func (e *engine) execQueue(ctx context.Context, query string, args ...any) {
+	unlock := e.lockWrites()
+	defer unlock()
+	if _, err := e.db.ExecContext(ctx, query, args...); err != nil {
+		log.Printf("embed queue: %v", err)
+	}
+}
@@ -2,26 +2,304 @@ package rag
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"strings"
 	"sync"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
 )
 
+// ErrIngestInProgress is returned by maintenance operations that cannot run
+// alongside an ingest.
+var ErrIngestInProgress = errors.New("ingestion in progress")
+
+// ErrCompactionDisabled is returned by Compact when COMPACT_MIN_CHARS is unset.
+var ErrCompactionDisabled = errors.New("compaction disabled: set COMPACT_MIN_CHARS")
+
+// ErrModelNotAllowed is returned by Answer when a per-request model override is
+// not in ALLOWED_COMPLETION_MODELS or ALLOWED_EMBEDDING_MODELS.
+var ErrModelNotAllowed = errors.New("model not allowed")
+
+// ErrContentBlocked is returned when a provider's safety system blocked the prompt
+// or withheld the answer. Rephrasing the question is the usual remedy.
+var ErrContentBlocked = errors.New("response blocked by safety filter")
+
+// ErrInvalidTemperature is returned by Answer for a temperature outside [0, 2].
+var ErrInvalidTemperature = errors.New("temperature must be between 0 and 2")
+
+// ErrInvalidChunkCount is returned by Answer for a candidate or prompt chunk count
+// out of range.
+var ErrInvalidChunkCount = errors.New("invalid chunk count")
+
+// ErrInvalidSourceWeight is returned by Answer for a source weight of an unknown
+// source type or out of range.
+var ErrInvalidSourceWeight = errors.New("invalid source weight")
+
 type Engine interface {
-	Answer(ctx context.Context, query string, kialiContext any) (answer string, citations []Citation, models ModelIdentifiers, err error)
-	IngestKialiDocs(ctx context.Context, baseURL string) (ingested int, skipped int, err error)
-	IngestYouTube(ctx context.Context, channelOrPlaylistURL string) (ingested int, skipped int, err error)
-	Clean(ctx context.Context) (removedDocuments int, err error)
-	Deduplicate(ctx context.Context) (removedDuplicates int, err error)
+	Answer(ctx context.Context, query string, kialiContext any, opts AnswerOptions) (AnswerResult, error)
+	Search(ctx context.Context, query, namespace string, k int) ([]ContextChunk, error)
+	IngestKialiDocs(ctx context.Context, seedURLs []string, opts IngestOptions) (IngestResult, error)
+	IngestYouTube(ctx context.Context, channelOrPlaylistURL string, opts IngestOptions) (IngestResult, error)
+	IngestDirectory(ctx context.Context, path, glob string, opts IngestOptions) (IngestResult, error)
+	Clean(ctx context.Context, namespace string) (removedDocuments int, err error)
+	Deduplicate(ctx context.Context, namespace string) (removedDuplicates int, err error)
+	PreviewDuplicates(ctx context.Context, namespace string, limit, offset int) (DuplicatePreview, error)
+	DocumentSearch(ctx context.Context, namespace string, q DocumentQuery) (DocumentSearchResult, error)
+	DocumentCount(ctx context.Context, namespace string) (int, error)
+	Stats(ctx context.Context, namespace string) (Stats, error)
+	CorpusHealth(ctx context.Context, namespace string) (CorpusHealth, error)
+	Vacuum(ctx context.Context) (VacuumResult, error)
+	CleanOrphans(ctx context.Context) (OrphanCleanupResult, error)
+	Compact(ctx context.Context, namespace string) (CompactResult, error)
+	Reextract(ctx context.Context, namespace string) (ReextractResult, error)
+	BackfillHashes(ctx context.Context, namespace string, opts HashBackfillOptions) (HashBackfillResult, error)
+	StartReembed(namespace string) (ReembedStatus, error)
+	ReembedStatus() ReembedStatus
+	CancelReembed() (ReembedStatus, error)
+	Embed(ctx context.Context, text string) (EmbedResult, error)
+	Trace(ctx context.Context, query string, kialiContext any, opts AnswerOptions) (AnswerTrace, error)
+	RecordUsage(client, namespace string, u TokenUsage)
+	CheckQuota(ctx context.Context, client string) error
+	Usage(ctx context.Context, f UsageFilter) ([]UsageRecord, error)
+	ResetUsage(ctx context.Context, f UsageFilter, before string) (int64, error)
+	ProviderStatus() []BreakerStatus
+	EventStats() EventStats
+	ValidateModels(ctx context.Context) ModelValidation
+	Models() ModelCatalog
+	Sources(ctx context.Context, namespace string) ([]Source, error)
+	AddFAQ(ctx context.Context, namespace, question, answer string) (FAQ, error)
+	FAQs(ctx context.Context, namespace string) ([]FAQ, error)
+	DeleteFAQ(ctx context.Context, namespace string, id int64) error
+	AddEvalCase(ctx context.Context, namespace, query string, relevantURLs []string) (EvalCase, error)
+	EvalCases(ctx context.Context, namespace string) ([]EvalCase, error)
+	DeleteEvalCase(ctx context.Context, namespace string, id int64) error
+	RunEval(ctx context.Context, namespace string, k int) (EvalReport, error)
+	AddAPIKey(ctx context.Context, name, namespace string) (APIKey, string, error)
+	APIKeys(ctx context.Context) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, name string) error
+	LookupAPIKey(ctx context.Context, secret string) (APIKey, bool, error)
+	ModerationEvents(ctx context.Context, namespace string, limit int) ([]ModerationEvent, error)
+}
+
+// EmbedResult is the raw embedding of a text together with the settings that produced
+// it. ConfiguredDimension is EMBEDDING_DIM, which stored vectors must match.
+type EmbedResult struct {
+	Provider            string    `json:"provider"`
+	Model               string    `json:"model"`
+	Dimension           int       `json:"dimension"`
+	ConfiguredDimension int       `json:"configured_dimension"`
+	Vector              []float32 `json:"vector"`
+}
+
+// VacuumResult reports database size around a vacuum. Postgres sizes cover the
+// documents and embeddings tables; plain VACUUM there often reclaims nothing on disk.
+type VacuumResult struct {
+	BytesBefore    int64 `json:"bytes_before"`
+	BytesAfter     int64 `json:"bytes_after"`
+	ReclaimedBytes int64 `json:"reclaimed_bytes"`
+}
+
+// CompactResult reports a compaction: MergedDocuments small documents were
+// replaced by CreatedDocuments merged ones.
+type CompactResult struct {
+	Namespace        string `json:"namespace"`
+	MergedDocuments  int    `json:"merged_documents"`
+	CreatedDocuments int    `json:"created_documents"`
+}
+
+// IngestOptions carries optional per-job settings for ingestion.
+type IngestOptions struct {
+	// Namespace is the knowledge base documents are stored in; empty means DefaultNamespace.
+	Namespace string
+	// Headers are sent with every page fetch of the job, e.g. Accept-Language.
+	Headers map[string]string
+	// Progress, when set, is called synchronously before each page or video is fetched.
+	Progress func(IngestProgress)
+	// CrawlID resumes the interrupted docs crawl saved under this id; its seeds
+	// replace those passed in.
+	CrawlID string
+}
+
+// IngestProgress is a snapshot of a running ingest.
+type IngestProgress struct {
+	PagesVisited int    `json:"pages_visited"`
+	CurrentURL   string `json:"current_url"`
+	IngestResult
+}
+
+func (o IngestOptions) report(visited int, current string, result IngestResult) {
+	if o.Progress != nil {
+		o.Progress(IngestProgress{PagesVisited: visited, CurrentURL: current, IngestResult: result})
+	}
+}
+
+// IngestResult counts the documents an ingest run stored or skipped. Partial
+// documents were stored with some chunks missing because they could not be embedded.
+// Merged counts small sections folded into a neighbour before storing, Summaries
+// the documents that got an LLM summary chunk. Queued documents were handed to the
+// embed queue and are stored in the background.
+type IngestResult struct {
+	Ingested  int `json:"ingested"`
+	Skipped   int `json:"skipped"`
+	Partial   int `json:"partial"`
+	Merged    int `json:"merged"`
+	Summaries int `json:"summaries"`
+	Queued    int `json:"queued"`
+	// Moderated counts chunks flagged by MODERATION; depending on the action they
+	// were skipped or stored.
+	Moderated int `json:"moderated"`
+	// Denied counts pages and documents INGEST_DENYLIST kept from being fetched or stored.
+	Denied int `json:"denied"`
+	// Capped counts documents MAX_CHUNKS_PER_DOC stored with only some of their chunks.
+	Capped int `json:"capped"`
+	// EmbeddingsReused counts chunks whose vector came from the embedding cache,
+	// EmbeddingsComputed the vectors requested from the provider.
+	EmbeddingsReused   int `json:"embeddings_reused"`
+	EmbeddingsComputed int `json:"embeddings_computed"`
+	// Cancelled is set when the run stopped early because its context ended; the
+	// counts cover the documents committed until then.
+	Cancelled bool `json:"cancelled,omitempty"`
+	// CrawlID is set when an interrupted docs crawl saved its frontier; passing it
+	// back resumes the crawl.
+	CrawlID string `json:"crawl_id,omitempty"`
+	// Truncated is set when CRAWL_MAX_QUEUE or CRAWL_MAX_VISITED kept a docs crawl
+	// from following DroppedLinks of the links it found.
+	Truncated    bool `json:"truncated,omitempty"`
+	DroppedLinks int  `json:"dropped_links,omitempty"`
+	// Transcripts tells, for each video a YouTube ingest fetched, where its
+	// transcript came from; see VideoTranscript.
+	Transcripts []VideoTranscript `json:"transcripts,omitempty"`
+}
+
+// VideoTranscript names the source of a video's stored text: "captions",
+// "service" (YOUTUBE_TRANSCRIPTION_URL), "description" (title and description),
+// or "none" when nothing usable was found and the video was skipped.
+type VideoTranscript struct {
+	URL    string `json:"url"`
+	Source string `json:"source"`
+}
+
+// Stats summarizes the stored corpus of one namespace. Byte counts cover document content only;
+// SavedBytes is the space reclaimed by content compression. QueueDepth counts documents
+// waiting in the embed queue.
+type Stats struct {
+	Namespace           string `json:"namespace"`
+	Documents           int    `json:"documents"`
+	Embeddings          int    `json:"embeddings"`
+	CompressedDocuments int    `json:"compressed_documents"`
+	ContentBytes        int64  `json:"content_bytes"`
+	RawContentBytes     int64  `json:"raw_content_bytes"`
+	SavedBytes          int64  `json:"saved_bytes"`
+	QueueDepth          int    `json:"queue_depth"`
+}
+
+// AnswerOptions carries optional per-request settings for Answer.
+type AnswerOptions struct {
+	// Namespace restricts retrieval to one knowledge base; empty means DefaultNamespace.
+	Namespace string
+	// ResponseFormat asks the model for JSON matching a schema instead of free text.
+	ResponseFormat *ResponseFormat
+	// CompletionModel and EmbeddingModel override the primary provider's models
+	// for this request; they must be allowlisted (see ErrModelNotAllowed).
+	CompletionModel string
+	EmbeddingModel  string
+	// IncludeContext returns the retrieved chunks as given to the model in AnswerResult.Context.
+	IncludeContext bool
+	// Language asks for the answer in another language, e.g. "es" or "pt-BR";
+	// sources are still cited as stored. See ErrUnsupportedLanguage.
+	Language string
+	// GroupCitations also returns the citations grouped by document in AnswerResult.Sources.
+	GroupCitations bool
+	// Temperature overrides the default completion temperature of 0.2; with 0 and a
+	// Seed, OpenAI answers are reproducible on a best-effort basis. Gemini ignores Seed.
+	Temperature *float64
+	Seed        *int64
+	// CandidateChunks and PromptChunks override ANSWER_CANDIDATE_CHUNKS and
+	// ANSWER_PROMPT_CHUNKS: how many chunks are retrieved and how many of them,
+	// after MMR, go into the prompt. Zero keeps the configured value; see
+	// ErrInvalidChunkCount.
+	CandidateChunks int
+	PromptChunks    int
+	// SourceWeights multiplies retrieval scores by source type, e.g. to prefer the
+	// docs over video transcripts; see ErrInvalidSourceWeight.
+	SourceWeights SourceWeights
+}
+
+// ResponseFormat describes the JSON schema a structured answer must satisfy.
+type ResponseFormat struct {
+	Name   string          `json:"name,omitempty"`
+	Schema json.RawMessage `json:"schema"`
+}
+
+// AnswerResult is the outcome of Answer. Structured is only set when a
+// ResponseFormat was requested and the model output validated against it.
+// Confidence in [0,1] reflects how well retrieval supported the answer.
+type AnswerResult struct {
+	Answer     string
+	Citations  []Citation
+	Models     ModelIdentifiers
+	Structured any
+	Confidence float64
+	Context    []ContextChunk
+	Sources    []CitationGroup
+	// CuratedID is the FAQ answering the query, with no completion call made;
+	// zero for generated answers. Confidence is then the question similarity.
+	CuratedID int64
+	// Redacted is set when moderation masked the generated answer.
+	Redacted bool
+	// Degraded is set when the query could not be embedded and KEYWORD_FALLBACK
+	// retrieved the chunks by keyword match instead.
+	Degraded bool
+	// Seed is the sampling seed sent to the provider that served the answer; nil
+	// when none was requested or the provider does not support one.
+	Seed *int64
+	// Usage counts the completion tokens spent on the answer; zero for callers
+	// that joined an identical call in progress.
+	Usage TokenUsage
+	// Grounding is the result of GROUNDING_CHECK; nil when the answer was not checked.
+	Grounding *Grounding
+}
+
+// ContextChunk is a retrieved chunk exactly as it was placed in the prompt.
+// Search also sets Vector, the chunk's stored embedding.
+type ContextChunk struct {
+	Title  string    `json:"title"`
+	URL    string    `json:"url"`
+	Text   string    `json:"text"`
+	Score  float64   `json:"score"`
+	Vector []float32 `json:"-"`
 }
 
+// ModelIdentifiers names the models used. In answers the provider fields record
+// which provider actually served each call, which differs from the configured one
+// after a fallback.
 type ModelIdentifiers struct {
-	CompletionModel string `json:"completion_model"`
-	EmbeddingModel  string `json:"embedding_model"`
+	CompletionModel    string `json:"completion_model"`
+	EmbeddingModel     string `json:"embedding_model"`
+	CompletionProvider string `json:"completion_provider,omitempty"`
+	EmbeddingProvider  string `json:"embedding_provider,omitempty"`
+	// RoutedFrom is the default completion model when the prompt was too large for
+	// it and CONTEXT_ROUTING_MODELS supplied CompletionModel instead. Only the v2
+	// chat response and GraphQL report it.
+	RoutedFrom string `json:"-"`
 }
 
+// Citation is a retrieved chunk an answer was grounded on. Score is its similarity
+// to the query and Cited reports whether the answer references its marker, [i] for
+// the i-th citation; like the section fields they are only serialized by the v2
+// chat response and GraphQL.
 type Citation struct {
-	Title string `json:"title"`
-	URL   string `json:"url"`
-	Span  string `json:"span"`
+	Title string  `json:"title"`
+	URL   string  `json:"url"`
+	Span  string  `json:"span"`
+	Score float64 `json:"-"`
+	Cited bool    `json:"-"`
+	// PageTitle, SectionTitle and Anchor are set for a section of a page, whose
+	// URL ends in #Anchor; see annotateSections.
+	PageTitle    string `json:"-"`
+	SectionTitle string `json:"-"`
+	Anchor       string `json:"-"`
 }
 
 var (
@@ -29,8 +307,14 @@ var (
 	defaultEng  Engine
 )
 
+// DefaultEngine returns the process-wide engine, a mock one with ENGINE=mock
+// (see NewMockEngine).
 func DefaultEngine() Engine {
 	defaultOnce.Do(func() {
+		if strings.ToLower(config.Get("ENGINE", "")) == "mock" {
+			defaultEng = NewMockEngine()
+			return
+		}
 		defaultEng = NewEngine()
 	})
 	return defaultEng
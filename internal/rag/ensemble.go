@@ -0,0 +1,131 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sort"
+)
+
+// rrfK is the rank offset of reciprocal-rank fusion; 60 is the value from the
+// original paper and keeps a single top rank from dominating the fused order.
+const rrfK = 60
+
+// Every embedding row records the model that produced it. Rows stored before the
+// column existed have none and are taken to belong to EMBEDDING_MODEL.
+//
+// With EMBED_ENSEMBLE (default false) retrieval spans every model present in a
+// namespace: the query is embedded once per model, each model's rows are searched
+// with its own query vector, and the rankings are merged with reciprocal-rank
+// fusion. A corpus half re-embedded after a model upgrade then stays searchable
+// as a whole while the migration runs.
+
+func initEmbeddingModels(db *sql.DB, backend string) error {
+	return ensureColumn(db, backend, "embeddings", "model", "TEXT")
+}
+
+// queryEmbedding is a query with its vector and the target that embedded it.
+type queryEmbedding struct {
+	Text    string
+	Vector  []float32
+	Target  llmTarget
+	Weights SourceWeights
+}
+
+// candidates searches ns for q, across all stored models with EMBED_ENSEMBLE.
+func (e *engine) candidates(ctx context.Context, ns string, q queryEmbedding, k int) ([]docChunk, error) {
+	if !e.embedEnsemble {
+		return e.search(ctx, ns, q.Vector, k, "", q.Weights)
+	}
+	models, err := e.storedModels(ctx, ns)
+	if err != nil {
+		return nil, err
+	}
+	served := q.Target.EmbeddingModel
+	if len(models) == 0 || (len(models) == 1 && models[0] == served) {
+		return e.search(ctx, ns, q.Vector, k, "", q.Weights)
+	}
+	var rankings [][]docChunk
+	for _, m := range models {
+		vec := q.Vector
+		if m != served {
+			if vec, err = e.embedQueryWith(ctx, q, m); err != nil {
+				log.Printf("ensemble: embed query with %s failed, skipping its embeddings: %v", m, err)
+				continue
+			}
+			if len(vec) != len(q.Vector) {
+				log.Printf("ensemble: %s embeds with %d dimensions, store uses %d; skipping its embeddings", m, len(vec), len(q.Vector))
+				continue
+			}
+		}
+		docs, err := e.search(ctx, ns, vec, k, m, q.Weights)
+		if err != nil {
+			return nil, err
+		}
+		rankings = append(rankings, docs)
+	}
+	return fuseRankings(rankings, k), nil
+}
+
+// storedModels lists the embedding models present in ns.
+func (e *engine) storedModels(ctx context.Context, ns string) ([]string, error) {
+	rows, err := e.db.QueryContext(ctx, "SELECT DISTINCT COALESCE(model, "+e.placeholder(1)+") FROM embeddings WHERE namespace="+e.placeholder(2), e.models.EmbeddingModel, ns)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var m string
+		if err := rows.Scan(&m); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	sort.Strings(out)
+	return out, rows.Err()
+}
+
+// embedQueryWith embeds q.Text with model, through the chain target that serves
+// model if there is one and otherwise through the target that embedded q.
+func (e *engine) embedQueryWith(ctx context.Context, q queryEmbedding, model string) ([]float32, error) {
+	t := q.Target
+	t.EmbeddingModel = model
+	for _, c := range e.embeddingChain() {
+		if c.EmbeddingModel == model {
+			t = c
+			break
+		}
+	}
+	text := q.Text
+	if e.preprocessEmbeddings {
+		text = normalizeEmbeddingInput(text, e.stripMarkdown)
+	}
+	return e.embedInput(ctx, t, text)
+}
+
+// fuseRankings merges rankings by reciprocal-rank fusion: a chunk scores the sum
+// of 1/(rrfK+rank) over the rankings it appears in. Cosine similarities from
+// different models are not comparable, so only ranks are fused; each chunk keeps
+// its own similarity as Score.
+func fuseRankings(rankings [][]docChunk, k int) []docChunk {
+	type key struct {
+		id      int64
+		snippet string
+	}
+	fused := map[key]float64{}
+	var order []docChunk
+	for _, docs := range rankings {
+		for rank, d := range docs {
+			kk := key{d.ID, d.Snippet}
+			if _, ok := fused[kk]; !ok {
+				order = append(order, d)
+			}
+			fused[kk] += 1 / float64(rrfK+rank+1)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return fused[key{order[i].ID, order[i].Snippet}] > fused[key{order[j].ID, order[j].Snippet}]
+	})
+	return order[:min(k, len(order))]
+}
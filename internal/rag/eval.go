@@ -0,0 +1,252 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Retrieval evaluation keeps labeled cases, a query and the document URLs that
+// should be retrieved for it, per namespace, and scores the current index against
+// them: RunEval retrieves each query exactly as chat would and reports recall@k,
+// MRR and the hit rate. Reports are plain JSON so CI can compare them across
+// chunking, embedding or reranking changes.
+
+// ErrEvalCaseNotFound is returned by DeleteEvalCase for an unknown id.
+var ErrEvalCaseNotFound = errors.New("eval case not found")
+
+// ErrNoEvalCases is returned by RunEval for a namespace without cases.
+var ErrNoEvalCases = errors.New("no eval cases")
+
+// EvalCase is a query and the documents relevant to it. A relevant URL without a
+// fragment also matches the sections of its page.
+type EvalCase struct {
+	ID           int64     `json:"id"`
+	Namespace    string    `json:"namespace"`
+	Query        string    `json:"query"`
+	RelevantURLs []string  `json:"relevant_urls"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// EvalReport is the outcome of RunEval. RecallAtK, MRR and HitRate average the
+// per-case results.
+type EvalReport struct {
+	Namespace      string       `json:"namespace"`
+	K              int          `json:"k"`
+	EmbeddingModel string       `json:"embedding_model"`
+	Cases          int          `json:"cases"`
+	RecallAtK      float64      `json:"recall_at_k"`
+	MRR            float64      `json:"mrr"`
+	HitRate        float64      `json:"hit_rate"`
+	Results        []EvalResult `json:"results"`
+	DurationMS     int64        `json:"duration_ms"`
+}
+
+// EvalResult scores one case. FirstRelevantRank is the 1-based rank of the first
+// relevant document among the retrieved ones, zero when none was retrieved.
+type EvalResult struct {
+	ID                int64    `json:"id"`
+	Query             string   `json:"query"`
+	Recall            float64  `json:"recall"`
+	ReciprocalRank    float64  `json:"reciprocal_rank"`
+	FirstRelevantRank int      `json:"first_relevant_rank"`
+	Retrieved         []string `json:"retrieved"`
+	Missing           []string `json:"missing"`
+}
+
+func initEvalCases(db *sql.DB, backend string) error {
+	id := "id INTEGER PRIMARY KEY AUTOINCREMENT"
+	if backend == "postgres" {
+		id = "id BIGSERIAL PRIMARY KEY"
+	}
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS eval_cases (
+	` + id + `,
+	namespace TEXT NOT NULL,
+	query TEXT NOT NULL,
+	relevant_urls TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+`)
+	return err
+}
+
+// AddEvalCase stores a labeled query of a namespace.
+func (e *engine) AddEvalCase(ctx context.Context, namespace, query string, relevantURLs []string) (EvalCase, error) {
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return EvalCase{}, err
+	}
+	c := EvalCase{Namespace: ns, Query: strings.TrimSpace(query), RelevantURLs: []string{}, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	for _, u := range relevantURLs {
+		if u = strings.TrimSpace(u); u != "" {
+			c.RelevantURLs = append(c.RelevantURLs, u)
+		}
+	}
+	if c.Query == "" || len(c.RelevantURLs) == 0 {
+		return EvalCase{}, errors.New("query and relevant_urls are required")
+	}
+	urls, _ := json.Marshal(c.RelevantURLs)
+	created := c.CreatedAt.Format(time.RFC3339)
+	if e.backend == "postgres" {
+		err = e.db.QueryRowContext(ctx, "INSERT INTO eval_cases(namespace, query, relevant_urls, created_at) VALUES($1,$2,$3,$4) RETURNING id",
+			ns, c.Query, string(urls), created).Scan(&c.ID)
+		return c, err
+	}
+	unlock := e.lockWrites()
+	defer unlock()
+	res, err := e.db.ExecContext(ctx, "INSERT INTO eval_cases(namespace, query, relevant_urls, created_at) VALUES(?,?,?,?)",
+		ns, c.Query, string(urls), created)
+	if err != nil {
+		return c, err
+	}
+	c.ID, err = res.LastInsertId()
+	return c, err
+}
+
+// EvalCases lists the labeled queries of a namespace, oldest first.
+func (e *engine) EvalCases(ctx context.Context, namespace string) ([]EvalCase, error) {
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := e.db.QueryContext(ctx, "SELECT id, namespace, query, relevant_urls, created_at FROM eval_cases WHERE namespace="+e.placeholder(1)+" ORDER BY id", ns)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []EvalCase{}
+	for rows.Next() {
+		var c EvalCase
+		var urls, created string
+		if err := rows.Scan(&c.ID, &c.Namespace, &c.Query, &urls, &created); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(urls), &c.RelevantURLs); err != nil {
+			return nil, fmt.Errorf("eval case %d: %w", c.ID, err)
+		}
+		c.CreatedAt, _ = time.Parse(time.RFC3339, created)
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// DeleteEvalCase removes one labeled query of a namespace.
+func (e *engine) DeleteEvalCase(ctx context.Context, namespace string, id int64) error {
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	if e.backend != "postgres" {
+		unlock := e.lockWrites()
+		defer unlock()
+	}
+	res, err := e.db.ExecContext(ctx, "DELETE FROM eval_cases WHERE namespace="+e.placeholder(1)+" AND id="+e.placeholder(2), ns, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %d", ErrEvalCaseNotFound, id)
+	}
+	return nil
+}
+
+// RunEval retrieves k chunks for every case of a namespace, with the configured
+// candidate pool, MMR and title matching, and scores the documents they come
+// from. A failing query fails the run, so a report always covers every case.
+func (e *engine) RunEval(ctx context.Context, namespace string, k int) (EvalReport, error) {
+	start := time.Now()
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return EvalReport{}, err
+	}
+	if k < 1 || k > maxAnswerChunks {
+		return EvalReport{}, fmt.Errorf("%w: k must be between 1 and %d", ErrInvalidChunkCount, maxAnswerChunks)
+	}
+	cases, err := e.EvalCases(ctx, ns)
+	if err != nil {
+		return EvalReport{}, err
+	}
+	if len(cases) == 0 {
+		return EvalReport{}, fmt.Errorf("%w in namespace %s", ErrNoEvalCases, ns)
+	}
+	rep := EvalReport{Namespace: ns, K: k, Cases: len(cases), Results: make([]EvalResult, 0, len(cases))}
+	for _, c := range cases {
+		vec, t, err := e.embedServed(ctx, e.embeddingChain(), c.Query)
+		if err != nil {
+			return rep, fmt.Errorf("eval case %d: %w", c.ID, err)
+		}
+		rep.EmbeddingModel = t.EmbeddingModel
+		docs, err := e.retrieve(ctx, ns, queryEmbedding{Text: c.Query, Vector: vec, Target: t}, e.candidateChunks, k)
+		if err != nil {
+			return rep, fmt.Errorf("eval case %d: %w", c.ID, err)
+		}
+		r := scoreEvalCase(c, docs)
+		rep.RecallAtK += r.Recall
+		rep.MRR += r.ReciprocalRank
+		if r.FirstRelevantRank > 0 {
+			rep.HitRate++
+		}
+		rep.Results = append(rep.Results, r)
+	}
+	n := float64(len(cases))
+	rep.RecallAtK, rep.MRR, rep.HitRate = rep.RecallAtK/n, rep.MRR/n, rep.HitRate/n
+	rep.DurationMS = time.Since(start).Milliseconds()
+	return rep, nil
+}
+
+// scoreEvalCase ranks the distinct documents of docs and scores them against
+// the relevant URLs of c.
+func scoreEvalCase(c EvalCase, docs []docChunk) EvalResult {
+	r := EvalResult{ID: c.ID, Query: c.Query, Retrieved: []string{}, Missing: []string{}}
+	seen := map[string]bool{}
+	for _, d := range docs {
+		if !seen[d.URL] {
+			seen[d.URL] = true
+			r.Retrieved = append(r.Retrieved, d.URL)
+		}
+	}
+	found := 0
+	for _, rel := range c.RelevantURLs {
+		rank := 0
+		for i, u := range r.Retrieved {
+			if evalURLMatches(rel, u) {
+				rank = i + 1
+				break
+			}
+		}
+		if rank == 0 {
+			r.Missing = append(r.Missing, rel)
+			continue
+		}
+		found++
+		if r.FirstRelevantRank == 0 || rank < r.FirstRelevantRank {
+			r.FirstRelevantRank = rank
+		}
+	}
+	r.Recall = float64(found) / float64(len(c.RelevantURLs))
+	if r.FirstRelevantRank > 0 {
+		r.ReciprocalRank = 1 / float64(r.FirstRelevantRank)
+	}
+	return r
+}
+
+// evalURLMatches reports whether the retrieved URL is the relevant one, ignoring
+// a trailing slash, or a section of it when relevant has no fragment.
+func evalURLMatches(relevant, retrieved string) bool {
+	rel, err1 := url.Parse(relevant)
+	got, err2 := url.Parse(retrieved)
+	if err1 != nil || err2 != nil {
+		return relevant == retrieved
+	}
+	if rel.Fragment == "" {
+		got.Fragment = ""
+	}
+	rel.Path, got.Path = strings.TrimSuffix(rel.Path, "/"), strings.TrimSuffix(got.Path, "/")
+	return rel.String() == got.String()
+}
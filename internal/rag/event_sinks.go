@@ -0,0 +1,57 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// The built-in "webhook" sink POSTs each event as JSON to EVENTS_URL and needs a
+// 2xx reply; EVENTS_TOPIC is sent as the X-Event-Topic header. Brokers such as
+// NATS, Redis Streams or Kafka plug in with RegisterEventSink, using their
+// official client libraries.
+
+type webhookSink struct {
+	url    string
+	topic  string
+	client *http.Client
+}
+
+func newWebhookSink(rawURL, topic string) (EventSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, errors.New("EVENTS_URL must be an http or https URL")
+	}
+	return &webhookSink{url: rawURL, topic: topic, client: newHTTPClient(eventPublishTimeout)}, nil
+}
+
+func (s *webhookSink) Publish(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Topic", s.topic)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *webhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,40 @@
+package rag
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookSink(t *testing.T) {
+	var got []byte
+	var topic string
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = io.ReadAll(r.Body)
+		topic = r.Header.Get("X-Event-Topic")
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	sink, err := newWebhookSink(srv.URL, "answers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if err := sink.Publish(context.Background(), []byte(`{"type":"answer"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"type":"answer"}` || topic != "answers" {
+		t.Errorf("received %s with topic %q", got, topic)
+	}
+	status = http.StatusServiceUnavailable
+	if err := sink.Publish(context.Background(), []byte(`{}`)); err == nil {
+		t.Error("503 reply accepted")
+	}
+	if _, err := newWebhookSink("nats://localhost:4222", "answers"); err == nil {
+		t.Error("non-http URL accepted")
+	}
+}
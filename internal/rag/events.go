@@ -0,0 +1,215 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// With EVENTS_SINK set, every Answer call publishes an AnswerEvent (query,
+// citations, models, token usage and latency) as JSON to a message broker for
+// analytics and audit trails: "webhook" posts it to EVENTS_URL, tagged with
+// EVENTS_TOPIC (default kiali-mcp.answers). Brokers, e.g. NATS or Kafka, plug in
+// with RegisterEventSink.
+// Publishing never delays an answer: events go through a buffer of EVENTS_BUFFER
+// (default 1024) drained by one goroutine, and are dropped when it is full or the
+// broker fails. A broker that fails is retried after eventRetryDelay, without
+// blocking anything; the counts of published, dropped and failed events are in
+// EventStats and /metrics.
+
+// AnswerEvent is published after each Answer call, failed ones included.
+type AnswerEvent struct {
+	Type       string           `json:"type"`
+	Time       time.Time        `json:"time"`
+	Namespace  string           `json:"namespace"`
+	Query      string           `json:"query"`
+	Citations  []EventCitation  `json:"citations"`
+	Models     ModelIdentifiers `json:"models"`
+	Usage      TokenUsage       `json:"usage"`
+	LatencyMS  int64            `json:"latency_ms"`
+	Confidence float64          `json:"confidence"`
+	CuratedID  int64            `json:"faq_id,omitempty"`
+	Degraded   bool             `json:"degraded,omitempty"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// EventCitation is a citation of an AnswerEvent.
+type EventCitation struct {
+	Title string  `json:"title"`
+	URL   string  `json:"url"`
+	Score float64 `json:"score"`
+	Cited bool    `json:"cited"`
+}
+
+// EventSink delivers serialized events to a broker. Publish is only called from
+// one goroutine at a time.
+type EventSink interface {
+	Publish(ctx context.Context, payload []byte) error
+	Close() error
+}
+
+// EventSinkFactory opens a sink for EVENTS_URL and EVENTS_TOPIC. It should not
+// connect yet, so a broker that is down does not stop startup.
+type EventSinkFactory func(url, topic string) (EventSink, error)
+
+var (
+	eventSinksMu sync.Mutex
+	eventSinks   = map[string]EventSinkFactory{
+		"webhook": newWebhookSink,
+	}
+)
+
+// RegisterEventSink makes a sink available as EVENTS_SINK=kind. It must be called
+// before the engine is created.
+func RegisterEventSink(kind string, open EventSinkFactory) {
+	eventSinksMu.Lock()
+	defer eventSinksMu.Unlock()
+	eventSinks[strings.ToLower(kind)] = open
+}
+
+// EventStats counts the events of EVENTS_SINK. Dropped counts events discarded
+// because the buffer was full, Failed those the broker did not accept.
+type EventStats struct {
+	Sink      string `json:"sink,omitempty"`
+	Published int64  `json:"published"`
+	Dropped   int64  `json:"dropped"`
+	Failed    int64  `json:"failed"`
+}
+
+// eventRetryDelay is how long a failed broker is left alone; events arriving
+// meanwhile count as failed.
+const eventRetryDelay = 5 * time.Second
+
+// eventPublishTimeout bounds one delivery, connecting included.
+const eventPublishTimeout = 5 * time.Second
+
+// eventPublisher feeds events to a sink in the background.
+type eventPublisher struct {
+	kind string
+	sink EventSink
+	ch   chan []byte
+
+	published, dropped, failed atomic.Int64
+}
+
+// loadEventPublisher starts the publisher of EVENTS_SINK, nil when unset. Like
+// the crawl filters, an unknown sink is an error.
+func loadEventPublisher() (*eventPublisher, error) {
+	kind := strings.ToLower(strings.TrimSpace(config.Get("EVENTS_SINK", "")))
+	if kind == "" || kind == "off" {
+		return nil, nil
+	}
+	eventSinksMu.Lock()
+	open, ok := eventSinks[kind]
+	kinds := make([]string, 0, len(eventSinks))
+	for k := range eventSinks {
+		kinds = append(kinds, k)
+	}
+	eventSinksMu.Unlock()
+	if !ok {
+		sort.Strings(kinds)
+		return nil, fmt.Errorf("EVENTS_SINK: unknown sink %q, use %s", kind, strings.Join(kinds, ", "))
+	}
+	sink, err := open(config.Get("EVENTS_URL", ""), config.Get("EVENTS_TOPIC", "kiali-mcp.answers"))
+	if err != nil {
+		return nil, fmt.Errorf("EVENTS_SINK %s: %w", kind, err)
+	}
+	p := &eventPublisher{kind: kind, sink: sink, ch: make(chan []byte, max(1, config.GetInt("EVENTS_BUFFER", 1024)))}
+	go p.run()
+	return p, nil
+}
+
+// publish queues an event, dropping it when the buffer is full.
+func (p *eventPublisher) publish(ev any) {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("events: %v", err)
+		return
+	}
+	select {
+	case p.ch <- b:
+	default:
+		p.dropped.Add(1)
+	}
+}
+
+func (p *eventPublisher) run() {
+	var retryAt time.Time
+	down := false
+	for b := range p.ch {
+		if down && time.Now().Before(retryAt) {
+			p.failed.Add(1)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), eventPublishTimeout)
+		err := p.sink.Publish(ctx, b)
+		cancel()
+		if err != nil {
+			p.failed.Add(1)
+			if !down {
+				log.Printf("events: %s sink failing, dropping events until it recovers: %v", p.kind, err)
+			}
+			down, retryAt = true, time.Now().Add(eventRetryDelay)
+			continue
+		}
+		p.published.Add(1)
+		if down {
+			log.Printf("events: %s sink recovered", p.kind)
+			down = false
+		}
+	}
+}
+
+func (p *eventPublisher) stats() EventStats {
+	return EventStats{Sink: p.kind, Published: p.published.Load(), Dropped: p.dropped.Load(), Failed: p.failed.Load()}
+}
+
+// EventStats returns the event counts; zero when EVENTS_SINK is unset.
+func (e *engine) EventStats() EventStats {
+	if e.events == nil {
+		return EventStats{}
+	}
+	return e.events.stats()
+}
+
+// Answer answers query (see joinAnswer) and publishes its AnswerEvent.
+func (e *engine) Answer(ctx context.Context, query string, kialiContext any, opts AnswerOptions) (AnswerResult, error) {
+	if e.events == nil {
+		return e.joinAnswer(ctx, query, kialiContext, opts)
+	}
+	start := time.Now()
+	res, err := e.joinAnswer(ctx, query, kialiContext, opts)
+	ns, nsErr := NormalizeNamespace(opts.Namespace)
+	if nsErr != nil {
+		ns = opts.Namespace
+	}
+	ev := AnswerEvent{
+		Type:       "answer",
+		Time:       start.UTC(),
+		Namespace:  ns,
+		Query:      query,
+		Citations:  make([]EventCitation, 0, len(res.Citations)),
+		Models:     res.Models,
+		Usage:      res.Usage,
+		LatencyMS:  time.Since(start).Milliseconds(),
+		Confidence: res.Confidence,
+		CuratedID:  res.CuratedID,
+		Degraded:   res.Degraded,
+	}
+	for _, c := range res.Citations {
+		ev.Citations = append(ev.Citations, EventCitation{Title: c.Title, URL: c.URL, Score: c.Score, Cited: c.Cited})
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	e.events.publish(ev)
+	return res, err
+}
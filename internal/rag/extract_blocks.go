@@ -0,0 +1,103 @@
+package rag
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// admonitionLabels maps Docsy alert and mkdocs admonition classes to the label
+// used when the callout has no heading of its own.
+var admonitionLabels = []struct {
+	class string
+	label string
+}{
+	{"alert-warning", "Warning"},
+	{"alert-danger", "Danger"},
+	{"alert-success", "Tip"},
+	{"alert-info", "Note"},
+	{"alert-primary", "Note"},
+	{"warning", "Warning"},
+	{"danger", "Danger"},
+	{"caution", "Caution"},
+	{"important", "Important"},
+	{"tip", "Tip"},
+	{"note", "Note"},
+}
+
+// blockText returns the text of a section-level element worth indexing: paragraphs,
+// definition lists as "term: definition" lines, and admonition callouts prefixed
+// with their type, e.g. "Warning: ...". Other elements yield "".
+func blockText(sel *goquery.Selection) string {
+	switch goquery.NodeName(sel) {
+	case "p":
+		return strings.TrimSpace(sel.Text())
+	case "dl":
+		return definitionListText(sel)
+	case "div":
+		if label, ok := admonitionLabel(sel); ok {
+			return admonitionText(sel, label)
+		}
+	}
+	return ""
+}
+
+func definitionListText(dl *goquery.Selection) string {
+	var lines []string
+	dl.ChildrenFiltered("dt").Each(func(_ int, dt *goquery.Selection) {
+		term := collapseSpaces(dt.Text())
+		var defs []string
+		for dd := dt.Next(); dd.Length() > 0 && goquery.NodeName(dd) == "dd"; dd = dd.Next() {
+			if d := collapseSpaces(dd.Text()); d != "" {
+				defs = append(defs, d)
+			}
+		}
+		if term == "" || len(defs) == 0 {
+			return
+		}
+		lines = append(lines, term+": "+strings.Join(defs, "; "))
+	})
+	return strings.Join(lines, "\n")
+}
+
+func admonitionLabel(div *goquery.Selection) (string, bool) {
+	class, _ := div.Attr("class")
+	classes := strings.Fields(class)
+	isCallout := false
+	for _, c := range classes {
+		if c == "alert" || c == "admonition" || c == "pageinfo" {
+			isCallout = true
+		}
+	}
+	if !isCallout {
+		return "", false
+	}
+	for _, l := range admonitionLabels {
+		for _, c := range classes {
+			if c == l.class {
+				return l.label, true
+			}
+		}
+	}
+	return "Note", true
+}
+
+// admonitionText prefers the callout's own title (Docsy .alert-heading, mkdocs
+// .admonition-title) as the label and keeps it out of the body.
+func admonitionText(div *goquery.Selection, label string) string {
+	title := div.Find(".alert-heading, .admonition-title").First()
+	if t := collapseSpaces(title.Text()); t != "" {
+		label = strings.TrimSuffix(t, ":")
+	}
+	body := div.Clone()
+	body.Find(".alert-heading, .admonition-title").Remove()
+	text := collapseSpaces(body.Text())
+	if text == "" {
+		return ""
+	}
+	return label + ": " + text
+}
+
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
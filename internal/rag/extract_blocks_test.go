@@ -0,0 +1,127 @@
+package rag
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestBlockText(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "paragraph",
+			html: `<p>  The graph   shows traffic. </p>`,
+			want: "The graph   shows traffic.",
+		},
+		{
+			name: "definition list",
+			html: `<dl><dt>auth.strategy</dt><dd>How users log in.</dd><dt>server.port</dt><dd>Listen port.</dd></dl>`,
+			want: "auth.strategy: How users log in.\nserver.port: Listen port.",
+		},
+		{
+			name: "term with several definitions",
+			html: `<dl><dt>replicas</dt><dd>Server pods.</dd><dd>Defaults to 1.</dd></dl>`,
+			want: "replicas: Server pods.; Defaults to 1.",
+		},
+		{
+			name: "term without definition is dropped",
+			html: `<dl><dt>orphan</dt><dt>kept</dt><dd>yes</dd></dl>`,
+			want: "kept: yes",
+		},
+		{
+			name: "docsy alert uses its type",
+			html: `<div class="alert alert-warning">Back up the CR.</div>`,
+			want: "Warning: Back up the CR.",
+		},
+		{
+			name: "docsy alert heading replaces the type",
+			html: `<div class="alert alert-danger"><h4 class="alert-heading">Data loss:</h4> Deletes all.</div>`,
+			want: "Data loss: Deletes all.",
+		},
+		{
+			name: "mkdocs admonition title",
+			html: `<div class="admonition note"><p class="admonition-title">Remember</p><p>Restart pods.</p></div>`,
+			want: "Remember: Restart pods.",
+		},
+		{
+			name: "callout without type is a note",
+			html: `<div class="pageinfo">Applies to 2.x.</div>`,
+			want: "Note: Applies to 2.x.",
+		},
+		{
+			name: "empty callout",
+			html: `<div class="alert alert-info"><h4 class="alert-heading">Empty</h4></div>`,
+			want: "",
+		},
+		{
+			name: "plain div is skipped",
+			html: `<div class="highlight"><pre>kubectl get pods</pre></div>`,
+			want: "",
+		},
+		{
+			name: "list is skipped",
+			html: `<ul><li>item</li></ul>`,
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader("<body>" + tt.html + "</body>"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := blockText(doc.Find("body").Children().First()); got != tt.want {
+				t.Errorf("blockText(%s) = %q, want %q", tt.html, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractKialiSectionsReferenceFixture(t *testing.T) {
+	f, err := os.Open("testdata/kiali_reference.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	doc, err := goquery.NewDocumentFromReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := extractKialiSections(doc, "https://kiali.io/docs/configuration/kialis.kiali.io/")
+	want := []extractedSection{
+		{
+			Title:   "Kiali CR Reference",
+			ID:      "kiali-cr-reference",
+			URL:     "https://kiali.io/docs/configuration/kialis.kiali.io/#kiali-cr-reference",
+			Content: "The Kiali custom resource configures the server.\n\nBefore you upgrade: Back up the existing CR.",
+		},
+		{
+			Title: "Deployment",
+			ID:    "deployment",
+			URL:   "https://kiali.io/docs/configuration/kialis.kiali.io/#deployment",
+			Content: "deployment.namespace: Namespace Kiali is installed in.\n" +
+				"deployment.replicas: Number of server pods.; Defaults to 1.\n\n" +
+				"Note: Changes take effect after the operator reconciles.",
+		},
+		{
+			Title:   "Auth",
+			ID:      "auth",
+			URL:     "https://kiali.io/docs/configuration/kialis.kiali.io/#auth",
+			Content: "Tip: Use openid in production.\n\nNote: Strategies are listed below.",
+		},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d sections, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("section %d:\n got %+v\nwant %+v", i, got[i], want[i])
+		}
+	}
+}
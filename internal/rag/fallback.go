@@ -0,0 +1,161 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// llmTarget is a provider together with the models to call on it.
+type llmTarget struct {
+	Provider        string
+	CompletionModel string
+	EmbeddingModel  string
+}
+
+var providerDefaults = map[string]llmTarget{
+	"gemini": {Provider: "gemini", CompletionModel: "gemini-1.5-flash", EmbeddingModel: "text-embedding-004"},
+	"openai": {Provider: "openai", CompletionModel: "gpt-4o-mini", EmbeddingModel: "text-embedding-3-small"},
+	"mock":   {Provider: "mock", CompletionModel: "mock", EmbeddingModel: "mock"},
+}
+
+// loadFallbacks parses LLM_FALLBACK_PROVIDERS, an ordered list of providers to try
+// when the primary fails. Each uses <PROVIDER>_COMPLETION_MODEL and
+// <PROVIDER>_EMBEDDING_MODEL, or the provider defaults.
+func loadFallbacks() []llmTarget {
+	var out []llmTarget
+	seen := map[string]bool{}
+	for _, p := range strings.Split(config.Get("LLM_FALLBACK_PROVIDERS", ""), ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		def, known := providerDefaults[p]
+		if p == "" || seen[p] {
+			continue
+		}
+		if !known {
+			log.Printf("LLM_FALLBACK_PROVIDERS: ignoring unknown provider %q", p)
+			continue
+		}
+		seen[p] = true
+		prefix := strings.ToUpper(p) + "_"
+		out = append(out, llmTarget{
+			Provider:        p,
+			CompletionModel: config.Get(prefix+"COMPLETION_MODEL", def.CompletionModel),
+			EmbeddingModel:  config.Get(prefix+"EMBEDDING_MODEL", def.EmbeddingModel),
+		})
+	}
+	return out
+}
+
+// providerChain returns the primary provider with the engine's models, followed by
+// the fallbacks other than the primary.
+func (e *engine) providerChain() []llmTarget {
+	primary := e.primary
+	chain := []llmTarget{{Provider: primary, CompletionModel: e.models.CompletionModel, EmbeddingModel: e.models.EmbeddingModel}}
+	for _, t := range e.fallbacks {
+		if t.Provider != primary {
+			chain = append(chain, t)
+		}
+	}
+	return chain
+}
+
+// embeddingChain limits fallback for embeddings, which is only safe between models
+// sharing a vector space; it must be enabled with LLM_FALLBACK_EMBEDDINGS.
+func (e *engine) embeddingChain() []llmTarget {
+	chain := e.providerChain()
+	if !config.GetBool("LLM_FALLBACK_EMBEDDINGS", false) {
+		return chain[:1]
+	}
+	return chain
+}
+
+// tryProviders calls fn for each target in turn until one succeeds, and reports
+// which target served the call. Targets whose circuit is open are skipped.
+// Cancellation stops the chain.
+func tryProviders[T any](ctx context.Context, b *breakers, op string, chain []llmTarget, fn func(t llmTarget) (T, error)) (T, llmTarget, error) {
+	var zero T
+	var errs []error
+	for i, t := range chain {
+		err := b.allow(t.Provider)
+		var v T
+		if err == nil {
+			v, err = withRetries(ctx, op+" via "+t.Provider, func() (T, error) { return fn(t) })
+			b.record(ctx, t.Provider, err)
+		}
+		if err == nil {
+			if i > 0 {
+				log.Printf("%s served by fallback provider %s", op, t.Provider)
+			}
+			return v, t, nil
+		}
+		if len(chain) == 1 {
+			return zero, t, err
+		}
+		log.Printf("%s via %s failed: %v", op, t.Provider, err)
+		errs = append(errs, fmt.Errorf("%s: %w", t.Provider, err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return zero, llmTarget{}, errors.Join(errs...)
+}
+
+// checkFallbackDim rejects a fallback embedding whose width differs from EMBEDDING_DIM,
+// since it could not be compared with stored vectors. With EMBEDDING_DIMENSIONS set
+// every embedding is checked, so ingest and queries cannot drift apart.
+func (e *engine) checkFallbackDim(t llmTarget, vec []float32) error {
+	if (t.Provider != e.primary || e.embedDimensions > 0) && len(vec) != e.embeddingDim {
+		return fmt.Errorf("%s embedding has %d dimensions, expected %d", t.Provider, len(vec), e.embeddingDim)
+	}
+	return nil
+}
+
+func (e *engine) embed(ctx context.Context, text string) ([]float32, error) {
+	vec, _, err := e.embedServed(ctx, e.embeddingChain(), text)
+	return vec, err
+}
+
+// embedServed embeds text, falling back along chain, and reports which target served it.
+func (e *engine) embedServed(ctx context.Context, chain []llmTarget, text string) ([]float32, llmTarget, error) {
+	// Queries and chunks go through the same normalization so they share a vector space.
+	if e.preprocessEmbeddings {
+		text = normalizeEmbeddingInput(text, e.stripMarkdown)
+	}
+	return tryProviders(ctx, e.breakers, "embed", chain, func(t llmTarget) ([]float32, error) {
+		vec, err := e.embedInput(ctx, t, text)
+		if err != nil {
+			return nil, err
+		}
+		return vec, e.checkFallbackDim(t, vec)
+	})
+}
+
+// embedBatch embeds several inputs in a single provider request and reports which
+// target served it.
+func (e *engine) embedBatch(ctx context.Context, texts []string) ([][]float32, llmTarget, error) {
+	inputs := make([]string, len(texts))
+	for i, t := range texts {
+		inputs[i] = t
+		if e.preprocessEmbeddings {
+			inputs[i] = normalizeEmbeddingInput(t, e.stripMarkdown)
+		}
+	}
+	return tryProviders(ctx, e.breakers, "embed batch", e.embeddingChain(), func(t llmTarget) ([][]float32, error) {
+		vecs, err := e.embedInputs(ctx, t, inputs)
+		if err != nil || len(vecs) == 0 {
+			return vecs, err
+		}
+		return vecs, e.checkFallbackDim(t, vecs[0])
+	})
+}
+
+// complete generates an answer, falling back along chain, and reports which target served it.
+func (e *engine) complete(ctx context.Context, chain []llmTarget, prompt string, format *ResponseFormat, s sampling) (string, llmTarget, error) {
+	return tryProviders(ctx, e.breakers, "complete", chain, func(t llmTarget) (string, error) {
+		return e.completeVia(ctx, t, prompt, format, s)
+	})
+}
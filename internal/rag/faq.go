@@ -0,0 +1,205 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+	"github.com/pgvector/pgvector-go"
+)
+
+// ErrFAQNotFound is returned by DeleteFAQ for an unknown id.
+var ErrFAQNotFound = errors.New("faq not found")
+
+// FAQ is a curated answer served instead of a generated one when a query's
+// embedding is close enough to Question.
+type FAQ struct {
+	ID        int64     `json:"id"`
+	Namespace string    `json:"namespace"`
+	Question  string    `json:"question"`
+	Answer    string    `json:"answer"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func initFAQs(db *sql.DB, backend string, dim int) error {
+	ddl := `
+CREATE TABLE IF NOT EXISTS faqs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	namespace TEXT NOT NULL,
+	question TEXT NOT NULL,
+	answer TEXT NOT NULL,
+	vector BLOB,
+	created_at TEXT NOT NULL
+);`
+	if backend == "postgres" {
+		ddl = fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS faqs (
+	id BIGSERIAL PRIMARY KEY,
+	namespace TEXT NOT NULL,
+	question TEXT NOT NULL,
+	answer TEXT NOT NULL,
+	vector VECTOR(%d),
+	created_at TEXT NOT NULL
+);`, dim)
+	}
+	if _, err := db.Exec(ddl); err != nil {
+		return err
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_faqs_namespace ON faqs(namespace)"); err != nil {
+		return err
+	}
+	// model records the embedding model of vector, so re-embeds can tell stale FAQs.
+	return ensureColumn(db, backend, "faqs", "model", "TEXT")
+}
+
+// faqThreshold reads FAQ_MATCH_THRESHOLD, the cosine similarity a query needs to
+// be answered from an FAQ (default 0.92). Above 1 no query matches.
+func faqThreshold() float64 {
+	v := strings.TrimSpace(config.Get("FAQ_MATCH_THRESHOLD", ""))
+	if v == "" {
+		return 0.92
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Printf("FAQ_MATCH_THRESHOLD: %v", err)
+		return 0.92
+	}
+	return f
+}
+
+// AddFAQ stores a curated question and answer, embedding the question as a query.
+func (e *engine) AddFAQ(ctx context.Context, namespace, question, answer string) (FAQ, error) {
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return FAQ{}, err
+	}
+	question, answer = strings.TrimSpace(question), strings.TrimSpace(answer)
+	if question == "" || answer == "" {
+		return FAQ{}, errors.New("question and answer are required")
+	}
+	vec, served, err := e.embedServed(ctx, e.embeddingChain(), question)
+	if err != nil {
+		return FAQ{}, err
+	}
+	f := FAQ{Namespace: ns, Question: question, Answer: answer, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	created := f.CreatedAt.Format(time.RFC3339)
+	if e.backend == "postgres" {
+		err = e.db.QueryRowContext(ctx, "INSERT INTO faqs(namespace, question, answer, vector, created_at, model) VALUES($1,$2,$3,$4,$5,$6) RETURNING id",
+			ns, question, answer, pgvector.NewVector(vec), created, served.EmbeddingModel).Scan(&f.ID)
+		return f, err
+	}
+	unlock := e.lockWrites()
+	defer unlock()
+	res, err := e.db.ExecContext(ctx, "INSERT INTO faqs(namespace, question, answer, vector, created_at, model) VALUES(?,?,?,?,?,?)",
+		ns, question, answer, floatsToBlob(vec), created, served.EmbeddingModel)
+	if err != nil {
+		return f, err
+	}
+	f.ID, err = res.LastInsertId()
+	return f, err
+}
+
+// FAQs lists a namespace's curated answers, oldest first.
+func (e *engine) FAQs(ctx context.Context, namespace string) ([]FAQ, error) {
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := e.db.QueryContext(ctx, "SELECT id, namespace, question, answer, created_at FROM faqs WHERE namespace="+e.placeholder(1)+" ORDER BY id", ns)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []FAQ{}
+	for rows.Next() {
+		var f FAQ
+		var created string
+		if err := rows.Scan(&f.ID, &f.Namespace, &f.Question, &f.Answer, &created); err != nil {
+			return nil, err
+		}
+		f.CreatedAt, _ = time.Parse(time.RFC3339, created)
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// DeleteFAQ removes one curated answer of a namespace.
+func (e *engine) DeleteFAQ(ctx context.Context, namespace string, id int64) error {
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	if e.backend != "postgres" {
+		unlock := e.lockWrites()
+		defer unlock()
+	}
+	res, err := e.db.ExecContext(ctx, "DELETE FROM faqs WHERE namespace="+e.placeholder(1)+" AND id="+e.placeholder(2), ns, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %d", ErrFAQNotFound, id)
+	}
+	return nil
+}
+
+// matchFAQ returns the namespace's FAQ most similar to the query embedding and
+// its similarity, or nil when there are none.
+func (e *engine) matchFAQ(ctx context.Context, ns string, queryVec []float32) (*FAQ, float64, error) {
+	if e.backend == "postgres" {
+		var f FAQ
+		var score float64
+		err := e.db.QueryRowContext(ctx, "SELECT id, question, answer, 1 - (vector <=> $2) AS score FROM faqs WHERE namespace=$1 ORDER BY vector <=> $2 LIMIT 1",
+			ns, pgvector.NewVector(queryVec)).Scan(&f.ID, &f.Question, &f.Answer, &score)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, 0, nil
+		}
+		f.Namespace = ns
+		return &f, score, err
+	}
+	rows, err := e.db.QueryContext(ctx, "SELECT id, question, answer, vector FROM faqs WHERE namespace=?", ns)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var best *FAQ
+	bestScore := math.Inf(-1)
+	for rows.Next() {
+		var f FAQ
+		var blob []byte
+		if err := rows.Scan(&f.ID, &f.Question, &f.Answer, &blob); err != nil {
+			return nil, 0, err
+		}
+		vec := blobToFloats(blob)
+		if len(vec) != len(queryVec) {
+			continue
+		}
+		if s := cosine(vec, queryVec); s > bestScore {
+			f.Namespace = ns
+			best, bestScore = &f, s
+		}
+	}
+	return best, bestScore, rows.Err()
+}
+
+// curatedAnswer answers from an FAQ when one matches the query closely enough.
+// Lookup errors are logged and fall through to generation.
+func (e *engine) curatedAnswer(ctx context.Context, ns string, queryVec []float32) (*FAQ, float64, bool) {
+	f, score, err := e.matchFAQ(ctx, ns, queryVec)
+	if err != nil {
+		log.Printf("faq lookup failed: %v", err)
+		return nil, 0, false
+	}
+	if f == nil || score < faqThreshold() {
+		return nil, 0, false
+	}
+	log.Printf("answered from faq %d (similarity %.3f)", f.ID, score)
+	return f, score, true
+}
@@ -0,0 +1,120 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// Documents record when they were stored (ingested_at) and when their content
+// last changed (content_updated_at): a document stored with the content hash of
+// a copy at the same URL keeps that copy's time, so re-crawls, re-embedding and
+// re-extraction of unchanged text do not make it look new. With
+// FRESHNESS_HALF_LIFE_DAYS set (default 0: off, for time-insensitive corpora)
+// search scales each chunk's rank by a freshness factor that halves with every
+// half-life of content age:
+//
+//	rank × (1 − w + w × 0.5^(age / half-life))
+//
+// FRESHNESS_WEIGHT w (default 0.2) caps the penalty, so newer documents win
+// between chunks of similar relevance instead of outranking better matches; 1
+// applies the plain decay. Documents stored before content_updated_at existed
+// age from ingested_at, and those stored before that are not decayed until they
+// are ingested again. On Postgres the decay
+// reorders a pool of rescorePool times the requested chunks.
+
+// rescorePool widens the Postgres search so summary boosts, freshness decay and
+// source weights can promote chunks below the top k by raw similarity.
+const rescorePool = 4
+
+type freshness struct {
+	halfLife time.Duration
+	weight   float64
+}
+
+func loadFreshness() freshness {
+	f := freshness{weight: 0.2}
+	days := config.Get("FRESHNESS_HALF_LIFE_DAYS", "")
+	if days == "" {
+		return f
+	}
+	d, err := strconv.ParseFloat(strings.TrimSpace(days), 64)
+	if err != nil || d < 0 {
+		log.Printf("FRESHNESS_HALF_LIFE_DAYS: invalid value %q, freshness decay disabled", days)
+		return f
+	}
+	f.halfLife = time.Duration(d * float64(24*time.Hour))
+	if v := config.Get("FRESHNESS_WEIGHT", ""); v != "" {
+		w, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || w <= 0 || w > 1 {
+			log.Printf("FRESHNESS_WEIGHT: want a number in (0,1], got %q; using %.1f", v, f.weight)
+		} else {
+			f.weight = w
+		}
+	}
+	return f
+}
+
+func (f freshness) enabled() bool { return f.halfLife > 0 }
+
+// factor returns the score multiplier of a document whose content changed at
+// updatedAt, 1 when decay is off or the time is unknown.
+func (f freshness) factor(updatedAt sql.NullString, now time.Time) float64 {
+	if !f.enabled() || !updatedAt.Valid {
+		return 1
+	}
+	t, err := time.Parse(time.RFC3339, updatedAt.String)
+	if err != nil {
+		return 1
+	}
+	age := max(0, now.Sub(t))
+	return 1 - f.weight + f.weight*math.Pow(0.5, float64(age)/float64(f.halfLife))
+}
+
+// ingestTimestamp is the ingested_at of a document stored now.
+func ingestTimestamp() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// contentUpdatedAt is the content_updated_at of a document of ns stored now at
+// docURL with content hash: that of a stored copy with the same content, or now.
+func (e *engine) contentUpdatedAt(ctx context.Context, ns, docURL, hash string) string {
+	var at string
+	err := e.db.QueryRowContext(ctx, "SELECT content_updated_at FROM documents WHERE namespace="+e.placeholder(1)+" AND url="+e.placeholder(2)+" AND content_hash="+e.placeholder(3)+" AND content_updated_at IS NOT NULL ORDER BY id LIMIT 1", ns, docURL, hash).Scan(&at)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("content_updated_at of %s: %v", docURL, err)
+		}
+		return ingestTimestamp()
+	}
+	return at
+}
+
+// keepContentUpdatedAt gives document id the latest content_updated_at of the
+// documents it was merged from, since merging changes no text.
+func (e *engine) keepContentUpdatedAt(ctx context.Context, id int64, from []int64) error {
+	args := []any{id}
+	marks := make([]string, len(from))
+	for i, f := range from {
+		args = append(args, f)
+		marks[i] = e.placeholder(len(args))
+	}
+	stmt := "UPDATE documents SET content_updated_at=(SELECT MAX(COALESCE(content_updated_at, ingested_at)) FROM documents WHERE id IN (" + strings.Join(marks, ", ") + ")) WHERE id=" + e.placeholder(1)
+	if e.backend == "postgres" {
+		_, err := e.db.ExecContext(ctx, stmt, args...)
+		return err
+	}
+	unlock := e.lockWrites()
+	defer unlock()
+	_, err := withBusyRetries(ctx, "keep content_updated_at", func() (sql.Result, error) {
+		return e.db.ExecContext(ctx, stmt, args...)
+	})
+	return err
+}
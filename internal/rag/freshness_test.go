@@ -0,0 +1,44 @@
+package rag
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContentUpdatedAtFollowsContent(t *testing.T) {
+	e := NewMockEngine().(*engine)
+	ctx := context.Background()
+	const u = "https://kiali.io/docs/graph/"
+	first, err := e.storeDocument(ctx, DefaultNamespace, "Graph", u, "The graph shows mesh traffic.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const old = "2024-01-01T00:00:00Z"
+	if _, err := e.db.Exec("UPDATE documents SET content_updated_at=? WHERE id=?", old, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	updatedAt := func(id int64) string {
+		t.Helper()
+		var at string
+		if err := e.db.QueryRow("SELECT content_updated_at FROM documents WHERE id=?", id).Scan(&at); err != nil {
+			t.Fatal(err)
+		}
+		return at
+	}
+
+	// A restored copy, as re-embedding stores it, keeps the time of the content.
+	same, err := e.storeDocument(ctx, DefaultNamespace, "Graph", u, "The graph shows mesh traffic.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := updatedAt(same.ID); got != old {
+		t.Errorf("unchanged content updated at %s, want %s", got, old)
+	}
+	changed, err := e.storeDocument(ctx, DefaultNamespace, "Graph", u, "The graph shows mesh traffic and health.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := updatedAt(changed.ID); got == old {
+		t.Error("changed content kept the old time")
+	}
+}
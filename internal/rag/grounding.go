@@ -0,0 +1,196 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// GROUNDING_CHECK verifies generated answers against the chunks they were given.
+// The answer is split into statements (sentences outside code blocks and
+// headings), and one more completion asks the model which of them the sources do
+// not support. flag reports them with the answer, remove also deletes them from
+// the answer text. Either way the answer carries a grounding score, the share of
+// supported statements. The check costs a completion per answer, so it is off by
+// default; it skips curated and structured answers and answers without sources,
+// and a failed check leaves the answer unchecked rather than failing it.
+
+// Grounding check modes.
+const (
+	groundingOff    = "off"
+	groundingFlag   = "flag"
+	groundingRemove = "remove"
+)
+
+// Grounding is the result of the grounding check. Score in [0,1] is the share of
+// the answer's statements supported by its sources; Unsupported lists the others
+// as they appeared in the answer. Removed is set when they were deleted from it.
+type Grounding struct {
+	Score       float64  `json:"score"`
+	Unsupported []string `json:"unsupported,omitempty"`
+	Removed     bool     `json:"removed,omitempty"`
+}
+
+// loadGroundingMode reads GROUNDING_CHECK; like CRAWL_STRATEGY, an unknown mode is
+// an error.
+func loadGroundingMode() (string, error) {
+	mode := strings.ToLower(strings.TrimSpace(config.Get("GROUNDING_CHECK", groundingOff)))
+	switch mode {
+	case "", groundingOff:
+		return groundingOff, nil
+	case groundingFlag, groundingRemove:
+		return mode, nil
+	}
+	return "", fmt.Errorf("GROUNDING_CHECK: unknown mode %q, use off, flag or remove", mode)
+}
+
+const groundingInstruction = `You check whether an answer is supported by its sources. For each numbered statement, decide whether the sources state or directly imply it. Statements that make no factual claim, such as saying the sources do not cover something or suggesting where to look, count as supported.`
+
+var groundingSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"unsupported": map[string]any{"type": "array", "items": map[string]any{"type": "integer"}},
+	},
+	"required":             []any{"unsupported"},
+	"additionalProperties": false,
+}
+
+// removedAnswer replaces an answer whose statements were all removed.
+const removedAnswer = "The available sources do not support an answer to this question."
+
+// checkGrounding runs the grounding check on answer and returns it, with the
+// unsupported statements removed in remove mode. The result is nil when the
+// check is off, skipped or failed.
+func (e *engine) checkGrounding(ctx context.Context, chain []llmTarget, answer string, docs []docChunk) (string, *Grounding) {
+	if e.groundingMode == groundingOff || len(docs) == 0 {
+		return answer, nil
+	}
+	statements := answerStatements(answer)
+	if len(statements) == 0 {
+		return answer, nil
+	}
+	var b strings.Builder
+	b.WriteString(groundingInstruction + "\n\nSources:\n")
+	for i, d := range docs {
+		fmt.Fprintf(&b, "[%d] %s\n%s\n\n", i+1, d.Title, d.Snippet)
+	}
+	b.WriteString("Statements:\n")
+	for i, s := range statements {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, s)
+	}
+	b.WriteString("\nReply with the numbers of the unsupported statements.")
+	schema, _ := json.Marshal(groundingSchema)
+	format := &ResponseFormat{Name: "grounding", Schema: schema}
+	text, _, err := e.complete(ctx, chain, b.String(), format, sampling{})
+	if err == nil {
+		var v any
+		if v, err = decodeStructured(text, groundingSchema); err == nil {
+			return applyGrounding(answer, statements, v, e.groundingMode == groundingRemove)
+		}
+	}
+	log.Printf("grounding check failed, answer left unchecked: %v", err)
+	return answer, nil
+}
+
+// applyGrounding scores the verdict v of the check and removes the unsupported
+// statements from answer when remove is set.
+func applyGrounding(answer string, statements []string, v any, remove bool) (string, *Grounding) {
+	bad := map[int]bool{}
+	if m, ok := v.(map[string]any); ok {
+		list, _ := m["unsupported"].([]any)
+		for _, n := range list {
+			if f, ok := n.(float64); ok && f >= 1 && int(f) <= len(statements) {
+				bad[int(f)-1] = true
+			}
+		}
+	}
+	g := &Grounding{Score: math.Round(float64(len(statements)-len(bad))/float64(len(statements))*100) / 100}
+	for i, s := range statements {
+		if bad[i] {
+			g.Unsupported = append(g.Unsupported, s)
+		}
+	}
+	if !remove || len(bad) == 0 {
+		return answer, g
+	}
+	for _, s := range g.Unsupported {
+		answer = strings.Replace(answer, s, "", 1)
+	}
+	g.Removed = true
+	return tidyAnswer(answer), g
+}
+
+var (
+	// sentenceEnd matches the end of a sentence followed by whitespace.
+	sentenceEnd = regexp.MustCompile(`[.!?](?:\[\d+\])*\s+`)
+	// emptyItem matches a list item or quote line left without text.
+	emptyItem   = regexp.MustCompile(`^[ \t]*(?:[-*+]|\d+[.)]|>)[ \t]*$`)
+	innerSpaces = regexp.MustCompile(`(\S)[ \t]{2,}`)
+)
+
+// answerStatements splits an answer into its sentences, skipping code blocks,
+// headings and list markers. Each statement is a verbatim substring of answer.
+func answerStatements(answer string) []string {
+	var out []string
+	inFence := false
+	for _, line := range strings.Split(answer, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence || trimmed == "" || mdHeadingTag.MatchString(trimmed) {
+			continue
+		}
+		trimmed = mdUnordered.ReplaceAllString(trimmed, "")
+		trimmed = mdOrdered.ReplaceAllString(trimmed, "")
+		trimmed = strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))
+		start := 0
+		for _, m := range sentenceEnd.FindAllStringIndex(trimmed, -1) {
+			out = appendStatement(out, trimmed[start:m[1]])
+			start = m[1]
+		}
+		out = appendStatement(out, trimmed[start:])
+	}
+	return out
+}
+
+func appendStatement(out []string, s string) []string {
+	s = strings.TrimSpace(s)
+	// Fragments without a word, e.g. a lone citation marker, are not statements.
+	if strings.IndexFunc(s, func(r rune) bool { return r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' }) < 0 {
+		return out
+	}
+	return append(out, s)
+}
+
+// tidyAnswer drops the list items and spaces removed statements leave behind,
+// outside code blocks.
+func tidyAnswer(answer string) string {
+	var lines []string
+	inFence := false
+	for _, line := range strings.Split(answer, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+		if !inFence {
+			if emptyItem.MatchString(line) {
+				continue
+			}
+			line = strings.TrimRight(innerSpaces.ReplaceAllString(line, "$1 "), " \t")
+		}
+		lines = append(lines, line)
+	}
+	answer = strings.TrimSpace(blankRuns.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+	if answer == "" {
+		return removedAnswer
+	}
+	return answer
+}
@@ -0,0 +1,114 @@
+package rag
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+)
+
+// With KEYWORD_FALLBACK (default false) an answer whose query cannot be embedded,
+// because every embedding provider failed or none is configured, retrieves its
+// chunks by keyword match against the stored documents instead of failing, and is
+// flagged degraded. Documents are scored by the share of the query's terms they
+// contain, then by how often those appear, titles counting double; the best
+// chunk of each of the top documents goes into the prompt. Curated FAQ answers
+// need the query embedding and are skipped. With CHUNK_KEYWORDS only the
+// documents whose chunk keywords hold a query term are read, through the
+// chunk_keywords index; otherwise, or when none does, every document of the
+// namespace is scanned, so this is meant to bridge provider outages, not as a
+// retrieval mode.
+
+// keywordSearch returns the k documents of ns that best match the terms of query,
+// each represented by its chunk with the most matches.
+func (e *engine) keywordSearch(ctx context.Context, ns, query string, k int) ([]docChunk, error) {
+	kw := &keywordExtractor{stopwords: loadStopwords()}
+	terms := map[string]bool{}
+	for _, t := range kw.terms(query) {
+		terms[t] = true
+	}
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	cond, args := "namespace="+e.placeholder(1), []any{ns}
+	if c, a, ok, err := e.keywordIndexFilter(ctx, ns, terms); err != nil {
+		return nil, err
+	} else if ok {
+		cond, args = c, a
+	}
+	rows, err := e.db.QueryContext(ctx, "SELECT id, title, url, content FROM documents WHERE "+cond, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	type scored struct {
+		doc     docChunk
+		content string
+		weight  float64
+	}
+	var found []scored
+	for rows.Next() {
+		var d docChunk
+		var stored string
+		if err := rows.Scan(&d.ID, &d.Title, &d.URL, &stored); err != nil {
+			return nil, err
+		}
+		content, err := decodeContent(stored)
+		if err != nil {
+			log.Printf("keyword search: document %d: %v", d.ID, err)
+			continue
+		}
+		tf := termCounts(kw, content, terms)
+		for t, n := range termCounts(kw, d.Title, terms) {
+			tf[t] += 2 * n
+		}
+		if len(tf) == 0 {
+			continue
+		}
+		weight := 0.0
+		for _, n := range tf {
+			weight += math.Log1p(float64(n))
+		}
+		d.Score = float64(len(tf)) / float64(len(terms))
+		d.Rank = d.Score
+		found = append(found, scored{d, content, weight})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].doc.Score != found[j].doc.Score {
+			return found[i].doc.Score > found[j].doc.Score
+		}
+		return found[i].weight > found[j].weight
+	})
+	found = found[:min(k, len(found))]
+	out := make([]docChunk, 0, len(found))
+	for _, f := range found {
+		best, bestHits := "", -1
+		for _, ch := range e.splitDocument(f.doc.URL, f.content, 800) {
+			hits := 0
+			for _, n := range termCounts(kw, ch, terms) {
+				hits += n
+			}
+			if hits > bestHits {
+				best, bestHits = ch, hits
+			}
+		}
+		f.doc.Snippet = best[:min(160, len(best))]
+		out = append(out, f.doc)
+	}
+	traceFrom(ctx).retrieved(out, out, mmrDisabled)
+	return out, nil
+}
+
+// termCounts counts the occurrences in text of each of terms it contains.
+func termCounts(kw *keywordExtractor, text string, terms map[string]bool) map[string]int {
+	out := map[string]int{}
+	for _, t := range kw.terms(text) {
+		if terms[t] {
+			out[t]++
+		}
+	}
+	return out
+}
@@ -0,0 +1,194 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// With CHUNK_KEYWORDS (default false) every stored chunk records its salient
+// terms in the embeddings keywords column, space-separated and lowercased, for
+// exact-term matching of Kiali/Istio jargon that embeddings handle poorly. Terms
+// are ranked by TF-IDF over the chunks of their document, so words that run
+// through the whole document rank below those specific to the chunk. Stopwords
+// are dropped: a built-in English list plus CHUNK_STOPWORDS. The chunk_keywords
+// table indexes each document's terms so keywordSearch can look up the documents
+// of a query's terms instead of scanning the namespace.
+
+// defaultStopwords are common English words that never make useful keywords.
+var defaultStopwords = strings.Fields(`
+	a about above after again against all also am an and any are as at be because
+	been before being below between both but by can could did do does doing down
+	during each either else etc every few for from further get gets had has have
+	having he her here hers him his how however i if in into is it its itself just
+	may me might more most must my no nor not now of off on once only or other our
+	ours out over own same see shall she should so some such than that the their
+	theirs them then there these they this those through to too under until up
+	upon us use used uses using very via was we were what when where which while
+	who whom why will with within without would yes yet you your yours
+`)
+
+// keywordExtractor picks the keywords of chunks; nil when CHUNK_KEYWORDS is off.
+type keywordExtractor struct {
+	perChunk  int
+	stopwords map[string]bool
+}
+
+// loadKeywordExtractor reads CHUNK_KEYWORDS, CHUNK_KEYWORDS_PER_CHUNK (default 8)
+// and CHUNK_STOPWORDS, comma-separated words added to the built-in list.
+func loadKeywordExtractor() *keywordExtractor {
+	if !config.GetBool("CHUNK_KEYWORDS", false) {
+		return nil
+	}
+	return &keywordExtractor{
+		perChunk:  max(1, config.GetInt("CHUNK_KEYWORDS_PER_CHUNK", 8)),
+		stopwords: loadStopwords(),
+	}
+}
+
+// loadStopwords returns the built-in stopwords plus CHUNK_STOPWORDS.
+func loadStopwords() map[string]bool {
+	out := map[string]bool{}
+	for _, w := range defaultStopwords {
+		out[w] = true
+	}
+	for _, w := range strings.Split(config.Get("CHUNK_STOPWORDS", ""), ",") {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			out[w] = true
+		}
+	}
+	return out
+}
+
+func initChunkKeywords(db *sql.DB, backend string) error {
+	if err := ensureColumn(db, backend, "embeddings", "keywords", "TEXT"); err != nil {
+		return err
+	}
+	idType := "INTEGER"
+	if backend == "postgres" {
+		idType = "BIGINT"
+	}
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS chunk_keywords (
+	namespace TEXT NOT NULL,
+	keyword TEXT NOT NULL,
+	document_id ` + idType + ` NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_chunk_keywords_ns_keyword ON chunk_keywords(namespace, keyword);
+CREATE INDEX IF NOT EXISTS idx_chunk_keywords_doc ON chunk_keywords(document_id);
+`)
+	return err
+}
+
+// storeKeywords indexes the distinct keywords of a document's chunks within the
+// transaction that stores it.
+func (e *engine) storeKeywords(ctx context.Context, tx *sql.Tx, ns string, id int64, keywords []sql.NullString) error {
+	seen := map[string]bool{}
+	for _, kw := range keywords {
+		for _, t := range strings.Fields(kw.String) {
+			if seen[t] {
+				continue
+			}
+			seen[t] = true
+			if _, err := tx.ExecContext(ctx, "INSERT INTO chunk_keywords(namespace, keyword, document_id) VALUES("+e.placeholders(3)+")", ns, t, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// keywordIndexFilter returns the condition on documents that selects those of ns
+// with any of terms among their chunk keywords, and its arguments. ok is false
+// when none matches, or when keyword extraction is off since documents stored
+// meanwhile would be missing from the index.
+func (e *engine) keywordIndexFilter(ctx context.Context, ns string, terms map[string]bool) (cond string, args []any, ok bool, err error) {
+	if e.keywords == nil || len(terms) == 0 {
+		return "", nil, false, nil
+	}
+	args = []any{ns}
+	marks := make([]string, 0, len(terms))
+	for t := range terms {
+		args = append(args, t)
+		marks = append(marks, e.placeholder(len(args)))
+	}
+	match := "SELECT document_id FROM chunk_keywords WHERE namespace=" + e.placeholder(1) + " AND keyword IN (" + strings.Join(marks, ", ") + ")"
+	var one int
+	switch err := e.db.QueryRowContext(ctx, "SELECT 1 FROM ("+match+") m LIMIT 1", args...).Scan(&one); {
+	case errors.Is(err, sql.ErrNoRows):
+		return "", nil, false, nil
+	case err != nil:
+		return "", nil, false, err
+	}
+	return "id IN (" + match + ")", args, true, nil
+}
+
+// extract returns the keywords column of each of a document's chunks, NULL for
+// all of them when extraction is off.
+func (k *keywordExtractor) extract(chunks []textChunk) []sql.NullString {
+	out := make([]sql.NullString, len(chunks))
+	if k == nil {
+		return out
+	}
+	tfs := make([]map[string]int, len(chunks))
+	df := map[string]int{}
+	for i, ch := range chunks {
+		tfs[i] = map[string]int{}
+		for _, t := range k.terms(ch.Text) {
+			if tfs[i][t] == 0 {
+				df[t]++
+			}
+			tfs[i][t]++
+		}
+	}
+	for i, tf := range tfs {
+		type scored struct {
+			term  string
+			score float64
+		}
+		ranked := make([]scored, 0, len(tf))
+		for t, n := range tf {
+			// Smoothed IDF keeps terms of single-chunk documents above zero.
+			idf := math.Log(1+float64(len(chunks))/float64(df[t])) + 1
+			ranked = append(ranked, scored{t, float64(n) * idf})
+		}
+		sort.Slice(ranked, func(a, b int) bool {
+			if ranked[a].score != ranked[b].score {
+				return ranked[a].score > ranked[b].score
+			}
+			return ranked[a].term < ranked[b].term
+		})
+		terms := make([]string, 0, k.perChunk)
+		for _, r := range ranked[:min(k.perChunk, len(ranked))] {
+			terms = append(terms, r.term)
+		}
+		if len(terms) > 0 {
+			out[i] = sql.NullString{String: strings.Join(terms, " "), Valid: true}
+		}
+	}
+	return out
+}
+
+// terms splits text into lowercased candidate keywords. Hyphens, dots and
+// underscores inside a word are kept, so istio-proxy, v1.22 and max_retries stay
+// whole; stopwords, numbers and words under three characters are dropped.
+func (k *keywordExtractor) terms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '.' && r != '_'
+	})
+	var out []string
+	for _, w := range words {
+		w = strings.Trim(w, "-._")
+		if len([]rune(w)) < 3 || k.stopwords[w] || !strings.ContainsFunc(w, unicode.IsLetter) {
+			continue
+		}
+		out = append(out, w)
+	}
+	return out
+}
@@ -0,0 +1,49 @@
+package rag
+
+import (
+	"context"
+	"testing"
+)
+
+func TestKeywordSearchUsesIndex(t *testing.T) {
+	e := NewMockEngine().(*engine)
+	e.keywords = &keywordExtractor{perChunk: 8, stopwords: loadStopwords()}
+	ctx := context.Background()
+	docs := map[string]string{
+		"https://kiali.io/docs/wizards/": "Wizards write a VirtualService and a DestinationRule for the service.",
+		"https://kiali.io/docs/graph/":   "The graph shows traffic between workloads of the mesh.",
+	}
+	ids := map[string]int64{}
+	for u, content := range docs {
+		out, err := e.storeDocument(ctx, DefaultNamespace, "Docs", u, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[u] = out.ID
+	}
+
+	_, _, ok, err := e.keywordIndexFilter(ctx, DefaultNamespace, map[string]bool{"virtualservice": true})
+	if err != nil || !ok {
+		t.Fatalf("index lookup = %v, %v", ok, err)
+	}
+	found, err := e.keywordSearch(ctx, DefaultNamespace, "Which VirtualService does it write?", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].URL != "https://kiali.io/docs/wizards/" {
+		t.Errorf("keywordSearch = %+v, want the wizards page only", found)
+	}
+
+	// Terms in no document's keywords fall back to the full scan.
+	if _, _, ok, _ := e.keywordIndexFilter(ctx, DefaultNamespace, map[string]bool{"prometheus": true}); ok {
+		t.Error("unknown term matched the index")
+	}
+
+	if err := e.deleteDocuments(ctx, []int64{ids["https://kiali.io/docs/wizards/"]}); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := e.db.QueryRow("SELECT COUNT(*) FROM chunk_keywords WHERE document_id=?", ids["https://kiali.io/docs/wizards/"]).Scan(&n); err != nil || n != 0 {
+		t.Errorf("%d keywords left for a deleted document (%v)", n, err)
+	}
+}
@@ -0,0 +1,213 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// With KIALI_CONTEXT_MAX_TOKENS set (default 0: off), a Kiali context whose JSON
+// is estimated above that many tokens is not put into the prompt whole. It is
+// split along its structure into parts of up to contextPartChars, packing small
+// neighbours together and making at most maxContextParts, each labeled with its
+// JSON path (e.g. elements.nodes[3..6]), the parts are embedded with the
+// query's embedding model, and the ones most similar to the query are kept, in
+// their original order, up to the token limit. The model is told how many parts
+// were left out. When the parts cannot be embedded the whole context goes on to
+// the usual prompt trimming.
+
+// contextPartChars is the target size of one Kiali context part.
+const contextPartChars = 2000
+
+// maxContextParts caps the parts embedded per answer; larger contexts get
+// larger parts (see contextParts).
+const maxContextParts = 256
+
+// contextPart is one piece of a Kiali context.
+type contextPart struct {
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// contextExcerpt replaces a Kiali context in the prompt with its relevant parts.
+type contextExcerpt struct {
+	Note  string        `json:"note"`
+	Parts []contextPart `json:"parts"`
+}
+
+// focusKialiContext returns kialiContext, or an excerpt of the parts relevant to
+// the query when it is over KIALI_CONTEXT_MAX_TOKENS.
+func (e *engine) focusKialiContext(ctx context.Context, queryVec []float32, t llmTarget, kialiContext any) any {
+	limit := config.GetInt("KIALI_CONTEXT_MAX_TOKENS", 0)
+	if limit <= 0 || kialiContext == nil {
+		return kialiContext
+	}
+	raw, err := json.Marshal(kialiContext)
+	if err != nil || estimateTokens(string(raw)) <= limit {
+		return kialiContext
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return kialiContext
+	}
+	// A part takes at most a quarter of the limit, so several fit.
+	parts := contextParts(v, max(min(contextPartChars, limit*charsPerToken/4), len(raw)/maxContextParts))
+	inputs := make([]string, len(parts))
+	for i, p := range parts {
+		inputs[i] = p.Path + ": " + string(p.Value)
+		if e.preprocessEmbeddings {
+			inputs[i] = normalizeEmbeddingInput(inputs[i], e.stripMarkdown)
+		}
+	}
+	vecs := make([][]float32, 0, len(parts))
+	size := max(1, config.GetInt("EMBED_BATCH_SIZE", 32))
+	for start := 0; start < len(inputs); start += size {
+		batch := inputs[start:min(start+size, len(inputs))]
+		got, _, err := tryProviders(ctx, e.breakers, "embed kiali context", []llmTarget{t}, func(t llmTarget) ([][]float32, error) {
+			return e.embedInputs(ctx, t, batch)
+		})
+		if err != nil {
+			log.Printf("kiali context of ~%d tokens not embedded, passing it whole: %v", estimateTokens(string(raw)), err)
+			return kialiContext
+		}
+		vecs = append(vecs, got...)
+	}
+
+	order := make([]int, len(parts))
+	scores := make([]float64, len(parts))
+	for i := range parts {
+		order[i], scores[i] = i, cosine(vecs[i], queryVec)
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	keep := make([]bool, len(parts))
+	kept, used := 0, 0
+	for _, i := range order {
+		cost := estimateTokens(parts[i].Path) + estimateTokens(string(parts[i].Value))
+		if used+cost > limit {
+			continue
+		}
+		keep[i], used = true, used+cost
+		kept++
+	}
+	ex := contextExcerpt{
+		Note:  fmt.Sprintf("Excerpt: the %d of %d parts of the Kiali data most relevant to the question; the others were left out.", kept, len(parts)),
+		Parts: make([]contextPart, 0, kept),
+	}
+	for i, p := range parts {
+		if keep[i] {
+			ex.Parts = append(ex.Parts, p)
+		}
+	}
+	log.Printf("kiali context of ~%d tokens reduced to %d of %d parts (~%d tokens)", estimateTokens(string(raw)), kept, len(parts), used)
+	return ex
+}
+
+// contextParts splits a decoded Kiali context into at most maxContextParts
+// parts, doubling the part size until they fit.
+func contextParts(v any, maxChars int) []contextPart {
+	maxChars = max(1, maxChars)
+	for {
+		parts := splitContext(v, "", maxChars)
+		if len(parts) <= maxContextParts {
+			return parts
+		}
+		maxChars *= 2
+	}
+}
+
+// splitContext splits a decoded JSON value into parts of at most maxChars where
+// its structure allows, descending into objects and arrays that are too large.
+// Adjacent members that fit are packed together: object members into an object
+// labeled with the parent path, array elements into an array labeled with their
+// index range (e.g. nodes[3..6]). Scalars are never split.
+func splitContext(v any, path string, maxChars int) []contextPart {
+	raw, _ := json.Marshal(v)
+	label := path
+	if label == "" {
+		label = "$"
+	}
+	if len(raw) <= maxChars {
+		return []contextPart{{Path: label, Value: raw}}
+	}
+	var members []contextMember
+	switch t := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			members = append(members, contextMember{path: child, key: k, value: t[k]})
+		}
+	case []any:
+		for i, el := range t {
+			members = append(members, contextMember{path: path + "[" + strconv.Itoa(i) + "]", index: i, value: el})
+		}
+	default:
+		return []contextPart{{Path: label, Value: raw}}
+	}
+	_, object := v.(map[string]any)
+	var out []contextPart
+	var pack []contextMember
+	size := 2
+	flush := func() {
+		switch {
+		case len(pack) == 1:
+			out = append(out, contextPart{Path: pack[0].path, Value: pack[0].raw})
+		case len(pack) > 1 && object:
+			m := make(map[string]json.RawMessage, len(pack))
+			for _, p := range pack {
+				m[p.key] = p.raw
+			}
+			value, _ := json.Marshal(m)
+			out = append(out, contextPart{Path: label, Value: value})
+		case len(pack) > 1:
+			els := make([]json.RawMessage, len(pack))
+			for i, p := range pack {
+				els[i] = p.raw
+			}
+			value, _ := json.Marshal(els)
+			out = append(out, contextPart{Path: fmt.Sprintf("%s[%d..%d]", path, pack[0].index, pack[len(pack)-1].index), Value: value})
+		}
+		pack, size = nil, 2
+	}
+	for _, m := range members {
+		m.raw, _ = json.Marshal(m.value)
+		if len(m.raw) > maxChars {
+			flush()
+			out = append(out, splitContext(m.value, m.path, maxChars)...)
+			continue
+		}
+		cost := len(m.raw) + 1
+		if object {
+			key, _ := json.Marshal(m.key)
+			cost += len(key) + 1
+		}
+		if len(pack) > 0 && size+cost > maxChars {
+			flush()
+		}
+		pack = append(pack, m)
+		size += cost
+	}
+	flush()
+	return out
+}
+
+// contextMember is an object member or array element being packed into parts.
+type contextMember struct {
+	path  string
+	key   string
+	index int
+	value any
+	raw   json.RawMessage
+}
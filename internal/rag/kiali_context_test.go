@@ -0,0 +1,86 @@
+package rag
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSplitContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		json     string
+		maxChars int
+		want     []string
+	}{
+		{
+			name:     "fits whole",
+			json:     `{"a":1,"b":2}`,
+			maxChars: 100,
+			want:     []string{`$ {"a":1,"b":2}`},
+		},
+		{
+			name:     "object members packed",
+			json:     `{"a":"xxxx","b":"yyyy","c":"zzzz"}`,
+			maxChars: 24,
+			want:     []string{`$ {"a":"xxxx","b":"yyyy"}`, `c "zzzz"`},
+		},
+		{
+			name:     "array elements packed by range",
+			json:     `{"nodes":[{"id":1},{"id":2},{"id":3},{"id":4},{"id":5}]}`,
+			maxChars: 30,
+			want:     []string{`nodes[0..2] [{"id":1},{"id":2},{"id":3}]`, `nodes[3..4] [{"id":4},{"id":5}]`},
+		},
+		{
+			name:     "oversized member split between packs",
+			json:     `{"a":1,"big":{"x":"0123456789","y":"0123456789"},"z":2}`,
+			maxChars: 20,
+			want:     []string{`a 1`, `big.x "0123456789"`, `big.y "0123456789"`, `z 2`},
+		},
+		{
+			name:     "oversized scalar kept whole",
+			json:     `["0123456789012345678901234567890123456789"]`,
+			maxChars: 10,
+			want:     []string{`[0] "0123456789012345678901234567890123456789"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v any
+			if err := json.Unmarshal([]byte(tt.json), &v); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range splitContext(v, "", tt.maxChars) {
+				got = append(got, p.Path+" "+string(p.Value))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("splitContext(%s, %d)\n got %q\nwant %q", tt.json, tt.maxChars, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContextPartsCapped(t *testing.T) {
+	// Elements too large to share a part would make one part each.
+	nodes := make([]any, 3*maxContextParts)
+	for i := range nodes {
+		nodes[i] = map[string]any{"id": fmt.Sprintf("node-%04d", i), "app": "reviews"}
+	}
+	parts := contextParts(map[string]any{"nodes": nodes}, 20)
+	if len(parts) > maxContextParts {
+		t.Errorf("got %d parts, want at most %d", len(parts), maxContextParts)
+	}
+	total := 0
+	for _, p := range parts {
+		var els []any
+		if err := json.Unmarshal(p.Value, &els); err != nil {
+			t.Fatalf("part %s is not an array: %s", p.Path, p.Value)
+		}
+		total += len(els)
+	}
+	if total != len(nodes) {
+		t.Errorf("parts hold %d nodes, want %d", total, len(nodes))
+	}
+}
@@ -0,0 +1,54 @@
+package rag
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnsupportedLanguage is returned by Answer for a language outside answerLanguages.
+var ErrUnsupportedLanguage = errors.New("unsupported language")
+
+// answerLanguages maps the supported answer languages, by ISO 639-1 code, to the
+// names used in the prompt.
+var answerLanguages = map[string]string{
+	"de": "German",
+	"en": "English",
+	"es": "Spanish",
+	"fr": "French",
+	"hi": "Hindi",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"nl": "Dutch",
+	"pl": "Polish",
+	"pt": "Portuguese",
+	"ru": "Russian",
+	"tr": "Turkish",
+	"uk": "Ukrainian",
+	"zh": "Chinese",
+}
+
+// answerLanguage resolves a language tag such as "es" or "pt-BR" to its prompt
+// name by the primary subtag; empty means the model's default, English.
+func answerLanguage(tag string) (string, error) {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return "", nil
+	}
+	primary, _, _ := strings.Cut(strings.ReplaceAll(tag, "_", "-"), "-")
+	name, ok := answerLanguages[strings.ToLower(primary)]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedLanguage, tag)
+	}
+	return name, nil
+}
+
+// languageInstruction is appended to the prompt for a non-English answer. Sources
+// stay in English, so titles and URLs are cited unchanged.
+func languageInstruction(name string) string {
+	if name == "" || name == "English" {
+		return ""
+	}
+	return "\n\nWrite the answer in " + name + ". The sources are in English: cite their titles and URLs exactly as given, without translating them."
+}
@@ -0,0 +1,206 @@
+package rag
+
+import (
+	"log"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// Chunk splitters selectable with CHUNK_SPLITTER.
+const (
+	splitterAuto  = "auto"
+	splitterWords = "words"
+)
+
+var (
+	mdATXHeading = regexp.MustCompile(`^\s{0,3}#{1,6}\s`)
+	mdFence      = regexp.MustCompile("^\\s{0,3}(`{3,}|~{3,})")
+)
+
+// loadChunkSplitter reads CHUNK_SPLITTER: "auto" (default) splits markdown
+// documents with splitMarkdown and everything else by words, "words" splits every
+// document by words as before.
+func loadChunkSplitter() string {
+	switch s := strings.ToLower(strings.TrimSpace(config.Get("CHUNK_SPLITTER", splitterAuto))); s {
+	case splitterAuto, splitterWords:
+		return s
+	default:
+		log.Printf("CHUNK_SPLITTER: unknown splitter %q, using %s", s, splitterAuto)
+		return splitterAuto
+	}
+}
+
+// isMarkdownURL reports whether a document came from a markdown file, judging by
+// the extension of its URL path.
+func isMarkdownURL(docURL string) bool {
+	p, _, _ := strings.Cut(docURL, "#")
+	p, _, _ = strings.Cut(p, "?")
+	ext := strings.ToLower(path.Ext(p))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// splitDocument cuts a document into chunks of at most wordsPerChunk words with
+// the splitter configured for its source.
+func (e *engine) splitDocument(docURL, content string, wordsPerChunk int) []string {
+	if e.chunkSplitter == splitterAuto && isMarkdownURL(docURL) {
+		return splitMarkdown(content, wordsPerChunk)
+	}
+	return splitIntoChunks(content, wordsPerChunk)
+}
+
+// mdBlock is a paragraph, heading or fenced code block of a markdown document.
+type mdBlock struct {
+	text    string
+	heading bool
+	code    bool
+}
+
+// markdownBlocks splits markdown into blocks at blank lines, headings and code
+// fences. A fenced block is kept whole, blank lines included; an unclosed fence
+// runs to the end of the document.
+func markdownBlocks(text string) []mdBlock {
+	var blocks []mdBlock
+	var para []string
+	flush := func() {
+		if len(para) > 0 {
+			blocks = append(blocks, mdBlock{text: strings.Join(para, "\n")})
+			para = nil
+		}
+	}
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if m := mdFence.FindStringSubmatch(line); m != nil {
+			flush()
+			fence := []string{line}
+			for i++; i < len(lines); i++ {
+				fence = append(fence, lines[i])
+				if t := strings.TrimSpace(lines[i]); strings.HasPrefix(t, m[1]) && strings.Trim(t, m[1][:1]) == "" {
+					break
+				}
+			}
+			blocks = append(blocks, mdBlock{text: strings.Join(fence, "\n"), code: true})
+			continue
+		}
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+		case mdATXHeading.MatchString(line):
+			flush()
+			blocks = append(blocks, mdBlock{text: strings.TrimSpace(line), heading: true})
+		default:
+			para = append(para, line)
+		}
+	}
+	flush()
+	return blocks
+}
+
+// splitMarkdown cuts markdown into chunks of at most wordsPerChunk words along its
+// structure: each heading starts a chunk together with the content that follows
+// it, headings directly followed by another heading stay with it, and a section
+// too long for one chunk continues in chunks that repeat its heading. Code fences
+// are only split, at line boundaries, when a single one exceeds the limit. Prose
+// loses its markdown markers; code keeps its fences and text.
+func splitMarkdown(text string, wordsPerChunk int) []string {
+	if wordsPerChunk < 1 {
+		wordsPerChunk = 1
+	}
+	var chunks []string
+	var cur []string
+	var heading string // headings of the current section, repeated in continuations
+	curWords, headingOnly := 0, true
+	emit := func() {
+		if len(cur) > 0 && !headingOnly {
+			chunks = append(chunks, strings.Join(cur, "\n\n"))
+		}
+		cur, curWords, headingOnly = nil, 0, true
+	}
+	add := func(s string) {
+		cur = append(cur, s)
+		curWords += len(strings.Fields(s))
+	}
+	for _, b := range markdownBlocks(text) {
+		if b.heading {
+			h := strings.TrimSpace(stripMarkdownMarkers(b.text))
+			if h == "" {
+				continue
+			}
+			if headingOnly && len(cur) > 0 {
+				// A heading followed directly by a subheading stays with it.
+				heading += "\n\n" + h
+				add(h)
+				continue
+			}
+			emit()
+			heading = h
+			add(h)
+			continue
+		}
+		body := b.text
+		if !b.code {
+			body = strings.TrimSpace(stripMarkdownMarkers(body))
+			if body == "" {
+				continue
+			}
+		}
+		for _, piece := range splitBlock(body, b.code, wordsPerChunk-len(strings.Fields(heading))) {
+			n := len(strings.Fields(piece))
+			if curWords+n > wordsPerChunk && !headingOnly {
+				emit()
+				if heading != "" {
+					add(heading)
+				}
+			}
+			add(piece)
+			headingOnly = false
+		}
+	}
+	emit()
+	if len(chunks) == 0 && strings.TrimSpace(text) != "" {
+		// A document of headings only is still stored.
+		return splitIntoChunks(stripMarkdownMarkers(text), wordsPerChunk)
+	}
+	return chunks
+}
+
+// splitBlock returns a block as is when it has at most limit words. Longer prose
+// is cut by words; longer code is cut at line boundaries, each piece wrapped in
+// the block's fence lines.
+func splitBlock(text string, code bool, limit int) []string {
+	limit = max(limit, 1)
+	if len(strings.Fields(text)) <= limit {
+		return []string{text}
+	}
+	if !code {
+		return splitIntoChunks(text, limit)
+	}
+	lines := strings.Split(text, "\n")
+	opening, closing := lines[0], ""
+	body := lines[1:]
+	if n := len(body); n > 0 && mdFence.MatchString(body[n-1]) {
+		closing, body = body[n-1], body[:n-1]
+	}
+	if closing == "" {
+		closing = strings.TrimSpace(mdFence.FindString(opening))
+	}
+	var pieces []string
+	var cur []string
+	words := 0
+	for _, l := range body {
+		n := len(strings.Fields(l))
+		if words+n > limit && len(cur) > 0 {
+			pieces = append(pieces, opening+"\n"+strings.Join(cur, "\n")+"\n"+closing)
+			cur, words = nil, 0
+		}
+		cur = append(cur, l)
+		words += n
+	}
+	if len(cur) > 0 {
+		pieces = append(pieces, opening+"\n"+strings.Join(cur, "\n")+"\n"+closing)
+	}
+	return pieces
+}
@@ -0,0 +1,119 @@
+package rag
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitMarkdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		words int
+		want  []string
+	}{
+		{
+			name:  "each heading starts a chunk with its content",
+			text:  "# Install\n\nRun the installer.\n\n## Verify\n\nCheck the pods.",
+			words: 100,
+			want:  []string{"Install\n\nRun the installer.", "Verify\n\nCheck the pods."},
+		},
+		{
+			name:  "nested headings stay with the first content",
+			text:  "# Configuration\n## Authentication\n### Token\nUse a service account token.",
+			words: 100,
+			want:  []string{"Configuration\n\nAuthentication\n\nToken\n\nUse a service account token."},
+		},
+		{
+			name:  "prose loses markdown markers",
+			text:  "## **Graph** [view](/docs/graph)\n\nSee *the* `legend`.",
+			words: 100,
+			want:  []string{"Graph view\n\nSee the legend."},
+		},
+		{
+			name:  "no split inside a fence",
+			text:  "## Deploy\n\n```bash\n# not a heading\n\nkubectl apply -f kiali.yaml\n```\n\nDone.",
+			words: 100,
+			want:  []string{"Deploy\n\n```bash\n# not a heading\n\nkubectl apply -f kiali.yaml\n```\n\nDone."},
+		},
+		{
+			name:  "unclosed fence runs to the end",
+			text:  "# Example\n\n~~~yaml\nauth:\n\n## strategy: token",
+			words: 100,
+			want:  []string{"Example\n\n~~~yaml\nauth:\n\n## strategy: token"},
+		},
+		{
+			name:  "oversized section repeats its heading",
+			text:  "# Big\n\none two three four five six seven eight nine ten",
+			words: 6,
+			want:  []string{"Big\n\none two three four five", "Big\n\nsix seven eight nine ten"},
+		},
+		{
+			name:  "oversized fence is cut at lines and re-fenced",
+			text:  "# Run\n\n```\na b\nc d\ne f\n```",
+			words: 4,
+			want:  []string{"Run\n\n```\na b\n```", "Run\n\n```\nc d\n```", "Run\n\n```\ne f\n```"},
+		},
+		{
+			name:  "content before the first heading",
+			text:  "Intro text.\n\n# Next\n\nMore.",
+			words: 100,
+			want:  []string{"Intro text.", "Next\n\nMore."},
+		},
+		{
+			name:  "headings only",
+			text:  "# Title\n## Subtitle",
+			words: 100,
+			want:  []string{"Title Subtitle"},
+		},
+		{
+			name:  "empty",
+			text:  " \n\n ",
+			words: 100,
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitMarkdown(tt.text, tt.words)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("splitMarkdown(%q, %d)\n got %q\nwant %q", tt.text, tt.words, got, tt.want)
+			}
+			for _, c := range got {
+				fences := 0
+				for _, l := range strings.Split(c, "\n") {
+					if mdFence.MatchString(l) {
+						fences++
+					}
+				}
+				if fences%2 != 0 && !strings.Contains(tt.name, "unclosed") {
+					t.Errorf("chunk %q has an unbalanced fence", c)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitDocumentSelectsMarkdown(t *testing.T) {
+	e := &engine{chunkSplitter: splitterAuto}
+	text := "# Title\n\nBody text."
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{"file:///docs/README.md", []string{"Title\n\nBody text."}},
+		{"https://github.com/kiali/kiali/blob/master/GUIDE.Markdown#setup", []string{"Title\n\nBody text."}},
+		{"https://kiali.io/docs/installation/", []string{"# Title Body text."}},
+		{"https://kiali.io/docs/md", []string{"# Title Body text."}},
+	}
+	for _, tt := range tests {
+		if got := e.splitDocument(tt.url, text, 100); !slices.Equal(got, tt.want) {
+			t.Errorf("splitDocument(%s) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+	e.chunkSplitter = splitterWords
+	if got := e.splitDocument("file:///docs/README.md", text, 100); !slices.Equal(got, []string{"# Title Body text."}) {
+		t.Errorf("words splitter = %q", got)
+	}
+}
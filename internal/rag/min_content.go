@@ -0,0 +1,33 @@
+package rag
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// defaultMinContentChars is the shortest content stored per source type: docs
+// sections and directory files only need to be more than a stray heading, while a
+// YouTube page shorter than 200 characters is an error or consent page.
+var defaultMinContentChars = map[string]int{
+	SourceDocs:      10,
+	SourceYouTube:   200,
+	SourceDirectory: 10,
+}
+
+// loadMinContentChars reads INGEST_MIN_CHARS_DOCS, INGEST_MIN_CHARS_YOUTUBE and
+// INGEST_MIN_CHARS_DIRECTORY, falling back to defaultMinContentChars.
+func loadMinContentChars() map[string]int {
+	out := make(map[string]int, len(defaultMinContentChars))
+	for kind, def := range defaultMinContentChars {
+		out[kind] = max(0, config.GetInt("INGEST_MIN_CHARS_"+strings.ToUpper(kind), def))
+	}
+	return out
+}
+
+// longEnough reports whether content, without surrounding whitespace, has at least
+// the minimum number of characters for its source type.
+func (e *engine) longEnough(kind, content string) bool {
+	return utf8.RuneCountInString(strings.TrimSpace(content)) >= e.minContentChars[kind]
+}
@@ -0,0 +1,93 @@
+package rag
+
+import (
+	"context"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// mmrDisabled marks MMR as off; any lambda of 1 or more selects purely by
+// relevance, which is plain top-k.
+const mmrDisabled = 1.0
+
+// loadMMRLambda reads MMR_LAMBDA, the weight of relevance against diversity in
+// [0,1]. Unset, invalid or 1 leaves retrieval as plain top-k.
+func loadMMRLambda() float64 {
+	v := strings.TrimSpace(config.Get("MMR_LAMBDA", ""))
+	if v == "" {
+		return mmrDisabled
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 || f > 1 {
+		log.Printf("MMR_LAMBDA: want a number in [0,1], got %q; MMR disabled", v)
+		return mmrDisabled
+	}
+	return f
+}
+
+// retrieve returns the k chunks handed to the model out of a pool of candidates,
+// zero for the default: four times k with MMR, k without. With MMR enabled the
+// pool is re-selected with mmrSelect, so near-duplicate chunks do not crowd out
+// other aspects of the question; without, the best k by score are kept.
+func (e *engine) retrieve(ctx context.Context, ns string, q queryEmbedding, pool, k int) ([]docChunk, error) {
+	if pool <= 0 {
+		pool = k
+		if e.mmrLambda < mmrDisabled {
+			pool = 4 * k
+		}
+	}
+	cands, err := e.candidates(ctx, ns, q, max(pool, k))
+	if err != nil {
+		return nil, err
+	}
+	pinned, cands := e.pinTitleMatches(ctx, ns, q, cands)
+	pinned = pinned[:min(k, len(pinned))]
+	rest := k - len(pinned)
+	var selected []docChunk
+	if e.mmrLambda >= mmrDisabled {
+		selected = append(pinned, cands[:min(rest, len(cands))]...)
+	} else {
+		selected = append(pinned, mmrSelect(cands, rest, e.mmrLambda)...)
+	}
+	traceFrom(ctx).retrieved(append(pinned[:len(pinned):len(pinned)], cands...), selected, e.mmrLambda)
+	return selected, nil
+}
+
+// mmrSelect greedily picks k candidates, each maximizing
+// lambda*relevance - (1-lambda)*max similarity to the chunks already picked.
+// Relevance is the search rank, including any summary boost, freshness decay and
+// source weight. The result is in
+// selection order, most valuable first.
+func mmrSelect(cands []docChunk, k int, lambda float64) []docChunk {
+	if len(cands) <= 1 || k <= 0 {
+		return cands[:min(k, len(cands))]
+	}
+	picked := make([]docChunk, 0, min(k, len(cands)))
+	// maxSim[i] is candidate i's highest similarity to any picked chunk.
+	maxSim := make([]float64, len(cands))
+	used := make([]bool, len(cands))
+	for len(picked) < k && len(picked) < len(cands) {
+		best, bestScore := -1, math.Inf(-1)
+		for i, c := range cands {
+			if used[i] {
+				continue
+			}
+			score := lambda*c.Rank - (1-lambda)*maxSim[i]
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		used[best] = true
+		picked = append(picked, cands[best])
+		for i, c := range cands {
+			if !used[i] && len(c.Vector) == len(cands[best].Vector) && len(c.Vector) > 0 {
+				maxSim[i] = math.Max(maxSim[i], cosine(c.Vector, cands[best].Vector))
+			}
+		}
+	}
+	return picked
+}
@@ -0,0 +1,23 @@
+package rag
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// With ENGINE=mock, DefaultEngine runs without a database server, API keys or
+// network access for answers: the regular engine over a private in-memory SQLite
+// database, with the mock provider for embeddings and completions (see
+// mockProvider). Every Engine method behaves as in production, so handlers can be
+// exercised end to end and demos run offline; IngestDirectory fills it from local
+// files, while docs and YouTube ingestion still fetch their pages. Nothing is
+// kept after the process exits.
+
+var mockEngines atomic.Int64
+
+// NewMockEngine returns an engine with the mock provider and an empty in-memory
+// store of its own. Other settings come from the configuration as usual.
+func NewMockEngine() Engine {
+	dsn := fmt.Sprintf("file:kiali-ai-mock-%d?mode=memory&cache=shared", mockEngines.Add(1))
+	return newEngine("mock", "sqlite", dsn)
+}
@@ -0,0 +1,76 @@
+package rag
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// Per-request model overrides are limited to allowlists: the configured models,
+// ALLOWED_COMPLETION_MODELS / ALLOWED_EMBEDDING_MODELS, which apply whatever the
+// provider, and the lists of the primary provider,
+// <PROVIDER>_ALLOWED_COMPLETION_MODELS and <PROVIDER>_ALLOWED_EMBEDDING_MODELS
+// (e.g. OPENAI_ALLOWED_COMPLETION_MODELS), which are ignored for any other
+// LLM_PROVIDER. Vendor-specific model names belong in the per-provider lists.
+
+// ModelCatalog lists the models of the primary provider a request may pick.
+type ModelCatalog struct {
+	Provider        string          `json:"provider"`
+	CompletionModel string          `json:"completion_model"`
+	EmbeddingModel  string          `json:"embedding_model"`
+	Available       AvailableModels `json:"available"`
+}
+
+// AvailableModels lists allowed models by role, the configured one first.
+type AvailableModels struct {
+	Completion []string `json:"completion"`
+	Embedding  []string `json:"embedding"`
+}
+
+// allowedModels returns the configured model followed by the allowlisted ones of
+// a role ("COMPLETION" or "EMBEDDING"), without duplicates.
+func (e *engine) allowedModels(role, configured string) []string {
+	out := []string{configured}
+	for _, key := range []string{"ALLOWED_" + role + "_MODELS", strings.ToUpper(e.primary) + "_ALLOWED_" + role + "_MODELS"} {
+		for _, m := range strings.Split(config.Get(key, ""), ",") {
+			if m = strings.TrimSpace(m); m != "" && !slices.Contains(out, m) {
+				out = append(out, m)
+			}
+		}
+	}
+	return out
+}
+
+// Models lists the models requests may override the configured ones with.
+func (e *engine) Models() ModelCatalog {
+	return ModelCatalog{
+		Provider:        e.primary,
+		CompletionModel: e.models.CompletionModel,
+		EmbeddingModel:  e.models.EmbeddingModel,
+		Available: AvailableModels{
+			Completion: e.allowedModels("COMPLETION", e.models.CompletionModel),
+			Embedding:  e.allowedModels("EMBEDDING", e.models.EmbeddingModel),
+		},
+	}
+}
+
+// applyModelOverrides points the primary targets of both chains at the models
+// requested in opts, after checking them against the allowlists. Fallback
+// providers keep their own models.
+func (e *engine) applyModelOverrides(opts AnswerOptions, compChain, embChain []llmTarget) error {
+	if m := opts.CompletionModel; m != "" {
+		if !slices.Contains(e.allowedModels("COMPLETION", e.models.CompletionModel), m) {
+			return fmt.Errorf("%w: completion model %q", ErrModelNotAllowed, m)
+		}
+		compChain[0].CompletionModel = m
+	}
+	if m := opts.EmbeddingModel; m != "" {
+		if !slices.Contains(e.allowedModels("EMBEDDING", e.models.EmbeddingModel), m) {
+			return fmt.Errorf("%w: embedding model %q", ErrModelNotAllowed, m)
+		}
+		embChain[0].EmbeddingModel = m
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// Moderation targets and actions recorded in the moderation_events table.
+const (
+	ModerationIngest = "ingest"
+	ModerationAnswer = "answer"
+
+	moderationSkip   = "skip"
+	moderationFlag   = "flag"
+	moderationRefuse = "refuse"
+	moderationRedact = "redact"
+)
+
+const redactedMarker = "[redacted]"
+
+// errDocumentBlocked is returned by storeDocument when moderation skipped every
+// chunk, so nothing was stored. Ingests count such documents as blocked; callers
+// that replace stored documents keep the originals.
+var errDocumentBlocked = errors.New("every chunk was blocked by moderation")
+
+// moderator screens ingested chunks and generated answers, either with the OpenAI
+// moderation API or locally with MODERATION_PATTERNS.
+type moderator struct {
+	provider     string
+	model        string
+	patterns     []*regexp.Regexp
+	ingestAction string
+	answerAction string
+}
+
+// loadModerator reads MODERATION (off by default, "openai" or "local") and its
+// actions: MODERATION_INGEST_ACTION "skip" (default) drops flagged chunks before
+// they are stored, "flag" stores them and only records the decision;
+// MODERATION_ANSWER_ACTION "refuse" (default) fails the answer, "redact" masks it.
+// Like the crawl filters, invalid settings are errors.
+func loadModerator() (*moderator, error) {
+	provider := strings.ToLower(strings.TrimSpace(config.Get("MODERATION", "")))
+	if provider == "" || provider == "off" {
+		return nil, nil
+	}
+	if provider != "openai" && provider != "local" {
+		return nil, fmt.Errorf("MODERATION: want openai or local, got %q", provider)
+	}
+	m := &moderator{
+		provider:     provider,
+		model:        config.Get("MODERATION_MODEL", "omni-moderation-latest"),
+		ingestAction: strings.ToLower(config.Get("MODERATION_INGEST_ACTION", moderationSkip)),
+		answerAction: strings.ToLower(config.Get("MODERATION_ANSWER_ACTION", moderationRefuse)),
+	}
+	if m.ingestAction != moderationSkip && m.ingestAction != moderationFlag {
+		return nil, fmt.Errorf("MODERATION_INGEST_ACTION: want skip or flag, got %q", m.ingestAction)
+	}
+	if m.answerAction != moderationRefuse && m.answerAction != moderationRedact {
+		return nil, fmt.Errorf("MODERATION_ANSWER_ACTION: want refuse or redact, got %q", m.answerAction)
+	}
+	var err error
+	if m.patterns, err = compilePatterns("MODERATION_PATTERNS"); err != nil {
+		return nil, err
+	}
+	if provider == "local" && len(m.patterns) == 0 {
+		return nil, errors.New("MODERATION=local needs MODERATION_PATTERNS")
+	}
+	return m, nil
+}
+
+// ModerationEvent is a recorded moderation decision. Ref is the document URL for
+// ingested chunks and the query for answers.
+type ModerationEvent struct {
+	ID         int64     `json:"id"`
+	Namespace  string    `json:"namespace"`
+	Target     string    `json:"target"`
+	Ref        string    `json:"ref"`
+	Categories []string  `json:"categories"`
+	Action     string    `json:"action"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func initModeration(db *sql.DB, backend string) error {
+	id := "INTEGER PRIMARY KEY AUTOINCREMENT"
+	if backend == "postgres" {
+		id = "BIGSERIAL PRIMARY KEY"
+	}
+	if _, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS moderation_events (
+	id ` + id + `,
+	namespace TEXT NOT NULL,
+	target TEXT NOT NULL,
+	ref TEXT NOT NULL,
+	categories TEXT NOT NULL,
+	action TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);`); err != nil {
+		return err
+	}
+	_, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_moderation_events_namespace ON moderation_events(namespace)")
+	return err
+}
+
+// moderationVerdict is the moderation result for one text.
+type moderationVerdict struct {
+	Flagged    bool
+	Categories []string
+}
+
+type openAIModerationResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+}
+
+// moderate classifies texts, one verdict per text.
+func (e *engine) moderate(ctx context.Context, texts []string) ([]moderationVerdict, error) {
+	m := e.moderation
+	if m.provider == "local" {
+		out := make([]moderationVerdict, len(texts))
+		for i, t := range texts {
+			for _, re := range m.patterns {
+				if re.MatchString(t) {
+					out[i] = moderationVerdict{Flagged: true, Categories: []string{"pattern:" + re.String()}}
+					break
+				}
+			}
+		}
+		return out, nil
+	}
+	return withRetries(ctx, "moderate", func() ([]moderationVerdict, error) {
+		return e.moderateOpenAI(ctx, texts)
+	})
+}
+
+func (e *engine) moderateOpenAI(ctx context.Context, texts []string) ([]moderationVerdict, error) {
+	key := config.Get("OPENAI_API_KEY", "")
+	if key == "" {
+		return nil, errors.New("moderation: OPENAI_API_KEY not set")
+	}
+	bs, err := json.Marshal(map[string]any{"model": e.moderation.model, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.openai.com/v1/moderations", bytes.NewReader(bs))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setProviderHeaders(req, "openai")
+	req.Header.Set("Authorization", "Bearer "+key)
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, retryable(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, statusError("moderate", resp)
+	}
+	var out openAIModerationResponse
+	if err := decodeResponse("moderate", resp.Body, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Results) != len(texts) {
+		return nil, fmt.Errorf("moderate: %d results for %d inputs", len(out.Results), len(texts))
+	}
+	verdicts := make([]moderationVerdict, len(texts))
+	for i, r := range out.Results {
+		verdicts[i].Flagged = r.Flagged
+		for c, on := range r.Categories {
+			if on {
+				verdicts[i].Categories = append(verdicts[i].Categories, c)
+			}
+		}
+		slices.Sort(verdicts[i].Categories)
+	}
+	return verdicts, nil
+}
+
+// moderateChunks screens a document's chunks before they are stored. With the skip
+// action flagged chunks are removed; it returns the chunks to store and how many
+// were flagged. Moderation errors fail the document rather than letting
+// unscreened text in.
+func (e *engine) moderateChunks(ctx context.Context, ns, docURL string, chunks []textChunk) ([]textChunk, int, error) {
+	if e.moderation == nil || len(chunks) == 0 {
+		return chunks, 0, nil
+	}
+	texts := make([]string, len(chunks))
+	for i, ch := range chunks {
+		texts[i] = ch.Text
+	}
+	verdicts, err := e.moderate(ctx, texts)
+	if err != nil {
+		return nil, 0, err
+	}
+	kept := chunks[:0:0]
+	flagged := 0
+	var categories []string
+	for i, v := range verdicts {
+		if !v.Flagged {
+			kept = append(kept, chunks[i])
+			continue
+		}
+		flagged++
+		categories = append(categories, v.Categories...)
+		if e.moderation.ingestAction == moderationFlag {
+			kept = append(kept, chunks[i])
+		}
+	}
+	if flagged > 0 {
+		slices.Sort(categories)
+		categories = slices.Compact(categories)
+		log.Printf("moderation flagged %d of %d chunks of %s (%s): %s", flagged, len(chunks), docURL, strings.Join(categories, ", "), e.moderation.ingestAction)
+		e.recordModeration(ns, ModerationIngest, docURL, categories, e.moderation.ingestAction)
+	}
+	return kept, flagged, nil
+}
+
+// moderateAnswer screens a generated answer. A flagged answer is refused with
+// ErrContentBlocked or, with the redact action, masked: pattern matches are
+// replaced locally, while an answer flagged by the API is withheld as a whole.
+// It reports whether the answer was changed.
+func (e *engine) moderateAnswer(ctx context.Context, ns, query, answer string) (string, bool, error) {
+	if e.moderation == nil {
+		return answer, false, nil
+	}
+	verdicts, err := e.moderate(ctx, []string{answer})
+	if err != nil {
+		return "", false, err
+	}
+	v := verdicts[0]
+	if !v.Flagged {
+		return answer, false, nil
+	}
+	action := e.moderation.answerAction
+	e.recordModeration(ns, ModerationAnswer, query, v.Categories, action)
+	if action == moderationRefuse {
+		return "", false, fmt.Errorf("%w: answer flagged by moderation (%s)", ErrContentBlocked, strings.Join(v.Categories, ", "))
+	}
+	log.Printf("moderation redacted an answer (%s)", strings.Join(v.Categories, ", "))
+	if e.moderation.provider == "local" {
+		for _, re := range e.moderation.patterns {
+			answer = re.ReplaceAllString(answer, redactedMarker)
+		}
+		return answer, true, nil
+	}
+	return redactedMarker + " The answer was withheld by content moderation.", true, nil
+}
+
+// recordModeration stores a decision. Failures are logged and never fail the caller.
+func (e *engine) recordModeration(ns, target, ref string, categories []string, action string) {
+	if len(ref) > 500 {
+		ref = ref[:500]
+	}
+	if e.backend != "postgres" {
+		unlock := e.lockWrites()
+		defer unlock()
+	}
+	_, err := e.db.Exec("INSERT INTO moderation_events(namespace, target, ref, categories, action, created_at) VALUES("+e.placeholders(6)+")",
+		ns, target, ref, strings.Join(categories, ","), action, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		log.Printf("record moderation event: %v", err)
+	}
+}
+
+// ModerationEvents lists a namespace's recorded moderation decisions, newest first.
+func (e *engine) ModerationEvents(ctx context.Context, namespace string, limit int) ([]ModerationEvent, error) {
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := e.db.QueryContext(ctx, "SELECT id, namespace, target, ref, categories, action, created_at FROM moderation_events WHERE namespace="+e.placeholder(1)+" ORDER BY id DESC LIMIT "+e.placeholder(2), ns, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []ModerationEvent{}
+	for rows.Next() {
+		var ev ModerationEvent
+		var categories, created string
+		if err := rows.Scan(&ev.ID, &ev.Namespace, &ev.Target, &ev.Ref, &categories, &ev.Action, &created); err != nil {
+			return nil, err
+		}
+		ev.Categories = []string{}
+		if categories != "" {
+			ev.Categories = strings.Split(categories, ",")
+		}
+		ev.CreatedAt, _ = time.Parse(time.RFC3339, created)
+		out = append(out, ev)
+	}
+	return out, rows.Err()
+}
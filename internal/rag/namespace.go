@@ -0,0 +1,26 @@
+package rag
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultNamespace holds documents ingested or queried without an explicit
+// namespace, including everything stored before namespaces existed.
+const DefaultNamespace = "default"
+
+var namespacePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// NormalizeNamespace lowercases and validates a namespace name, mapping an empty
+// name to DefaultNamespace.
+func NormalizeNamespace(ns string) (string, error) {
+	ns = strings.ToLower(strings.TrimSpace(ns))
+	if ns == "" {
+		return DefaultNamespace, nil
+	}
+	if !namespacePattern.MatchString(ns) {
+		return "", fmt.Errorf("invalid namespace %q: use up to 63 lowercase letters, digits, '-' or '_'", ns)
+	}
+	return ns, nil
+}
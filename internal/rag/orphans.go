@@ -0,0 +1,80 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// Embeddings can outlive their document when a two-step delete or a store is
+// interrupted. CleanOrphans removes those whose document_id matches no document;
+// with ORPHAN_CLEANUP_INTERVAL_HOURS set (default 0: off) StartOrphanCleanup also
+// runs it on that schedule.
+
+// OrphanCleanupResult reports CleanOrphans.
+type OrphanCleanupResult struct {
+	RemovedEmbeddings int64 `json:"removed_embeddings"`
+}
+
+// CleanOrphans deletes the embeddings and keyword index entries of every namespace
+// whose document no longer exists. It refuses to run while an ingest is in
+// progress.
+func (e *engine) CleanOrphans(ctx context.Context) (OrphanCleanupResult, error) {
+	var res OrphanCleanupResult
+	done, err := e.ops.begin("orphan-cleanup", "")
+	if err != nil {
+		return res, err
+	}
+	defer done()
+	if !e.corpusMu.TryLock() {
+		return res, ErrIngestInProgress
+	}
+	defer e.corpusMu.Unlock()
+	const q = "DELETE FROM embeddings WHERE document_id IS NULL OR NOT EXISTS (SELECT 1 FROM documents d WHERE d.id = embeddings.document_id)"
+	const keywordsQ = "DELETE FROM chunk_keywords WHERE NOT EXISTS (SELECT 1 FROM documents d WHERE d.id = chunk_keywords.document_id)"
+	clean := func() (sql.Result, error) {
+		if _, err := e.db.ExecContext(ctx, keywordsQ); err != nil {
+			return nil, err
+		}
+		return e.db.ExecContext(ctx, q)
+	}
+	var r sql.Result
+	if e.backend == "postgres" {
+		r, err = clean()
+	} else {
+		unlock := e.lockWrites()
+		defer unlock()
+		r, err = withBusyRetries(ctx, "clean orphans", clean)
+	}
+	if err != nil {
+		return res, err
+	}
+	res.RemovedEmbeddings, err = r.RowsAffected()
+	return res, err
+}
+
+// StartOrphanCleanup runs CleanOrphans every ORPHAN_CLEANUP_INTERVAL_HOURS in
+// the background, skipping runs that find an ingest in progress. It does nothing
+// when the interval is unset.
+func StartOrphanCleanup(eng Engine) {
+	hours := config.GetInt("ORPHAN_CLEANUP_INTERVAL_HOURS", 0)
+	if hours <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(hours) * time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			res, err := eng.CleanOrphans(context.Background())
+			switch {
+			case err != nil:
+				log.Printf("orphan cleanup: %v", err)
+			case res.RemovedEmbeddings > 0:
+				log.Printf("orphan cleanup: removed %d embeddings", res.RemovedEmbeddings)
+			}
+		}
+	}()
+}
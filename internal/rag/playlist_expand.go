@@ -0,0 +1,77 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// Playlist expansion is bounded: each playlist yields at most
+// YOUTUBE_PLAYLIST_MAX_VIDEOS videos (default 500, 0 for no cap) and is given
+// YOUTUBE_PLAYLIST_TIMEOUT_SECONDS (default 60) to list them, after which the
+// videos found so far are used. Several playlists of one request are expanded in
+// parallel by up to YOUTUBE_PLAYLIST_CONCURRENCY workers (default 4).
+
+func playlistMaxVideos() int {
+	return max(0, config.GetInt("YOUTUBE_PLAYLIST_MAX_VIDEOS", 500))
+}
+
+// expandURLs replaces the playlist URLs among urls by their videos, keeping the
+// order of urls. A playlist that cannot be expanded is logged and dropped.
+func (e *engine) expandURLs(ctx context.Context, urls []string, headers map[string]string) []string {
+	expanded := make([][]string, len(urls))
+	var playlists []int
+	for i, u := range urls {
+		if isYouTubePlaylistURL(u) {
+			playlists = append(playlists, i)
+		} else {
+			expanded[i] = []string{u}
+		}
+	}
+	timeout := time.Duration(config.GetInt("YOUTUBE_PLAYLIST_TIMEOUT_SECONDS", 60)) * time.Second
+	workers := min(max(1, config.GetInt("YOUTUBE_PLAYLIST_CONCURRENCY", 4)), max(1, len(playlists)))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				expanded[i] = e.expandPlaylistWithin(ctx, urls[i], headers, timeout)
+			}
+		}()
+	}
+	for _, i := range playlists {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var out []string
+	for _, vs := range expanded {
+		out = append(out, vs...)
+	}
+	return out
+}
+
+// expandPlaylistWithin expands one playlist, returning the videos listed before
+// timeout (when positive) expires.
+func (e *engine) expandPlaylistWithin(ctx context.Context, u string, headers map[string]string, timeout time.Duration) []string {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	vs, err := e.expandPlaylist(ctx, u, headers)
+	switch {
+	case err != nil && len(vs) > 0 && errors.Is(err, context.DeadlineExceeded):
+		log.Printf("playlist expand of %s timed out after %s; using the %d videos found", u, timeout, len(vs))
+	case err != nil:
+		log.Printf("playlist expand error: %v", err)
+	}
+	return vs
+}
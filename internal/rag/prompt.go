@@ -0,0 +1,88 @@
+package rag
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// charsPerToken is the rough ratio used to estimate token counts without a tokenizer.
+const charsPerToken = 4
+
+// completionReserveTokens is left free for the answer; it matches the output cap in complete.
+const completionReserveTokens = 1024
+
+const contextTruncatedMarker = "...[truncated]"
+
+// modelContextTokens lists context windows by model name prefix, most specific first.
+var modelContextTokens = []struct {
+	prefix string
+	tokens int
+}{
+	{"gemini-1.5-pro", 2_000_000},
+	{"gemini-", 1_000_000},
+	{"gpt-4o", 128_000},
+	{"gpt-4-turbo", 128_000},
+	{"gpt-4.1", 1_000_000},
+	{"gpt-3.5-turbo", 16_000},
+}
+
+// defaultContextTokens is assumed for models missing from modelContextTokens.
+const defaultContextTokens = 8192
+
+// maxPromptTokens returns MAX_PROMPT_TOKENS, or the model's context window minus
+// room for the answer. Zero or less disables the limit.
+func maxPromptTokens(model string) int {
+	return config.GetInt("MAX_PROMPT_TOKENS", contextWindow(model)-completionReserveTokens)
+}
+
+// contextWindow returns the model's context window in tokens.
+func contextWindow(model string) int {
+	for _, m := range modelContextTokens {
+		if strings.HasPrefix(model, m.prefix) {
+			return m.tokens
+		}
+	}
+	return defaultContextTokens
+}
+
+func estimateTokens(s string) int {
+	return (len(s) + charsPerToken - 1) / charsPerToken
+}
+
+// fitPrompt builds the prompt within maxTokens. The lowest-ranked chunks are dropped
+// first, then the Kiali context is truncated, and only then the last chunk goes.
+// It returns the prompt and the chunks it still contains.
+func fitPrompt(query string, kialiContext any, docs []docChunk, maxTokens int) (string, []docChunk) {
+	var contextJSON []byte
+	if kialiContext != nil {
+		contextJSON, _ = json.Marshal(kialiContext)
+	}
+	prompt := buildPrompt(query, contextJSON, docs)
+	if estimateTokens(prompt) <= maxTokens {
+		return prompt, docs
+	}
+	totalDocs, contextBytes := len(docs), len(contextJSON)
+	for len(docs) > 1 && estimateTokens(prompt) > maxTokens {
+		docs = docs[:len(docs)-1]
+		prompt = buildPrompt(query, contextJSON, docs)
+	}
+	if over := estimateTokens(prompt) - maxTokens; over > 0 && len(contextJSON) > 0 {
+		keep := max(0, len(contextJSON)-over*charsPerToken-len(contextTruncatedMarker))
+		for keep > 0 && !utf8.RuneStart(contextJSON[keep]) {
+			keep--
+		}
+		contextJSON = append(contextJSON[:keep:keep], contextTruncatedMarker...)
+		prompt = buildPrompt(query, contextJSON, docs)
+	}
+	if len(docs) > 0 && estimateTokens(prompt) > maxTokens {
+		docs = nil
+		prompt = buildPrompt(query, contextJSON, docs)
+	}
+	log.Printf("prompt exceeded %d tokens: dropped %d of %d chunks, kiali context %d -> %d bytes, now ~%d tokens",
+		maxTokens, totalDocs-len(docs), totalDocs, contextBytes, len(contextJSON), estimateTokens(prompt))
+	return prompt, docs
+}
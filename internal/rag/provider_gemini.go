@@ -0,0 +1,116 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// geminiProvider calls the Gemini embedContent, batchEmbedContents and
+// generateContent APIs with GEMINI_API_KEY.
+type geminiProvider struct {
+	client *http.Client
+}
+
+func (p *geminiProvider) key() (string, error) {
+	key := config.Get("GEMINI_API_KEY", "")
+	if key == "" {
+		return "", errors.New("GEMINI_API_KEY not set")
+	}
+	return key, nil
+}
+
+func (p *geminiProvider) endpoint(model, method, key string) string {
+	return fmt.Sprintf("https://generativelanguage.googleapis.com/v1/models/%s:%s?key=%s", model, method, key)
+}
+
+func geminiEmbedModel(model string) string {
+	if model == "" {
+		return providerDefaults["gemini"].EmbeddingModel
+	}
+	return model
+}
+
+func (p *geminiProvider) Embed(ctx context.Context, model, text string) ([]float32, error) {
+	key, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	model = geminiEmbedModel(model)
+	body := map[string]any{
+		"model":   "models/" + model,
+		"content": map[string]any{"parts": []map[string]any{{"text": text}}},
+	}
+	var out geminiEmbedResponse
+	if err := postJSON(ctx, p.client, "gemini", "embed", p.endpoint(model, "embedContent", key), "", body, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Embedding.Values) == 0 {
+		return nil, retryable(errors.New("embed: no embedding in response"))
+	}
+	return out.Embedding.Values, nil
+}
+
+func (p *geminiProvider) EmbedBatch(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	key, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	model = geminiEmbedModel(model)
+	requests := make([]map[string]any, len(inputs))
+	for i, t := range inputs {
+		requests[i] = map[string]any{
+			"model":   "models/" + model,
+			"content": map[string]any{"parts": []map[string]any{{"text": t}}},
+		}
+	}
+	var out geminiBatchEmbedResponse
+	if err := postJSON(ctx, p.client, "gemini", "embed batch", p.endpoint(model, "batchEmbedContents", key), "", map[string]any{"requests": requests}, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Embeddings) != len(inputs) {
+		return nil, fmt.Errorf("embed batch returned %d embeddings for %d inputs", len(out.Embeddings), len(inputs))
+	}
+	vecs := make([][]float32, len(inputs))
+	for i, emb := range out.Embeddings {
+		vecs[i] = emb.Values
+	}
+	return vecs, checkBatchVectors(vecs)
+}
+
+func (p *geminiProvider) Complete(ctx context.Context, req CompletionRequest) (string, error) {
+	key, err := p.key()
+	if err != nil {
+		return "", err
+	}
+	model := req.Model
+	if model == "" {
+		model = providerDefaults["gemini"].CompletionModel
+	}
+	prompt := req.Prompt
+	genConfig := map[string]any{"maxOutputTokens": 1024, "temperature": req.Temperature}
+	if req.Format != nil {
+		// Gemini's responseSchema only accepts an OpenAPI subset, so request JSON mode
+		// and describe the schema in the prompt; the result is validated afterwards.
+		genConfig["responseMimeType"] = "application/json"
+		prompt += "\n\nRespond only with JSON matching this schema:\n" + string(req.Format.Schema)
+	}
+	body := map[string]any{
+		"contents": []map[string]any{{
+			"parts": []map[string]any{{"text": req.System + "\n\n" + prompt}},
+		}},
+		"generationConfig": genConfig,
+	}
+	var out geminiGenerateResponse
+	if err := postJSON(ctx, p.client, "gemini", "complete", p.endpoint(model, "generateContent", key), "", body, &out); err != nil {
+		return "", err
+	}
+	text, err := out.text()
+	if err == nil {
+		meterFrom(ctx).add(out.tokens(req.System+"\n\n"+prompt, text))
+	}
+	return text, err
+}
@@ -0,0 +1,53 @@
+package rag
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// providerHeaders returns the billing attribution headers configured for provider:
+// OpenAI organization/project, or the Google Cloud quota project for Gemini.
+func providerHeaders(provider string) map[string]string {
+	h := map[string]string{}
+	if provider == "openai" {
+		if v := config.Get("OPENAI_ORGANIZATION", ""); v != "" {
+			h["OpenAI-Organization"] = v
+		}
+		if v := config.Get("OPENAI_PROJECT", ""); v != "" {
+			h["OpenAI-Project"] = v
+		}
+		return h
+	}
+	if v := config.Get("GEMINI_QUOTA_PROJECT", ""); v != "" {
+		h["X-Goog-User-Project"] = v
+	}
+	return h
+}
+
+func setProviderHeaders(req *http.Request, provider string) {
+	for k, v := range providerHeaders(provider) {
+		req.Header.Set(k, v)
+	}
+}
+
+// checkProviderHeaders fails when PROVIDER_ATTRIBUTION_REQUIRED is set and the
+// attribution settings of provider are missing, so usage is never billed to the
+// wrong organization or project.
+func checkProviderHeaders(provider string) error {
+	if !config.GetBool("PROVIDER_ATTRIBUTION_REQUIRED", false) {
+		return nil
+	}
+	h := providerHeaders(provider)
+	if provider == "openai" {
+		if h["OpenAI-Organization"] == "" || h["OpenAI-Project"] == "" {
+			return errors.New("OPENAI_ORGANIZATION and OPENAI_PROJECT are required")
+		}
+		return nil
+	}
+	if h["X-Goog-User-Project"] == "" {
+		return errors.New("GEMINI_QUOTA_PROJECT is required")
+	}
+	return nil
+}
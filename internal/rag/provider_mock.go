@@ -0,0 +1,56 @@
+package rag
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// mockProvider (LLM_PROVIDER=mock) answers without network calls or keys, for
+// tests and local runs. Embeddings hash each word into one of dim buckets, so
+// texts sharing words are similar and the same text always gets the same vector;
+// completions are a fixed answer citing the first context chunk.
+type mockProvider struct {
+	dim int
+}
+
+// mockAnswer is the text every mock completion returns.
+const mockAnswer = "This is a mock answer [1]."
+
+func (p *mockProvider) Embed(_ context.Context, _, text string) ([]float32, error) {
+	vec := make([]float32, max(p.dim, 1))
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		h := fnv.New32a()
+		h.Write([]byte(w))
+		vec[h.Sum32()%uint32(len(vec))]++
+	}
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v * v)
+	}
+	if norm == 0 {
+		vec[0] = 1
+		return vec, nil
+	}
+	for i := range vec {
+		vec[i] /= float32(math.Sqrt(norm))
+	}
+	return vec, nil
+}
+
+func (p *mockProvider) EmbedBatch(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	vecs := make([][]float32, len(inputs))
+	for i, in := range inputs {
+		vecs[i], _ = p.Embed(ctx, model, in)
+	}
+	return vecs, nil
+}
+
+func (p *mockProvider) Complete(_ context.Context, req CompletionRequest) (string, error) {
+	if req.Format != nil {
+		return "{}", nil
+	}
+	return mockAnswer, nil
+}
@@ -0,0 +1,115 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// openAIProvider calls the OpenAI embeddings and chat completions APIs with
+// OPENAI_API_KEY.
+type openAIProvider struct {
+	client *http.Client
+	// dimensions is the reduced embedding width to request, 0 for native.
+	dimensions int
+}
+
+func (p *openAIProvider) key() (string, error) {
+	key := config.Get("OPENAI_API_KEY", "")
+	if key == "" {
+		return "", errors.New("OPENAI_API_KEY not set")
+	}
+	return key, nil
+}
+
+// embedBody builds an embeddings request; input is a string or a list of them.
+func (p *openAIProvider) embedBody(model string, input any) map[string]any {
+	if model == "" {
+		model = providerDefaults["openai"].EmbeddingModel
+	}
+	body := map[string]any{"model": model, "input": input}
+	if p.dimensions > 0 && supportsDimensions(model) {
+		body["dimensions"] = p.dimensions
+	}
+	return body
+}
+
+func (p *openAIProvider) Embed(ctx context.Context, model, text string) ([]float32, error) {
+	key, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	var out openAIEmbedResponse
+	if err := postJSON(ctx, p.client, "openai", "embed", "https://api.openai.com/v1/embeddings", key, p.embedBody(model, text), &out); err != nil {
+		return nil, err
+	}
+	if len(out.Data) == 0 || len(out.Data[0].Embedding) == 0 {
+		return nil, retryable(errors.New("embed: no embedding in response"))
+	}
+	return out.Data[0].Embedding, nil
+}
+
+func (p *openAIProvider) EmbedBatch(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	key, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	var out openAIEmbedResponse
+	if err := postJSON(ctx, p.client, "openai", "embed batch", "https://api.openai.com/v1/embeddings", key, p.embedBody(model, inputs), &out); err != nil {
+		return nil, err
+	}
+	vecs := make([][]float32, len(inputs))
+	for _, d := range out.Data {
+		if d.Index >= 0 && d.Index < len(vecs) {
+			vecs[d.Index] = d.Embedding
+		}
+	}
+	return vecs, checkBatchVectors(vecs)
+}
+
+func (p *openAIProvider) Complete(ctx context.Context, req CompletionRequest) (string, error) {
+	key, err := p.key()
+	if err != nil {
+		return "", err
+	}
+	model := req.Model
+	if model == "" {
+		model = providerDefaults["openai"].CompletionModel
+	}
+	body := map[string]any{
+		"model":       model,
+		"temperature": req.Temperature,
+		"max_tokens":  1024,
+		"messages": []map[string]any{
+			{"role": "system", "content": req.System},
+			{"role": "user", "content": req.Prompt},
+		},
+	}
+	if req.Seed != nil {
+		body["seed"] = *req.Seed
+	}
+	if req.CacheKey != "" {
+		body["prompt_cache_key"] = req.CacheKey
+	}
+	if req.Format != nil {
+		jsonSchema := map[string]any{
+			"name":   req.Format.schemaName(),
+			"schema": req.Format.Schema,
+		}
+		if req.Format.strict() {
+			jsonSchema["strict"] = true
+		}
+		body["response_format"] = map[string]any{"type": "json_schema", "json_schema": jsonSchema}
+	}
+	var out openAIChatResponse
+	if err := postJSON(ctx, p.client, "openai", "complete", "https://api.openai.com/v1/chat/completions", key, body, &out); err != nil {
+		return "", err
+	}
+	text, err := out.text()
+	if err == nil {
+		meterFrom(ctx).add(out.tokens(req.System+req.Prompt, text))
+	}
+	return text, err
+}
@@ -0,0 +1,206 @@
+package rag
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Typed views of the provider responses. Decoding into structs instead of walking
+// map[string]any keeps unexpected shapes from panicking and lets every failure
+// say what was missing.
+
+type geminiEmbedding struct {
+	Values []float32 `json:"values"`
+}
+
+type geminiEmbedResponse struct {
+	Embedding geminiEmbedding `json:"embedding"`
+}
+
+type geminiBatchEmbedResponse struct {
+	Embeddings []geminiEmbedding `json:"embeddings"`
+}
+
+type geminiSafetyRating struct {
+	Category    string `json:"category"`
+	Probability string `json:"probability"`
+	Blocked     bool   `json:"blocked"`
+}
+
+type geminiGenerateResponse struct {
+	Candidates []struct {
+		Content struct {
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"content"`
+		FinishReason  string               `json:"finishReason"`
+		SafetyRatings []geminiSafetyRating `json:"safetyRatings"`
+	} `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason   string               `json:"blockReason"`
+		SafetyRatings []geminiSafetyRating `json:"safetyRatings"`
+	} `json:"promptFeedback"`
+	UsageMetadata struct {
+		PromptTokenCount        int `json:"promptTokenCount"`
+		CandidatesTokenCount    int `json:"candidatesTokenCount"`
+		CachedContentTokenCount int `json:"cachedContentTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+// tokens returns the token counts Gemini reported for a call, estimated from the
+// prompt and answer when it reported none.
+func (r geminiGenerateResponse) tokens(prompt, answer string) TokenUsage {
+	u := reportedOrEstimated(r.UsageMetadata.PromptTokenCount, r.UsageMetadata.CandidatesTokenCount, prompt, answer)
+	u.CachedPromptTokens = r.UsageMetadata.CachedContentTokenCount
+	return u
+}
+
+// geminiBlockingReasons are finish reasons meaning the output was withheld.
+var geminiBlockingReasons = map[string]bool{
+	"SAFETY": true, "RECITATION": true, "BLOCKLIST": true, "PROHIBITED_CONTENT": true, "SPII": true,
+}
+
+// text joins the parts of the first candidate. A blocked prompt or a candidate
+// withheld by a safety finish reason yields ErrContentBlocked.
+func (r geminiGenerateResponse) text() (string, error) {
+	if fb := r.PromptFeedback; fb != nil && fb.BlockReason != "" {
+		return "", fmt.Errorf("%w: prompt blocked (%s%s)", ErrContentBlocked, fb.BlockReason, flaggedCategories(fb.SafetyRatings))
+	}
+	if len(r.Candidates) == 0 {
+		return "", retryable(errors.New("complete: no candidates in response"))
+	}
+	c := r.Candidates[0]
+	var b strings.Builder
+	for _, p := range c.Content.Parts {
+		b.WriteString(p.Text)
+	}
+	if b.Len() == 0 {
+		if geminiBlockingReasons[c.FinishReason] {
+			return "", fmt.Errorf("%w: answer withheld (%s%s)", ErrContentBlocked, c.FinishReason, flaggedCategories(c.SafetyRatings))
+		}
+		return "", retryable(fmt.Errorf("complete: candidate has no text (finish reason %q)", c.FinishReason))
+	}
+	if c.FinishReason == "MAX_TOKENS" {
+		log.Printf("complete: answer truncated at the output token limit")
+	}
+	return b.String(), nil
+}
+
+// flaggedCategories lists the safety categories that caused or risked a block,
+// e.g. "; HARM_CATEGORY_DANGEROUS_CONTENT=HIGH".
+func flaggedCategories(ratings []geminiSafetyRating) string {
+	var out []string
+	for _, r := range ratings {
+		if r.Blocked || r.Probability == "MEDIUM" || r.Probability == "HIGH" {
+			out = append(out, r.Category+"="+r.Probability)
+		}
+	}
+	if len(out) == 0 {
+		return ""
+	}
+	return "; " + strings.Join(out, ", ")
+}
+
+type openAIEmbedResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+			Refusal string `json:"refusal"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens        int `json:"prompt_tokens"`
+		CompletionTokens    int `json:"completion_tokens"`
+		PromptTokensDetails struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"prompt_tokens_details"`
+	} `json:"usage"`
+}
+
+// tokens returns the token counts OpenAI reported for a call, estimated from the
+// prompt and answer when it reported none.
+func (r openAIChatResponse) tokens(prompt, answer string) TokenUsage {
+	u := reportedOrEstimated(r.Usage.PromptTokens, r.Usage.CompletionTokens, prompt, answer)
+	u.CachedPromptTokens = r.Usage.PromptTokensDetails.CachedTokens
+	return u
+}
+
+func reportedOrEstimated(promptTokens, completionTokens int, prompt, answer string) TokenUsage {
+	if promptTokens == 0 && completionTokens == 0 {
+		return TokenUsage{PromptTokens: estimateTokens(prompt), CompletionTokens: estimateTokens(answer)}
+	}
+	return TokenUsage{PromptTokens: promptTokens, CompletionTokens: completionTokens}
+}
+
+func (r openAIChatResponse) text() (string, error) {
+	if len(r.Choices) == 0 {
+		return "", retryable(errors.New("complete: no choices in response"))
+	}
+	c := r.Choices[0]
+	if c.FinishReason == "content_filter" {
+		return "", fmt.Errorf("%w: answer withheld by the OpenAI content filter", ErrContentBlocked)
+	}
+	if c.Message.Refusal != "" {
+		return "", fmt.Errorf("%w: model refused: %s", ErrContentBlocked, c.Message.Refusal)
+	}
+	if c.Message.Content == "" {
+		return "", retryable(fmt.Errorf("complete: choice has no content (finish reason %q)", c.FinishReason))
+	}
+	if c.FinishReason == "length" {
+		log.Printf("complete: answer truncated at the output token limit")
+	}
+	return c.Message.Content, nil
+}
+
+// providerErrorBody is the error envelope both providers use.
+type providerErrorBody struct {
+	Error *struct {
+		Message string `json:"message"`
+		Status  string `json:"status"` // Gemini, e.g. RESOURCE_EXHAUSTED
+		Type    string `json:"type"`   // OpenAI, e.g. insufficient_quota
+	} `json:"error"`
+}
+
+// statusError turns a non-200 provider response into an error carrying the
+// provider's own message when the body is a known error envelope. Rate limits and
+// server errors are retryable.
+func statusError(op string, resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	msg := strings.TrimSpace(string(b))
+	var body providerErrorBody
+	if json.Unmarshal(b, &body) == nil && body.Error != nil && body.Error.Message != "" {
+		msg = body.Error.Message
+		if kind := cmp.Or(body.Error.Status, body.Error.Type); kind != "" {
+			msg = kind + ": " + msg
+		}
+	}
+	err := fmt.Errorf("%s status %d: %s", op, resp.StatusCode, msg)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return retryable(err)
+	}
+	return err
+}
+
+// decodeResponse decodes a 200 response body; a body that is not the expected
+// JSON is treated as a transient provider fault.
+func decodeResponse(op string, r io.Reader, v any) error {
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return retryable(fmt.Errorf("%s: malformed response: %w", op, err))
+	}
+	return nil
+}
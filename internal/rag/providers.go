@@ -0,0 +1,116 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// Each LLM vendor implements Embedder and Completer in its own file. The engine
+// builds one instance per known provider at construction and routes every call
+// of a fallback chain by llmTarget.Provider, so adding a vendor means a new
+// implementation plus an entry in newProviders and providerDefaults.
+
+// Embedder embeds text with one vendor. An empty model selects the vendor's
+// default embedding model.
+type Embedder interface {
+	Embed(ctx context.Context, model, text string) ([]float32, error)
+	EmbedBatch(ctx context.Context, model string, inputs []string) ([][]float32, error)
+}
+
+// Completer generates text with one vendor.
+type Completer interface {
+	Complete(ctx context.Context, req CompletionRequest) (string, error)
+}
+
+// CompletionRequest is one completion call. An empty Model selects the vendor's
+// default completion model; Format asks for JSON matching its schema.
+type CompletionRequest struct {
+	Model       string
+	System      string
+	Prompt      string
+	Format      *ResponseFormat
+	Temperature float64
+	// Seed is only honored by vendors that support it; see seedHonored.
+	Seed *int64
+	// CacheKey groups requests sharing a prompt prefix for vendors whose prompt
+	// cache routes by key; empty leaves routing to the vendor.
+	CacheKey string
+}
+
+// llmProvider is a vendor implementing both interfaces.
+type llmProvider interface {
+	Embedder
+	Completer
+}
+
+// newProviders returns the implementation of every provider LLM_PROVIDER and
+// LLM_FALLBACK_PROVIDERS may name. dimensions is the reduced embedding width to
+// request where supported, 0 for native; embeddingDim sizes the mock vectors.
+func newProviders(client *http.Client, dimensions, embeddingDim int) map[string]llmProvider {
+	return map[string]llmProvider{
+		"gemini": &geminiProvider{client: client},
+		"openai": &openAIProvider{client: client, dimensions: dimensions},
+		"mock":   &mockProvider{dim: embeddingDim},
+	}
+}
+
+// provider returns the implementation of name. Unknown names get Gemini, the
+// default provider, as they always have.
+func (e *engine) provider(name string) llmProvider {
+	if p, ok := e.providers[name]; ok {
+		return p
+	}
+	return e.providers["gemini"]
+}
+
+// embedVia embeds already-normalized text with one provider.
+func (e *engine) embedVia(ctx context.Context, t llmTarget, text string) ([]float32, error) {
+	return e.provider(t.Provider).Embed(ctx, t.EmbeddingModel, text)
+}
+
+// embedBatchVia embeds several already-normalized inputs in a single request to one provider.
+func (e *engine) embedBatchVia(ctx context.Context, t llmTarget, inputs []string) ([][]float32, error) {
+	return e.provider(t.Provider).EmbedBatch(ctx, t.EmbeddingModel, inputs)
+}
+
+// completeVia generates an answer with one provider.
+func (e *engine) completeVia(ctx context.Context, t llmTarget, prompt string, format *ResponseFormat, s sampling) (string, error) {
+	return e.provider(t.Provider).Complete(ctx, CompletionRequest{
+		Model:       t.CompletionModel,
+		System:      systemPrompt,
+		Prompt:      prompt,
+		Format:      format,
+		Temperature: s.Temperature,
+		Seed:        s.Seed,
+		CacheKey:    e.promptCacheKey,
+	})
+}
+
+// postJSON sends body to a provider endpoint and decodes a 200 response into
+// out. Transport failures are retryable; other statuses go through statusError.
+func postJSON(ctx context.Context, client *http.Client, provider, op, endpoint, bearer string, body, out any) error {
+	bs, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(bs))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setProviderHeaders(req, provider)
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return retryable(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return statusError(op, resp)
+	}
+	return decodeResponse(op, resp.Body, out)
+}
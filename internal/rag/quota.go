@@ -0,0 +1,174 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// API_KEY_QUOTAS caps what a client may consume per UTC day or calendar month:
+// answered chat requests and completion output tokens. Entries are
+// comma-separated client:metric/period=limit, e.g.
+// "ci:requests/day=1000,ci:output_tokens/month=2000000,*:requests/day=200", where
+// the client is named as in usage accounting and "*" covers every client without
+// entries of its own. Quotas are checked before a chat calls the model; the
+// request that crosses a token limit still completes, the next one is refused.
+
+// ErrQuotaExceeded is wrapped by the *QuotaError CheckQuota returns.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Quota metrics and periods of API_KEY_QUOTAS.
+const (
+	QuotaRequests     = "requests"
+	QuotaOutputTokens = "output_tokens"
+	QuotaDay          = "day"
+	QuotaMonth        = "month"
+)
+
+var quotaEntryPattern = regexp.MustCompile(`^(.+):(requests|output_tokens)/(day|month)=(\d+)$`)
+
+// Quota is one limit of a client.
+type Quota struct {
+	Metric string
+	Period string
+	Limit  int64
+}
+
+// QuotaError reports the quota a client used up and when it resets.
+type QuotaError struct {
+	Client  string
+	Quota   Quota
+	ResetAt time.Time
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%v: %s reached its limit of %d %s per %s; resets at %s", ErrQuotaExceeded, e.Client, e.Quota.Limit,
+		strings.ReplaceAll(e.Quota.Metric, "_", " "), e.Quota.Period, e.ResetAt.Format(time.RFC3339))
+}
+
+func (e *QuotaError) Unwrap() error { return ErrQuotaExceeded }
+
+// loadQuotas parses API_KEY_QUOTAS into the limits of each client. Malformed
+// entries are logged and skipped.
+func loadQuotas() map[string][]Quota {
+	out := map[string][]Quota{}
+	for _, entry := range strings.Split(config.Get("API_KEY_QUOTAS", ""), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		m := quotaEntryPattern.FindStringSubmatch(entry)
+		if m == nil {
+			log.Printf("API_KEY_QUOTAS: ignoring %q, want client:requests|output_tokens/day|month=limit", entry)
+			continue
+		}
+		limit, err := strconv.ParseInt(m[4], 10, 64)
+		if err != nil {
+			log.Printf("API_KEY_QUOTAS: ignoring %q: %v", entry, err)
+			continue
+		}
+		client := strings.TrimSpace(m[1])
+		out[client] = append(out[client], Quota{Metric: m[2], Period: m[3], Limit: limit})
+	}
+	return out
+}
+
+// quotasFor returns the limits of client: its own, else those of "*".
+func (e *engine) quotasFor(client string) []Quota {
+	if client == "" {
+		return nil
+	}
+	if q, ok := e.quotas[client]; ok {
+		return q
+	}
+	return e.quotas["*"]
+}
+
+func initQuotas(db *sql.DB) error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS quota_counters (
+	client TEXT NOT NULL,
+	period TEXT NOT NULL,
+	requests BIGINT NOT NULL DEFAULT 0,
+	output_tokens BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (client, period)
+);
+`)
+	return err
+}
+
+// quotaPeriods returns the day and month counter keys of now and when they reset.
+func quotaPeriods(now time.Time) (day, month string, dayReset, monthReset time.Time) {
+	now = now.UTC()
+	y, m, d := now.Date()
+	return now.Format("2006-01-02"), now.Format("2006-01"),
+		time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC), time.Date(y, m+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// CheckQuota returns a *QuotaError when client has used up one of its quotas.
+func (e *engine) CheckQuota(ctx context.Context, client string) error {
+	quotas := e.quotasFor(client)
+	if len(quotas) == 0 {
+		return nil
+	}
+	day, month, dayReset, monthReset := quotaPeriods(time.Now())
+	used := map[string][2]int64{}
+	rows, err := e.db.QueryContext(ctx, "SELECT period, requests, output_tokens FROM quota_counters WHERE client="+e.placeholder(1)+" AND period IN ("+e.placeholder(2)+", "+e.placeholder(3)+")", client, day, month)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var period string
+		var requests, tokens int64
+		if err := rows.Scan(&period, &requests, &tokens); err != nil {
+			return err
+		}
+		used[period] = [2]int64{requests, tokens}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, q := range quotas {
+		period, reset := day, dayReset
+		if q.Period == QuotaMonth {
+			period, reset = month, monthReset
+		}
+		n := used[period][0]
+		if q.Metric == QuotaOutputTokens {
+			n = used[period][1]
+		}
+		if n >= q.Limit {
+			return &QuotaError{Client: client, Quota: q, ResetAt: reset}
+		}
+	}
+	return nil
+}
+
+// countQuota adds one request and its output tokens to the day and month
+// counters of client.
+func (e *engine) countQuota(client string, outputTokens int) {
+	day, month, _, _ := quotaPeriods(time.Now())
+	q := `INSERT INTO quota_counters(client, period, requests, output_tokens) VALUES(` + e.placeholders(4) + `)
+ON CONFLICT(client, period) DO UPDATE SET requests=quota_counters.requests+excluded.requests,
+	output_tokens=quota_counters.output_tokens+excluded.output_tokens`
+	unlock := e.lockWrites()
+	defer unlock()
+	ctx := context.Background()
+	for _, period := range []string{day, month} {
+		_, err := withBusyRetries(ctx, "count quota", func() (sql.Result, error) {
+			return e.db.ExecContext(ctx, q, client, period, 1, outputTokens)
+		})
+		if err != nil {
+			log.Printf("count quota of %s: %v", client, err)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// With STORE_RAW_HTML=true a docs crawl keeps the HTML of every page it processes,
+// gzip-compressed, in the page_html table keyed by namespace and canonical URL.
+// Reextract then re-runs section extraction on the stored pages and re-embeds the
+// result, so an extraction improvement reaches the corpus without fetching any
+// page again. Each page's new sections are all stored before its old documents
+// are deleted; when one fails to store or moderation blocks it, the sections
+// stored so far are removed again and the page keeps its old documents.
+
+func initPageHTML(db *sql.DB) error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS page_html (
+	namespace TEXT NOT NULL,
+	url TEXT NOT NULL,
+	html TEXT NOT NULL,
+	fetched_at TEXT NOT NULL,
+	PRIMARY KEY (namespace, url)
+);
+`)
+	return err
+}
+
+// ReextractResult reports a Reextract run. Pages counts the stored pages
+// processed, Failed those left as they were, Replaced the old documents deleted;
+// the IngestResult counts cover the new documents.
+type ReextractResult struct {
+	Namespace string `json:"namespace"`
+	Pages     int    `json:"pages"`
+	Failed    int    `json:"failed"`
+	Replaced  int    `json:"replaced"`
+	IngestResult
+}
+
+// storePageHTML saves the fetched HTML of a page; failures are only logged.
+func (e *engine) storePageHTML(ns string, page fetchedPage) {
+	html, err := encodeContent(string(page.HTML), true)
+	if err != nil {
+		log.Printf("store html of %s: %v", page.CanonicalURL, err)
+		return
+	}
+	stmt := `INSERT INTO page_html(namespace, url, html, fetched_at) VALUES(` + e.placeholders(4) + `)
+ON CONFLICT(namespace, url) DO UPDATE SET html=excluded.html, fetched_at=excluded.fetched_at`
+	unlock := e.lockWrites()
+	defer unlock()
+	// Stored even when the crawl is being interrupted, like its sections.
+	ctx := context.Background()
+	_, err = withBusyRetries(ctx, "store html", func() (sql.Result, error) {
+		return e.db.ExecContext(ctx, stmt, ns, page.CanonicalURL, html, time.Now().UTC().Format(time.RFC3339))
+	})
+	if err != nil {
+		log.Printf("store html of %s: %v", page.CanonicalURL, err)
+	}
+}
+
+// Reextract re-extracts and re-embeds every page of namespace with stored HTML.
+func (e *engine) Reextract(ctx context.Context, namespace string) (ReextractResult, error) {
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return ReextractResult{}, err
+	}
+	res := ReextractResult{Namespace: ns}
+	done, err := e.ops.begin("reextract", ns)
+	if err != nil {
+		return res, err
+	}
+	defer done()
+	e.corpusMu.RLock()
+	defer e.corpusMu.RUnlock()
+
+	old, err := e.pageDocumentIDs(ctx, ns)
+	if err != nil {
+		return res, err
+	}
+	urls, err := e.storedPageURLs(ctx, ns)
+	if err != nil {
+		return res, err
+	}
+	for _, pageURL := range urls {
+		if err := ctx.Err(); err != nil {
+			res.Cancelled = true
+			return res, err
+		}
+		res.Pages++
+		if err := e.reextractPage(ctx, ns, pageURL, old[pageURL], &res); err != nil {
+			if ctx.Err() != nil {
+				res.Cancelled = true
+				return res, ctx.Err()
+			}
+			log.Printf("re-extract %s: %v", pageURL, err)
+			res.Failed++
+		}
+	}
+	return res, nil
+}
+
+// reextractPage replaces the documents oldIDs of one page with the sections
+// extracted from its stored HTML.
+func (e *engine) reextractPage(ctx context.Context, ns, pageURL string, oldIDs []int64, res *ReextractResult) error {
+	var stored string
+	err := e.db.QueryRowContext(ctx, "SELECT html FROM page_html WHERE namespace="+e.placeholder(1)+" AND url="+e.placeholder(2), ns, pageURL).Scan(&stored)
+	if err != nil {
+		return err
+	}
+	html, err := decodeContent(stored)
+	if err != nil {
+		return err
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return err
+	}
+	e.storePageTitle(ns, pageURL, kialiPageTitle(doc))
+	sections, merged := mergeSmallSections(extractKialiSections(doc, pageURL), e.compactMinChars)
+	var outs []upsertOutcome
+	var newIDs []int64
+	for _, sec := range sections {
+		if !e.longEnough(SourceDocs, sec.Content) {
+			continue
+		}
+		out, err := e.storeDocument(ctx, ns, sec.Title, sec.URL, sec.Content)
+		if err != nil {
+			// Removing a partly stored page must not be cancelled halfway.
+			if delErr := e.deleteDocuments(context.WithoutCancel(ctx), newIDs); delErr != nil {
+				log.Printf("re-extract %s: remove new sections: %v", pageURL, delErr)
+			}
+			return err
+		}
+		outs = append(outs, out)
+		newIDs = append(newIDs, out.ID)
+	}
+	// The new sections are committed; removing the old ones must not be cancelled halfway.
+	if err := e.deleteDocuments(context.WithoutCancel(ctx), oldIDs); err != nil {
+		return err
+	}
+	res.Merged += merged
+	for _, out := range outs {
+		res.add(out)
+	}
+	res.Replaced += len(oldIDs)
+	return nil
+}
+
+// pageDocumentIDs returns the document ids of namespace by page URL, the
+// document URL without its fragment.
+func (e *engine) pageDocumentIDs(ctx context.Context, ns string) (map[string][]int64, error) {
+	rows, err := e.db.QueryContext(ctx, "SELECT id, url FROM documents WHERE namespace="+e.placeholder(1), ns)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string][]int64{}
+	for rows.Next() {
+		var id int64
+		var docURL string
+		if err := rows.Scan(&id, &docURL); err != nil {
+			return nil, err
+		}
+		page, _, _ := strings.Cut(docURL, "#")
+		out[page] = append(out[page], id)
+	}
+	return out, rows.Err()
+}
+
+func (e *engine) storedPageURLs(ctx context.Context, ns string) ([]string, error) {
+	rows, err := e.db.QueryContext(ctx, "SELECT url FROM page_html WHERE namespace="+e.placeholder(1)+" ORDER BY url", ns)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var urls []string
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+	return urls, rows.Err()
+}
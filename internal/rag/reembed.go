@@ -0,0 +1,292 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pgvector/pgvector-go"
+)
+
+// ErrReembedRunning is returned by StartReembed while a re-embed is in progress.
+var ErrReembedRunning = errors.New("re-embed already running")
+
+// ErrNoReembed is returned by CancelReembed when no re-embed is in progress.
+var ErrNoReembed = errors.New("no re-embed running")
+
+// ErrReembedLeavesModels is returned by StartReembed for one namespace while other
+// namespaces hold embeddings of another model, which only a re-embed of the whole
+// store brings into the current model's vector space.
+var ErrReembedLeavesModels = errors.New("other namespaces hold embeddings of another model: re-embed the whole store")
+
+// ReembedStatus reports the progress of a corpus re-embed. Total counts the
+// documents and FAQs to re-embed; Done those re-chunked and re-embedded, Failed
+// those left as they were because storing the new version failed or moderation
+// blocked it. Namespace is empty for the whole store. ETASeconds extrapolates the
+// pace so far.
+type ReembedStatus struct {
+	State      string     `json:"state"` // idle, running, completed, cancelled, failed
+	Namespace  string     `json:"namespace,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Total      int        `json:"total"`
+	Done       int        `json:"done"`
+	Failed     int        `json:"failed"`
+	ETASeconds *int64     `json:"eta_seconds,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+// reembedJob is the state of the engine's single re-embed.
+type reembedJob struct {
+	mu     sync.Mutex
+	status ReembedStatus
+	cancel context.CancelFunc
+	// done ends the corpus operation of the running re-embed.
+	done func()
+}
+
+// reembedItem is a document or, with faq set, an FAQ question to re-embed.
+type reembedItem struct {
+	id  int64
+	faq bool
+}
+
+// StartReembed re-chunks and re-embeds every document and re-embeds every FAQ
+// question of a namespace, or of the whole store when namespace is empty, in the
+// background with the current chunking and embedding settings. Documents are
+// replaced one at a time, the new version committed before the old is deleted, so
+// the corpus stays searchable throughout and a failure or cancellation keeps the
+// documents already done. Documents ingested after the start are not revisited.
+// A namespace is refused with ErrReembedLeavesModels while others hold embeddings
+// of another model, so a model switch never leaves mixed vector spaces behind.
+// Only one re-embed runs at a time.
+func (e *engine) StartReembed(namespace string) (ReembedStatus, error) {
+	var ns string
+	if namespace != "" {
+		var err error
+		if ns, err = NormalizeNamespace(namespace); err != nil {
+			return ReembedStatus{}, err
+		}
+	}
+	j := &e.reembed
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status.State == "running" {
+		return j.status, ErrReembedRunning
+	}
+	done, err := e.ops.begin("reembed", ns)
+	if err != nil {
+		return ReembedStatus{}, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	items, err := e.reembedItems(ctx, ns)
+	if err != nil {
+		cancel()
+		done()
+		return ReembedStatus{}, err
+	}
+	started := time.Now()
+	j.status = ReembedStatus{State: "running", Namespace: ns, StartedAt: &started, Total: len(items)}
+	j.cancel, j.done = cancel, done
+	log.Printf("re-embed: %d documents and FAQs in %s", len(items), storeScope(ns))
+	go e.runReembed(ctx, ns, items)
+	return j.status, nil
+}
+
+func storeScope(ns string) string {
+	if ns == "" {
+		return "all namespaces"
+	}
+	return ns
+}
+
+// reembedItems lists the documents, then the FAQs, of ns or of the whole store.
+func (e *engine) reembedItems(ctx context.Context, ns string) ([]reembedItem, error) {
+	if ns != "" {
+		var other int
+		q := "SELECT (SELECT COUNT(1) FROM embeddings WHERE namespace<>" + e.placeholder(1) + " AND (model IS NULL OR model<>" + e.placeholder(2) + "))" +
+			" + (SELECT COUNT(1) FROM faqs WHERE namespace<>" + e.placeholder(3) + " AND (model IS NULL OR model<>" + e.placeholder(4) + "))"
+		model := e.models.EmbeddingModel
+		if err := e.db.QueryRowContext(ctx, q, ns, model, ns, model).Scan(&other); err != nil {
+			return nil, err
+		}
+		if other > 0 {
+			return nil, ErrReembedLeavesModels
+		}
+	}
+	var items []reembedItem
+	for _, table := range []string{"documents", "faqs"} {
+		q := "SELECT id FROM " + table
+		var args []any
+		if ns != "" {
+			q += " WHERE namespace=" + e.placeholder(1)
+			args = append(args, ns)
+		}
+		rows, err := e.db.QueryContext(ctx, q+" ORDER BY id", args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			item := reembedItem{faq: table == "faqs"}
+			if err := rows.Scan(&item.id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// ReembedStatus returns a snapshot of the current or last re-embed.
+func (e *engine) ReembedStatus() ReembedStatus {
+	j := &e.reembed
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	s := j.status
+	if s.State == "" {
+		s.State = "idle"
+	}
+	if s.State == "running" && s.Done+s.Failed > 0 {
+		elapsed := time.Since(*s.StartedAt)
+		eta := int64((elapsed * time.Duration(s.Total-s.Done-s.Failed) / time.Duration(s.Done+s.Failed)).Seconds())
+		s.ETASeconds = &eta
+	}
+	return s
+}
+
+// CancelReembed stops the running re-embed after the document in progress.
+func (e *engine) CancelReembed() (ReembedStatus, error) {
+	j := &e.reembed
+	j.mu.Lock()
+	running := j.status.State == "running"
+	if running {
+		j.cancel()
+	}
+	j.mu.Unlock()
+	if !running {
+		return e.ReembedStatus(), ErrNoReembed
+	}
+	return e.ReembedStatus(), nil
+}
+
+func (e *engine) runReembed(ctx context.Context, ns string, items []reembedItem) {
+	j := &e.reembed
+	update := func(f func(s *ReembedStatus)) {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		f(&j.status)
+	}
+	state := "completed"
+	for _, item := range items {
+		if ctx.Err() != nil {
+			state = "cancelled"
+			break
+		}
+		var err error
+		if item.faq {
+			err = e.reembedFAQ(ctx, item.id)
+		} else {
+			err = e.reembedDocument(ctx, item.id)
+		}
+		if err != nil && ctx.Err() != nil {
+			state = "cancelled"
+			break
+		}
+		update(func(s *ReembedStatus) {
+			if err != nil {
+				s.Failed++
+				s.LastError = err.Error()
+				return
+			}
+			s.Done++
+		})
+		if err != nil && item.faq {
+			log.Printf("re-embed: faq %d: %v", item.id, err)
+		} else if err != nil {
+			log.Printf("re-embed: document %d: %v", item.id, err)
+		}
+	}
+	finished := time.Now()
+	update(func(s *ReembedStatus) {
+		if state == "completed" && s.Failed > 0 && s.Done == 0 {
+			state = "failed"
+		}
+		s.State, s.FinishedAt = state, &finished
+		j.done()
+		log.Printf("re-embed of %s %s in %s: done=%d failed=%d", storeScope(ns), state, finished.Sub(*s.StartedAt).Round(time.Second), s.Done, s.Failed)
+	})
+	j.mu.Lock()
+	j.cancel()
+	j.mu.Unlock()
+}
+
+// reembedDocument replaces one document with a freshly chunked and embedded copy.
+// A document removed since the job started counts as done; one whose new copy
+// fails or is blocked by moderation keeps its old copy.
+func (e *engine) reembedDocument(ctx context.Context, id int64) error {
+	e.corpusMu.RLock()
+	defer e.corpusMu.RUnlock()
+	var ns, title, docURL, stored string
+	err := e.db.QueryRowContext(ctx, "SELECT namespace, title, url, content FROM documents WHERE id="+e.placeholder(1), id).Scan(&ns, &title, &docURL, &stored)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	content, err := decodeContent(stored)
+	if err != nil {
+		return err
+	}
+	// Transcripts are re-cut at their stored chunks to keep their timestamps.
+	stamps, err := e.storedTimestamps(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(stamps) > 0 {
+		_, err = e.storeChunks(ctx, ns, title, docURL, content, retimeTranscript(content, stamps))
+	} else {
+		_, err = e.storeDocument(ctx, ns, title, docURL, content)
+	}
+	if err != nil {
+		return err
+	}
+	// The new copy is committed; removing the old one must not be cancelled halfway.
+	return e.deleteDocuments(context.WithoutCancel(ctx), []int64{id})
+}
+
+// reembedFAQ re-embeds the question of one FAQ. An FAQ removed since the job
+// started counts as done.
+func (e *engine) reembedFAQ(ctx context.Context, id int64) error {
+	var question string
+	err := e.db.QueryRowContext(ctx, "SELECT question FROM faqs WHERE id="+e.placeholder(1), id).Scan(&question)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	vec, served, err := e.embedServed(ctx, e.embeddingChain(), question)
+	if err != nil {
+		return err
+	}
+	stmt := "UPDATE faqs SET vector=" + e.placeholder(1) + ", model=" + e.placeholder(2) + " WHERE id=" + e.placeholder(3)
+	if e.backend == "postgres" {
+		_, err = e.db.ExecContext(ctx, stmt, pgvector.NewVector(vec), served.EmbeddingModel, id)
+		return err
+	}
+	unlock := e.lockWrites()
+	defer unlock()
+	_, err = withBusyRetries(ctx, "re-embed faq", func() (sql.Result, error) {
+		return e.db.ExecContext(ctx, stmt, floatsToBlob(vec), served.EmbeddingModel, id)
+	})
+	return err
+}
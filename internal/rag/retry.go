@@ -0,0 +1,52 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// retryableError marks provider failures worth another attempt: transport errors,
+// rate limits, server errors and malformed responses.
+type retryableError struct{ err error }
+
+func (r retryableError) Error() string { return r.err.Error() }
+func (r retryableError) Unwrap() error { return r.err }
+
+func retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return retryableError{err}
+}
+
+func isRetryable(err error) bool {
+	var r retryableError
+	return errors.As(err, &r)
+}
+
+// retryBaseDelay is the wait before the first retry; it doubles per attempt.
+const retryBaseDelay = 500 * time.Millisecond
+
+// withRetries calls fn up to LLM_RETRIES extra times while it fails with a
+// retryable error.
+func withRetries[T any](ctx context.Context, op string, fn func() (T, error)) (T, error) {
+	retries := max(0, config.GetInt("LLM_RETRIES", 2))
+	delay := retryBaseDelay
+	for attempt := 0; ; attempt++ {
+		v, err := fn()
+		if err == nil || attempt >= retries || !isRetryable(err) || ctx.Err() != nil {
+			return v, err
+		}
+		log.Printf("%s failed, retrying in %s: %v", op, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return v, err
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,37 @@
+package rag
+
+import "fmt"
+
+// defaultTemperature is the completion temperature when a request sets none.
+const defaultTemperature = 0.2
+
+// maxTemperature is the upper bound both providers accept.
+const maxTemperature = 2.0
+
+// sampling holds the generation parameters of one completion call.
+type sampling struct {
+	Temperature float64
+	// Seed is only sent to OpenAI; Gemini has no equivalent, so temperature 0 is
+	// as close to reproducible as it gets there.
+	Seed *int64
+}
+
+var defaultSampling = sampling{Temperature: defaultTemperature}
+
+// sampling returns the request's generation parameters, or ErrInvalidTemperature
+// for a temperature outside [0, 2].
+func (o AnswerOptions) sampling() (sampling, error) {
+	s := sampling{Temperature: defaultTemperature, Seed: o.Seed}
+	if o.Temperature != nil {
+		if t := *o.Temperature; t < 0 || t > maxTemperature {
+			return s, fmt.Errorf("%w: got %g", ErrInvalidTemperature, t)
+		}
+		s.Temperature = *o.Temperature
+	}
+	return s, nil
+}
+
+// seedHonored reports whether provider applies a sampling seed.
+func seedHonored(provider string) bool {
+	return provider == "openai"
+}
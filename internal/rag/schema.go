@@ -0,0 +1,194 @@
+package rag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+var schemaNamePattern = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// parseSchema decodes a JSON schema document and checks that it is an object.
+func parseSchema(raw json.RawMessage) (map[string]any, error) {
+	if len(raw) == 0 {
+		return nil, errors.New("response_format.schema required")
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return nil, fmt.Errorf("invalid response_format.schema: %w", err)
+	}
+	if schema == nil {
+		return nil, errors.New("response_format.schema must be a JSON object")
+	}
+	return schema, nil
+}
+
+// schemaName returns a provider-safe name for the response format.
+func (f *ResponseFormat) schemaName() string {
+	name := schemaNamePattern.ReplaceAllString(f.Name, "_")
+	if name == "" {
+		return "kiali_answer"
+	}
+	return name[:min(64, len(name))]
+}
+
+// strict reports whether the schema qualifies for OpenAI's strict mode, which
+// enforces it during generation: every object requires all of its properties and
+// sets additionalProperties to false. Other schemas are only checked by
+// decodeStructured.
+func (f *ResponseFormat) strict() bool {
+	schema, err := parseSchema(f.Schema)
+	return err == nil && strictSchema(schema)
+}
+
+func strictSchema(schema map[string]any) bool {
+	if props, ok := schema["properties"].(map[string]any); ok || schema["type"] == "object" {
+		if ap, ok := schema["additionalProperties"].(bool); !ok || ap {
+			return false
+		}
+		required := map[string]bool{}
+		req, _ := schema["required"].([]any)
+		for _, r := range req {
+			name, _ := r.(string)
+			required[name] = true
+		}
+		for name, p := range props {
+			sub, ok := p.(map[string]any)
+			if !required[name] || !ok || !strictSchema(sub) {
+				return false
+			}
+		}
+	}
+	if items, ok := schema["items"].(map[string]any); ok {
+		return strictSchema(items)
+	}
+	return true
+}
+
+// Validate reports whether the format carries a usable schema.
+func (f *ResponseFormat) Validate() error {
+	_, err := parseSchema(f.Schema)
+	return err
+}
+
+// decodeStructured parses model output as JSON and validates it against the schema.
+// Models sometimes wrap JSON in markdown fences even in JSON mode, so those are stripped.
+func decodeStructured(text string, schema map[string]any) (any, error) {
+	text = strings.TrimSpace(text)
+	text = strings.TrimPrefix(text, "```json")
+	text = strings.TrimPrefix(text, "```")
+	text = strings.TrimSuffix(text, "```")
+	var v any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(text)), &v); err != nil {
+		return nil, fmt.Errorf("output is not JSON: %w", err)
+	}
+	if err := validateSchema(schema, v, "$"); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// validateSchema checks v against the commonly used subset of JSON Schema:
+// type, enum, properties, required, additionalProperties, items, minItems and maxItems.
+func validateSchema(schema map[string]any, v any, path string) error {
+	if t, ok := schema["type"]; ok {
+		if !matchesType(t, v) {
+			return fmt.Errorf("%s: expected type %v", path, t)
+		}
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value not in enum", path)
+		}
+	}
+	switch val := v.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		if req, ok := schema["required"].([]any); ok {
+			for _, r := range req {
+				name, _ := r.(string)
+				if _, present := val[name]; !present {
+					return fmt.Errorf("%s: missing required property %q", path, name)
+				}
+			}
+		}
+		for k, pv := range val {
+			sub, ok := props[k].(map[string]any)
+			if !ok {
+				if ap, ok := schema["additionalProperties"].(bool); ok && !ap {
+					return fmt.Errorf("%s: unexpected property %q", path, k)
+				}
+				continue
+			}
+			if err := validateSchema(sub, pv, path+"."+k); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if n, ok := schema["minItems"].(float64); ok && float64(len(val)) < n {
+			return fmt.Errorf("%s: expected at least %v items", path, n)
+		}
+		if n, ok := schema["maxItems"].(float64); ok && float64(len(val)) > n {
+			return fmt.Errorf("%s: expected at most %v items", path, n)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, it := range val {
+				if err := validateSchema(items, it, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func matchesType(t any, v any) bool {
+	switch tt := t.(type) {
+	case string:
+		return matchesTypeName(tt, v)
+	case []any:
+		for _, x := range tt {
+			if s, ok := x.(string); ok && matchesTypeName(s, v) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesTypeName(name string, v any) bool {
+	switch name {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	}
+	return true
+}
@@ -0,0 +1,29 @@
+package rag
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestResponseFormatStrict(t *testing.T) {
+	grounding, _ := json.Marshal(groundingSchema)
+	tests := []struct {
+		name   string
+		schema string
+		want   bool
+	}{
+		{"grounding", string(grounding), true},
+		{"closed object", `{"type":"object","properties":{"steps":{"type":"array","items":{"type":"string"}}},"required":["steps"],"additionalProperties":false}`, true},
+		{"optional property", `{"type":"object","properties":{"steps":{"type":"string"},"severity":{"type":"string"}},"required":["steps"],"additionalProperties":false}`, false},
+		{"open object", `{"type":"object","properties":{"steps":{"type":"string"}},"required":["steps"]}`, false},
+		{"open nested object", `{"type":"object","properties":{"items":{"type":"array","items":{"type":"object","properties":{"a":{"type":"string"}},"required":["a"]}}},"required":["items"],"additionalProperties":false}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &ResponseFormat{Schema: json.RawMessage(tt.schema)}
+			if got := f.strict(); got != tt.want {
+				t.Errorf("strict() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
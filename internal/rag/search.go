@@ -0,0 +1,37 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Search returns the k chunks most similar to query without generating an answer,
+// as Answer would retrieve them. URLs carry the same timestamps as citations, and
+// each chunk carries its vector as stored.
+func (e *engine) Search(ctx context.Context, query, namespace string, k int) ([]ContextChunk, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, errors.New("empty query")
+	}
+	if k <= 0 {
+		return nil, errors.New("k must be positive")
+	}
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	vec, t, err := e.embedServed(ctx, e.embeddingChain(), query)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := e.retrieve(ctx, ns, queryEmbedding{Text: query, Vector: vec, Target: t}, e.candidateChunks, k)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ContextChunk, 0, len(docs))
+	snippets := e.querySnippets(ctx, query, docs)
+	for i, d := range docs {
+		out = append(out, ContextChunk{Title: d.Title, URL: citationURL(d), Text: snippets[i], Score: d.Score, Vector: d.Vector})
+	}
+	return out, nil
+}
@@ -0,0 +1,35 @@
+package rag
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSearchRanksSummaryBoost(t *testing.T) {
+	e := NewMockEngine().(*engine)
+	ctx := context.Background()
+	graph, err := e.storeDocument(ctx, DefaultNamespace, "Graph", "https://kiali.io/docs/graph/", "The graph shows traffic between the workloads of the mesh.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := e.storeDocument(ctx, DefaultNamespace, "Wizards", "https://kiali.io/docs/wizards/", "Wizards write a VirtualService and a DestinationRule.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.db.Exec("UPDATE embeddings SET kind=? WHERE document_id=?", chunkKindSummary, summary.ID); err != nil {
+		t.Fatal(err)
+	}
+	var blob []byte
+	if err := e.db.QueryRow("SELECT vector FROM embeddings WHERE document_id=?", graph.ID).Scan(&blob); err != nil {
+		t.Fatal(err)
+	}
+	// The boost lifts the summary over the exact match even with fewer chunks than k.
+	e.summaryScoreBoost = 2
+	found, err := e.search(ctx, DefaultNamespace, blobToFloats(blob), 10, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || found[0].URL != "https://kiali.io/docs/wizards/" {
+		t.Errorf("search = %+v, want the boosted summary first", found)
+	}
+}
@@ -0,0 +1,109 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Docs are stored per section: the document title is the section heading and its
+// URL ends in the heading's #anchor. Citations of such documents name both
+// (SectionTitle, Anchor) and, when the crawl recorded it, the title of the page
+// the section belongs to (PageTitle), so clients can show "Page > Section" and
+// link to the heading. Page titles are kept in the page_titles table by
+// namespace and canonical page URL; pages crawled before it existed get theirs
+// on the next crawl or re-extraction.
+
+func initPageTitles(db *sql.DB) error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS page_titles (
+	namespace TEXT NOT NULL,
+	url TEXT NOT NULL,
+	title TEXT NOT NULL,
+	PRIMARY KEY (namespace, url)
+);
+`)
+	return err
+}
+
+// kialiPageTitle returns the title of a docs page, its first h1 or else the
+// document title, like extractKialiContent.
+func kialiPageTitle(doc *goquery.Document) string {
+	root := doc.Find(".td-content")
+	if root.Length() == 0 {
+		root = doc.Find("main")
+	}
+	if root.Length() == 0 {
+		root = doc.Find("article")
+	}
+	if title := strings.TrimSpace(root.Find("h1").First().Text()); title != "" {
+		return title
+	}
+	return strings.TrimSpace(doc.Find("title").First().Text())
+}
+
+// storePageTitle records the title of a crawled page; failures are only logged,
+// since citations then just lack it.
+func (e *engine) storePageTitle(ns, pageURL, title string) {
+	if title == "" {
+		return
+	}
+	stmt := `INSERT INTO page_titles(namespace, url, title) VALUES(` + e.placeholders(3) + `)
+ON CONFLICT(namespace, url) DO UPDATE SET title=excluded.title`
+	unlock := e.lockWrites()
+	defer unlock()
+	ctx := context.Background()
+	_, err := withBusyRetries(ctx, "store page title", func() (sql.Result, error) {
+		return e.db.ExecContext(ctx, stmt, ns, pageURL, title)
+	})
+	if err != nil {
+		log.Printf("store title of %s: %v", pageURL, err)
+	}
+}
+
+// annotateSections fills the section fields of the citations whose URL has an
+// anchor, other than video links.
+func (e *engine) annotateSections(ctx context.Context, ns string, citations []Citation) {
+	var pages []any
+	seen := map[string]bool{}
+	for i := range citations {
+		c := &citations[i]
+		page, anchor, ok := strings.Cut(c.URL, "#")
+		if !ok || anchor == "" || strings.Contains(page, "youtube.com/") {
+			continue
+		}
+		c.SectionTitle, c.Anchor = c.Title, anchor
+		if !seen[page] {
+			seen[page] = true
+			pages = append(pages, page)
+		}
+	}
+	if len(pages) == 0 {
+		return
+	}
+	titles := map[string]string{}
+	rows, err := e.db.QueryContext(ctx, "SELECT url, title FROM page_titles WHERE url IN ("+e.placeholders(len(pages))+") AND namespace="+e.placeholder(len(pages)+1), append(pages, ns)...)
+	if err != nil {
+		log.Printf("page titles lookup failed: %v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var u, title string
+		if err := rows.Scan(&u, &title); err != nil {
+			log.Printf("page titles lookup failed: %v", err)
+			return
+		}
+		titles[u] = title
+	}
+	for i := range citations {
+		if citations[i].Anchor == "" {
+			continue
+		}
+		page, _, _ := strings.Cut(citations[i].URL, "#")
+		citations[i].PageTitle = titles[page]
+	}
+}
@@ -14,8 +14,11 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
@@ -42,50 +45,205 @@ type engine struct {
 	httpClient   *http.Client
 	backend      string // "sqlite" or "postgres"
 	embeddingDim int
+	// embedDimensions is the reduced width requested from the provider, 0 for native.
+	embedDimensions int
+
+	// embedding input preprocessing
+	preprocessEmbeddings bool
+	stripMarkdown        bool
+
+	compressContent bool
+	// storeRawHTML keeps the HTML of crawled pages for Reextract.
+	storeRawHTML bool
+
+	// maxPromptTokens caps the estimated prompt size; zero or less disables it.
+	maxPromptTokens int
+
+	// crawl decides which discovered links a docs crawl follows.
+	crawl crawlFilter
+	// crawlStrategy orders the crawl frontier; see crawlQueue. crawlMaxPages caps
+	// the pages fetched per run, zero for no cap.
+	crawlStrategy string
+	crawlMaxPages int
+	// crawlWorkers is the number of pages a crawl fetches and parses at once.
+	crawlWorkers int
+	// crawlLimits caps the frontier and visited set of a crawl.
+	crawlLimits crawlLimits
+	// minContentChars is the shortest content stored, by source type.
+	minContentChars map[string]int
+	// primary is the LLM_PROVIDER, first in every provider chain.
+	primary string
+	// promptCacheKey is PROMPT_CACHE_KEY; see CompletionRequest.CacheKey.
+	promptCacheKey string
+	// groundingMode is GROUNDING_CHECK; see checkGrounding.
+	groundingMode string
+	// events publishes AnswerEvents to EVENTS_SINK; nil when unset.
+	events *eventPublisher
+	// providers implement the calls to each LLM vendor; see newProviders.
+	providers map[string]llmProvider
+	// fallbacks are tried in order when the primary provider fails.
+	fallbacks []llmTarget
+	// breakers fail calls fast while a provider keeps failing.
+	breakers *breakers
+
+	// compactMinChars is the section size below which neighbours are merged; zero disables it.
+	compactMinChars int
+	// chunkCap bounds the chunks embedded per document; see loadChunkCap.
+	chunkCap chunkCap
+	// titleIndex embeds document titles for navigational queries; see pinTitleMatches.
+	titleIndex bool
+	// keywordFallback retrieves by keyword when the query cannot be embedded; see keywordSearch.
+	keywordFallback bool
+
+	// ingest summaries; see summaryChunks. summaryScoreBoost is added to the
+	// similarity of summary chunks so they win over comparable raw chunks.
+	summaryMode       string
+	summaryMinChars   int
+	summaryScoreBoost float64
+
+	// contextTiers are larger-context completion models a prompt too big for the
+	// default model is routed to; see routeForContext.
+	contextTiers []string
+
+	// mmrLambda enables MMR re-selection of retrieved chunks when in [0,1); see
+	// retrieve.
+	mmrLambda float64
+	// candidateChunks and promptChunks are the default retrieval and prompt widths
+	// of Answer; see loadChunkCounts.
+	candidateChunks int
+	promptChunks    int
+	// searchMaxK bounds every vector search; see clampK.
+	searchMaxK int
+	// freshness decays search scores by document age; see loadFreshness.
+	freshness freshness
+
+	// embedCache reuses stored vectors for identical chunk text; see embedChunksCached.
+	embedCache bool
+	// embedCheckpoints saves the vectors of large documents before they are
+	// stored; see embedChunksCheckpointed.
+	embedCheckpoints bool
+	// embedEnsemble searches the embeddings of every stored model; see candidates.
+	embedEnsemble bool
+	// moderation screens ingested chunks and answers; nil when MODERATION is off.
+	moderation *moderator
+	// footer is appended to free-text answers; nil when ANSWER_FOOTER is off.
+	footer *answerFooter
+	// longInputMode handles inputs over the embedding model's limit; see embedInput.
+	longInputMode string
+	// chunkSplitter is CHUNK_SPLITTER; see splitDocument.
+	chunkSplitter string
+	// keywords extracts per-chunk keywords; nil when CHUNK_KEYWORDS is off.
+	keywords *keywordExtractor
+	// quotas are the API_KEY_QUOTAS limits by client; see CheckQuota.
+	quotas map[string][]Quota
+
+	// writeMu serializes SQLite writers; see lockWrites.
+	writeMu sync.Mutex
+	// storeDim is the recorded SQLite vector width, 0 while the store is empty.
+	storeDim atomic.Int64
+	// corpusMu is held shared by ingests and exclusively by Vacuum, CleanOrphans
+	// and, without exclusive operations, Compact.
+	corpusMu sync.RWMutex
+	// ops admits one corpus operation per namespace at a time; see corpusOps.
+	ops corpusOps
+	// queue feeds queued document ids to the embedding workers; nil embeds inline.
+	queue chan int64
+	// reembed tracks the background re-embed; see StartReembed.
+	reembed reembedJob
+	// flights shares identical Answer calls in progress when coalesceAnswers is set.
+	flights         answerFlights
+	coalesceAnswers bool
 }
 
 func NewEngine() Engine {
+	dbPath := os.Getenv("VECTOR_DB_PATH")
+	if dbPath == "" {
+		dbPath = "./data/rag.sqlite"
+	}
+	return newEngine(strings.ToLower(config.Get("LLM_PROVIDER", "gemini")), strings.ToLower(config.Get("VECTOR_BACKEND", "sqlite")), dbPath)
+}
+
+// newEngine builds the engine for an LLM provider and a vector backend; dbPath
+// is the SQLite database, unused with Postgres.
+func newEngine(provider, backend, dbPath string) *engine {
 	// Provider selection and model defaults
-	provider := strings.ToLower(config.Get("LLM_PROVIDER", "gemini"))
-	compDef := "gemini-1.5-flash"
-	embDef := "text-embedding-004"
+	def, ok := providerDefaults[provider]
+	if !ok {
+		def = providerDefaults["gemini"]
+	}
 	defEmbDim := 1536
-	if provider == "openai" {
-		compDef = "gpt-4o-mini"
-		embDef = "text-embedding-3-small"
-		defEmbDim = 1536
-	}
-	completionModel := config.Get("COMPLETION_MODEL", compDef)
-	embeddingModel := config.Get("EMBEDDING_MODEL", embDef)
-	apiKey := os.Getenv("GEMINI_API_KEY")
+	completionModel := config.Get("COMPLETION_MODEL", def.CompletionModel)
+	embeddingModel := config.Get("EMBEDDING_MODEL", def.EmbeddingModel)
+	apiKey := config.Get("GEMINI_API_KEY", "")
 	if apiKey == "" {
-		apiKey = os.Getenv("OPENAI_API_KEY")
+		apiKey = config.Get("OPENAI_API_KEY", "")
+	}
+
+	if err := checkProviderHeaders(provider); err != nil {
+		log.Fatalf("provider attribution: %v", err)
+	}
+	crawl, err := loadCrawlFilter()
+	if err != nil {
+		log.Fatalf("crawl filters: %v", err)
+	}
+	crawlStrategy, err := loadCrawlStrategy()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	crawlLimits, err := loadCrawlLimits()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	groundingMode, err := loadGroundingMode()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	events, err := loadEventPublisher()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	moderation, err := loadModerator()
+	if err != nil {
+		log.Fatalf("moderation: %v", err)
+	}
+	footer, err := loadAnswerFooter()
+	if err != nil {
+		log.Fatalf("answer footer: %v", err)
 	}
 
-	backend := strings.ToLower(config.Get("VECTOR_BACKEND", "sqlite"))
 	embDim := defEmbDim
 	if v := config.Get("EMBEDDING_DIM", ""); v != "" {
 		if i, err := strconv.Atoi(v); err == nil {
 			embDim = i
 		}
 	}
+	// EMBEDDING_DIMENSIONS asks the provider for shorter vectors, so it also sets the stored width.
+	embedDimensions := config.GetInt("EMBEDDING_DIMENSIONS", 0)
+	if embedDimensions > 0 {
+		if config.Get("EMBEDDING_DIM", "") != "" && embDim != embedDimensions {
+			log.Fatalf("EMBEDDING_DIM=%d conflicts with EMBEDDING_DIMENSIONS=%d", embDim, embedDimensions)
+		}
+		embDim = embedDimensions
+		if provider != "openai" || !supportsDimensions(embeddingModel) {
+			log.Printf("EMBEDDING_DIMENSIONS is only sent to OpenAI text-embedding-3 models; %s/%s must return %d dimensions natively", provider, embeddingModel, embDim)
+		}
+	}
 
 	var db *sql.DB
-	var err error
+	var storeDim int
 	if backend == "postgres" {
 		dsn := buildPostgresDSN()
 		db, err = sql.Open("pgx", dsn)
 		if err != nil {
 			log.Fatalf("open postgres: %v", err)
 		}
+		if embDim, err = resolvePostgresDim(db, embDim, embedDimensions); err != nil {
+			log.Fatalf("%v", err)
+		}
 		if err := initPostgres(db, embDim); err != nil {
 			log.Fatalf("init postgres schema: %v", err)
 		}
 	} else {
-		dbPath := os.Getenv("VECTOR_DB_PATH")
-		if dbPath == "" {
-			dbPath = "./data/rag.sqlite"
-		}
 		if dir := filepath.Dir(dbPath); dir != "" && dir != "." {
 			if err := os.MkdirAll(dir, 0o755); err != nil {
 				log.Fatalf("create db dir: %v", err)
@@ -101,104 +259,435 @@ func NewEngine() Engine {
 		if err := initSqlite(db); err != nil {
 			log.Fatalf("init sqlite schema: %v", err)
 		}
+		if storeDim, err = loadSqliteDim(db); err != nil {
+			log.Fatalf("load sqlite embedding dimension: %v", err)
+		}
 	}
 
-	return &engine{
+	eng := &engine{
 		apiKey:       apiKey,
 		models:       ModelIdentifiers{CompletionModel: completionModel, EmbeddingModel: embeddingModel},
 		db:           db,
-		httpClient:   &http.Client{Timeout: 20 * time.Second},
+		httpClient:   newHTTPClient(20 * time.Second),
 		backend:      backend,
 		embeddingDim: embDim,
-	}
+
+		embedDimensions: embedDimensions,
+
+		preprocessEmbeddings: config.GetBool("EMBED_PREPROCESS", true),
+		stripMarkdown:        config.GetBool("EMBED_STRIP_MARKDOWN", false),
+
+		compressContent: config.GetBool("CONTENT_COMPRESSION", false),
+		storeRawHTML:    config.GetBool("STORE_RAW_HTML", false),
+
+		maxPromptTokens: maxPromptTokens(completionModel),
+		crawl:           crawl,
+		crawlStrategy:   crawlStrategy,
+		crawlMaxPages:   config.GetInt("CRAWL_MAX_PAGES", 0),
+		crawlWorkers:    loadCrawlWorkers(),
+		crawlLimits:     crawlLimits,
+		groundingMode:   groundingMode,
+		events:          events,
+
+		minContentChars: loadMinContentChars(),
+		fallbacks:       loadFallbacks(),
+		breakers:        loadBreakers(),
+		compactMinChars: config.GetInt("COMPACT_MIN_CHARS", 0),
+		chunkCap:        loadChunkCap(),
+		titleIndex:      config.GetBool("TITLE_INDEX", false),
+		keywordFallback: config.GetBool("KEYWORD_FALLBACK", false),
+		promptCacheKey:  strings.TrimSpace(config.Get("PROMPT_CACHE_KEY", "")),
+
+		summaryMode:       loadSummaryMode(),
+		summaryMinChars:   config.GetInt("SUMMARY_MIN_CHARS", 4000),
+		summaryScoreBoost: summaryScoreBoost(),
+
+		contextTiers: loadContextTiers(),
+
+		mmrLambda: loadMMRLambda(),
+
+		embedCache:       config.GetBool("EMBED_CACHE", true),
+		embedCheckpoints: config.GetBool("EMBED_CHECKPOINTS", true),
+		ops:              corpusOps{exclusive: config.GetBool("CORPUS_OPS_EXCLUSIVE", true)},
+		embedEnsemble:    config.GetBool("EMBED_ENSEMBLE", false),
+		longInputMode:    loadLongInputMode(),
+		chunkSplitter:    loadChunkSplitter(),
+		keywords:         loadKeywordExtractor(),
+		quotas:           loadQuotas(),
+		coalesceAnswers:  config.GetBool("CHAT_COALESCE", true),
+		moderation:       moderation,
+		footer:           footer,
+	}
+	eng.primary = provider
+	eng.providers = newProviders(eng.httpClient, embedDimensions, embDim)
+	eng.candidateChunks, eng.promptChunks = loadChunkCounts()
+	eng.searchMaxK = loadSearchMaxK()
+	eng.freshness = loadFreshness()
+	eng.storeDim.Store(int64(storeDim))
+	if workers := config.GetInt("EMBED_QUEUE_WORKERS", 0); workers > 0 {
+		if err := eng.startEmbedQueue(workers, config.GetInt("EMBED_QUEUE_SIZE", 256)); err != nil {
+			log.Fatalf("start embed queue: %v", err)
+		}
+	}
+	return eng
 }
 
-func (e *engine) Answer(ctx context.Context, query string, kialiContext any) (string, []Citation, ModelIdentifiers, error) {
+func (e *engine) answer(ctx context.Context, query string, kialiContext any, opts AnswerOptions) (res AnswerResult, err error) {
+	res = AnswerResult{Models: e.models}
+	ctx, meter := withTokenMeter(ctx)
+	defer func() { res.Usage = meter.usage() }()
 	if strings.TrimSpace(query) == "" {
-		return "", nil, e.models, errors.New("empty query")
+		return res, errors.New("empty query")
 	}
-	emb, err := e.embed(ctx, query)
+	ns, err := NormalizeNamespace(opts.Namespace)
 	if err != nil {
-		return "", nil, e.models, err
+		return res, err
+	}
+	compChain, embChain := e.providerChain(), e.embeddingChain()
+	if err := e.applyModelOverrides(opts, compChain, embChain); err != nil {
+		return res, err
 	}
-	docs, err := e.search(ctx, emb, 8)
+	samp, err := opts.sampling()
 	if err != nil {
-		return "", nil, e.models, err
+		return res, err
 	}
-
-	prompt := buildPrompt(query, kialiContext, docs)
-	answer, err := e.complete(ctx, prompt)
+	candidateK, promptK, err := opts.chunkCounts(e.candidateChunks, e.promptChunks)
 	if err != nil {
-		return "", nil, e.models, err
+		return res, err
 	}
-	cit := make([]Citation, 0, len(docs))
-	for _, d := range docs {
-		cit = append(cit, Citation{Title: d.Title, URL: d.URL, Span: d.Snippet})
+	if err := opts.SourceWeights.validate(); err != nil {
+		return res, err
 	}
-	return answer, cit, e.models, nil
-}
-
-func (e *engine) IngestKialiDocs(ctx context.Context, base string) (int, int, error) {
-	u, err := url.Parse(base)
+	tr := traceFrom(ctx)
+	tr.started(ns, candidateK, promptK)
+	language, err := answerLanguage(opts.Language)
 	if err != nil {
-		return 0, 0, err
+		return res, err
 	}
-	if u.Scheme == "" {
-		u.Scheme = "https"
+	langNote := languageInstruction(language)
+	var schema map[string]any
+	if opts.ResponseFormat != nil {
+		if schema, err = parseSchema(opts.ResponseFormat.Schema); err != nil {
+			return res, err
+		}
 	}
-	if u.Host == "" {
-		u.Host = "kiali.io"
+	var clock stageClock
+	defer func() { err = clock.annotate(err); clock.end() }()
+	rctx := clock.begin(ctx, StageRetrieval, stageTimeout("RETRIEVAL_TIMEOUT_SECONDS"))
+	emb, embTarget, err := e.embedServed(rctx, embChain, query)
+	if err != nil && (!e.keywordFallback || rctx.Err() != nil) {
+		return res, err
 	}
+	var docs []docChunk
+	if err != nil {
+		log.Printf("embedding failed, retrieving by keyword: %v", err)
+		res.Degraded = true
+		res.Models.EmbeddingModel, res.Models.EmbeddingProvider = "", ""
+		if docs, err = e.keywordSearch(rctx, ns, query, promptK); err != nil {
+			return res, err
+		}
+	} else {
+		res.Models.EmbeddingModel, res.Models.EmbeddingProvider = embTarget.EmbeddingModel, embTarget.Provider
+		tr.embedded(embTarget, len(emb))
+		// Curated answers need the default embedding space and a free-text reply, and
+		// are stored in English.
+		if opts.EmbeddingModel == "" && opts.ResponseFormat == nil && langNote == "" {
+			if f, score, ok := e.curatedAnswer(rctx, ns, emb); ok {
+				res.Answer, res.CuratedID, res.Confidence = f.Answer, f.ID, math.Round(score*100)/100
+				res.Models.CompletionModel = ""
+				res.Citations = []Citation{}
+				if opts.GroupCitations {
+					res.Sources = []CitationGroup{}
+				}
+				e.appendFooter(ctx, ns, &res)
+				return res, nil
+			}
+		}
+		docs, err = e.retrieve(rctx, ns, queryEmbedding{Text: query, Vector: emb, Target: embTarget, Weights: opts.SourceWeights}, candidateK, promptK)
+		if err != nil {
+			return res, err
+		}
+		kialiContext = e.focusKialiContext(rctx, emb, embTarget, kialiContext)
+	}
+	clock.end()
 
-	visited := map[string]bool{}
-	queue := []string{u.String()}
-	ingested, skipped := 0, 0
-	for len(queue) > 0 {
-		curr := queue[0]
-		queue = queue[1:]
-		if visited[curr] {
-			continue
+	// Chunks dropped to fit the prompt are not cited either.
+	budget := math.MaxInt
+	if e.maxPromptTokens > 0 {
+		overhead := estimateTokens(systemPrompt) + estimateTokens(langNote)
+		if opts.ResponseFormat != nil {
+			overhead += estimateTokens(string(opts.ResponseFormat.Schema)) + 16
+		}
+		budget = e.maxPromptTokens - overhead
+		// A larger-context model beats trimming, unless the caller chose the model.
+		if need := promptTokens(query, kialiContext, docs); need > budget && opts.CompletionModel == "" {
+			if m, b, ok := e.routeForContext(need, overhead, budget); ok {
+				log.Printf("prompt of ~%d tokens exceeds %s budget of %d; routing to %s", need, compChain[0].CompletionModel, budget, m)
+				res.Models.RoutedFrom = compChain[0].CompletionModel
+				compChain[0].CompletionModel, budget = m, b
+			}
 		}
-		visited[curr] = true
-		if !strings.Contains(curr, "kiali.io") {
-			continue
+	}
+	prompt, docs := fitPrompt(query, kialiContext, docs, budget)
+	prompt += langNote
+	tr.prompted(docs, prompt)
+	cctx := clock.begin(ctx, StageCompletion, stageTimeout("LLM_TIMEOUT_SECONDS"))
+	answer, compTarget, err := e.complete(cctx, compChain, prompt, opts.ResponseFormat, samp)
+	if err != nil {
+		return res, err
+	}
+	clock.end()
+	if answer, res.Redacted, err = e.moderateAnswer(ctx, ns, query, answer); err != nil {
+		return res, err
+	}
+	res.Models.CompletionModel, res.Models.CompletionProvider = compTarget.CompletionModel, compTarget.Provider
+	if compTarget.Provider != compChain[0].Provider {
+		// A fallback provider served the prompt with its own model.
+		res.Models.RoutedFrom = ""
+	}
+	if samp.Seed != nil && seedHonored(compTarget.Provider) {
+		res.Seed = samp.Seed
+	}
+	log.Printf("answer models: completion=%s/%s embedding=%s/%s",
+		res.Models.CompletionProvider, res.Models.CompletionModel, res.Models.EmbeddingProvider, res.Models.EmbeddingModel)
+	var cited []int
+	if opts.ResponseFormat == nil {
+		answer, res.Grounding = e.checkGrounding(ctx, compChain, answer, docs)
+		answer, cited = resolveCitationMarkers(answer, len(docs))
+	}
+	res.Answer = answer
+	if schema != nil {
+		// Fall back to the plain text answer when the model output does not satisfy the schema.
+		if structured, err := decodeStructured(answer, schema); err != nil {
+			log.Printf("structured output rejected, falling back to text: %v", err)
+		} else {
+			res.Structured = structured
 		}
+	}
+	res.Confidence = answerConfidence(docs)
+	res.Citations = make([]Citation, 0, len(docs))
+	spans := e.querySnippets(ctx, query, docs)
+	for i, d := range docs {
+		res.Citations = append(res.Citations, Citation{Title: d.Title, URL: citationURL(d), Span: spans[i], Score: d.Score})
+		if opts.IncludeContext {
+			res.Context = append(res.Context, ContextChunk{Title: d.Title, URL: d.URL, Text: d.Snippet, Score: d.Score})
+		}
+	}
+	markCited(res.Citations, cited)
+	e.annotateSections(ctx, ns, res.Citations)
+	if opts.GroupCitations {
+		res.Sources = groupCitations(docs, spans)
+	}
+	if opts.ResponseFormat == nil {
+		e.appendFooter(ctx, ns, &res)
+	}
+	return res, nil
+}
 
-		doc, err := e.fetchDoc(curr)
+// IngestKialiDocs crawls the seeds, or resumes crawl opts.CrawlID, and records
+// the run in the sources table.
+func (e *engine) IngestKialiDocs(ctx context.Context, seeds []string, opts IngestOptions) (IngestResult, error) {
+	var resume *crawlFrontier
+	if opts.CrawlID != "" {
+		f, err := e.loadCrawl(ctx, opts.Namespace, opts.CrawlID)
 		if err != nil {
-			continue
+			return IngestResult{}, err
+		}
+		seeds, resume = f.Seeds, &f
+	}
+	res, err := e.ingestKialiDocs(ctx, seeds, opts, resume)
+	res.Cancelled = err != nil && ctx.Err() != nil
+	e.recordSource(opts.Namespace, SourceDocs, strings.Join(seeds, ","), res, err)
+	return res, err
+}
+
+// ingestKialiDocs crawls from every seed in one run, or with resume from a saved
+// frontier. The seeds share a visited set, so pages cross-linked between entry
+// points are fetched once.
+func (e *engine) ingestKialiDocs(ctx context.Context, seeds []string, opts IngestOptions, resume *crawlFrontier) (IngestResult, error) {
+	var result IngestResult
+	if len(seeds) == 0 {
+		return result, errors.New("no seed URLs")
+	}
+	ns, err := NormalizeNamespace(opts.Namespace)
+	if err != nil {
+		return result, err
+	}
+	done, err := e.ops.begin("ingest-docs", ns)
+	if err != nil {
+		return result, err
+	}
+	defer done()
+	e.corpusMu.RLock()
+	defer e.corpusMu.RUnlock()
+	logFetchHeaders(opts.Headers)
+	queue := crawlQueue{strategy: e.crawlStrategy}
+	visited := map[string]bool{}
+	// pages holds the canonical URLs processed in this crawl, so a page reached
+	// under several URLs (redirects, aliases) is ingested once.
+	pages := map[string]bool{}
+	fetched := 0
+	limit := crawlCap{crawlLimits: e.crawlLimits}
+	if resume != nil {
+		queue, visited, pages, fetched = resume.restore()
+		log.Printf("resuming crawl %s: %d pages fetched, %d links queued", opts.CrawlID, fetched, queue.len())
+	} else {
+		for _, base := range seeds {
+			u, err := url.Parse(strings.TrimSpace(base))
+			if err != nil {
+				return result, fmt.Errorf("seed %q: %w", base, err)
+			}
+			if u.Scheme == "" {
+				u.Scheme = "https"
+			}
+			if u.Host == "" {
+				u.Host = "kiali.io"
+			}
+			queue.push(u.String())
+		}
+	}
+	cp := e.newCrawlCheckpoint(ns, seeds, opts.CrawlID, fetched)
+	// interrupted saves the frontier with the pages of pending queued again, so a
+	// resume fetches them first.
+	interrupted := func(pending []crawlItem, err error) (IngestResult, error) {
+		queue.unpop(pending...)
+		for _, it := range pending {
+			delete(visited, it.url)
 		}
-		sections := extractKialiSections(doc, curr)
-		for _, sec := range sections {
-			if len(strings.TrimSpace(sec.Content)) < 10 {
+		fetched -= len(pending)
+		result.CrawlID = cp.save(&queue, visited, pages, fetched)
+		limit.report(&result)
+		return result, err
+	}
+
+	for queue.len() > 0 {
+		if cp.due(fetched) {
+			cp.save(&queue, visited, pages, fetched)
+		}
+		if err := ctx.Err(); err != nil {
+			return interrupted(nil, err)
+		}
+		var batch []crawlItem
+		capped := false
+		for len(batch) < e.crawlWorkers && queue.len() > 0 {
+			it := queue.pop()
+			curr := it.url
+			if visited[curr] {
 				continue
 			}
-			exists, _ := e.documentExists(ctx, sec.URL)
-			if exists {
-				skipped++
+			visited[curr] = true
+			if !strings.Contains(curr, "kiali.io") {
 				continue
 			}
-			upErr := e.upsertDocument(ctx, sec.Title, sec.URL, sec.Content)
-			if upErr != nil {
-				log.Printf("upsert error: %v", upErr)
+			if e.crawl.denied(curr) {
+				result.Denied++
 				continue
 			}
-			ingested++
+			if e.crawlMaxPages > 0 && fetched >= e.crawlMaxPages {
+				log.Printf("crawl stopped after CRAWL_MAX_PAGES=%d pages, %d links left", e.crawlMaxPages, queue.len()+1)
+				capped = true
+				break
+			}
+			fetched++
+			opts.report(len(visited), curr, result)
+			batch = append(batch, it)
 		}
 
-		for _, link := range collectKialiLinks(doc, curr) {
-			if strings.Contains(link, "kiali.io") && !visited[link] && shouldCrawl(link) {
-				queue = append(queue, link)
+		for i, page := range e.crawlBatch(ctx, batch, opts.Headers) {
+			curr := batch[i].url
+			if page.err != nil {
+				if ctx.Err() != nil {
+					return interrupted(batch[i:], ctx.Err())
+				}
+				continue
+			}
+			if pages[page.CanonicalURL] {
+				log.Printf("skipping %s: already ingested as %s", curr, page.CanonicalURL)
+				continue
+			}
+			pages[page.CanonicalURL] = true
+			visited[page.FinalURL] = true
+			if page.CanonicalURL != curr && e.crawl.denied(page.CanonicalURL) {
+				log.Printf("skipping %s: %s is denylisted", curr, page.CanonicalURL)
+				result.Denied++
+				continue
+			}
+			if e.storeRawHTML {
+				e.storePageHTML(ns, page.fetchedPage)
+			}
+			e.storePageTitle(ns, page.CanonicalURL, page.title)
+			result.Merged += page.merged
+			for _, sec := range page.sections {
+				if !e.longEnough(SourceDocs, sec.Content) {
+					continue
+				}
+				exists, _ := e.documentExists(ctx, ns, sec.URL)
+				if exists {
+					result.Skipped++
+					continue
+				}
+				out, upErr := e.upsertDocument(ctx, ns, sec.Title, sec.URL, sec.Content)
+				if upErr != nil {
+					log.Printf("upsert error: %v", upErr)
+					continue
+				}
+				result.add(out)
+			}
+			if ctx.Err() != nil {
+				// Sections stored before the interruption are skipped on resume.
+				delete(pages, page.CanonicalURL)
+				return interrupted(batch[i:], ctx.Err())
+			}
+
+			var links []string
+			for _, link := range page.links {
+				if !visited[link] && e.crawl.denied(link) {
+					// Counted once, never fetched.
+					visited[link] = true
+					result.Denied++
+					continue
+				}
+				if !visited[link] && e.crawl.shouldCrawl(link) {
+					links = append(links, link)
+				}
 			}
+			queue.push(limit.admit(links, queue.len(), len(visited))...)
+		}
+		if capped {
+			break
 		}
 	}
-	return ingested, skipped, nil
+	cp.finish()
+	limit.report(&result)
+	return result, nil
+}
+
+// IngestYouTube ingests the videos and playlists of channelOrPlaylistURL and
+// records the run in the sources table.
+func (e *engine) IngestYouTube(ctx context.Context, channelOrPlaylistURL string, opts IngestOptions) (IngestResult, error) {
+	res, err := e.ingestYouTube(ctx, channelOrPlaylistURL, opts)
+	res.Cancelled = err != nil && ctx.Err() != nil
+	e.recordSource(opts.Namespace, SourceYouTube, strings.TrimSpace(channelOrPlaylistURL), res, err)
+	return res, err
 }
 
-func (e *engine) IngestYouTube(ctx context.Context, channelOrPlaylistURL string) (int, int, error) {
+func (e *engine) ingestYouTube(ctx context.Context, channelOrPlaylistURL string, opts IngestOptions) (IngestResult, error) {
+	var result IngestResult
+	logFetchHeaders(opts.Headers)
 	if !strings.Contains(channelOrPlaylistURL, "http") {
-		return 0, 0, errors.New("expect URLs or use external ingestion pipeline")
+		return result, errors.New("expect URLs or use external ingestion pipeline")
 	}
+	ns, err := NormalizeNamespace(opts.Namespace)
+	if err != nil {
+		return result, err
+	}
+	done, err := e.ops.begin("ingest-youtube", ns)
+	if err != nil {
+		return result, err
+	}
+	defer done()
+	e.corpusMu.RLock()
+	defer e.corpusMu.RUnlock()
 	// If a single playlist URL is given, expand to video URLs
 	urlsStr := strings.Split(channelOrPlaylistURL, ",")
 	var urls []string
@@ -210,19 +699,7 @@ func (e *engine) IngestYouTube(ctx context.Context, channelOrPlaylistURL string)
 		urls = append(urls, s)
 	}
 
-	expanded := make([]string, 0, len(urls))
-	for _, u := range urls {
-		if isYouTubePlaylistURL(u) {
-			vs, err := e.expandPlaylist(ctx, u)
-			if err != nil {
-				log.Printf("playlist expand error: %v", err)
-			} else {
-				expanded = append(expanded, vs...)
-			}
-		} else {
-			expanded = append(expanded, u)
-		}
-	}
+	expanded := e.expandURLs(ctx, urls, opts.Headers)
 	// Deduplicate expanded URLs
 	seen := map[string]bool{}
 	final := make([]string, 0, len(expanded))
@@ -233,44 +710,36 @@ func (e *engine) IngestYouTube(ctx context.Context, channelOrPlaylistURL string)
 		}
 	}
 
-	ingested, skipped := 0, 0
-	for _, u := range final {
-		exists, _ := e.documentExists(ctx, u)
-		if exists {
-			skipped++
-			continue
-		}
-		body, err := e.fetchRaw(u)
-		if err != nil || len(body) < 200 {
-			continue
-		}
-		if err := e.upsertDocument(ctx, "YouTube Video", u, body); err == nil {
-			ingested++
-		}
-	}
-	return ingested, skipped, nil
+	return e.ingestVideos(ctx, ns, final, opts)
 }
 
 func isYouTubePlaylistURL(u string) bool {
 	return strings.Contains(u, "youtube.com/playlist") || (strings.Contains(u, "list=") && strings.Contains(u, "youtube.com"))
 }
 
-func (e *engine) expandPlaylist(ctx context.Context, playlistURL string) ([]string, error) {
+// expandPlaylist lists the videos of a playlist, at most YOUTUBE_PLAYLIST_MAX_VIDEOS.
+// When ctx ends while the Data API is paging, the videos listed so far are
+// returned with the context error.
+func (e *engine) expandPlaylist(ctx context.Context, playlistURL string, headers map[string]string) ([]string, error) {
 	// Prefer Data API if key available
-	apiKey := os.Getenv("YOUTUBE_API_KEY")
+	apiKey := config.Get("YOUTUBE_API_KEY", "")
 	if apiKey == "" {
-		apiKey = os.Getenv("GOOGLE_API_KEY")
+		apiKey = config.Get("GOOGLE_API_KEY", "")
 	}
+	limit := playlistMaxVideos()
 	listID := extractPlaylistID(playlistURL)
 	if listID != "" && apiKey != "" {
-		videos, err := e.expandPlaylistViaAPI(ctx, apiKey, listID)
+		videos, err := e.expandPlaylistViaAPI(ctx, apiKey, listID, limit)
 		if err == nil && len(videos) > 0 {
 			return videos, nil
 		}
+		if ctx.Err() != nil {
+			return videos, ctx.Err()
+		}
 		log.Printf("fallback to HTML playlist parse: %v", err)
 	}
 	// Fallback: parse HTML
-	doc, err := e.fetchDoc(playlistURL)
+	doc, err := e.fetchDoc(ctx, playlistURL, headers)
 	if err != nil {
 		return nil, err
 	}
@@ -294,10 +763,16 @@ func (e *engine) expandPlaylist(ctx context.Context, playlistURL string) ([]stri
 			out = append(out, v)
 		}
 	}
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
 	return out, nil
 }
 
-func (e *engine) expandPlaylistViaAPI(ctx context.Context, apiKey, playlistID string) ([]string, error) {
+// expandPlaylistViaAPI pages through a playlist with the Data API until limit
+// videos (0 for all) are listed. On failure the videos of the pages already read
+// are returned with the error.
+func (e *engine) expandPlaylistViaAPI(ctx context.Context, apiKey, playlistID string, limit int) ([]string, error) {
 	base := "https://www.googleapis.com/youtube/v3/playlistItems"
 	pageToken := ""
 	var results []string
@@ -314,16 +789,16 @@ func (e *engine) expandPlaylistViaAPI(ctx context.Context, apiKey, playlistID st
 		endpoint := base + "?" + q.Encode()
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 		if err != nil {
-			return nil, err
+			return results, err
 		}
 		resp, err := client.Do(req)
 		if err != nil {
-			return nil, err
+			return results, err
 		}
 		if resp.StatusCode != 200 {
 			b, _ := io.ReadAll(resp.Body)
 			resp.Body.Close()
-			return nil, fmt.Errorf("yt api %d: %s", resp.StatusCode, string(b))
+			return results, fmt.Errorf("yt api %d: %s", resp.StatusCode, string(b))
 		}
 		var out struct {
 			Items []struct {
@@ -335,7 +810,7 @@ func (e *engine) expandPlaylistViaAPI(ctx context.Context, apiKey, playlistID st
 		}
 		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
 			resp.Body.Close()
-			return nil, err
+			return results, err
 		}
 		resp.Body.Close()
 		for _, it := range out.Items {
@@ -343,6 +818,10 @@ func (e *engine) expandPlaylistViaAPI(ctx context.Context, apiKey, playlistID st
 				results = append(results, "https://www.youtube.com/watch?v="+it.ContentDetails.VideoId)
 			}
 		}
+		if limit > 0 && len(results) >= limit {
+			log.Printf("playlist %s: stopping at the %d video limit", playlistID, limit)
+			return results[:limit], nil
+		}
 		if out.NextPageToken == "" {
 			break
 		}
@@ -362,6 +841,17 @@ func extractPlaylistID(u string) string {
 	return ""
 }
 
+// citationURL deep-links YouTube citations to the chunk's timestamp when one is stored.
+func citationURL(d docChunk) string {
+	if d.StartSeconds == nil || !strings.Contains(d.URL, "youtube.com/watch") {
+		return d.URL
+	}
+	if u, err := url.Parse(d.URL); err != nil || u.Query().Has("t") {
+		return d.URL
+	}
+	return d.URL + "&t=" + strconv.Itoa(int(*d.StartSeconds))
+}
+
 func normalizeYouTubeWatchURL(src string) string {
 	u, err := url.Parse(src)
 	if err != nil {
@@ -374,17 +864,28 @@ func normalizeYouTubeWatchURL(src string) string {
 	return src
 }
 
-func (e *engine) Deduplicate(ctx context.Context) (int, error) {
+// Deduplicate removes documents whose URL repeats within the namespace, keeping
+// the oldest copy.
+func (e *engine) Deduplicate(ctx context.Context, namespace string) (int, error) {
 	removed := 0
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return 0, err
+	}
+	done, err := e.ops.begin("deduplicate", ns)
+	if err != nil {
+		return 0, err
+	}
+	defer done()
 	if e.backend == "postgres" {
 		// find duplicate urls keeping min(id)
 		rows, err := e.db.QueryContext(ctx, `
 			SELECT id FROM documents d
-			WHERE EXISTS (
+			WHERE d.namespace = $1 AND EXISTS (
 			  SELECT 1 FROM documents d2
-			  WHERE d2.url = d.url AND d2.id < d.id
+			  WHERE d2.namespace = d.namespace AND d2.url = d.url AND d2.id < d.id
 			)
-		`)
+		`, ns)
 		if err != nil {
 			return 0, err
 		}
@@ -397,6 +898,9 @@ func (e *engine) Deduplicate(ctx context.Context) (int, error) {
 			}
 		}
 		for _, id := range dupIDs {
+			if _, err := e.db.ExecContext(ctx, "DELETE FROM chunk_keywords WHERE document_id=$1", id); err != nil {
+				return removed, err
+			}
 			if _, err := e.db.ExecContext(ctx, "DELETE FROM embeddings WHERE document_id=$1", id); err != nil {
 				return removed, err
 			}
@@ -409,471 +913,989 @@ func (e *engine) Deduplicate(ctx context.Context) (int, error) {
 		}
 		return removed, nil
 	}
-	// sqlite
-	rows, err := e.db.QueryContext(ctx, `
-		SELECT id FROM documents d
-		WHERE EXISTS (
-		  SELECT 1 FROM documents d2
-		  WHERE d2.url = d.url AND d2.id < d.id
-		)
-	`)
+	// sqlite; a locked database repeats the lookup, which skips what was removed
+	unlock := e.lockWrites()
+	defer unlock()
+	_, err = withBusyRetries(ctx, "deduplicate "+ns, func() (struct{}, error) {
+		rows, err := e.db.QueryContext(ctx, `
+			SELECT id FROM documents d
+			WHERE d.namespace = ? AND EXISTS (
+			  SELECT 1 FROM documents d2
+			  WHERE d2.namespace = d.namespace AND d2.url = d.url AND d2.id < d.id
+			)
+		`, ns)
+		if err != nil {
+			return struct{}{}, err
+		}
+		var dupIDs []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err == nil {
+				dupIDs = append(dupIDs, id)
+			}
+		}
+		rows.Close()
+		for _, id := range dupIDs {
+			if _, err := e.db.ExecContext(ctx, "DELETE FROM chunk_keywords WHERE document_id=?", id); err != nil {
+				return struct{}{}, err
+			}
+			if _, err := e.db.ExecContext(ctx, "DELETE FROM embeddings WHERE document_id=?", id); err != nil {
+				return struct{}{}, err
+			}
+			res, err := e.db.ExecContext(ctx, "DELETE FROM documents WHERE id=?", id)
+			if err != nil {
+				return struct{}{}, err
+			}
+			af, _ := res.RowsAffected()
+			removed += int(af)
+		}
+		return struct{}{}, nil
+	})
+	return removed, err
+}
+
+func (e *engine) documentExists(ctx context.Context, ns, url string) (bool, error) {
+	var count int
+	if e.backend == "postgres" {
+		err := e.db.QueryRowContext(ctx, "SELECT (SELECT COUNT(1) FROM documents WHERE namespace=$1 AND url=$2) + (SELECT COUNT(1) FROM embed_queue WHERE namespace=$1 AND url=$2)", ns, url).Scan(&count)
+		return count > 0, err
+	}
+	err := e.db.QueryRowContext(ctx, "SELECT (SELECT COUNT(1) FROM documents WHERE namespace=? AND url=?) + (SELECT COUNT(1) FROM embed_queue WHERE namespace=? AND url=?)", ns, url, ns, url).Scan(&count)
+	return count > 0, err
+}
+
+func (e *engine) DocumentCount(ctx context.Context, namespace string) (int, error) {
+	ns, err := NormalizeNamespace(namespace)
 	if err != nil {
 		return 0, err
 	}
-	defer rows.Close()
-	var dupIDs []int64
-	for rows.Next() {
-		var id int64
-		if err := rows.Scan(&id); err == nil {
-			dupIDs = append(dupIDs, id)
+	var count int
+	err = e.db.QueryRowContext(ctx, "SELECT COUNT(1) FROM documents WHERE namespace="+e.placeholder(1), ns).Scan(&count)
+	return count, err
+}
+
+func (e *engine) Stats(ctx context.Context, namespace string) (Stats, error) {
+	var st Stats
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return st, err
+	}
+	st.Namespace = ns
+	if err := e.db.QueryRowContext(ctx, "SELECT COUNT(1) FROM embeddings WHERE namespace="+e.placeholder(1), ns).Scan(&st.Embeddings); err != nil {
+		return st, err
+	}
+	if err := e.db.QueryRowContext(ctx, "SELECT COUNT(1) FROM embed_queue WHERE namespace="+e.placeholder(1), ns).Scan(&st.QueueDepth); err != nil {
+		return st, err
+	}
+	// content_size holds the uncompressed length; rows from before it existed were stored raw.
+	size := e.byteLength("content")
+	err = e.db.QueryRowContext(ctx, `
+		SELECT COUNT(1),
+		       COALESCE(SUM(CASE WHEN content LIKE '`+compressedPrefix+`%' THEN 1 ELSE 0 END), 0),
+		       COALESCE(SUM(`+size+`), 0),
+		       COALESCE(SUM(COALESCE(content_size, `+size+`)), 0)
+		FROM documents
+		WHERE namespace=`+e.placeholder(1), ns).Scan(&st.Documents, &st.CompressedDocuments, &st.ContentBytes, &st.RawContentBytes)
+	if err != nil {
+		return st, err
+	}
+	st.SavedBytes = st.RawContentBytes - st.ContentBytes
+	return st, nil
+}
+
+// Vacuum reclaims space left by deletes: VACUUM on SQLite, VACUUM (ANALYZE) on
+// Postgres. It refuses to run while an ingest is in progress.
+func (e *engine) Vacuum(ctx context.Context) (VacuumResult, error) {
+	var res VacuumResult
+	done, err := e.ops.begin("vacuum", "")
+	if err != nil {
+		return res, err
+	}
+	defer done()
+	if !e.corpusMu.TryLock() {
+		return res, ErrIngestInProgress
+	}
+	defer e.corpusMu.Unlock()
+	if e.backend == "postgres" {
+		const sizeQuery = "SELECT pg_total_relation_size('documents') + pg_total_relation_size('embeddings')"
+		if err = e.db.QueryRowContext(ctx, sizeQuery).Scan(&res.BytesBefore); err != nil {
+			return res, err
+		}
+		if _, err = e.db.ExecContext(ctx, "VACUUM (ANALYZE) documents, embeddings"); err != nil {
+			return res, err
+		}
+		err = e.db.QueryRowContext(ctx, sizeQuery).Scan(&res.BytesAfter)
+	} else {
+		unlock := e.lockWrites()
+		defer unlock()
+		if res.BytesBefore, err = e.sqliteSize(ctx); err != nil {
+			return res, err
 		}
+		if _, err = e.db.ExecContext(ctx, "VACUUM"); err != nil {
+			return res, err
+		}
+		_, _ = e.db.ExecContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)")
+		res.BytesAfter, err = e.sqliteSize(ctx)
+	}
+	res.ReclaimedBytes = res.BytesBefore - res.BytesAfter
+	return res, err
+}
+
+func (e *engine) sqliteSize(ctx context.Context) (int64, error) {
+	var pages, pageSize int64
+	if err := e.db.QueryRowContext(ctx, "PRAGMA page_count").Scan(&pages); err != nil {
+		return 0, err
+	}
+	if err := e.db.QueryRowContext(ctx, "PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, err
 	}
-	for _, id := range dupIDs {
-		if _, err := e.db.ExecContext(ctx, "DELETE FROM embeddings WHERE document_id=?", id); err != nil {
-			return removed, err
+	return pages * pageSize, nil
+}
+
+// Clean removes every document and embedding of the namespace.
+func (e *engine) Clean(ctx context.Context, namespace string) (int, error) {
+	// Return number of removed documents; embeddings have FK delete cascade not defined, so delete embeddings first
+	var removed int
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return 0, err
+	}
+	done, err := e.ops.begin("clean", ns)
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+	if e.backend == "postgres" {
+		if _, err := e.db.ExecContext(ctx, "DELETE FROM embed_queue WHERE namespace=$1", ns); err != nil {
+			return 0, err
 		}
-		res, err := e.db.ExecContext(ctx, "DELETE FROM documents WHERE id=?", id)
+		if _, err := e.db.ExecContext(ctx, "DELETE FROM sources WHERE namespace=$1", ns); err != nil {
+			return 0, err
+		}
+		if _, err := e.db.ExecContext(ctx, "DELETE FROM page_html WHERE namespace=$1", ns); err != nil {
+			return 0, err
+		}
+		if _, err := e.db.ExecContext(ctx, "DELETE FROM page_titles WHERE namespace=$1", ns); err != nil {
+			return 0, err
+		}
+		if _, err := e.db.ExecContext(ctx, "DELETE FROM chunk_keywords WHERE namespace=$1", ns); err != nil {
+			return 0, err
+		}
+		if _, err := e.db.ExecContext(ctx, "DELETE FROM embeddings WHERE namespace=$1", ns); err != nil {
+			return 0, err
+		}
+		res, err := e.db.ExecContext(ctx, "DELETE FROM documents WHERE namespace=$1", ns)
 		if err != nil {
-			return removed, err
+			return 0, err
+		}
+		affected, _ := res.RowsAffected()
+		removed = int(affected)
+		return removed, nil
+	}
+	unlock := e.lockWrites()
+	defer unlock()
+	// The deletes are idempotent, so a locked database retries them all.
+	removed, err = withBusyRetries(ctx, "clean "+ns, func() (int, error) {
+		if _, err := e.db.ExecContext(ctx, "DELETE FROM embed_queue WHERE namespace=?", ns); err != nil {
+			return 0, err
+		}
+		if _, err := e.db.ExecContext(ctx, "DELETE FROM sources WHERE namespace=?", ns); err != nil {
+			return 0, err
+		}
+		if _, err := e.db.ExecContext(ctx, "DELETE FROM page_html WHERE namespace=?", ns); err != nil {
+			return 0, err
+		}
+		if _, err := e.db.ExecContext(ctx, "DELETE FROM page_titles WHERE namespace=?", ns); err != nil {
+			return 0, err
+		}
+		if _, err := e.db.ExecContext(ctx, "DELETE FROM chunk_keywords WHERE namespace=?", ns); err != nil {
+			return 0, err
 		}
-		af, _ := res.RowsAffected()
-		removed += int(af)
+		if _, err := e.db.ExecContext(ctx, "DELETE FROM embeddings WHERE namespace=?", ns); err != nil {
+			return 0, err
+		}
+		res, err := e.db.ExecContext(ctx, "DELETE FROM documents WHERE namespace=?", ns)
+		if err != nil {
+			return 0, err
+		}
+		affected, _ := res.RowsAffected()
+		return int(affected), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, e.resetStoreDimIfEmpty(ctx)
+}
+
+// --- storage backends ---
+
+type docChunk struct {
+	ID      int64
+	Title   string
+	URL     string
+	Snippet string
+	Content string
+	Vector  []float32
+	// StartSeconds is the offset of a transcript chunk within its video, if known.
+	StartSeconds *float64
+	// Score is the cosine similarity to the query.
+	Score float64
+	// Rank is Score with the summary boost, freshness decay and source weights
+	// applied; retrieval orders chunks by it.
+	Rank float64
+}
+
+// textChunk is a unit of document text to embed, optionally tied to a media timestamp.
+// Kind tells raw text from LLM summaries.
+type textChunk struct {
+	Text         string
+	StartSeconds *float64
+	Kind         string
+}
+
+// chunkSnippet is the prefix of a chunk stored with its vector.
+func chunkSnippet(text string) string {
+	return text[:min(160, len(text))]
+}
+
+func (c textChunk) kind() string {
+	if c.Kind == "" {
+		return chunkKindRaw
+	}
+	return c.Kind
+}
+
+func initSqlite(db *sql.DB) error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS documents (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title TEXT,
+	url TEXT,
+	content TEXT
+);
+CREATE TABLE IF NOT EXISTS embeddings (
+	document_id INTEGER,
+	position INTEGER,
+	vector BLOB,
+	snippet TEXT,
+	FOREIGN KEY(document_id) REFERENCES documents(id)
+);
+CREATE INDEX IF NOT EXISTS idx_embeddings_doc ON embeddings(document_id);
+`)
+	if err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "sqlite", "embeddings", "start_seconds", "REAL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "sqlite", "documents", "content_size", "INTEGER"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "sqlite", "documents", "partial", "BOOLEAN NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "sqlite", "documents", "ingested_at", "TEXT"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "sqlite", "documents", "content_updated_at", "TEXT"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "sqlite", "documents", "source_type", "TEXT"); err != nil {
+		return err
+	}
+	if err := ensureNamespaceColumns(db, "sqlite"); err != nil {
+		return err
+	}
+	if err := initDocumentHashes(db, "sqlite"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "sqlite", "embeddings", "kind", "TEXT NOT NULL DEFAULT '"+chunkKindRaw+"'"); err != nil {
+		return err
+	}
+	if err := initEmbeddingCache(db, "sqlite"); err != nil {
+		return err
+	}
+	if err := initEmbedCheckpoints(db, "sqlite"); err != nil {
+		return err
+	}
+	if err := initEmbeddingModels(db, "sqlite"); err != nil {
+		return err
+	}
+	if err := initChunkKeywords(db, "sqlite"); err != nil {
+		return err
+	}
+	if err := initUsage(db, "sqlite"); err != nil {
+		return err
+	}
+	if err := initQuotas(db); err != nil {
+		return err
+	}
+	if err := initCrawlState(db); err != nil {
+		return err
+	}
+	if err := initPageHTML(db); err != nil {
+		return err
+	}
+	if err := initPageTitles(db); err != nil {
+		return err
+	}
+	if err := initEvalCases(db, "sqlite"); err != nil {
+		return err
+	}
+	if err := initEmbedQueue(db, "sqlite"); err != nil {
+		return err
+	}
+	if err := initSources(db); err != nil {
+		return err
+	}
+	if err := initFAQs(db, "sqlite", 0); err != nil {
+		return err
+	}
+	if err := initAPIKeys(db); err != nil {
+		return err
+	}
+	if err := initModeration(db, "sqlite"); err != nil {
+		return err
+	}
+	return initSqliteMeta(db)
+}
+
+func initPostgres(db *sql.DB, dim int) error {
+	_, err := db.Exec(`CREATE EXTENSION IF NOT EXISTS vector;`)
+	if err != nil {
+		return err
+	}
+	ddl := fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS documents (
+	id BIGSERIAL PRIMARY KEY,
+	title TEXT,
+	url TEXT,
+	content TEXT
+);
+CREATE TABLE IF NOT EXISTS embeddings (
+	document_id BIGINT REFERENCES documents(id),
+	position INTEGER,
+	vector VECTOR(%d),
+	snippet TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_embeddings_doc ON embeddings(document_id);
+`, dim)
+	if _, err = db.Exec(ddl); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "postgres", "embeddings", "start_seconds", "DOUBLE PRECISION"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "postgres", "documents", "content_size", "BIGINT"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "postgres", "documents", "partial", "BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "postgres", "documents", "ingested_at", "TEXT"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "postgres", "documents", "content_updated_at", "TEXT"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "postgres", "documents", "source_type", "TEXT"); err != nil {
+		return err
+	}
+	if err := ensureNamespaceColumns(db, "postgres"); err != nil {
+		return err
+	}
+	if err := initDocumentHashes(db, "postgres"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "postgres", "embeddings", "kind", "TEXT NOT NULL DEFAULT '"+chunkKindRaw+"'"); err != nil {
+		return err
+	}
+	if err := initEmbeddingCache(db, "postgres"); err != nil {
+		return err
+	}
+	if err := initEmbedCheckpoints(db, "postgres"); err != nil {
+		return err
+	}
+	if err := initEmbeddingModels(db, "postgres"); err != nil {
+		return err
+	}
+	if err := initChunkKeywords(db, "postgres"); err != nil {
+		return err
+	}
+	if err := initUsage(db, "postgres"); err != nil {
+		return err
+	}
+	if err := initQuotas(db); err != nil {
+		return err
+	}
+	if err := initCrawlState(db); err != nil {
+		return err
+	}
+	if err := initPageHTML(db); err != nil {
+		return err
+	}
+	if err := initPageTitles(db); err != nil {
+		return err
+	}
+	if err := initEvalCases(db, "postgres"); err != nil {
+		return err
+	}
+	if err := initEmbedQueue(db, "postgres"); err != nil {
+		return err
+	}
+	if err := initSources(db); err != nil {
+		return err
+	}
+	if err := initFAQs(db, "postgres", dim); err != nil {
+		return err
+	}
+	if err := initAPIKeys(db); err != nil {
+		return err
+	}
+	return initModeration(db, "postgres")
+}
+
+// ensureNamespaceColumns adds the namespace columns and their indexes. Rows from
+// before namespaces existed land in DefaultNamespace.
+func ensureNamespaceColumns(db *sql.DB, backend string) error {
+	colType := "TEXT NOT NULL DEFAULT '" + DefaultNamespace + "'"
+	for _, table := range []string{"documents", "embeddings"} {
+		if err := ensureColumn(db, backend, table, "namespace", colType); err != nil {
+			return err
+		}
+	}
+	_, err := db.Exec(`
+CREATE INDEX IF NOT EXISTS idx_documents_namespace_url ON documents(namespace, url);
+CREATE INDEX IF NOT EXISTS idx_embeddings_namespace ON embeddings(namespace);
+`)
+	return err
+}
+
+// ensureColumn adds a column missing from a table created by an older version,
+// since CREATE TABLE IF NOT EXISTS leaves existing tables untouched.
+func ensureColumn(db *sql.DB, backend, table, column, colType string) error {
+	if backend == "postgres" {
+		_, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", table, column, colType))
+		return err
+	}
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, typ string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if strings.EqualFold(name, column) {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, colType))
+	return err
+}
+
+// placeholder returns the n-th bind parameter marker for the backend.
+func (e *engine) placeholder(n int) string {
+	if e.backend == "postgres" {
+		return "$" + strconv.Itoa(n)
 	}
-	return removed, nil
+	return "?"
 }
 
-func (e *engine) documentExists(ctx context.Context, url string) (bool, error) {
-	var count int
+// byteLength is the SQL for the length of col in bytes, which content_size also
+// counts. LENGTH() counts characters of text on both backends.
+func (e *engine) byteLength(col string) string {
 	if e.backend == "postgres" {
-		err := e.db.QueryRowContext(ctx, "SELECT COUNT(1) FROM documents WHERE url=$1", url).Scan(&count)
-		return count > 0, err
+		return "OCTET_LENGTH(" + col + ")"
 	}
-	err := e.db.QueryRowContext(ctx, "SELECT COUNT(1) FROM documents WHERE url=?", url).Scan(&count)
-	return count > 0, err
+	return "LENGTH(CAST(" + col + " AS BLOB))"
 }
 
-func (e *engine) Clean(ctx context.Context) (int, error) {
-	// Return number of removed documents; embeddings have FK delete cascade not defined, so delete embeddings first
-	var removed int
+// lockWrites serializes writers on SQLite, which allows a single writer at a time
+// and otherwise fails concurrent ingests with "database is locked". Readers are not
+// blocked since the database runs in WAL mode. Postgres needs no coordination.
+func (e *engine) lockWrites() func() {
 	if e.backend == "postgres" {
-		if _, err := e.db.ExecContext(ctx, "DELETE FROM embeddings"); err != nil {
-			return 0, err
-		}
-		res, err := e.db.ExecContext(ctx, "DELETE FROM documents")
-		if err != nil {
-			return 0, err
-		}
-		affected, _ := res.RowsAffected()
-		removed = int(affected)
-		return removed, nil
+		return func() {}
 	}
-	if _, err := e.db.ExecContext(ctx, "DELETE FROM embeddings"); err != nil {
-		return 0, err
+	e.writeMu.Lock()
+	return e.writeMu.Unlock
+}
+
+// upsertOutcome describes how a document was stored.
+type upsertOutcome struct {
+	// ID is the stored document, zero when none was stored.
+	ID         int64
+	Partial    bool
+	Summarized bool
+	Queued     bool
+	// Denied is set when INGEST_DENYLIST kept the document out.
+	Denied bool
+	// Moderated counts chunks flagged by moderation; Blocked is set when none
+	// were left to store.
+	Moderated int
+	Blocked   bool
+	// Capped is set when MAX_CHUNKS_PER_DOC dropped chunks.
+	Capped bool
+
+	EmbeddingsReused, EmbeddingsComputed int
+}
+
+func (r *IngestResult) add(o upsertOutcome) {
+	r.Moderated += o.Moderated
+	if o.Blocked {
+		return
 	}
-	res, err := e.db.ExecContext(ctx, "DELETE FROM documents")
-	if err != nil {
-		return 0, err
+	if o.Denied {
+		r.Denied++
+		return
+	}
+	if o.Queued {
+		r.Queued++
+		return
+	}
+	r.Ingested++
+	r.EmbeddingsReused += o.EmbeddingsReused
+	r.EmbeddingsComputed += o.EmbeddingsComputed
+	if o.Partial {
+		r.Partial++
+	}
+	if o.Summarized {
+		r.Summaries++
+	}
+	if o.Capped {
+		r.Capped++
 	}
-	affected, _ := res.RowsAffected()
-	removed = int(affected)
-	return removed, nil
 }
 
-// --- storage backends ---
-
-type docChunk struct {
-	ID      int64
-	Title   string
-	URL     string
-	Snippet string
-	Content string
-	Vector  []float32
+// upsertDocument stores a document, or hands it to the embed queue when enabled.
+func (e *engine) upsertDocument(ctx context.Context, ns, title, docURL, content string) (upsertOutcome, error) {
+	if e.crawl.denied(docURL) {
+		log.Printf("not storing %s: denylisted", docURL)
+		return upsertOutcome{Denied: true}, nil
+	}
+	if e.queue != nil {
+		return upsertOutcome{Queued: true}, e.enqueueDocument(ctx, ns, title, docURL, content)
+	}
+	out, err := e.storeDocument(ctx, ns, title, docURL, content)
+	if errors.Is(err, errDocumentBlocked) {
+		return out, nil
+	}
+	return out, err
 }
 
-func initSqlite(db *sql.DB) error {
-	_, err := db.Exec(`
-CREATE TABLE IF NOT EXISTS documents (
-	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	title TEXT,
-	url TEXT,
-	content TEXT
-);
-CREATE TABLE IF NOT EXISTS embeddings (
-	document_id INTEGER,
-	position INTEGER,
-	vector BLOB,
-	snippet TEXT,
-	FOREIGN KEY(document_id) REFERENCES documents(id)
-);
-CREATE INDEX IF NOT EXISTS idx_embeddings_doc ON embeddings(document_id);
-`)
-	return err
+// storeDocument chunks, embeds and stores a document. It fails with
+// errDocumentBlocked when moderation leaves no chunk to store.
+func (e *engine) storeDocument(ctx context.Context, ns, title, docURL, content string) (upsertOutcome, error) {
+	var raw []textChunk
+	for _, t := range e.splitDocument(docURL, content, 800) {
+		raw = append(raw, textChunk{Text: t, Kind: chunkKindRaw})
+	}
+	return e.storeChunks(ctx, ns, title, docURL, content, raw)
 }
 
-func initPostgres(db *sql.DB, dim int) error {
-	_, err := db.Exec(`CREATE EXTENSION IF NOT EXISTS vector;`)
+// storeChunks caps, moderates and stores the raw chunks of a document, adding its
+// summary and title chunks. It fails with errDocumentBlocked when moderation
+// leaves no chunk to store.
+func (e *engine) storeChunks(ctx context.Context, ns, title, docURL, content string, raw []textChunk) (upsertOutcome, error) {
+	raw, capped := e.chunkCap.apply(docURL, raw)
+	chunks, flagged, err := e.moderateChunks(ctx, ns, docURL, raw)
 	if err != nil {
-		return err
-	}
-	ddl := fmt.Sprintf(`
-CREATE TABLE IF NOT EXISTS documents (
-	id BIGSERIAL PRIMARY KEY,
-	title TEXT,
-	url TEXT,
-	content TEXT
-);
-CREATE TABLE IF NOT EXISTS embeddings (
-	document_id BIGINT REFERENCES documents(id),
-	position INTEGER,
-	vector VECTOR(%d),
-	snippet TEXT
-);
-CREATE INDEX IF NOT EXISTS idx_embeddings_doc ON embeddings(document_id);
-`, dim)
-	_, err = db.Exec(ddl)
-	return err
+		return upsertOutcome{}, err
+	}
+	if len(chunks) < len(raw) {
+		// Skipped chunks must not be stored as document content or summarized either.
+		if len(chunks) == 0 {
+			return upsertOutcome{Moderated: flagged, Blocked: true}, errDocumentBlocked
+		}
+		content = chunksContent(chunks)
+	}
+	chunks, summarized := e.summaryChunks(ctx, title, content, chunks)
+	chunks = e.withTitleChunk(title, chunks)
+	out, err := e.upsertChunks(ctx, ns, title, docURL, content, chunks)
+	out.Summarized = summarized
+	out.Moderated = flagged
+	out.Capped = capped
+	return out, err
 }
 
-func (e *engine) upsertDocument(ctx context.Context, title, docURL, content string) error {
-	chunks := splitIntoChunks(content, 800)
+// upsertChunks stores a document with pre-split chunks, which lets sources such as
+// transcripts keep per-chunk timestamps. Chunks that cannot be embedded are dropped
+// and the document is flagged partial for later repair; the outcome reports whether
+// that happened and how many vectors came from the embedding cache. It only fails
+// when no chunk could be embedded.
+func (e *engine) upsertChunks(ctx context.Context, ns, title, docURL, content string, chunks []textChunk) (upsertOutcome, error) {
+	// Embed before touching the database so the SQLite write lock is never held
+	// across provider round-trips.
+	texts := make([]string, len(chunks))
+	for i, ch := range chunks {
+		texts[i] = ch.Text
+	}
+	var out upsertOutcome
+	outcomes, hashes, reused, computed := e.embedChunksCached(ctx, texts)
+	out.EmbeddingsReused, out.EmbeddingsComputed = reused, computed
+	var kept []textChunk
+	var vectors [][]float32
+	var keptHashes []sql.NullString
+	var keptModels []string
+	// keptPositions are the indexes of kept in chunks, stored as each chunk's
+	// position so positions stay put when chunks are dropped.
+	var keptPositions []int
+	var firstErr error
+	for i, o := range outcomes {
+		if o.Err != nil {
+			log.Printf("embed chunk %d of %s failed: %v", i, docURL, o.Err)
+			if firstErr == nil {
+				firstErr = o.Err
+			}
+			continue
+		}
+		kept = append(kept, chunks[i])
+		vectors = append(vectors, o.Vector)
+		keptHashes = append(keptHashes, sql.NullString{String: hashes[i], Valid: hashes[i] != ""})
+		keptModels = append(keptModels, o.Model)
+		keptPositions = append(keptPositions, i)
+	}
+	if len(chunks) > 0 && len(kept) == 0 {
+		return out, firstErr
+	}
+	out.Partial = len(kept) < len(chunks)
+	keywords := e.keywords.extract(kept)
+	stored, err := encodeContent(content, e.compressContent)
+	if err != nil {
+		return out, err
+	}
+	hash := documentHash(content)
+	updated := e.contentUpdatedAt(ctx, ns, docURL, hash)
+	// The document and its embeddings are written in one transaction, so a failed
+	// or cancelled ingest never leaves a document without its chunks.
 	if e.backend == "postgres" {
-		var id int64
-		if err := e.db.QueryRowContext(ctx, "INSERT INTO documents(title, url, content) VALUES($1,$2,$3) RETURNING id", title, docURL, content).Scan(&id); err != nil {
-			return err
+		tx, err := e.db.BeginTx(ctx, nil)
+		if err != nil {
+			return out, err
 		}
-		for i, ch := range chunks {
-			emb, err := e.embed(ctx, ch)
-			if err != nil {
-				return err
-			}
-			snippet := ch[:min(160, len(ch))]
-			vec := pgvector.NewVector(emb)
-			if _, err := e.db.ExecContext(ctx, "INSERT INTO embeddings(document_id, position, vector, snippet) VALUES($1,$2,$3,$4)", id, i, vec, snippet); err != nil {
-				return err
+		defer tx.Rollback()
+		var id int64
+		if err := tx.QueryRowContext(ctx, "INSERT INTO documents(namespace, title, url, content, content_size, partial, ingested_at, source_type, content_hash, url_norm, content_updated_at) VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11) RETURNING id", ns, title, docURL, stored, len(content), out.Partial, ingestTimestamp(), documentSourceType(docURL), hash, normalizeDocumentURL(docURL), updated).Scan(&id); err != nil {
+			return out, err
+		}
+		out.ID = id
+		for i, ch := range kept {
+			snippet := chunkSnippet(ch.Text)
+			vec := pgvector.NewVector(vectors[i])
+			if _, err := tx.ExecContext(ctx, "INSERT INTO embeddings(namespace, document_id, position, vector, snippet, start_seconds, kind, content_hash, model, keywords) VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)", ns, id, keptPositions[i], vec, snippet, ch.StartSeconds, ch.kind(), keptHashes[i], keptModels[i], keywords[i]); err != nil {
+				return out, err
 			}
 		}
-		return nil
+		if err := e.storeKeywords(ctx, tx, ns, id, keywords); err != nil {
+			return out, err
+		}
+		if err := e.clearCheckpoints(ctx, tx, keptHashes); err != nil {
+			return out, err
+		}
+		return out, tx.Commit()
 	}
 	// sqlite path
-	res, err := e.db.ExecContext(ctx, "INSERT INTO documents(title, url, content) VALUES(?,?,?)", title, docURL, content)
-	if err != nil {
-		return err
+	unlock := e.lockWrites()
+	defer unlock()
+	if err := e.checkStoreDim(ctx, vectors); err != nil {
+		return out, err
 	}
-	id, _ := res.LastInsertId()
-	for i, ch := range chunks {
-		emb, err := e.embed(ctx, ch)
+	_, err = withBusyRetries(ctx, "store "+docURL, func() (struct{}, error) {
+		tx, err := e.db.BeginTx(ctx, nil)
 		if err != nil {
-			return err
+			return struct{}{}, err
 		}
-		snippet := ch[:min(160, len(ch))]
-		if _, err := e.db.ExecContext(ctx, "INSERT INTO embeddings(document_id, position, vector, snippet) VALUES(?,?,?,?)", id, i, floatsToBlob(emb), snippet); err != nil {
-			return err
+		defer tx.Rollback()
+		res, err := tx.ExecContext(ctx, "INSERT INTO documents(namespace, title, url, content, content_size, partial, ingested_at, source_type, content_hash, url_norm, content_updated_at) VALUES(?,?,?,?,?,?,?,?,?,?,?)", ns, title, docURL, stored, len(content), out.Partial, ingestTimestamp(), documentSourceType(docURL), hash, normalizeDocumentURL(docURL), updated)
+		if err != nil {
+			return struct{}{}, err
+		}
+		id, _ := res.LastInsertId()
+		out.ID = id
+		for i, ch := range kept {
+			snippet := chunkSnippet(ch.Text)
+			if _, err := tx.ExecContext(ctx, "INSERT INTO embeddings(namespace, document_id, position, vector, snippet, start_seconds, kind, content_hash, model, keywords) VALUES(?,?,?,?,?,?,?,?,?,?)", ns, id, keptPositions[i], floatsToBlob(vectors[i]), snippet, ch.StartSeconds, ch.kind(), keptHashes[i], keptModels[i], keywords[i]); err != nil {
+				return struct{}{}, err
+			}
 		}
-	}
-	return nil
+		if err := e.storeKeywords(ctx, tx, ns, id, keywords); err != nil {
+			return struct{}{}, err
+		}
+		if err := e.clearCheckpoints(ctx, tx, keptHashes); err != nil {
+			return struct{}{}, err
+		}
+		return struct{}{}, tx.Commit()
+	})
+	return out, err
 }
 
-func (e *engine) search(ctx context.Context, queryVec []float32, k int) ([]docChunk, error) {
+// search returns the k chunks of ns most similar to queryVec, with scores
+// multiplied by weights. A non-empty model restricts it to that model's
+// embeddings; see candidates.
+func (e *engine) search(ctx context.Context, ns string, queryVec []float32, k int, model string, weights SourceWeights) ([]docChunk, error) {
+	k = e.clampK(k)
 	if e.backend == "postgres" {
-		q := "SELECT d.id, d.title, d.url, e.snippet FROM embeddings e JOIN documents d ON d.id=e.document_id ORDER BY e.vector <=> $1 LIMIT $2"
-		rows, err := e.db.QueryContext(ctx, q, pgvector.NewVector(queryVec), k)
+		// Rows are ordered by distance alone so the vector index can serve them;
+		// the summary boost (see summaryChunks), freshness and source weights are
+		// applied here and re-rank a wider pool.
+		q := "SELECT d.id, d.title, d.url, e.snippet, e.vector, e.start_seconds, e.kind, COALESCE(d.content_updated_at, d.ingested_at), d.source_type, e.vector <=> $2 AS distance FROM embeddings e JOIN documents d ON d.id=e.document_id WHERE e.namespace=$1 AND e.kind <> 'title'"
+		rescored := e.summaryScoreBoost != 0 || e.freshness.enabled() || weights.active()
+		limit := k
+		if rescored {
+			limit = k * rescorePool
+		}
+		args := []any{ns, pgvector.NewVector(queryVec), limit}
+		if model != "" {
+			q += " AND COALESCE(e.model, $4) = $5"
+			args = append(args, e.models.EmbeddingModel, model)
+		}
+		rows, err := e.db.QueryContext(ctx, q+" ORDER BY e.vector <=> $2 LIMIT $3", args...)
 		if err != nil {
 			return nil, err
 		}
 		defer rows.Close()
 		var results []docChunk
+		now := time.Now()
 		for rows.Next() {
 			var id int64
-			var title, u, snippet string
-			if err := rows.Scan(&id, &title, &u, &snippet); err != nil {
+			var title, u, snippet, kind string
+			var vec pgvector.Vector
+			var start sql.NullFloat64
+			var updated, srcType sql.NullString
+			var distance float64
+			if err := rows.Scan(&id, &title, &u, &snippet, &vec, &start, &kind, &updated, &srcType, &distance); err != nil {
 				continue
 			}
-			results = append(results, docChunk{ID: id, Title: title, URL: u, Snippet: snippet})
+			sim := 1 - distance
+			results = append(results, docChunk{ID: id, Title: title, URL: u, Snippet: snippet, Vector: vec.Slice(), StartSeconds: nullFloat(start), Score: sim, Rank: e.rank(sim, kind, updated, srcType, u, weights, now)})
 		}
-		return results, nil
+		if rescored {
+			results = topK(results, k)
+		}
+		return results, rows.Err()
 	}
 	// sqlite brute force
-	rows, err := e.db.QueryContext(ctx, "SELECT d.id, d.title, d.url, e.snippet, e.vector FROM embeddings e JOIN documents d ON d.id = e.document_id")
+	dim := int(e.storeDim.Load())
+	if dim > 0 && len(queryVec) != dim {
+		return nil, fmt.Errorf("query embedding has %d dimensions, store has %d", len(queryVec), dim)
+	}
+	q := "SELECT d.id, d.title, d.url, e.snippet, e.vector, e.start_seconds, e.kind, COALESCE(d.content_updated_at, d.ingested_at), d.source_type FROM embeddings e JOIN documents d ON d.id = e.document_id WHERE e.namespace = ? AND e.kind <> 'title'"
+	args := []any{ns}
+	if model != "" {
+		q += " AND COALESCE(e.model, ?) = ?"
+		args = append(args, e.models.EmbeddingModel, model)
+	}
+	rows, err := withBusyRetries(ctx, "search", func() (*sql.Rows, error) {
+		return e.db.QueryContext(ctx, q, args...)
+	})
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var results []docChunk
+	mismatched := 0
+	now := time.Now()
 	for rows.Next() {
 		var id int64
-		var title, u, snippet string
+		var title, u, snippet, kind string
 		var blob []byte
-		if err := rows.Scan(&id, &title, &u, &snippet, &blob); err != nil {
+		var start sql.NullFloat64
+		var updated, srcType sql.NullString
+		if err := rows.Scan(&id, &title, &u, &snippet, &blob, &start, &kind, &updated, &srcType); err != nil {
+			continue
+		}
+		if len(blob) != len(queryVec)*4 {
+			mismatched++
 			continue
 		}
 		vec := blobToFloats(blob)
 		sim := cosine(vec, queryVec)
-		results = append(results, docChunk{ID: id, Title: title, URL: u, Snippet: fmt.Sprintf("%s (sim=%.3f)", snippet, sim), Vector: vec})
+		results = append(results, docChunk{ID: id, Title: title, URL: u, Snippet: snippet, Vector: vec, StartSeconds: nullFloat(start), Score: sim, Rank: e.rank(sim, kind, updated, srcType, u, weights, now)})
 	}
-	if len(results) > k {
-		results = topK(results, k)
+	if mismatched > 0 {
+		log.Printf("search skipped %d embeddings whose width does not match %d dimensions", mismatched, len(queryVec))
 	}
-	return results, nil
+	// Rows come in table order, so they are always ranked, summary boost included.
+	return topK(results, k), nil
+}
+
+// rank adjusts the similarity of a chunk for ordering: summary chunks get
+// summaryScoreBoost (see summaryChunks), then freshness decay and source weights
+// scale it.
+func (e *engine) rank(sim float64, kind string, updated, srcType sql.NullString, docURL string, weights SourceWeights, now time.Time) float64 {
+	if kind == chunkKindSummary {
+		sim += e.summaryScoreBoost
+	}
+	return sim * e.freshness.factor(updated, now) * weights.factor(srcType, docURL)
 }
 
 // --- LLM + web helpers remain unchanged ---
 
-func (e *engine) embed(ctx context.Context, text string) ([]float32, error) {
-	provider := strings.ToLower(config.Get("LLM_PROVIDER", "gemini"))
-	if provider == "openai" {
-		key := os.Getenv("OPENAI_API_KEY")
-		if key == "" {
-			return nil, errors.New("OPENAI_API_KEY not set")
-		}
-		model := e.models.EmbeddingModel
-		if model == "" {
-			model = "text-embedding-3-small"
-		}
-		endpoint := "https://api.openai.com/v1/embeddings"
-		body := map[string]any{
-			"model": model,
-			"input": text,
-		}
-		bs, err := json.Marshal(body)
-		if err != nil {
-			return nil, err
-		}
-		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(bs))
-		if err != nil {
-			return nil, err
-		}
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Authorization", "Bearer "+key)
-		resp, err := e.httpClient.Do(req)
-		if err != nil {
-			return nil, err
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode != 200 {
-			b, _ := io.ReadAll(resp.Body)
-			return nil, fmt.Errorf("embed status %d: %s", resp.StatusCode, string(b))
-		}
-		var out struct {
-			Data []struct {
-				Embedding []float64 `json:"embedding"`
-			} `json:"data"`
-		}
-		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-			return nil, err
-		}
-		if len(out.Data) == 0 || len(out.Data[0].Embedding) == 0 {
-			return nil, errors.New("empty embedding values")
-		}
-		vec := make([]float32, len(out.Data[0].Embedding))
-		for i, v := range out.Data[0].Embedding {
-			vec[i] = float32(v)
-		}
-		return vec, nil
+// Embed embeds text exactly as queries are, for diagnosing provider and dimension issues.
+func (e *engine) Embed(ctx context.Context, text string) (EmbedResult, error) {
+	res := EmbedResult{
+		Provider:            e.primary,
+		Model:               e.models.EmbeddingModel,
+		ConfiguredDimension: e.embeddingDim,
+	}
+	if strings.TrimSpace(text) == "" {
+		return res, errors.New("empty text")
 	}
-	// default: Gemini
-	key := os.Getenv("GEMINI_API_KEY")
-	if key == "" {
-		return nil, errors.New("GEMINI_API_KEY not set")
+	vec, t, err := e.embedServed(ctx, e.embeddingChain(), text)
+	if err != nil {
+		return res, err
 	}
-	model := e.models.EmbeddingModel
-	if model == "" {
-		model = "text-embedding-004"
+	res.Provider, res.Model = t.Provider, t.EmbeddingModel
+	res.Dimension, res.Vector = len(vec), vec
+	return res, nil
+}
+
+const systemPrompt = "You are Kiali/Istio assistant. Be precise, cite sources, and use provided Kiali endpoint data to analyze graphs, traffic, metrics, and propose troubleshooting steps."
+
+func buildPrompt(query string, contextJSON []byte, docs []docChunk) string {
+	var b strings.Builder
+	b.WriteString("User question:\n")
+	b.WriteString(query)
+	b.WriteString("\n\nRelevant context (from Kiali docs and demos):\n")
+	for i, d := range docs {
+		b.WriteString(fmt.Sprintf("[%d] %s (%s)\n%s\n\n", i+1, d.Title, d.URL, d.Snippet))
 	}
-	endpoint := fmt.Sprintf("https://generativelanguage.googleapis.com/v1/models/%s:embedContent?key=%s", model, key)
-	body := map[string]any{
-		"model":   "models/" + model,
-		"content": map[string]any{"parts": []map[string]any{{"text": text}}},
+	if len(contextJSON) > 0 {
+		b.WriteString("\nKiali data (graphs/metrics JSON):\n")
+		b.Write(contextJSON)
 	}
-	bs, err := json.Marshal(body)
+	b.WriteString("\nAnswer step-by-step. Cite the context you rely on with its bracketed number, e.g. [1] or [2][3], right after the statement it supports. Only cite numbers listed above and do not write out source URLs.")
+	return b.String()
+}
+
+// --- web fetching helpers ---
+
+const defaultUserAgent = "kiali-ai-mcp (+https://github.com/kiali/kiali-mcp)"
+
+// newFetchRequest builds a crawl GET request. Per-job headers are applied on top of
+// the default User-Agent, so a job may override it.
+func newFetchRequest(ctx context.Context, u string, headers map[string]string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(bs))
+	req.Header.Set("User-Agent", config.Get("CRAWL_USER_AGENT", defaultUserAgent))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+func (e *engine) fetchDoc(ctx context.Context, u string, headers map[string]string) (*goquery.Document, error) {
+	page, err := e.fetchPage(ctx, u, headers)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
+	return page.Doc, nil
+}
+
+// fetchedPage is a parsed HTML page. FinalURL is where redirects ended; relative
+// links resolve against it. CanonicalURL is what the page should be stored and
+// deduplicated under: its <link rel="canonical"> when that stays on the same host,
+// otherwise FinalURL.
+type fetchedPage struct {
+	Doc *goquery.Document
+	// HTML is the fetched body, kept with STORE_RAW_HTML.
+	HTML         []byte
+	FinalURL     string
+	CanonicalURL string
+}
+
+func (e *engine) fetchPage(ctx context.Context, u string, headers map[string]string) (fetchedPage, error) {
+	var page fetchedPage
+	req, err := newFetchRequest(ctx, u, headers)
+	if err != nil {
+		return page, err
+	}
 	resp, err := e.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return page, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
-		b, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("embed status %d: %s", resp.StatusCode, string(b))
+		return page, fmt.Errorf("status %d", resp.StatusCode)
 	}
-	var out map[string]any
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return nil, err
+	if e.storeRawHTML {
+		if page.HTML, err = io.ReadAll(resp.Body); err != nil {
+			return page, err
+		}
+		page.Doc, err = goquery.NewDocumentFromReader(bytes.NewReader(page.HTML))
+	} else {
+		page.Doc, err = goquery.NewDocumentFromReader(resp.Body)
 	}
-	embObj, ok := out["embedding"].(map[string]any)
-	if !ok {
-		return nil, errors.New("no embedding in response")
+	if err != nil {
+		return page, err
 	}
-	vals, ok := embObj["values"].([]any)
-	if !ok || len(vals) == 0 {
-		return nil, errors.New("empty embedding values")
+	final := *resp.Request.URL
+	final.Fragment = ""
+	page.FinalURL, page.CanonicalURL = final.String(), final.String()
+	if href, ok := page.Doc.Find(`link[rel="canonical"]`).First().Attr("href"); ok && strings.TrimSpace(href) != "" {
+		if c, err := final.Parse(strings.TrimSpace(href)); err == nil && c.Host == final.Host && (c.Scheme == "http" || c.Scheme == "https") {
+			c.Fragment = ""
+			page.CanonicalURL = c.String()
+		}
 	}
-	vec := make([]float32, len(vals))
-	for i, v := range vals {
-		vec[i] = float32(v.(float64))
+	if page.CanonicalURL != u {
+		log.Printf("fetched %s as %s", u, page.CanonicalURL)
 	}
-	return vec, nil
+	return page, nil
 }
 
-func (e *engine) complete(ctx context.Context, prompt string) (string, error) {
-	provider := strings.ToLower(getEnv("LLM_PROVIDER", "gemini"))
-	if provider == "openai" {
-		key := os.Getenv("OPENAI_API_KEY")
-		if key == "" {
-			return "", errors.New("OPENAI_API_KEY not set")
-		}
-		model := e.models.CompletionModel
-		if model == "" {
-			model = "gpt-4o-mini"
-		}
-		endpoint := "https://api.openai.com/v1/chat/completions"
-		body := map[string]any{
-			"model":       model,
-			"temperature": 0.2,
-			"max_tokens":  1024,
-			"messages": []map[string]any{
-				{"role": "system", "content": systemPrompt},
-				{"role": "user", "content": prompt},
-			},
-		}
-		bs, err := json.Marshal(body)
-		if err != nil {
-			return "", err
-		}
-		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(bs))
-		if err != nil {
-			return "", err
-		}
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Authorization", "Bearer "+key)
-		resp, err := e.httpClient.Do(req)
-		if err != nil {
-			return "", err
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode != 200 {
-			b, _ := io.ReadAll(resp.Body)
-			return "", fmt.Errorf("complete status %d: %s", resp.StatusCode, string(b))
-		}
-		var out struct {
-			Choices []struct {
-				Message struct {
-					Content string `json:"content"`
-				} `json:"message"`
-			} `json:"choices"`
-		}
-		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-			return "", err
-		}
-		if len(out.Choices) == 0 {
-			return "", errors.New("no choices in response")
-		}
-		return out.Choices[0].Message.Content, nil
-	}
-	// default: Gemini
-	key := os.Getenv("GEMINI_API_KEY")
-	if key == "" {
-		return "", errors.New("GEMINI_API_KEY not set")
-	}
-	model := e.models.CompletionModel
-	if model == "" {
-		model = "gemini-1.5-flash"
-	}
-	endpoint := fmt.Sprintf("https://generativelanguage.googleapis.com/v1/models/%s:generateContent?key=%s", model, key)
-	body := map[string]any{
-		"contents": []map[string]any{{
-			"parts": []map[string]any{{"text": systemPrompt + "\n\n" + prompt}},
-		}},
-		"generationConfig": map[string]any{"maxOutputTokens": 1024, "temperature": 0.2},
-	}
-	bs, err := json.Marshal(body)
-	if err != nil {
-		return "", err
-	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(bs))
+func (e *engine) fetchRaw(ctx context.Context, u string, headers map[string]string) (string, error) {
+	req, err := newFetchRequest(ctx, u, headers)
 	if err != nil {
 		return "", err
 	}
-	req.Header.Set("Content-Type", "application/json")
 	resp, err := e.httpClient.Do(req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
-		b, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("complete status %d: %s", resp.StatusCode, string(b))
-	}
-	var out map[string]any
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return "", err
-	}
-	cands, ok := out["candidates"].([]any)
-	if !ok || len(cands) == 0 {
-		return "", errors.New("no candidates")
-	}
-	content, ok := cands[0].(map[string]any)["content"].(map[string]any)
-	if !ok {
-		return "", errors.New("no content in candidate")
-	}
-	parts, ok := content["parts"].([]any)
-	if !ok || len(parts) == 0 {
-		return "", errors.New("no parts in content")
-	}
-	text, _ := parts[0].(map[string]any)["text"].(string)
-	return text, nil
-}
-
-const systemPrompt = "You are Kiali/Istio assistant. Be precise, cite sources, and use provided Kiali endpoint data to analyze graphs, traffic, metrics, and propose troubleshooting steps."
-
-func buildPrompt(query string, kialiContext any, docs []docChunk) string {
-	var b strings.Builder
-	b.WriteString("User question:\n")
-	b.WriteString(query)
-	b.WriteString("\n\nRelevant context (from Kiali docs and demos):\n")
-	for i, d := range docs {
-		b.WriteString(fmt.Sprintf("[%d] %s - %s: %s\n", i+1, d.Title, d.URL, d.Snippet))
-	}
-	if kialiContext != nil {
-		b.WriteString("\nKiali data (graphs/metrics JSON):\n")
-		bs, _ := json.Marshal(kialiContext)
-		b.Write(bs)
+		return "", fmt.Errorf("status %d", resp.StatusCode)
 	}
-	b.WriteString("\nAnswer step-by-step. Reference sources by URL when relevant.")
-	return b.String()
+	b, _ := io.ReadAll(resp.Body)
+	return string(b), nil
 }
 
-// --- web fetching helpers ---
-
-func (e *engine) fetchDoc(u string) (*goquery.Document, error) {
-	resp, err := e.httpClient.Get(u)
-	if err != nil {
-		return nil, err
+// logFetchHeaders records the custom headers of an ingest job with secrets redacted.
+func logFetchHeaders(headers map[string]string) {
+	if len(headers) == 0 {
+		return
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	parts := make([]string, 0, len(headers))
+	for k, v := range headers {
+		if isSensitiveHeader(k) {
+			v = "[REDACTED]"
+		}
+		parts = append(parts, k+"="+v)
 	}
-	return goquery.NewDocumentFromReader(resp.Body)
+	sort.Strings(parts)
+	log.Printf("ingest fetch headers: %s", strings.Join(parts, ", "))
 }
 
-func (e *engine) fetchRaw(u string) (string, error) {
-	resp, err := e.httpClient.Get(u)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("status %d", resp.StatusCode)
+func isSensitiveHeader(name string) bool {
+	lower := strings.ToLower(name)
+	for _, s := range []string{"authorization", "cookie", "token", "secret", "key", "password", "auth"} {
+		if strings.Contains(lower, s) {
+			return true
+		}
 	}
-	b, _ := io.ReadAll(resp.Body)
-	return string(b), nil
+	return false
 }
 
 // extractKialiContent builds structured text from typical kiali.io docs markup, prioritizing <h3 id> FAQ sections,
@@ -918,12 +1940,9 @@ func extractKialiContent(doc *goquery.Document, currURL string) (string, string)
 				if tag == "h3" {
 					break
 				}
-				if tag == "p" {
-					text := strings.TrimSpace(sib.Text())
-					if text != "" {
-						b.WriteString(text)
-						b.WriteString("\n\n")
-					}
+				if text := blockText(sib); text != "" {
+					b.WriteString(text)
+					b.WriteString("\n\n")
 				}
 			}
 		})
@@ -951,12 +1970,9 @@ func extractKialiContent(doc *goquery.Document, currURL string) (string, string)
 			if tag == "h2" {
 				break
 			}
-			if tag == "p" {
-				text := strings.TrimSpace(sib.Text())
-				if text != "" {
-					b.WriteString(text)
-					b.WriteString("\n\n")
-				}
+			if text := blockText(sib); text != "" {
+				b.WriteString(text)
+				b.WriteString("\n\n")
 			}
 		}
 	})
@@ -993,41 +2009,11 @@ func collectKialiLinks(doc *goquery.Document, curr string) []string {
 		if strings.HasPrefix(href, "mailto:") || strings.HasPrefix(href, "javascript:") {
 			return
 		}
-		link := resolveURL(curr, href)
-		if shouldCrawl(link) {
-			out = append(out, link)
-		}
+		out = append(out, resolveURL(curr, href))
 	})
 	return out
 }
 
-func shouldCrawl(u string) bool {
-	parsed, err := url.Parse(u)
-	if err != nil {
-		return false
-	}
-	if parsed.Host == "" {
-		return false
-	}
-	if !strings.Contains(parsed.Host, "kiali.io") {
-		return false
-	}
-	// focus on docs subtree
-	if !strings.Contains(parsed.Path, "/docs/") {
-		return false
-	}
-	// skip assets and binary files
-	lower := strings.ToLower(parsed.Path)
-	if strings.HasSuffix(lower, ".png") || strings.HasSuffix(lower, ".jpg") || strings.HasSuffix(lower, ".jpeg") || strings.HasSuffix(lower, ".gif") || strings.HasSuffix(lower, ".svg") || strings.HasSuffix(lower, ".ico") || strings.HasSuffix(lower, ".pdf") || strings.HasSuffix(lower, ".zip") {
-		return false
-	}
-	// avoid taxonomy pages
-	if strings.Contains(lower, "/tag/") || strings.Contains(lower, "/category/") {
-		return false
-	}
-	return true
-}
-
 func resolveURL(baseURL, href string) string {
 	u, err := url.Parse(href)
 	if err != nil {
@@ -1062,6 +2048,13 @@ func min(a, b int) int {
 	return b
 }
 
+func nullFloat(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
+
 func floatsToBlob(vec []float32) []byte {
 	b := make([]byte, len(vec)*4)
 	for i, f := range vec {
@@ -1105,9 +2098,9 @@ func topK(items []docChunk, k int) []docChunk {
 	res := make([]docChunk, 0, k)
 	for i := 0; i < k && len(items) > 0; i++ {
 		best := 0
-		bestScore := extractScore(items[0].Snippet)
+		bestScore := items[0].Rank
 		for j := 1; j < len(items); j++ {
-			s := extractScore(items[j].Snippet)
+			s := items[j].Rank
 			if s > bestScore {
 				best = j
 				bestScore = s
@@ -1119,28 +2112,11 @@ func topK(items []docChunk, k int) []docChunk {
 	return res
 }
 
-func extractScore(snippet string) float64 {
-	idx := strings.LastIndex(snippet, "(sim=")
-	if idx == -1 {
-		return -1
-	}
-	var s float64
-	fmt.Sscanf(snippet[idx+5:], "%f)", &s)
-	return s
-}
-
-func getEnv(key, def string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
-	}
-	return def
-}
-
 func buildPostgresDSN() string {
-	host := os.Getenv("DB_HOST")
-	dbName := os.Getenv("DB_NAME")
-	user := os.Getenv("DB_USER")
-	pass := os.Getenv("DB_PASS")
+	host := config.Get("DB_HOST", "")
+	dbName := config.Get("DB_NAME", "")
+	user := config.Get("DB_USER", "")
+	pass := config.Get("DB_PASS", "")
 
 	if host == "" {
 		log.Fatalf("DB_HOST not set for Postgres backend")
@@ -1186,12 +2162,9 @@ func extractKialiSections(doc *goquery.Document, currURL string) []extractedSect
 				if tag == "h1" || tag == "h2" || tag == "h3" {
 					break
 				}
-				if tag == "p" {
-					text := strings.TrimSpace(sib.Text())
-					if text != "" {
-						b.WriteString(text)
-						b.WriteString("\n\n")
-					}
+				if text := blockText(sib); text != "" {
+					b.WriteString(text)
+					b.WriteString("\n\n")
 				}
 			}
 			secURL := currURL
@@ -0,0 +1,171 @@
+package rag
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// With SNIPPET_WINDOW set to a number of characters (default 0: off), search
+// results and citation spans show the part of their chunk around the query terms
+// instead of the 160-character prefix stored with the chunk: a window of about
+// that size covering as many distinct query terms as possible, with the terms
+// wrapped in SNIPPET_HIGHLIGHT (default "**", empty for none) and "…" marking cut
+// text. The chunk is re-split from its stored document; chunks that cannot be
+// recovered (summaries, transcripts) or mention none of the terms keep the prefix.
+// The prompt always gets the stored snippet.
+
+// querySnippets returns the snippet of each of docs for query, the stored one
+// where no window applies.
+func (e *engine) querySnippets(ctx context.Context, query string, docs []docChunk) []string {
+	out := make([]string, len(docs))
+	for i, d := range docs {
+		out[i] = d.Snippet
+	}
+	size := config.GetInt("SNIPPET_WINDOW", 0)
+	if size <= 0 {
+		return out
+	}
+	kw := &keywordExtractor{stopwords: loadStopwords()}
+	terms := map[string]bool{}
+	for _, t := range kw.terms(query) {
+		terms[t] = true
+	}
+	if len(terms) == 0 {
+		return out
+	}
+	mark := config.Get("SNIPPET_HIGHLIGHT", "**")
+	chunks := map[int64][]string{}
+	for i, d := range docs {
+		split, ok := chunks[d.ID]
+		if !ok {
+			split = e.documentChunks(ctx, d.ID)
+			chunks[d.ID] = split
+		}
+		for _, ch := range split {
+			if ch[:min(160, len(ch))] != d.Snippet {
+				continue
+			}
+			if w, ok := snippetWindow(kw, ch, terms, size, mark); ok {
+				out[i] = w
+			}
+			break
+		}
+	}
+	return out
+}
+
+// documentChunks re-splits a stored document as it was chunked at ingest; nil
+// when it cannot be loaded.
+func (e *engine) documentChunks(ctx context.Context, id int64) []string {
+	var docURL, stored string
+	if err := e.db.QueryRowContext(ctx, "SELECT url, content FROM documents WHERE id="+e.placeholder(1), id).Scan(&docURL, &stored); err != nil {
+		return nil
+	}
+	content, err := decodeContent(stored)
+	if err != nil {
+		return nil
+	}
+	return e.splitDocument(docURL, content, 800)
+}
+
+// termSpan is one occurrence of a query term in a chunk, by byte offsets.
+type termSpan struct {
+	start, end int
+	term       string
+}
+
+// termSpans finds the query terms in text, tokenized like keywordExtractor.terms.
+func termSpans(kw *keywordExtractor, text string, terms map[string]bool) []termSpan {
+	var out []termSpan
+	isWord := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '.' || r == '_'
+	}
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		word := text[start:end]
+		trimmed := strings.TrimLeft(word, "-._")
+		s := start + len(word) - len(trimmed)
+		trimmed = strings.TrimRight(trimmed, "-._")
+		if t := kw.terms(trimmed); len(t) == 1 && terms[t[0]] {
+			out = append(out, termSpan{start: s, end: s + len(trimmed), term: t[0]})
+		}
+		start = -1
+	}
+	for i, r := range text {
+		if isWord(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		flush(i)
+	}
+	flush(len(text))
+	return out
+}
+
+// snippetWindow cuts about size bytes of chunk around the densest run of query
+// terms, highlighting them with mark. It reports false when no term occurs.
+func snippetWindow(kw *keywordExtractor, chunk string, terms map[string]bool, size int, mark string) (string, bool) {
+	spans := termSpans(kw, chunk, terms)
+	if len(spans) == 0 {
+		return "", false
+	}
+	// Pick the run of matches fitting the window with the most distinct terms.
+	bestFirst, bestLast, bestDistinct := 0, 0, 0
+	for i := range spans {
+		seen := map[string]bool{}
+		last := i
+		for j := i; j < len(spans) && spans[j].end-spans[i].start <= size; j++ {
+			seen[spans[j].term] = true
+			last = j
+		}
+		if len(seen) > bestDistinct {
+			bestFirst, bestLast, bestDistinct = i, last, len(seen)
+		}
+	}
+	center := (spans[bestFirst].start + spans[bestLast].end) / 2
+	start := max(0, center-size/2)
+	end := min(len(chunk), start+size)
+	start = max(0, end-size)
+	// Cut at spaces so no word, or rune, is split.
+	if start > 0 {
+		if i := strings.IndexFunc(chunk[start:], unicode.IsSpace); i >= 0 && start+i < spans[bestFirst].start {
+			start += i + 1
+		} else {
+			start = spans[bestFirst].start
+		}
+	}
+	if end < len(chunk) {
+		if i := strings.LastIndexFunc(chunk[:end], unicode.IsSpace); i > spans[bestLast].end {
+			end = i
+		} else {
+			end = spans[bestLast].end
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("… ")
+	}
+	pos := start
+	for _, s := range spans {
+		if s.start < start || s.end > end {
+			continue
+		}
+		b.WriteString(chunk[pos:s.start])
+		b.WriteString(mark + chunk[s.start:s.end] + mark)
+		pos = s.end
+	}
+	b.WriteString(chunk[pos:end])
+	if end < len(chunk) {
+		b.WriteString(" …")
+	}
+	return strings.Join(strings.Fields(b.String()), " "), true
+}
@@ -0,0 +1,79 @@
+package rag
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// Documents record the source type they were ingested from in
+// documents.source_type: docs pages, YouTube videos or files of an ingested
+// directory. AnswerOptions.SourceWeights multiplies the rank of every retrieved
+// chunk by the weight of its document's type, so one query can prefer the docs
+// over video transcripts without excluding them; the similarity reported with
+// citations is left as is. Types left out weigh 1; documents stored before the
+// column existed are classified by URL.
+
+// maxSourceWeight bounds a single weight, so one type cannot drown out the others
+// entirely.
+const maxSourceWeight = 10
+
+// SourceWeights maps source types (SourceDocs, SourceYouTube, SourceDirectory) to
+// score multipliers in (0, maxSourceWeight].
+type SourceWeights map[string]float64
+
+func (w SourceWeights) validate() error {
+	for kind, v := range w {
+		if !slices.Contains(sourceTypes, kind) {
+			return fmt.Errorf("%w: unknown source type %q, use %s", ErrInvalidSourceWeight, kind, strings.Join(sourceTypes, ", "))
+		}
+		if v <= 0 || v > maxSourceWeight {
+			return fmt.Errorf("%w: %s must be above 0 and at most %d, got %g", ErrInvalidSourceWeight, kind, maxSourceWeight, v)
+		}
+	}
+	return nil
+}
+
+// active reports whether any weight changes scores.
+func (w SourceWeights) active() bool {
+	for _, v := range w {
+		if v != 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// factor returns the weight of a document with the stored source type, or the
+// type of its URL when none is stored.
+func (w SourceWeights) factor(stored sql.NullString, docURL string) float64 {
+	if !w.active() {
+		return 1
+	}
+	kind := stored.String
+	if !stored.Valid || kind == "" {
+		kind = documentSourceType(docURL)
+	}
+	if v, ok := w[kind]; ok {
+		return v
+	}
+	return 1
+}
+
+// documentSourceType classifies a document by its URL: YouTube videos, files of an
+// ingested directory (file:// URLs or under INGEST_DIR_URL_BASE) and docs pages.
+func documentSourceType(docURL string) string {
+	switch {
+	case strings.Contains(docURL, "youtube.com/") || strings.Contains(docURL, "youtu.be/"):
+		return SourceYouTube
+	case strings.HasPrefix(docURL, "file://"):
+		return SourceDirectory
+	}
+	if base := strings.TrimRight(config.Get("INGEST_DIR_URL_BASE", ""), "/"); base != "" && strings.HasPrefix(docURL, base+"/") {
+		return SourceDirectory
+	}
+	return SourceDocs
+}
@@ -0,0 +1,61 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSourceWeightsRankWithoutChangingScore(t *testing.T) {
+	e := NewMockEngine().(*engine)
+	ctx := context.Background()
+	for _, u := range []string{"https://kiali.io/docs/graph/", "https://www.youtube.com/watch?v=graph"} {
+		if _, err := e.storeDocument(ctx, DefaultNamespace, "Graph", u, "The Kiali graph shows mesh traffic."); err != nil {
+			t.Fatal(err)
+		}
+	}
+	query, err := e.embed(ctx, "Kiali graph traffic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := e.search(ctx, DefaultNamespace, query, 2, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weighted, err := e.search(ctx, DefaultNamespace, query, 2, "", SourceWeights{SourceYouTube: 3, SourceDocs: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plain) != 2 || len(weighted) != 2 {
+		t.Fatalf("got %d and %d chunks", len(plain), len(weighted))
+	}
+	if documentSourceType(weighted[0].URL) != SourceYouTube {
+		t.Errorf("weighted first = %s, want the video", weighted[0].URL)
+	}
+	for _, c := range weighted {
+		if c.Score != plain[0].Score {
+			t.Errorf("%s score = %v, want the plain similarity %v", c.URL, c.Score, plain[0].Score)
+		}
+	}
+	if weighted[0].Rank <= weighted[1].Rank {
+		t.Errorf("ranks %v, %v not in order", weighted[0].Rank, weighted[1].Rank)
+	}
+}
+
+func TestSourceWeightsValidate(t *testing.T) {
+	tests := []struct {
+		weights SourceWeights
+		ok      bool
+	}{
+		{SourceWeights{SourceDocs: 1.5, SourceYouTube: 0.6, SourceDirectory: 10}, true},
+		{SourceWeights{"github": 2}, false},
+		{SourceWeights{SourceDocs: 0}, false},
+		{SourceWeights{SourceDocs: 11}, false},
+	}
+	for _, tt := range tests {
+		err := tt.weights.validate()
+		if (err == nil) != tt.ok || (err != nil && !errors.Is(err, ErrInvalidSourceWeight)) {
+			t.Errorf("validate(%v) = %v, want ok=%v", tt.weights, err, tt.ok)
+		}
+	}
+}
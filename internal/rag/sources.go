@@ -0,0 +1,122 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Source types recorded in the sources table.
+const (
+	SourceDocs      = "docs"
+	SourceYouTube   = "youtube"
+	SourceDirectory = "directory"
+)
+
+// sourceTypes lists the source types in the order they are documented.
+var sourceTypes = []string{SourceDocs, SourceYouTube, SourceDirectory}
+
+// Source is the ingest history of one source: a docs seed list, a YouTube URL list
+// or a directory. Documents accumulates what every run stored or queued.
+type Source struct {
+	Namespace    string    `json:"namespace"`
+	URL          string    `json:"url"`
+	Type         string    `json:"type"`
+	LastRunAt    time.Time `json:"last_run_at"`
+	LastStatus   string    `json:"last_status"`
+	LastError    string    `json:"last_error,omitempty"`
+	LastIngested int       `json:"last_ingested"`
+	LastSkipped  int       `json:"last_skipped"`
+	Documents    int       `json:"documents"`
+	Runs         int       `json:"runs"`
+}
+
+func initSources(db *sql.DB) error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS sources (
+	namespace TEXT NOT NULL,
+	url TEXT NOT NULL,
+	type TEXT NOT NULL,
+	last_run_at TEXT NOT NULL,
+	last_status TEXT NOT NULL,
+	last_error TEXT NOT NULL DEFAULT '',
+	last_ingested INTEGER NOT NULL DEFAULT 0,
+	last_skipped INTEGER NOT NULL DEFAULT 0,
+	documents INTEGER NOT NULL DEFAULT 0,
+	runs INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (namespace, url)
+);
+`)
+	return err
+}
+
+// recordSource updates the sources table after an ingest run. Runs rejected before
+// they processed anything (bad namespace, no seeds, directory not allowed) are not
+// recorded. Bookkeeping failures are logged and never fail the ingest.
+func (e *engine) recordSource(namespace, kind, source string, res IngestResult, runErr error) {
+	if runErr != nil && reflect.ValueOf(res).IsZero() {
+		return
+	}
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil || source == "" {
+		return
+	}
+	status, errText := "ok", ""
+	switch {
+	case res.Cancelled:
+		status, errText = "cancelled", runErr.Error()
+	case runErr != nil:
+		status, errText = "error", runErr.Error()
+	}
+	contributed := res.Ingested + res.Queued
+	q := `INSERT INTO sources(namespace, url, type, last_run_at, last_status, last_error, last_ingested, last_skipped, documents, runs)
+VALUES(` + e.placeholders(9) + `, 1)
+ON CONFLICT(namespace, url) DO UPDATE SET type=excluded.type, last_run_at=excluded.last_run_at,
+	last_status=excluded.last_status, last_error=excluded.last_error, last_ingested=excluded.last_ingested,
+	last_skipped=excluded.last_skipped, documents=sources.documents+excluded.documents, runs=sources.runs+1`
+	unlock := e.lockWrites()
+	defer unlock()
+	// The run's context may be cancelled already; the record should still land.
+	_, err = e.db.ExecContext(context.Background(), q, ns, source, kind, time.Now().UTC().Format(time.RFC3339),
+		status, errText, contributed, res.Skipped, contributed)
+	if err != nil {
+		log.Printf("record source %s: %v", source, err)
+	}
+}
+
+// Sources lists the ingest sources of a namespace, most recently run first.
+func (e *engine) Sources(ctx context.Context, namespace string) ([]Source, error) {
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := e.db.QueryContext(ctx, `SELECT namespace, url, type, last_run_at, last_status, last_error, last_ingested, last_skipped, documents, runs
+FROM sources WHERE namespace=`+e.placeholder(1)+` ORDER BY last_run_at DESC, url`, ns)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Source{}
+	for rows.Next() {
+		var s Source
+		var at string
+		if err := rows.Scan(&s.Namespace, &s.URL, &s.Type, &at, &s.LastStatus, &s.LastError, &s.LastIngested, &s.LastSkipped, &s.Documents, &s.Runs); err != nil {
+			return nil, err
+		}
+		s.LastRunAt, _ = time.Parse(time.RFC3339, at)
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// placeholders returns n comma-separated bind markers.
+func (e *engine) placeholders(n int) string {
+	marks := make([]string, n)
+	for i := range marks {
+		marks[i] = e.placeholder(i + 1)
+	}
+	return strings.Join(marks, ", ")
+}
@@ -0,0 +1,49 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// busyRetryBaseDelay is the wait before the first retry of a locked SQLite
+// operation; it doubles per attempt.
+const busyRetryBaseDelay = 50 * time.Millisecond
+
+// isSQLiteBusy reports lock contention that outlasted busy_timeout: SQLITE_BUSY
+// or SQLITE_LOCKED, including their extended codes.
+func isSQLiteBusy(err error) bool {
+	var se *sqlite.Error
+	if !errors.As(err, &se) {
+		return false
+	}
+	code := se.Code() & 0xff
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+}
+
+// withBusyRetries calls fn up to SQLITE_BUSY_RETRIES extra times (default 3)
+// while it fails because the database is locked. fn must be safe to repeat, e.g.
+// a whole transaction or idempotent deletes. Other errors return at once, so
+// Postgres operations pass through unchanged.
+func withBusyRetries[T any](ctx context.Context, op string, fn func() (T, error)) (T, error) {
+	retries := max(0, config.GetInt("SQLITE_BUSY_RETRIES", 3))
+	delay := busyRetryBaseDelay
+	for attempt := 0; ; attempt++ {
+		v, err := fn()
+		if err == nil || attempt >= retries || !isSQLiteBusy(err) || ctx.Err() != nil {
+			return v, err
+		}
+		log.Printf("%s: database locked, retrying in %s: %v", op, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return v, err
+		}
+		delay *= 2
+	}
+}
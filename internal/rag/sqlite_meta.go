@@ -0,0 +1,86 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+)
+
+// metaEmbeddingDim is the meta key holding the width of every vector in a SQLite
+// store. SQLite blobs carry no dimension of their own, so it is recorded from the
+// first stored embedding and checked on every write and read.
+const metaEmbeddingDim = "embedding_dim"
+
+func initSqliteMeta(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS meta (key TEXT PRIMARY KEY, value TEXT)`)
+	return err
+}
+
+// loadSqliteDim returns the recorded store dimension, or 0 when nothing is stored
+// yet. Stores written before the meta table existed are detected from their first
+// blob and recorded.
+func loadSqliteDim(db *sql.DB) (int, error) {
+	var v string
+	err := db.QueryRow("SELECT value FROM meta WHERE key=?", metaEmbeddingDim).Scan(&v)
+	if err == nil {
+		return strconv.Atoi(v)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	var n int
+	err = db.QueryRow("SELECT LENGTH(vector) FROM embeddings ORDER BY rowid LIMIT 1").Scan(&n)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	dim := n / 4
+	if _, err := db.Exec("INSERT INTO meta(key, value) VALUES(?, ?)", metaEmbeddingDim, strconv.Itoa(dim)); err != nil {
+		return 0, err
+	}
+	log.Printf("sqlite store: detected embedding dimension %d", dim)
+	return dim, nil
+}
+
+// checkStoreDim verifies vectors against the store dimension, recording it on the
+// first write. The caller must hold the SQLite write lock.
+func (e *engine) checkStoreDim(ctx context.Context, vectors [][]float32) error {
+	if len(vectors) == 0 {
+		return nil
+	}
+	dim := int(e.storeDim.Load())
+	if dim == 0 {
+		dim = len(vectors[0])
+		if _, err := e.db.ExecContext(ctx, "INSERT OR REPLACE INTO meta(key, value) VALUES(?, ?)", metaEmbeddingDim, strconv.Itoa(dim)); err != nil {
+			return err
+		}
+		e.storeDim.Store(int64(dim))
+		log.Printf("sqlite store: recorded embedding dimension %d", dim)
+	}
+	for _, v := range vectors {
+		if len(v) != dim {
+			return fmt.Errorf("embedding has %d dimensions, store has %d; clean the store before switching embedding models", len(v), dim)
+		}
+	}
+	return nil
+}
+
+// resetStoreDimIfEmpty forgets the store dimension once no embeddings remain, so a
+// cleaned store can be filled with a different embedding model. The caller must
+// hold the SQLite write lock.
+func (e *engine) resetStoreDimIfEmpty(ctx context.Context) error {
+	var n int
+	if err := e.db.QueryRowContext(ctx, "SELECT COUNT(1) FROM embeddings").Scan(&n); err != nil || n > 0 {
+		return err
+	}
+	if _, err := e.db.ExecContext(ctx, "DELETE FROM meta WHERE key=?", metaEmbeddingDim); err != nil {
+		return err
+	}
+	e.storeDim.Store(0)
+	return nil
+}
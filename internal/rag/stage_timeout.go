@@ -0,0 +1,84 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// An answer runs in two stages with their own deadlines inside the request's:
+// retrieval (embedding the query, the FAQ lookup and the vector search) gets
+// RETRIEVAL_TIMEOUT_SECONDS and the completion call LLM_TIMEOUT_SECONDS, both
+// 0 (default) for no limit of their own. A slow embedding then cannot use up
+// the time the completion needs, provided SERVER_TIMEOUT_SECONDS leaves room for
+// both. A run that hits any deadline fails with a *StageTimeoutError naming the
+// stage it was in.
+
+// ErrStageTimeout is wrapped by the *StageTimeoutError of an answer that ran out
+// of time.
+var ErrStageTimeout = errors.New("timed out")
+
+// Answer stages.
+const (
+	StageRetrieval  = "retrieval"
+	StageCompletion = "completion"
+)
+
+// StageTimeoutError reports the stage an answer was in when its deadline passed
+// and how long the stage had run.
+type StageTimeoutError struct {
+	Stage string
+	After time.Duration
+}
+
+func (e *StageTimeoutError) Error() string {
+	return fmt.Sprintf("%s stage %v after %s", e.Stage, ErrStageTimeout, e.After)
+}
+
+func (e *StageTimeoutError) Unwrap() []error {
+	return []error{ErrStageTimeout, context.DeadlineExceeded}
+}
+
+func stageTimeout(key string) time.Duration {
+	return time.Duration(max(0, config.GetInt(key, 0))) * time.Second
+}
+
+// stageClock tracks the running stage of one answer.
+type stageClock struct {
+	stage  string
+	start  time.Time
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// begin starts stage under ctx, with its own timeout when positive, ending the
+// previous one.
+func (c *stageClock) begin(ctx context.Context, stage string, timeout time.Duration) context.Context {
+	c.end()
+	c.cancel = func() {}
+	if timeout > 0 {
+		ctx, c.cancel = context.WithTimeout(ctx, timeout)
+	}
+	c.stage, c.start, c.ctx = stage, time.Now(), ctx
+	return ctx
+}
+
+// end ends the running stage, if any.
+func (c *stageClock) end() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.stage, c.ctx, c.cancel = "", nil, nil
+}
+
+// annotate turns err into a *StageTimeoutError when the running stage's
+// deadline has passed.
+func (c *stageClock) annotate(err error) error {
+	if err == nil || c.ctx == nil || !errors.Is(c.ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return &StageTimeoutError{Stage: c.stage, After: time.Since(c.start).Round(time.Millisecond)}
+}
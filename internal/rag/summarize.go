@@ -0,0 +1,86 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// Summary modes for INGEST_SUMMARIES. Summaries cost one completion per long
+// document, so they are off by default.
+const (
+	summaryModeOff     = "off"
+	summaryModeAdd     = "add"     // embed the summary next to the raw chunks
+	summaryModeReplace = "replace" // embed only the summary
+)
+
+const (
+	chunkKindRaw     = "chunk"
+	chunkKindSummary = "summary"
+)
+
+const summaryInstruction = "Summarize the following documentation in at most five sentences for search indexing. Keep product names, settings and commands exact. Reply with the summary only."
+
+func loadSummaryMode() string {
+	mode := strings.ToLower(strings.TrimSpace(config.Get("INGEST_SUMMARIES", summaryModeOff)))
+	switch mode {
+	case summaryModeOff, summaryModeAdd, summaryModeReplace:
+		return mode
+	}
+	log.Printf("INGEST_SUMMARIES: unknown mode %q, summaries disabled", mode)
+	return summaryModeOff
+}
+
+// summaryChunks returns the chunks to embed for a document, adding or substituting
+// an LLM summary when summaries are enabled and the content is long enough. A failed
+// summary falls back to the raw chunks.
+func (e *engine) summaryChunks(ctx context.Context, title, content string, raw []textChunk) ([]textChunk, bool) {
+	if e.summaryMode == summaryModeOff || len(content) < e.summaryMinChars {
+		return raw, false
+	}
+	summary, err := e.summarize(ctx, title, content)
+	if err != nil {
+		log.Printf("summarize %q failed, keeping raw chunks: %v", title, err)
+		return raw, false
+	}
+	sum := textChunk{Text: summary, Kind: chunkKindSummary}
+	if e.summaryMode == summaryModeReplace {
+		return []textChunk{sum}, true
+	}
+	return append(raw, sum), true
+}
+
+func (e *engine) summarize(ctx context.Context, title, content string) (string, error) {
+	if e.maxPromptTokens > 0 {
+		// Leave room for the instructions and the system prompt.
+		limit := max(0, (e.maxPromptTokens-512)*charsPerToken)
+		content = content[:min(limit, len(content))]
+	}
+	prompt := fmt.Sprintf("%s\n\nTitle: %s\n\n%s", summaryInstruction, title, content)
+	text, _, err := e.complete(ctx, e.providerChain(), prompt, nil, defaultSampling)
+	if err != nil {
+		return "", err
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return text, nil
+}
+
+func summaryScoreBoost() float64 {
+	v := config.Get("SUMMARY_SCORE_BOOST", "")
+	if v == "" {
+		return 0.02
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil {
+		log.Printf("SUMMARY_SCORE_BOOST: %v", err)
+		return 0.02
+	}
+	return f
+}
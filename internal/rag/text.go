@@ -0,0 +1,40 @@
+package rag
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	mdImage        = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLink         = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	mdHeading      = regexp.MustCompile(`(?m)^\s{0,3}#{1,6}\s+`)
+	mdListMarker   = regexp.MustCompile(`(?m)^\s*(?:[-*+]|\d+\.)\s+`)
+	mdBlockquote   = regexp.MustCompile(`(?m)^\s*>\s?`)
+	mdEmphasis     = regexp.MustCompile("(\\*\\*|__|\\*|~~|`{1,3})")
+	mdHorizontalHR = regexp.MustCompile(`(?m)^\s*(?:-{3,}|\*{3,}|_{3,})\s*$`)
+)
+
+// normalizeEmbeddingInput cleans extraction artifacts before text is embedded:
+// HTML entities are decoded, markdown markers are optionally stripped, and runs of
+// whitespace collapse to single spaces.
+func normalizeEmbeddingInput(text string, stripMarkdown bool) string {
+	text = html.UnescapeString(text)
+	if stripMarkdown {
+		text = stripMarkdownMarkers(text)
+	}
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// stripMarkdownMarkers removes markdown syntax while keeping the readable text,
+// e.g. "## [Graph](/docs/graph) **basics**" becomes "Graph basics".
+func stripMarkdownMarkers(text string) string {
+	text = mdImage.ReplaceAllString(text, "$1")
+	text = mdLink.ReplaceAllString(text, "$1")
+	text = mdHorizontalHR.ReplaceAllString(text, "")
+	text = mdHeading.ReplaceAllString(text, "")
+	text = mdBlockquote.ReplaceAllString(text, "")
+	text = mdListMarker.ReplaceAllString(text, "")
+	return mdEmphasis.ReplaceAllString(text, "")
+}
@@ -0,0 +1,82 @@
+package rag
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestNormalizeEmbeddingInput(t *testing.T) {
+	tests := []struct {
+		name          string
+		in            string
+		stripMarkdown bool
+		want          string
+	}{
+		{
+			name: "collapses whitespace",
+			in:   "  Kiali\tshows\n\n the   mesh  ",
+			want: "Kiali shows the mesh",
+		},
+		{
+			name: "decodes html entities",
+			in:   "Istio &amp; Kiali &lt;graph&gt; &quot;view&quot; &#39;tab&#39;",
+			want: `Istio & Kiali <graph> "view" 'tab'`,
+		},
+		{
+			name: "keeps markdown by default",
+			in:   "## Graph\n\n**basics** of [Kiali](/docs)",
+			want: "## Graph **basics** of [Kiali](/docs)",
+		},
+		{
+			name:          "strips headings, emphasis and links",
+			in:            "## [Graph](/docs/graph) **basics**",
+			stripMarkdown: true,
+			want:          "Graph basics",
+		},
+		{
+			name:          "strips images, lists, quotes and rules",
+			in:            "![diagram](mesh.png)\n- first\n2. second\n> quoted\n---\n`kubectl` ~~old~~",
+			stripMarkdown: true,
+			want:          "diagram first second quoted kubectl old",
+		},
+		{
+			name:          "decodes entities before stripping",
+			in:            "&gt; note: __use__ the &amp; operator",
+			stripMarkdown: true,
+			want:          "note: use the & operator",
+		},
+		{
+			name: "empty",
+			in:   " \n\t ",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeEmbeddingInput(tt.in, tt.stripMarkdown); got != tt.want {
+				t.Errorf("normalizeEmbeddingInput(%q, %v) = %q, want %q", tt.in, tt.stripMarkdown, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbedNormalizesQueriesLikeChunks(t *testing.T) {
+	e := NewMockEngine().(*engine)
+	ctx := context.Background()
+	query, err := e.embed(ctx, "  Kiali &amp;\n graph ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The mock provider embeds words, so an undecoded entity would add "amp".
+	chunks, _, err := e.embedBatch(ctx, []string{"Kiali & graph", "Kiali amp graph"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(query, chunks[0]) {
+		t.Error("query and chunk with the same cleaned text got different vectors")
+	}
+	if slices.Equal(query, chunks[1]) {
+		t.Error("query was embedded with its html entity undecoded")
+	}
+}
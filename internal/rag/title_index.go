@@ -0,0 +1,188 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+	"github.com/pgvector/pgvector-go"
+)
+
+// With TITLE_INDEX (default false) every stored document also embeds its title,
+// kept as a chunk of kind title that body retrieval never returns. Navigational
+// queries ("Kiali Graph page docs") match titles far better than body text: when
+// the query embedding reaches TITLE_MATCH_THRESHOLD (default 0.8) cosine
+// similarity to a title, the best chunk of that document is surfaced ahead of the
+// retrieved ones, for at most maxTitleMatches documents. Documents stored before
+// the toggle have no title chunk until they are ingested again.
+
+const chunkKindTitle = "title"
+
+// maxTitleMatches caps the documents a query surfaces by title.
+const maxTitleMatches = 2
+
+func titleMatchThreshold() float64 {
+	v := strings.TrimSpace(config.Get("TITLE_MATCH_THRESHOLD", ""))
+	if v == "" {
+		return 0.8
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Printf("TITLE_MATCH_THRESHOLD: %v", err)
+		return 0.8
+	}
+	return f
+}
+
+// withTitleChunk appends the title chunk of a document when the title index is on.
+func (e *engine) withTitleChunk(title string, chunks []textChunk) []textChunk {
+	if !e.titleIndex || strings.TrimSpace(title) == "" {
+		return chunks
+	}
+	return append(chunks, textChunk{Text: strings.TrimSpace(title), Kind: chunkKindTitle})
+}
+
+// titleMatch is a document whose title the query matched.
+type titleMatch struct {
+	docID int64
+	score float64
+}
+
+// pinTitleMatches moves the best chunk of each document whose title matches q to
+// the front of cands, loading it when retrieval did not find it, and returns the
+// chunks pinned that way together with the remaining candidates.
+func (e *engine) pinTitleMatches(ctx context.Context, ns string, q queryEmbedding, cands []docChunk) (pinned, rest []docChunk) {
+	if !e.titleIndex {
+		return nil, cands
+	}
+	matches, err := e.titleMatches(ctx, ns, q)
+	if err != nil {
+		log.Printf("title match: %v", err)
+		return nil, cands
+	}
+	rest = cands
+	for _, m := range matches {
+		best := -1
+		for i, c := range rest {
+			if c.ID == m.docID && (best < 0 || c.Rank > rest[best].Rank) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			pinned = append(pinned, rest[best])
+			rest = append(rest[:best:best], rest[best+1:]...)
+			continue
+		}
+		c, ok, err := e.bestDocumentChunk(ctx, m.docID, q.Vector)
+		if err != nil {
+			log.Printf("title match: load document %d: %v", m.docID, err)
+			continue
+		}
+		if ok {
+			pinned = append(pinned, c)
+		}
+	}
+	return pinned, rest
+}
+
+// titleMatches returns up to maxTitleMatches documents of ns whose title
+// embedding reaches the threshold, best first.
+func (e *engine) titleMatches(ctx context.Context, ns string, q queryEmbedding) ([]titleMatch, error) {
+	threshold := titleMatchThreshold()
+	model := q.Target.EmbeddingModel
+	var out []titleMatch
+	if e.backend == "postgres" {
+		rows, err := e.db.QueryContext(ctx, `SELECT document_id, 1 - (vector <=> $2) AS score FROM embeddings
+WHERE namespace=$1 AND kind='title' AND COALESCE(model, $3) = $4 ORDER BY vector <=> $2 LIMIT $5`,
+			ns, pgvector.NewVector(q.Vector), e.models.EmbeddingModel, model, maxTitleMatches)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var m titleMatch
+			if err := rows.Scan(&m.docID, &m.score); err != nil {
+				return nil, err
+			}
+			if m.score >= threshold {
+				out = append(out, m)
+			}
+		}
+		return out, rows.Err()
+	}
+	rows, err := e.db.QueryContext(ctx, "SELECT document_id, vector FROM embeddings WHERE namespace=? AND kind='title' AND COALESCE(model, ?) = ?",
+		ns, e.models.EmbeddingModel, model)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var blob []byte
+		if err := rows.Scan(&id, &blob); err != nil {
+			return nil, err
+		}
+		if len(blob) != len(q.Vector)*4 {
+			continue
+		}
+		if sim := cosine(blobToFloats(blob), q.Vector); sim >= threshold {
+			out = append(out, titleMatch{docID: id, score: sim})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].score > out[j].score })
+	return out[:min(maxTitleMatches, len(out))], nil
+}
+
+// bestDocumentChunk returns the body chunk of a document most similar to queryVec.
+func (e *engine) bestDocumentChunk(ctx context.Context, docID int64, queryVec []float32) (docChunk, bool, error) {
+	if e.backend == "postgres" {
+		var c docChunk
+		var vec pgvector.Vector
+		var start sql.NullFloat64
+		err := e.db.QueryRowContext(ctx, `SELECT d.id, d.title, d.url, e.snippet, e.vector, e.start_seconds, 1 - (e.vector <=> $2) AS score
+FROM embeddings e JOIN documents d ON d.id=e.document_id WHERE e.document_id=$1 AND e.kind <> 'title' ORDER BY e.vector <=> $2 LIMIT 1`,
+			docID, pgvector.NewVector(queryVec)).Scan(&c.ID, &c.Title, &c.URL, &c.Snippet, &vec, &start, &c.Score)
+		if err == sql.ErrNoRows {
+			return c, false, nil
+		}
+		if err != nil {
+			return c, false, err
+		}
+		c.Vector, c.StartSeconds, c.Rank = vec.Slice(), nullFloat(start), c.Score
+		return c, true, nil
+	}
+	rows, err := e.db.QueryContext(ctx, "SELECT d.id, d.title, d.url, e.snippet, e.vector, e.start_seconds FROM embeddings e JOIN documents d ON d.id = e.document_id WHERE e.document_id = ? AND e.kind <> 'title'", docID)
+	if err != nil {
+		return docChunk{}, false, err
+	}
+	defer rows.Close()
+	var best docChunk
+	found := false
+	for rows.Next() {
+		var c docChunk
+		var blob []byte
+		var start sql.NullFloat64
+		if err := rows.Scan(&c.ID, &c.Title, &c.URL, &c.Snippet, &blob, &start); err != nil {
+			return docChunk{}, false, err
+		}
+		if len(blob) != len(queryVec)*4 {
+			continue
+		}
+		c.Vector, c.StartSeconds = blobToFloats(blob), nullFloat(start)
+		c.Score = cosine(c.Vector, queryVec)
+		if !found || c.Score > best.Score {
+			best, found = c, true
+		}
+	}
+	if found {
+		best.Rank = best.Score
+	}
+	return best, found, rows.Err()
+}
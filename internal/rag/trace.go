@@ -0,0 +1,115 @@
+package rag
+
+import (
+	"context"
+	"time"
+)
+
+// AnswerTrace records each stage of one Answer run for debugging retrieval and
+// answers: the query embedding, the candidate pool by score, the chunks MMR (or
+// plain top-k) selected from it, the chunks and prompt sent to the model after
+// token budgeting, and the answer. Stages a run did not reach stay empty, as do
+// retrieval and prompt for curated FAQ answers.
+type AnswerTrace struct {
+	Query      string `json:"query"`
+	Namespace  string `json:"namespace"`
+	CandidateK int    `json:"candidate_k"`
+	PromptK    int    `json:"prompt_k"`
+	// MMRLambda is set when MMR re-selected the candidates.
+	MMRLambda    *float64       `json:"mmr_lambda,omitempty"`
+	Embedding    TraceEmbedding `json:"embedding"`
+	Candidates   []TraceChunk   `json:"candidates"`
+	Selected     []TraceChunk   `json:"selected"`
+	PromptChunks []TraceChunk   `json:"prompt_chunks"`
+	SystemPrompt string         `json:"system_prompt,omitempty"`
+	Prompt       string         `json:"prompt,omitempty"`
+	Answer       string         `json:"answer"`
+	// Cited lists the prompt chunks the answer cites, by rank.
+	Cited      []int            `json:"cited"`
+	Confidence float64          `json:"confidence"`
+	CuratedID  int64            `json:"faq_id,omitempty"`
+	Degraded   bool             `json:"degraded,omitempty"`
+	Grounding  *Grounding       `json:"grounding,omitempty"`
+	Models     ModelIdentifiers `json:"models"`
+	Usage      TokenUsage       `json:"usage"`
+	DurationMS int64            `json:"duration_ms"`
+}
+
+// TraceEmbedding is the query embedding of a trace.
+type TraceEmbedding struct {
+	Provider  string `json:"provider,omitempty"`
+	Model     string `json:"model,omitempty"`
+	Dimension int    `json:"dimension"`
+}
+
+// TraceChunk is a chunk at one stage of a trace; Rank is its 1-based position there.
+type TraceChunk struct {
+	Rank  int     `json:"rank"`
+	Title string  `json:"title"`
+	URL   string  `json:"url"`
+	Text  string  `json:"text"`
+	Score float64 `json:"score"`
+}
+
+type traceKey struct{}
+
+// traceFrom returns the trace recording the Answer run of ctx, nil when there is
+// none. The recording methods do nothing on a nil trace.
+func traceFrom(ctx context.Context) *AnswerTrace {
+	t, _ := ctx.Value(traceKey{}).(*AnswerTrace)
+	return t
+}
+
+// Trace answers query like Answer, without joining identical calls in progress,
+// and returns the trace of the run. On error the trace covers the stages reached.
+func (e *engine) Trace(ctx context.Context, query string, kialiContext any, opts AnswerOptions) (AnswerTrace, error) {
+	t := &AnswerTrace{Query: query, Candidates: []TraceChunk{}, Selected: []TraceChunk{}, PromptChunks: []TraceChunk{}}
+	start := time.Now()
+	res, err := e.answer(context.WithValue(ctx, traceKey{}, t), query, kialiContext, opts)
+	t.DurationMS = time.Since(start).Milliseconds()
+	t.Answer, t.Confidence, t.CuratedID, t.Degraded, t.Models, t.Usage = res.Answer, res.Confidence, res.CuratedID, res.Degraded, res.Models, res.Usage
+	t.Grounding = res.Grounding
+	t.Cited = []int{}
+	for i, c := range res.Citations {
+		if c.Cited {
+			t.Cited = append(t.Cited, i+1)
+		}
+	}
+	return *t, err
+}
+
+func (t *AnswerTrace) started(ns string, candidateK, promptK int) {
+	if t != nil {
+		t.Namespace, t.CandidateK, t.PromptK = ns, candidateK, promptK
+	}
+}
+
+func (t *AnswerTrace) embedded(target llmTarget, dim int) {
+	if t != nil {
+		t.Embedding = TraceEmbedding{Provider: target.Provider, Model: target.EmbeddingModel, Dimension: dim}
+	}
+}
+
+func (t *AnswerTrace) retrieved(candidates, selected []docChunk, mmrLambda float64) {
+	if t == nil {
+		return
+	}
+	t.Candidates, t.Selected = traceChunks(candidates), traceChunks(selected)
+	if mmrLambda < mmrDisabled {
+		t.MMRLambda = &mmrLambda
+	}
+}
+
+func (t *AnswerTrace) prompted(docs []docChunk, prompt string) {
+	if t != nil {
+		t.PromptChunks, t.SystemPrompt, t.Prompt = traceChunks(docs), systemPrompt, prompt
+	}
+}
+
+func traceChunks(docs []docChunk) []TraceChunk {
+	out := make([]TraceChunk, 0, len(docs))
+	for i, d := range docs {
+		out = append(out, TraceChunk{Rank: i + 1, Title: d.Title, URL: citationURL(d), Text: d.Snippet, Score: d.Score})
+	}
+	return out
+}
@@ -0,0 +1,38 @@
+package rag
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// newTransport returns the shared outbound transport, tuned for bursts of requests
+// to a few hosts (the LLM APIs and kiali.io):
+//   - HTTP_MAX_IDLE_CONNS (default 100) and HTTP_MAX_IDLE_CONNS_PER_HOST (default
+//     16, Go's default is 2) keep connections open between calls.
+//   - HTTP_IDLE_CONN_TIMEOUT_SECONDS (default 90) closes unused ones.
+//   - HTTP_KEEPALIVE_SECONDS (default 30) sets TCP keep-alive probes; negative
+//     disables keep-alive, closing connections after each request.
+//   - HTTP2 (default true) negotiates HTTP/2 over TLS, which multiplexes requests
+//     to one host on a single connection.
+//
+// The dialer is returned too so the egress allowlist can wrap it.
+func newTransport() (*http.Transport, *net.Dialer) {
+	keepAlive := time.Duration(config.GetInt("HTTP_KEEPALIVE_SECONDS", 30)) * time.Second
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: keepAlive}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.MaxIdleConns = config.GetInt("HTTP_MAX_IDLE_CONNS", 100)
+	transport.MaxIdleConnsPerHost = config.GetInt("HTTP_MAX_IDLE_CONNS_PER_HOST", 16)
+	transport.IdleConnTimeout = time.Duration(config.GetInt("HTTP_IDLE_CONN_TIMEOUT_SECONDS", 90)) * time.Second
+	transport.DisableKeepAlives = keepAlive < 0
+	if !config.GetBool("HTTP2", true) {
+		// A non-nil empty map is how net/http is told not to upgrade to HTTP/2.
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport, dialer
+}
@@ -0,0 +1,281 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// With USAGE_ACCOUNTING (default false) every answered chat adds its query count,
+// completion tokens and estimated cost to a counter per client (the API key or
+// Basic user) and namespace in the usage_counters table. Counters are kept per
+// period, the calendar month or with USAGE_PERIOD=day the UTC day, so a new period
+// starts from zero while old ones stay queryable until they are reset.
+//
+// Tokens are those the provider reported for every completion call of an answer,
+// estimated from the text when it reported none; embedding calls are not counted.
+// Cost uses USAGE_COST_PER_1K_PROMPT_TOKENS and USAGE_COST_PER_1K_COMPLETION_TOKENS
+// at the time of the query, so changing prices does not rewrite history. Prompt
+// tokens served from the provider's prompt cache are counted separately too and,
+// when USAGE_COST_PER_1K_CACHED_PROMPT_TOKENS is set, priced at that rate.
+
+// ErrInvalidPeriod is returned by Usage and ResetUsage for a malformed period.
+var ErrInvalidPeriod = errors.New("invalid period")
+
+// usagePeriodPattern matches a year, month or day: 2025, 2025-01 or 2025-01-31.
+var usagePeriodPattern = regexp.MustCompile(`^\d{4}(-\d{2}(-\d{2})?)?$`)
+
+// TokenUsage counts the completion tokens of one answer. CachedPromptTokens are
+// the part of PromptTokens the provider served from its prompt cache.
+type TokenUsage struct {
+	PromptTokens       int `json:"prompt_tokens"`
+	CompletionTokens   int `json:"completion_tokens"`
+	CachedPromptTokens int `json:"cached_prompt_tokens"`
+}
+
+// UsageRecord is the usage of one client in one namespace over a period.
+type UsageRecord struct {
+	Client           string `json:"client"`
+	Namespace        string `json:"namespace"`
+	Queries          int64  `json:"queries"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	// CachedPromptTokens is the part of PromptTokens served from prompt caches.
+	CachedPromptTokens int64   `json:"cached_prompt_tokens"`
+	Cost               float64 `json:"cost"`
+}
+
+// UsageFilter selects usage. Period is a year, month or day prefix of the stored
+// periods, so "2025" rolls a year of monthly counters into one record per client
+// and namespace. Empty fields match everything.
+type UsageFilter struct {
+	Period    string
+	Client    string
+	Namespace string
+}
+
+func initUsage(db *sql.DB, backend string) error {
+	costType := "REAL"
+	if backend == "postgres" {
+		costType = "DOUBLE PRECISION"
+	}
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS usage_counters (
+	period TEXT NOT NULL,
+	client TEXT NOT NULL,
+	namespace TEXT NOT NULL,
+	queries BIGINT NOT NULL DEFAULT 0,
+	prompt_tokens BIGINT NOT NULL DEFAULT 0,
+	completion_tokens BIGINT NOT NULL DEFAULT 0,
+	cost ` + costType + ` NOT NULL DEFAULT 0,
+	PRIMARY KEY (period, client, namespace)
+);
+`)
+	if err != nil {
+		return err
+	}
+	return ensureColumn(db, backend, "usage_counters", "cached_prompt_tokens", "BIGINT NOT NULL DEFAULT 0")
+}
+
+// usagePeriod returns the period now falls in.
+func usagePeriod(now time.Time) string {
+	if strings.EqualFold(config.Get("USAGE_PERIOD", "month"), "day") {
+		return now.UTC().Format("2006-01-02")
+	}
+	return now.UTC().Format("2006-01")
+}
+
+// CurrentUsagePeriod returns the period usage is recorded under now.
+func CurrentUsagePeriod() string {
+	return usagePeriod(time.Now())
+}
+
+// RecordUsage adds one answered query and its tokens to the counters of client in
+// namespace when USAGE_ACCOUNTING is on, and to the quota counters of client when
+// it has quotas. Failures are logged and never fail the query.
+func (e *engine) RecordUsage(client, namespace string, u TokenUsage) {
+	if len(e.quotasFor(client)) > 0 {
+		e.countQuota(client, u.CompletionTokens)
+	}
+	if !config.GetBool("USAGE_ACCOUNTING", false) {
+		return
+	}
+	ns, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return
+	}
+	promptPrice := costPer1K("USAGE_COST_PER_1K_PROMPT_TOKENS")
+	cachedPrice := promptPrice
+	if strings.TrimSpace(config.Get("USAGE_COST_PER_1K_CACHED_PROMPT_TOKENS", "")) != "" {
+		cachedPrice = costPer1K("USAGE_COST_PER_1K_CACHED_PROMPT_TOKENS")
+	}
+	cost := float64(u.PromptTokens-u.CachedPromptTokens)/1000*promptPrice +
+		float64(u.CachedPromptTokens)/1000*cachedPrice +
+		float64(u.CompletionTokens)/1000*costPer1K("USAGE_COST_PER_1K_COMPLETION_TOKENS")
+	q := `INSERT INTO usage_counters(period, client, namespace, queries, prompt_tokens, completion_tokens, cached_prompt_tokens, cost)
+VALUES(` + e.placeholders(8) + `)
+ON CONFLICT(period, client, namespace) DO UPDATE SET queries=usage_counters.queries+excluded.queries,
+	prompt_tokens=usage_counters.prompt_tokens+excluded.prompt_tokens,
+	completion_tokens=usage_counters.completion_tokens+excluded.completion_tokens,
+	cached_prompt_tokens=usage_counters.cached_prompt_tokens+excluded.cached_prompt_tokens, cost=usage_counters.cost+excluded.cost`
+	unlock := e.lockWrites()
+	defer unlock()
+	// The request may be over already; the record should still land.
+	ctx := context.Background()
+	_, err = withBusyRetries(ctx, "record usage", func() (sql.Result, error) {
+		return e.db.ExecContext(ctx, q, CurrentUsagePeriod(), client, ns, 1, u.PromptTokens, u.CompletionTokens, u.CachedPromptTokens, cost)
+	})
+	if err != nil {
+		log.Printf("record usage of %s: %v", client, err)
+	}
+}
+
+func costPer1K(key string) float64 {
+	v := strings.TrimSpace(config.Get(key, ""))
+	if v == "" {
+		return 0
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		log.Printf("%s: want a non-negative price, got %q; using 0", key, v)
+		return 0
+	}
+	return f
+}
+
+// usageWhere builds the WHERE clause of f, numbering placeholders from 1.
+func (e *engine) usageWhere(f UsageFilter) (string, []any, error) {
+	var conds []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, strings.ReplaceAll(cond, "?", e.placeholder(len(args))))
+	}
+	if f.Period != "" {
+		if !usagePeriodPattern.MatchString(f.Period) {
+			return "", nil, fmt.Errorf("%w: %q: want YYYY, YYYY-MM or YYYY-MM-DD", ErrInvalidPeriod, f.Period)
+		}
+		add("period LIKE ?", f.Period+"%")
+	}
+	if f.Client != "" {
+		add("client=?", f.Client)
+	}
+	if f.Namespace != "" {
+		ns, err := NormalizeNamespace(f.Namespace)
+		if err != nil {
+			return "", nil, err
+		}
+		add("namespace=?", ns)
+	}
+	if len(conds) == 0 {
+		return "", nil, nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args, nil
+}
+
+// Usage sums the counters matching f per client and namespace, heaviest
+// consumers first.
+func (e *engine) Usage(ctx context.Context, f UsageFilter) ([]UsageRecord, error) {
+	where, args, err := e.usageWhere(f)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := e.db.QueryContext(ctx, `SELECT client, namespace, SUM(queries), SUM(prompt_tokens), SUM(completion_tokens), SUM(cached_prompt_tokens), SUM(cost)
+FROM usage_counters`+where+` GROUP BY client, namespace ORDER BY SUM(prompt_tokens)+SUM(completion_tokens) DESC, client, namespace`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []UsageRecord{}
+	for rows.Next() {
+		var r UsageRecord
+		if err := rows.Scan(&r.Client, &r.Namespace, &r.Queries, &r.PromptTokens, &r.CompletionTokens, &r.CachedPromptTokens, &r.Cost); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// ResetUsage deletes the counters matching f, or with before set those of periods
+// that sort before it (e.g. "2025-01" drops 2024 and earlier), and returns how
+// many counters were removed. Counters of the current period start over at the
+// next query.
+func (e *engine) ResetUsage(ctx context.Context, f UsageFilter, before string) (int64, error) {
+	where, args, err := e.usageWhere(f)
+	if err != nil {
+		return 0, err
+	}
+	if before != "" {
+		if !usagePeriodPattern.MatchString(before) {
+			return 0, fmt.Errorf("%w: %q: want YYYY, YYYY-MM or YYYY-MM-DD", ErrInvalidPeriod, before)
+		}
+		args = append(args, before)
+		cond := "period < " + e.placeholder(len(args))
+		if where == "" {
+			where = " WHERE " + cond
+		} else {
+			where += " AND " + cond
+		}
+	}
+	unlock := e.lockWrites()
+	defer unlock()
+	res, err := withBusyRetries(ctx, "reset usage", func() (sql.Result, error) {
+		return e.db.ExecContext(ctx, "DELETE FROM usage_counters"+where, args...)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// tokenMeter sums the completion tokens used under a context; see withTokenMeter.
+type tokenMeter struct {
+	mu sync.Mutex
+	u  TokenUsage
+}
+
+type meterKey struct{}
+
+// withTokenMeter returns a context whose completion calls add their tokens to the
+// returned meter.
+func withTokenMeter(ctx context.Context) (context.Context, *tokenMeter) {
+	m := &tokenMeter{}
+	return context.WithValue(ctx, meterKey{}, m), m
+}
+
+// meterFrom returns the meter of ctx, nil when there is none. The meter methods
+// do nothing on a nil meter.
+func meterFrom(ctx context.Context) *tokenMeter {
+	m, _ := ctx.Value(meterKey{}).(*tokenMeter)
+	return m
+}
+
+func (m *tokenMeter) add(u TokenUsage) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.u.PromptTokens += u.PromptTokens
+	m.u.CompletionTokens += u.CompletionTokens
+	m.u.CachedPromptTokens += u.CachedPromptTokens
+}
+
+func (m *tokenMeter) usage() TokenUsage {
+	if m == nil {
+		return TokenUsage{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.u
+}
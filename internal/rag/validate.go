@@ -0,0 +1,59 @@
+package rag
+
+import (
+	"context"
+	"time"
+)
+
+// ModelCheck is the outcome of one probe call. Dimension is set for embedding
+// checks; DimensionMatches compares it with EMBEDDING_DIM.
+type ModelCheck struct {
+	Provider         string `json:"provider"`
+	Kind             string `json:"kind"`
+	Model            string `json:"model"`
+	OK               bool   `json:"ok"`
+	Error            string `json:"error,omitempty"`
+	LatencyMs        int64  `json:"latency_ms"`
+	Dimension        int    `json:"dimension,omitempty"`
+	DimensionMatches bool   `json:"dimension_matches,omitempty"`
+}
+
+// ModelValidation reports ValidateModels. OK covers the primary provider only,
+// since fallbacks are optional.
+type ModelValidation struct {
+	OK                  bool         `json:"ok"`
+	ConfiguredDimension int          `json:"configured_dimension"`
+	Checks              []ModelCheck `json:"checks"`
+}
+
+// ValidateModels makes a minimal embedding and completion call to every provider
+// in the chain, bypassing fallback and the circuit breakers, so wrong model names,
+// bad keys and quota problems show up before an ingest.
+func (e *engine) ValidateModels(ctx context.Context) ModelValidation {
+	res := ModelValidation{OK: true, ConfiguredDimension: e.embeddingDim}
+	for i, t := range e.providerChain() {
+		start := time.Now()
+		vec, err := e.embedVia(ctx, t, "Kiali service mesh observability")
+		emb := ModelCheck{Provider: t.Provider, Kind: "embedding", Model: t.EmbeddingModel, LatencyMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			emb.Error = err.Error()
+		} else {
+			emb.OK, emb.Dimension, emb.DimensionMatches = true, len(vec), len(vec) == e.embeddingDim
+		}
+
+		start = time.Now()
+		_, err = e.completeVia(ctx, t, "Reply with OK.", nil, defaultSampling)
+		comp := ModelCheck{Provider: t.Provider, Kind: "completion", Model: t.CompletionModel, LatencyMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			comp.Error = err.Error()
+		} else {
+			comp.OK = true
+		}
+
+		if i == 0 && !(emb.OK && emb.DimensionMatches && comp.OK) {
+			res.OK = false
+		}
+		res.Checks = append(res.Checks, emb, comp)
+	}
+	return res
+}
@@ -0,0 +1,146 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// ingestVideos fetches and stores videos with up to YOUTUBE_INGEST_CONCURRENCY
+// workers (default 4). Videos are started in playlist order and progress is
+// reported one call at a time with increasing counts; results are merged under a
+// lock so totals match a sequential run. Cancellation stops new fetches, lets the
+// running ones finish and returns the context error with what was stored.
+func (e *engine) ingestVideos(ctx context.Context, ns string, urls []string, opts IngestOptions) (IngestResult, error) {
+	workers := min(max(1, config.GetInt("YOUTUBE_INGEST_CONCURRENCY", 4)), max(1, len(urls)))
+	var (
+		mu      sync.Mutex
+		result  IngestResult
+		started int
+		wg      sync.WaitGroup
+	)
+	jobs := make(chan string)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range jobs {
+				out, source, skipped, ok := e.ingestVideo(ctx, ns, u, opts)
+				mu.Lock()
+				if source != "" {
+					result.Transcripts = append(result.Transcripts, VideoTranscript{URL: u, Source: source})
+				}
+				switch {
+				case skipped:
+					result.Skipped++
+				case ok:
+					result.add(out)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, u := range urls {
+		if ctx.Err() != nil {
+			break
+		}
+		mu.Lock()
+		started++
+		progress := result
+		progress.Transcripts = nil
+		opts.report(started, u, progress)
+		mu.Unlock()
+		select {
+		case jobs <- u:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	order := make(map[string]int, len(urls))
+	for i, u := range urls {
+		order[u] = i
+	}
+	slices.SortStableFunc(result.Transcripts, func(a, b VideoTranscript) int {
+		return order[a.URL] - order[b.URL]
+	})
+	return result, ctx.Err()
+}
+
+// ingestVideo stores one video's transcript: its captions in timed chunks, else
+// the first YOUTUBE_TRANSCRIPT_FALLBACK that yields enough text. It reports the
+// transcript source, whether the video was already stored and whether it was
+// stored now; fetch failures and videos without a usable transcript are neither.
+// Denylisted videos are not fetched and come back with a Denied outcome. Timed
+// transcripts bypass the embed queue, which would keep only their text.
+func (e *engine) ingestVideo(ctx context.Context, ns, u string, opts IngestOptions) (upsertOutcome, string, bool, bool) {
+	if e.crawl.denied(u) {
+		return upsertOutcome{Denied: true}, "", false, true
+	}
+	if exists, _ := e.documentExists(ctx, ns, u); exists {
+		return upsertOutcome{}, "", true, false
+	}
+	body, err := e.fetchRaw(ctx, u, opts.Headers)
+	if err != nil {
+		return upsertOutcome{}, "", false, false
+	}
+	page, err := parseVideoPage(body)
+	if err != nil {
+		log.Printf("youtube %s: %v", u, err)
+		return upsertOutcome{}, "", false, false
+	}
+	title := page.Title
+	if title == "" {
+		title = "YouTube Video"
+	}
+	for _, source := range append([]string{transcriptCaptions}, transcriptFallbacks()...) {
+		content, chunks, err := e.videoTranscript(ctx, source, u, page, opts.Headers)
+		if err == nil && !e.longEnough(SourceYouTube, content) {
+			err = errors.New("too short")
+		}
+		if err != nil {
+			log.Printf("youtube %s: no transcript from %s: %v", u, source, err)
+			continue
+		}
+		var out upsertOutcome
+		if chunks != nil {
+			out, err = e.storeChunks(ctx, ns, title, u, content, chunks)
+			if errors.Is(err, errDocumentBlocked) {
+				err = nil
+			}
+		} else {
+			out, err = e.upsertDocument(ctx, ns, title, u, content)
+		}
+		if err != nil {
+			log.Printf("upsert error for %s: %v", u, err)
+			return upsertOutcome{}, source, false, false
+		}
+		return out, source, false, true
+	}
+	return upsertOutcome{}, transcriptNone, false, false
+}
+
+// videoTranscript returns the text of a video from one transcript source, with
+// timed chunks for captions and the transcription service.
+func (e *engine) videoTranscript(ctx context.Context, source, u string, page videoPage, headers map[string]string) (string, []textChunk, error) {
+	var cues []transcriptCue
+	var err error
+	switch source {
+	case transcriptCaptions:
+		cues, err = e.fetchCaptions(ctx, page, headers)
+	case transcriptService:
+		cues, err = e.transcribe(ctx, u)
+	default:
+		return strings.TrimSpace(page.Title + "\n\n" + page.Description), nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	chunks := transcriptChunks(cues, transcriptChunkWords)
+	return chunksContent(chunks), chunks, nil
+}
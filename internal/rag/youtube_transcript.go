@@ -0,0 +1,309 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+)
+
+// YouTube videos are stored as their caption transcript, cut into chunks of about
+// transcriptChunkWords words that remember when they start so citations can
+// deep-link to the moment (see citationURL). YOUTUBE_CAPTION_LANGUAGES (default
+// "en") orders the caption languages tried; uploaded captions win over automatic
+// ones of the same language, and any track is used when none matches.
+//
+// Videos without captions go through YOUTUBE_TRANSCRIPT_FALLBACK, a comma-separated
+// list tried in order (default "description"; "none" skips such videos):
+// "service" posts {"url": ...} to YOUTUBE_TRANSCRIPTION_URL, waiting up to
+// YOUTUBE_TRANSCRIPTION_TIMEOUT_SECONDS (default 300), and expects
+// {"segments": [{"start": 1.5, "text": "..."}]}; "description" stores the video
+// title and description.
+
+const transcriptChunkWords = 120
+
+// Where a video's transcript came from, as reported in IngestResult.Transcripts.
+const (
+	transcriptCaptions    = "captions"
+	transcriptService     = "service"
+	transcriptDescription = "description"
+	transcriptNone        = "none"
+)
+
+// errNoCaptions is returned for videos without a caption track.
+var errNoCaptions = errors.New("no captions")
+
+// videoPage is what the watch page tells about a video.
+type videoPage struct {
+	Title       string
+	Description string
+	Tracks      []captionTrack
+}
+
+type captionTrack struct {
+	BaseURL      string `json:"baseUrl"`
+	LanguageCode string `json:"languageCode"`
+	// Kind is "asr" for automatic captions.
+	Kind string `json:"kind"`
+}
+
+// transcriptCue is one caption line and its offset in seconds.
+type transcriptCue struct {
+	Start float64
+	Text  string
+}
+
+// parseVideoPage reads the player response embedded in a watch page.
+func parseVideoPage(body string) (videoPage, error) {
+	const marker = "ytInitialPlayerResponse = "
+	i := strings.Index(body, marker)
+	if i < 0 {
+		return videoPage{}, errors.New("no player response in watch page")
+	}
+	var player struct {
+		VideoDetails struct {
+			Title            string `json:"title"`
+			ShortDescription string `json:"shortDescription"`
+		} `json:"videoDetails"`
+		Captions struct {
+			Renderer struct {
+				Tracks []captionTrack `json:"captionTracks"`
+			} `json:"playerCaptionsTracklistRenderer"`
+		} `json:"captions"`
+	}
+	// The decoder stops after the object, ignoring the script that follows it.
+	if err := json.NewDecoder(strings.NewReader(body[i+len(marker):])).Decode(&player); err != nil {
+		return videoPage{}, err
+	}
+	return videoPage{
+		Title:       strings.TrimSpace(player.VideoDetails.Title),
+		Description: strings.TrimSpace(player.VideoDetails.ShortDescription),
+		Tracks:      player.Captions.Renderer.Tracks,
+	}, nil
+}
+
+// pickCaptionTrack returns the track to use for the first matching language.
+func pickCaptionTrack(tracks []captionTrack, languages []string) (captionTrack, bool) {
+	if len(tracks) == 0 {
+		return captionTrack{}, false
+	}
+	for _, lang := range languages {
+		var auto *captionTrack
+		for i, t := range tracks {
+			if !strings.EqualFold(t.LanguageCode, lang) && !strings.HasPrefix(strings.ToLower(t.LanguageCode), strings.ToLower(lang)+"-") {
+				continue
+			}
+			if t.Kind != "asr" {
+				return t, true
+			}
+			if auto == nil {
+				auto = &tracks[i]
+			}
+		}
+		if auto != nil {
+			return *auto, true
+		}
+	}
+	return tracks[0], true
+}
+
+func captionLanguages() []string {
+	var langs []string
+	for _, l := range strings.Split(config.Get("YOUTUBE_CAPTION_LANGUAGES", "en"), ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			langs = append(langs, l)
+		}
+	}
+	return langs
+}
+
+// parseTimedText reads a timedtext caption document.
+func parseTimedText(body string) ([]transcriptCue, error) {
+	var doc struct {
+		Texts []struct {
+			Start string `xml:"start,attr"`
+			Text  string `xml:",chardata"`
+		} `xml:"text"`
+	}
+	if err := xml.Unmarshal([]byte(body), &doc); err != nil {
+		return nil, err
+	}
+	var cues []transcriptCue
+	for _, t := range doc.Texts {
+		// Caption text is escaped once more inside the XML.
+		text := strings.Join(strings.Fields(html.UnescapeString(t.Text)), " ")
+		if text == "" {
+			continue
+		}
+		start, _ := strconv.ParseFloat(t.Start, 64)
+		cues = append(cues, transcriptCue{Start: start, Text: text})
+	}
+	return cues, nil
+}
+
+// transcriptChunks groups cues into chunks of about words words, each starting at
+// its first cue.
+func transcriptChunks(cues []transcriptCue, words int) []textChunk {
+	var chunks []textChunk
+	var b strings.Builder
+	var start float64
+	n := 0
+	flush := func() {
+		if n == 0 {
+			return
+		}
+		s := start
+		chunks = append(chunks, textChunk{Text: b.String(), StartSeconds: &s, Kind: chunkKindRaw})
+		b.Reset()
+		n = 0
+	}
+	for _, c := range cues {
+		if n == 0 {
+			start = c.Start
+		} else {
+			b.WriteByte(' ')
+		}
+		b.WriteString(c.Text)
+		if n += len(strings.Fields(c.Text)); n >= words {
+			flush()
+		}
+	}
+	flush()
+	return chunks
+}
+
+// chunksContent is the document text made of chunks: one paragraph each, so a
+// transcript's chunks can be found again when it is re-embedded.
+func chunksContent(chunks []textChunk) string {
+	texts := make([]string, len(chunks))
+	for i, ch := range chunks {
+		texts[i] = ch.Text
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// fetchCaptions downloads the chosen caption track of a video.
+func (e *engine) fetchCaptions(ctx context.Context, page videoPage, headers map[string]string) ([]transcriptCue, error) {
+	track, ok := pickCaptionTrack(page.Tracks, captionLanguages())
+	if !ok {
+		return nil, errNoCaptions
+	}
+	body, err := e.fetchRaw(ctx, track.BaseURL, headers)
+	if err != nil {
+		return nil, err
+	}
+	cues, err := parseTimedText(body)
+	if err == nil && len(cues) == 0 {
+		err = errNoCaptions
+	}
+	return cues, err
+}
+
+// storedTimestamps maps the snippets of a document's timed chunks to their offsets.
+func (e *engine) storedTimestamps(ctx context.Context, id int64) (map[string]float64, error) {
+	rows, err := e.db.QueryContext(ctx, "SELECT snippet, start_seconds FROM embeddings WHERE document_id="+e.placeholder(1)+" AND start_seconds IS NOT NULL", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stamps := map[string]float64{}
+	for rows.Next() {
+		var snippet string
+		var start sql.NullFloat64
+		if err := rows.Scan(&snippet, &start); err != nil {
+			return nil, err
+		}
+		stamps[snippet] = start.Float64
+	}
+	return stamps, rows.Err()
+}
+
+// retimeTranscript splits stored transcript content back into its chunks and
+// gives each the offset its previous copy had.
+func retimeTranscript(content string, stamps map[string]float64) []textChunk {
+	var chunks []textChunk
+	for _, p := range strings.Split(content, "\n\n") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		ch := textChunk{Text: p, Kind: chunkKindRaw}
+		if s, ok := stamps[chunkSnippet(p)]; ok {
+			ch.StartSeconds = &s
+		}
+		chunks = append(chunks, ch)
+	}
+	return chunks
+}
+
+func transcriptFallbacks() []string {
+	var out []string
+	for _, f := range strings.Split(config.Get("YOUTUBE_TRANSCRIPT_FALLBACK", transcriptDescription), ",") {
+		switch f = strings.ToLower(strings.TrimSpace(f)); f {
+		case "", transcriptNone:
+		case transcriptService, transcriptDescription:
+			out = append(out, f)
+		default:
+			log.Printf("YOUTUBE_TRANSCRIPT_FALLBACK: unknown fallback %q ignored", f)
+		}
+	}
+	return out
+}
+
+// transcribe asks the YOUTUBE_TRANSCRIPTION_URL service for a video's transcript.
+func (e *engine) transcribe(ctx context.Context, videoURL string) ([]transcriptCue, error) {
+	endpoint := config.Get("YOUTUBE_TRANSCRIPTION_URL", "")
+	if endpoint == "" {
+		return nil, errors.New("YOUTUBE_TRANSCRIPTION_URL not set")
+	}
+	payload, err := json.Marshal(map[string]string{"url": videoURL})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{
+		Transport: e.httpClient.Transport,
+		Timeout:   time.Duration(config.GetInt("YOUTUBE_TRANSCRIPTION_TIMEOUT_SECONDS", 300)) * time.Second,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("transcription service: status %d", resp.StatusCode)
+	}
+	var out struct {
+		Segments []struct {
+			Start float64 `json:"start"`
+			Text  string  `json:"text"`
+		} `json:"segments"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("transcription service: %w", err)
+	}
+	var cues []transcriptCue
+	for _, seg := range out.Segments {
+		if text := strings.Join(strings.Fields(seg.Text), " "); text != "" {
+			cues = append(cues, transcriptCue{Start: seg.Start, Text: text})
+		}
+	}
+	if len(cues) == 0 {
+		return nil, errors.New("transcription service: empty transcript")
+	}
+	return cues, nil
+}
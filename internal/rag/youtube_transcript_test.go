@@ -0,0 +1,95 @@
+package rag
+
+import "testing"
+
+func TestParseVideoPage(t *testing.T) {
+	body := `<script>var ytInitialPlayerResponse = {"videoDetails":{"title":" Kiali graph tour ","shortDescription":"Walks through the graph."},` +
+		`"captions":{"playerCaptionsTracklistRenderer":{"captionTracks":[{"baseUrl":"https://www.youtube.com/api/timedtext?v=x&lang=en","languageCode":"en","kind":"asr"}]}}};var meta = {};</script>`
+	page, err := parseVideoPage(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Title != "Kiali graph tour" || page.Description != "Walks through the graph." {
+		t.Errorf("page = %+v", page)
+	}
+	if len(page.Tracks) != 1 || page.Tracks[0].Kind != "asr" {
+		t.Errorf("tracks = %+v", page.Tracks)
+	}
+	if _, err := parseVideoPage("<html>no player</html>"); err == nil {
+		t.Error("page without player response parsed")
+	}
+}
+
+func TestPickCaptionTrack(t *testing.T) {
+	tracks := []captionTrack{
+		{BaseURL: "de", LanguageCode: "de"},
+		{BaseURL: "en-auto", LanguageCode: "en", Kind: "asr"},
+		{BaseURL: "en-gb", LanguageCode: "en-GB"},
+	}
+	tests := []struct {
+		languages []string
+		want      string
+	}{
+		{[]string{"en"}, "en-gb"},
+		{[]string{"es", "de"}, "de"},
+		{[]string{"fr"}, "de"},
+		{nil, "de"},
+	}
+	for _, tt := range tests {
+		if got, _ := pickCaptionTrack(tracks, tt.languages); got.BaseURL != tt.want {
+			t.Errorf("pickCaptionTrack(%v) = %s, want %s", tt.languages, got.BaseURL, tt.want)
+		}
+	}
+	if got, _ := pickCaptionTrack(tracks[1:2], []string{"en"}); got.BaseURL != "en-auto" {
+		t.Errorf("automatic track not used when alone: %s", got.BaseURL)
+	}
+	if _, ok := pickCaptionTrack(nil, []string{"en"}); ok {
+		t.Error("track picked from none")
+	}
+}
+
+func TestTranscriptChunks(t *testing.T) {
+	cues, err := parseTimedText(`<?xml version="1.0" encoding="utf-8" ?><transcript>` +
+		`<text start="0.5" dur="2">Welcome to the  Kiali</text>` +
+		`<text start="2.5" dur="2">graph &amp;#39;tour&amp;#39;</text>` +
+		`<text start="4" dur="1"> </text>` +
+		`<text start="61.25" dur="3">Open the Istio config</text></transcript>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []transcriptCue{{0.5, "Welcome to the Kiali"}, {2.5, "graph 'tour'"}, {61.25, "Open the Istio config"}}
+	if len(cues) != len(want) {
+		t.Fatalf("cues = %+v", cues)
+	}
+	for i := range want {
+		if cues[i] != want[i] {
+			t.Errorf("cue %d = %+v, want %+v", i, cues[i], want[i])
+		}
+	}
+
+	chunks := transcriptChunks(cues, 5)
+	if len(chunks) != 2 {
+		t.Fatalf("chunks = %+v", chunks)
+	}
+	if chunks[0].Text != "Welcome to the Kiali graph 'tour'" || *chunks[0].StartSeconds != 0.5 {
+		t.Errorf("chunk 0 = %q at %v", chunks[0].Text, *chunks[0].StartSeconds)
+	}
+	if chunks[1].Text != "Open the Istio config" || *chunks[1].StartSeconds != 61.25 {
+		t.Errorf("chunk 1 = %q at %v", chunks[1].Text, *chunks[1].StartSeconds)
+	}
+
+	// Re-embedding re-cuts the stored content and finds the offsets again.
+	stamps := map[string]float64{}
+	for _, ch := range chunks {
+		stamps[chunkSnippet(ch.Text)] = *ch.StartSeconds
+	}
+	again := retimeTranscript(chunksContent(chunks), stamps)
+	if len(again) != len(chunks) {
+		t.Fatalf("retimed = %+v", again)
+	}
+	for i := range chunks {
+		if again[i].Text != chunks[i].Text || again[i].StartSeconds == nil || *again[i].StartSeconds != *chunks[i].StartSeconds {
+			t.Errorf("retimed chunk %d = %+v, want %+v", i, again[i], chunks[i])
+		}
+	}
+}
@@ -1,27 +1,83 @@
 package server
 
 import (
+	"context"
 	"encoding/base64"
+	"fmt"
+	"log"
 	"net/http"
-	"os"
+	"slices"
 	"strings"
+	"sync/atomic"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/rag"
+)
+
+type ctxKey int
+
+const (
+	// namespaceKey holds the namespace an authenticated API key is bound to.
+	namespaceKey ctxKey = iota
+	// clientKey holds the name of the authenticated client; see requestClient.
+	clientKey
 )
 
-func AuthMiddleware() func(http.Handler) http.Handler {
+// namespaceKeys maps the keys of API_KEY_NAMESPACES to their namespace and client
+// name, as last read by ReloadAPIKeys.
+type namespaceKeys struct {
+	namespaces map[string]string
+	names      map[string]string
+}
+
+var apiKeys atomic.Pointer[namespaceKeys]
+
+// ReloadAPIKeys reads API_KEY_NAMESPACES again, e.g. after config.ReloadSecrets
+// picked up a rotated API_KEY_NAMESPACES_FILE.
+func ReloadAPIKeys() {
+	apiKeys.Store(&namespaceKeys{namespaces: apiKeyNamespaces(), names: configuredKeyNames()})
+}
+
+// AuthMiddleware requires an API key or Basic credentials on every path except the
+// probe endpoints in publicPaths.
+func AuthMiddleware(publicPaths ...string) func(http.Handler) http.Handler {
+	ReloadAPIKeys()
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.URL.Path == "/healthz" {
+			if slices.Contains(publicPaths, r.URL.Path) {
 				next.ServeHTTP(w, r)
 				return
 			}
 
 			// API key header
 			apiKey := r.Header.Get("X-API-Key")
-			expected := os.Getenv("API_KEY")
+			keys := apiKeys.Load()
+			if ns, ok := keys.namespaces[apiKey]; ok && apiKey != "" {
+				ctx := context.WithValue(r.Context(), namespaceKey, ns)
+				next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, clientKey, keys.names[apiKey])))
+				return
+			}
+			expected := config.Get("API_KEY", "")
 			if expected != "" && apiKey == expected {
-				next.ServeHTTP(w, r)
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientKey, "API_KEY")))
 				return
 			}
+			// Keys added at runtime are looked up on every request, so a revoked
+			// key stops working immediately.
+			if apiKey != "" {
+				k, ok, err := rag.DefaultEngine().LookupAPIKey(r.Context(), apiKey)
+				if err != nil {
+					log.Printf("api key lookup failed: %v", err)
+				}
+				if ok {
+					ctx := context.WithValue(r.Context(), clientKey, k.Name)
+					if k.Namespace != "" {
+						ctx = context.WithValue(ctx, namespaceKey, k.Namespace)
+					}
+					next.ServeHTTP(w, r.WithContext(ctx))
+					return
+				}
+			}
 
 			// Basic auth header
 			auth := r.Header.Get("Authorization")
@@ -29,10 +85,10 @@ func AuthMiddleware() func(http.Handler) http.Handler {
 				payload, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(auth, "Basic "))
 				parts := strings.SplitN(string(payload), ":", 2)
 				if len(parts) == 2 {
-					userEnv := os.Getenv("BASIC_AUTH_USER")
-					passEnv := os.Getenv("BASIC_AUTH_PASS")
+					userEnv := config.Get("BASIC_AUTH_USER", "")
+					passEnv := config.Get("BASIC_AUTH_PASS", "")
 					if parts[0] == userEnv && parts[1] == passEnv && userEnv != "" {
-						next.ServeHTTP(w, r)
+						next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientKey, "basic:"+userEnv)))
 						return
 					}
 				}
@@ -42,4 +98,97 @@ func AuthMiddleware() func(http.Handler) http.Handler {
 			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 		})
 	}
-} 
\ No newline at end of file
+}
+
+// apiKeyNamespaces parses API_KEY_NAMESPACES, comma-separated key=namespace pairs.
+// Each key authenticates on its own and confines its requests to that namespace.
+func apiKeyNamespaces() map[string]string {
+	out := map[string]string{}
+	for _, pair := range strings.Split(config.Get("API_KEY_NAMESPACES", ""), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		// Split on the last '=' since base64 keys may end in padding.
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 {
+			log.Printf("API_KEY_NAMESPACES: ignoring entry without key=namespace")
+			continue
+		}
+		ns, err := rag.NormalizeNamespace(pair[i+1:])
+		if err != nil {
+			log.Printf("API_KEY_NAMESPACES: %v", err)
+			continue
+		}
+		out[strings.TrimSpace(pair[:i])] = ns
+	}
+	return out
+}
+
+// requestClient names the client a request authenticated as, for usage
+// accounting: "API_KEY", "API_KEY_NAMESPACES[n]" as listed by configuredKeys, the
+// name of a stored key, or "basic:" and the Basic auth user. Unauthenticated
+// requests to public paths have none.
+func requestClient(ctx context.Context) string {
+	name, _ := ctx.Value(clientKey).(string)
+	return name
+}
+
+// configuredKey names an API key defined in configuration, which the admin API
+// lists but cannot revoke.
+type configuredKey struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// configuredKeys lists API_KEY and the API_KEY_NAMESPACES entries by position,
+// never by secret.
+func configuredKeys() []configuredKey {
+	out := []configuredKey{}
+	if config.Get("API_KEY", "") != "" {
+		out = append(out, configuredKey{Name: "API_KEY"})
+	}
+	i := 0
+	for _, pair := range strings.Split(config.Get("API_KEY_NAMESPACES", ""), ",") {
+		j := strings.LastIndex(pair, "=")
+		if j <= 0 {
+			continue
+		}
+		ns, err := rag.NormalizeNamespace(pair[j+1:])
+		if err != nil {
+			continue
+		}
+		i++
+		out = append(out, configuredKey{Name: fmt.Sprintf("API_KEY_NAMESPACES[%d]", i), Namespace: ns})
+	}
+	return out
+}
+
+// configuredKeyNames maps each API_KEY_NAMESPACES secret to its configuredKeys name.
+func configuredKeyNames() map[string]string {
+	out := map[string]string{}
+	i := 0
+	for _, pair := range strings.Split(config.Get("API_KEY_NAMESPACES", ""), ",") {
+		j := strings.LastIndex(pair, "=")
+		if j <= 0 {
+			continue
+		}
+		if _, err := rag.NormalizeNamespace(pair[j+1:]); err != nil {
+			continue
+		}
+		i++
+		out[strings.TrimSpace(pair[:j])] = fmt.Sprintf("API_KEY_NAMESPACES[%d]", i)
+	}
+	return out
+}
+
+// requireUnpinned rejects key management and operations on the whole store by API
+// keys confined to a namespace, which could otherwise mint themselves a wider key
+// or act on other namespaces.
+func requireUnpinned(w http.ResponseWriter, r *http.Request) bool {
+	if _, pinned := r.Context().Value(namespaceKey).(string); pinned {
+		writeJSONError(w, http.StatusForbidden, "api keys bound to a namespace cannot manage keys or the whole store")
+		return false
+	}
+	return true
+}
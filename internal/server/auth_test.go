@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	basic := func(user, pass string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+	}
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		headers map[string]string
+		status  int
+	}{
+		{"no credentials", http.MethodGet, "/v1/models", "", map[string]string{"Authorization": ""}, http.StatusUnauthorized},
+		{"unknown key", http.MethodGet, "/v1/models", "", map[string]string{"Authorization": "", "X-API-Key": "nope"}, http.StatusUnauthorized},
+		{"api key", http.MethodGet, "/v1/models", "", nil, http.StatusOK},
+		{"basic auth", http.MethodGet, "/v1/models", "", map[string]string{"Authorization": basic("admin", "secret")}, http.StatusOK},
+		{"wrong basic password", http.MethodGet, "/v1/models", "", map[string]string{"Authorization": basic("admin", "guess")}, http.StatusUnauthorized},
+		{"healthz is public", http.MethodGet, "/healthz", "", map[string]string{"Authorization": ""}, http.StatusOK},
+		{"readyz is public", http.MethodGet, "/readyz", "", map[string]string{"Authorization": ""}, http.StatusOK},
+		{"tenant key in its namespace", http.MethodPost, "/v1/chat", `{"query":"graph","namespace":"tenant"}`, map[string]string{"X-API-Key": testTenantKey}, http.StatusOK},
+		{"tenant key defaults to its namespace", http.MethodPost, "/v1/chat", `{"query":"graph"}`, map[string]string{"X-API-Key": testTenantKey}, http.StatusOK},
+		{"tenant key in another namespace", http.MethodPost, "/v1/chat", `{"query":"graph","namespace":"chat"}`, map[string]string{"X-API-Key": testTenantKey}, http.StatusForbidden},
+		{"health needs credentials", http.MethodGet, "/v1/admin/health", "", map[string]string{"Authorization": ""}, http.StatusUnauthorized},
+		{"tenant key health of another namespace", http.MethodGet, "/v1/admin/health?namespace=chat", "", map[string]string{"X-API-Key": testTenantKey}, http.StatusForbidden},
+		{"tenant key cannot vacuum", http.MethodPost, "/v1/admin/vacuum", "", map[string]string{"X-API-Key": testTenantKey}, http.StatusForbidden},
+		{"tenant key cannot clean orphans", http.MethodPost, "/v1/admin/orphans", "", map[string]string{"X-API-Key": testTenantKey}, http.StatusForbidden},
+		{"tenant key cannot validate models", http.MethodPost, "/v1/admin/models/validate", "", map[string]string{"X-API-Key": testTenantKey}, http.StatusForbidden},
+		{"tenant key cannot debug embeddings", http.MethodPost, "/v1/debug/embed", `{"text":"graph"}`, map[string]string{"X-API-Key": testTenantKey}, http.StatusForbidden},
+		{"tenant key cannot read auto-ingest status", http.MethodGet, "/v1/admin/ingest/status", "", map[string]string{"X-API-Key": testTenantKey}, http.StatusForbidden},
+		{"tenant key cannot read metrics", http.MethodGet, "/metrics", "", map[string]string{"X-API-Key": testTenantKey}, http.StatusForbidden},
+		{"metrics", http.MethodGet, "/metrics", "", nil, http.StatusOK},
+		{"tenant key cannot manage keys", http.MethodPost, "/v1/admin/keys", `{"name":"wider"}`, map[string]string{"X-API-Key": testTenantKey}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(t, tt.method, tt.path, tt.body, tt.headers); w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestStoredAPIKeys(t *testing.T) {
+	w := serve(t, http.MethodPost, "/v1/admin/keys", `{"name":"ci","namespace":"tenant"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("add key: status %d: %s", w.Code, w.Body.String())
+	}
+	res := decode(t, w)
+	secret, _ := res["key"].(string)
+	if secret == "" {
+		t.Fatalf("no key in %v", res)
+	}
+	if res["namespace"] != "tenant" {
+		t.Errorf("namespace = %v, want tenant", res["namespace"])
+	}
+
+	stored := map[string]string{"X-API-Key": secret}
+	if w := serve(t, http.MethodPost, "/v1/chat", `{"query":"graph","namespace":"chat"}`, stored); w.Code != http.StatusForbidden {
+		t.Errorf("stored tenant key in another namespace: status %d, want 403", w.Code)
+	}
+	if w := serve(t, http.MethodGet, "/v1/models", "", stored); w.Code != http.StatusOK {
+		t.Errorf("stored key: status %d, want 200", w.Code)
+	}
+	if w := serve(t, http.MethodDelete, "/v1/admin/keys/ci", "", nil); w.Code >= 300 {
+		t.Fatalf("revoke: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := serve(t, http.MethodGet, "/v1/models", "", stored); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked key: status %d, want 401", w.Code)
+	}
+}
+
+func TestReloadAPIKeys(t *testing.T) {
+	const rotated = "rotated-key"
+	// Cleanups run last first, so the keys are reloaded after the variable is restored.
+	t.Cleanup(ReloadAPIKeys)
+	t.Setenv("API_KEY_NAMESPACES", rotated+"=tenant")
+	ReloadAPIKeys()
+	if w := serve(t, http.MethodGet, "/v1/models", "", map[string]string{"X-API-Key": rotated}); w.Code != http.StatusOK {
+		t.Errorf("rotated key: status %d, want 200", w.Code)
+	}
+	if w := serve(t, http.MethodGet, "/v1/models", "", map[string]string{"X-API-Key": testTenantKey}); w.Code != http.StatusUnauthorized {
+		t.Errorf("replaced key: status %d, want 401", w.Code)
+	}
+}
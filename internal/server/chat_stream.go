@@ -0,0 +1,280 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/rag"
+)
+
+// chatDeltaBytes is the size of the answer pieces sent as "delta" events.
+const chatDeltaBytes = 256
+
+// chatStreamHeartbeat is how often a comment line keeps idle proxies from closing
+// the connection while the answer is generated.
+const chatStreamHeartbeat = 15 * time.Second
+
+type streamEvent struct {
+	name string
+	data []byte
+}
+
+// chatStream buffers the events of one answer. Generation runs detached from the
+// client, so a client that drops can reconnect and resume from the last event it
+// saw instead of paying for a new completion.
+type chatStream struct {
+	id        string
+	namespace string
+
+	mu      sync.Mutex
+	events  []streamEvent
+	done    bool
+	expires time.Time
+	// changed is closed and replaced whenever an event is added.
+	changed chan struct{}
+}
+
+func (s *chatStream) add(name string, v any) {
+	b, _ := json.Marshal(v)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, streamEvent{name: name, data: b})
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *chatStream) finish(retention time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done, s.expires = true, time.Now().Add(retention)
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// since returns the events from index next on, whether the stream is complete,
+// and a channel closed on the next change.
+func (s *chatStream) since(next int) ([]streamEvent, bool, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []streamEvent
+	if next < len(s.events) {
+		out = append(out, s.events[next:]...)
+	}
+	return out, s.done, s.changed
+}
+
+// chatStreamStore keeps streams for CHAT_STREAM_RETENTION_SECONDS (default 120)
+// after they complete, and holds at most CHAT_STREAM_MAX (default 100) streams,
+// running or retained, so detached generations cannot pile up.
+type chatStreamStore struct {
+	mu      sync.Mutex
+	streams map[string]*chatStream
+}
+
+var chatStreams = &chatStreamStore{streams: map[string]*chatStream{}}
+
+// start registers a new stream, or returns nil when the store is full.
+func (c *chatStreamStore) start(namespace string) *chatStream {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	s := &chatStream{id: hex.EncodeToString(buf), namespace: namespace, changed: make(chan struct{})}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.streams) >= config.GetInt("CHAT_STREAM_MAX", 100) {
+		return nil
+	}
+	c.streams[s.id] = s
+	return s
+}
+
+// finish completes s and drops it from the store once its retention is over.
+func (c *chatStreamStore) finish(s *chatStream) {
+	retention := chatStreamRetention()
+	s.finish(retention)
+	time.AfterFunc(retention, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.streams, s.id)
+	})
+}
+
+func (c *chatStreamStore) get(id string) *chatStream {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.streams[id]
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	expired := s.done && time.Now().After(s.expires)
+	s.mu.Unlock()
+	if expired {
+		delete(c.streams, id)
+		return nil
+	}
+	return s
+}
+
+func chatStreamRetention() time.Duration {
+	return time.Duration(config.GetInt("CHAT_STREAM_RETENTION_SECONDS", 120)) * time.Second
+}
+
+// parseEventID splits an event id of the form "<stream id>:<index>".
+func parseEventID(v string) (string, int, bool) {
+	id, idx, ok := strings.Cut(strings.TrimSpace(v), ":")
+	n, err := strconv.Atoi(idx)
+	if !ok || id == "" || err != nil || n < 0 {
+		return "", 0, false
+	}
+	return id, n, true
+}
+
+// ChatStreamHandler serves GET /v1/chat as server-sent events: "start" with the
+// request id, the answer in "delta" pieces, then "done" with the full response or
+// "error". Every event carries an id; reconnecting with Last-Event-ID (or
+// ?last_event_id=) replays what followed it from the buffer.
+func ChatStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := w.(http.Flusher); !ok {
+		writeJSONError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	q := r.URL.Query()
+	last := r.Header.Get("Last-Event-ID")
+	if last == "" {
+		last = q.Get("last_event_id")
+	}
+	if last != "" {
+		id, idx, ok := parseEventID(last)
+		if !ok {
+			writeJSONError(w, http.StatusBadRequest, "invalid Last-Event-ID")
+			return
+		}
+		s := chatStreams.get(id)
+		if s == nil {
+			writeJSONError(w, http.StatusNotFound, "chat stream unknown or expired")
+			return
+		}
+		if _, err := resolveNamespace(r.Context(), s.namespace); err != nil {
+			writeJSONError(w, http.StatusForbidden, errNamespaceForbidden.Error())
+			return
+		}
+		serveChatStream(w, r, s, idx+1)
+		return
+	}
+
+	query := q.Get("query")
+	if strings.TrimSpace(query) == "" {
+		writeJSONError(w, http.StatusBadRequest, "query required")
+		return
+	}
+	format := q.Get("format")
+	if err := rag.CheckFormat(format); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ns, ok := requestNamespace(w, r, q.Get("namespace"))
+	if !ok {
+		return
+	}
+	if !withinQuota(w, r) {
+		return
+	}
+	opts := rag.AnswerOptions{
+		Namespace:       ns,
+		CompletionModel: r.Header.Get("X-Completion-Model"),
+		EmbeddingModel:  r.Header.Get("X-Embedding-Model"),
+		GroupCitations:  q.Get("group_citations") == "true",
+		Language:        q.Get("language"),
+	}
+	s := chatStreams.start(ns)
+	if s == nil {
+		w.Header().Set("Retry-After", strconv.Itoa(int(chatStreamHeartbeat.Seconds())))
+		writeJSONError(w, http.StatusServiceUnavailable, "too many chat streams")
+		return
+	}
+	s.add("start", map[string]any{"request_id": s.id})
+	go generateChatStream(r, s, query, format, opts)
+	serveChatStream(w, r, s, 0)
+}
+
+// generateChatStream answers the query into s, rendered in format. It runs under
+// the server timeout but not the client's connection, which may come and go.
+func generateChatStream(r *http.Request, s *chatStream, query, format string, opts rag.AnswerOptions) {
+	defer chatStreams.finish(s)
+	ctx, cancel := getContextWithTimeout(context.Background())
+	defer cancel()
+	res, err := rag.DefaultEngine().Answer(ctx, query, nil, opts)
+	if err != nil {
+		status, msg := chatError(r, err)
+		s.add("error", map[string]any{"error": msg, "status_code": status})
+		return
+	}
+	rag.DefaultEngine().RecordUsage(requestClient(r.Context()), opts.Namespace, res.Usage)
+	res.Answer, _ = rag.FormatAnswer(res.Answer, format)
+	for _, piece := range splitUTF8(res.Answer, chatDeltaBytes) {
+		s.add("delta", map[string]string{"text": piece})
+	}
+	s.add("done", chatResponse{Answer: res.Answer, Structured: res.Structured, Confidence: res.Confidence, Citations: res.Citations, UsedModels: res.Models, Sources: res.Sources})
+}
+
+// serveChatStream writes the events of s from index next on until the stream is
+// complete or the client goes away.
+func serveChatStream(w http.ResponseWriter, r *http.Request, s *chatStream, next int) {
+	flusher := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	heartbeat := time.NewTicker(chatStreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		events, done, changed := s.since(next)
+		for _, ev := range events {
+			_, _ = fmt.Fprintf(w, "id: %s:%d\nevent: %s\ndata: %s\n\n", s.id, next, ev.name, ev.data)
+			next++
+		}
+		flusher.Flush()
+		if done {
+			return
+		}
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			_, _ = fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			log.Printf("%s %s client left chat stream %s at event %d", r.Method, r.URL.Path, s.id, next)
+			return
+		}
+	}
+}
+
+// splitUTF8 cuts s into pieces of at most n bytes without splitting a character.
+func splitUTF8(s string, n int) []string {
+	var out []string
+	for len(s) > n {
+		cut := n
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		if cut == 0 {
+			cut = n
+		}
+		out = append(out, s[:cut])
+		s = s[cut:]
+	}
+	if s != "" {
+		out = append(out, s)
+	}
+	return out
+}
@@ -0,0 +1,23 @@
+package server
+
+import "testing"
+
+func TestChatStreamStoreLimit(t *testing.T) {
+	t.Setenv("CHAT_STREAM_MAX", "2")
+	t.Setenv("CHAT_STREAM_RETENTION_SECONDS", "0")
+	c := &chatStreamStore{streams: map[string]*chatStream{}}
+	a, b := c.start("default"), c.start("default")
+	if a == nil || b == nil {
+		t.Fatal("streams under the limit rejected")
+	}
+	if c.start("default") != nil {
+		t.Fatal("stream over the limit accepted")
+	}
+	c.finish(a)
+	if got := c.get(a.id); got != nil {
+		t.Error("expired stream still served")
+	}
+	if c.start("default") == nil {
+		t.Error("slot of an expired stream not freed")
+	}
+}
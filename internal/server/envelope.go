@@ -0,0 +1,119 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/rag"
+)
+
+// Chat response envelope versions. v1 is the original shape and never changes;
+// v2 may gain fields.
+const (
+	responseV1 = 1
+	responseV2 = 2
+
+	mediaTypeV1 = "application/vnd.kiali-mcp.v1+json"
+	mediaTypeV2 = "application/vnd.kiali-mcp.v2+json"
+)
+
+// responseVersion picks the chat envelope from the request body's version field or,
+// failing that, a vendor media type in Accept. Everything else gets v1.
+func responseVersion(r *http.Request, requested int) (int, error) {
+	switch requested {
+	case 0:
+	case responseV1, responseV2:
+		return requested, nil
+	default:
+		return 0, fmt.Errorf("unsupported response version %d", requested)
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mt {
+		case mediaTypeV2:
+			return responseV2, nil
+		case mediaTypeV1:
+			return responseV1, nil
+		}
+	}
+	return responseV1, nil
+}
+
+type chatResponseV2 struct {
+	Version    int                 `json:"version"`
+	Answer     string              `json:"answer"`
+	Structured any                 `json:"structured,omitempty"`
+	Confidence float64             `json:"confidence"`
+	Citations  []citationV2        `json:"citations"`
+	Models     modelsV2            `json:"models"`
+	Context    []rag.ContextChunk  `json:"context,omitempty"`
+	Sources    []rag.CitationGroup `json:"sources,omitempty"`
+	Curated    bool                `json:"curated"`
+	FAQID      int64               `json:"faq_id,omitempty"`
+	Seed       *int64              `json:"seed,omitempty"`
+	Redacted   bool                `json:"redacted,omitempty"`
+	Degraded   bool                `json:"degraded,omitempty"`
+	Grounding  *rag.Grounding      `json:"grounding,omitempty"`
+}
+
+type citationV2 struct {
+	Marker       int     `json:"marker"`
+	Title        string  `json:"title"`
+	URL          string  `json:"url"`
+	Span         string  `json:"span"`
+	Score        float64 `json:"score"`
+	Cited        bool    `json:"cited"`
+	PageTitle    string  `json:"page_title,omitempty"`
+	SectionTitle string  `json:"section_title,omitempty"`
+	Anchor       string  `json:"anchor,omitempty"`
+}
+
+type modelsV2 struct {
+	Completion modelRef `json:"completion"`
+	Embedding  modelRef `json:"embedding"`
+}
+
+type modelRef struct {
+	Provider   string `json:"provider,omitempty"`
+	Model      string `json:"model"`
+	RoutedFrom string `json:"routed_from,omitempty"`
+}
+
+func writeChatResponse(w http.ResponseWriter, version int, res rag.AnswerResult) {
+	if version != responseV2 {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(chatResponse{Answer: res.Answer, Structured: res.Structured, Confidence: res.Confidence, Citations: res.Citations, UsedModels: res.Models, Context: res.Context, Sources: res.Sources})
+		return
+	}
+	out := chatResponseV2{
+		Version:    responseV2,
+		Answer:     res.Answer,
+		Structured: res.Structured,
+		Confidence: res.Confidence,
+		Citations:  make([]citationV2, 0, len(res.Citations)),
+		Context:    res.Context,
+		Sources:    res.Sources,
+		Curated:    res.CuratedID != 0,
+		FAQID:      res.CuratedID,
+		Seed:       res.Seed,
+		Redacted:   res.Redacted,
+		Degraded:   res.Degraded,
+		Grounding:  res.Grounding,
+		Models: modelsV2{
+			Completion: modelRef{Provider: res.Models.CompletionProvider, Model: res.Models.CompletionModel, RoutedFrom: res.Models.RoutedFrom},
+			Embedding:  modelRef{Provider: res.Models.EmbeddingProvider, Model: res.Models.EmbeddingModel},
+		},
+	}
+	for i, c := range res.Citations {
+		out.Citations = append(out.Citations, citationV2{Marker: i + 1, Title: c.Title, URL: c.URL, Span: c.Span, Score: c.Score, Cited: c.Cited,
+			PageTitle: c.PageTitle, SectionTitle: c.SectionTitle, Anchor: c.Anchor})
+	}
+	w.Header().Set("Content-Type", mediaTypeV2)
+	_ = json.NewEncoder(w).Encode(out)
+}
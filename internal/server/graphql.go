@@ -0,0 +1,655 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/rag"
+)
+
+// graphqlSchema mirrors the REST chat, search and admin routes. Arguments and
+// limits follow their REST counterparts; byte counts are Float since GraphQL Int
+// is 32-bit.
+const graphqlSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+type Query {
+	chat(query: String!, namespace: String, includeContext: Boolean, completionModel: String, embeddingModel: String, temperature: Float, seed: Int, language: String, candidateChunks: Int, promptChunks: Int, sourceWeights: [SourceWeight!], format: String): Answer!
+	search(query: String!, namespace: String, limit: Int): [Chunk!]!
+	documents(namespace: String, term: String, urlPrefix: String, limit: Int, offset: Int): DocumentPage!
+	stats(namespace: String): Stats!
+}
+
+type Mutation {
+	ingestDocs(seedUrls: [String!], namespace: String): IngestResult!
+	clean(namespace: String): Int!
+	deduplicate(namespace: String): Int!
+}
+
+input SourceWeight {
+	source: String!
+	weight: Float!
+}
+
+type Answer {
+	answer: String!
+	confidence: Float!
+	citations: [Citation!]!
+	sources: [CitationGroup!]!
+	models: Models!
+	context: [Chunk!]
+	curated: Boolean!
+	faqId: ID
+	seed: Int
+	degraded: Boolean!
+	grounding: Grounding
+}
+
+type Grounding {
+	score: Float!
+	unsupported: [String!]!
+	removed: Boolean!
+}
+
+type Citation {
+	marker: Int!
+	title: String!
+	url: String!
+	span: String!
+	score: Float!
+	cited: Boolean!
+	pageTitle: String
+	sectionTitle: String
+	anchor: String
+}
+
+type CitationGroup {
+	title: String!
+	url: String!
+	score: Float!
+	spans: [Span!]!
+}
+
+type Span {
+	span: String!
+	url: String!
+	score: Float!
+}
+
+type Models {
+	completionModel: String!
+	completionProvider: String
+	embeddingModel: String!
+	embeddingProvider: String
+	routedFrom: String
+}
+
+type Chunk {
+	title: String!
+	url: String!
+	text: String!
+	score: Float!
+}
+
+type DocumentPage {
+	total: Int!
+	limit: Int!
+	offset: Int!
+	documents: [Document!]!
+}
+
+type Document {
+	id: ID!
+	title: String!
+	url: String!
+	matches: Int!
+	snippet: String!
+}
+
+type Stats {
+	namespace: String!
+	documents: Int!
+	embeddings: Int!
+	compressedDocuments: Int!
+	contentBytes: Float!
+	rawContentBytes: Float!
+	savedBytes: Float!
+	queueDepth: Int!
+}
+
+type IngestResult {
+	ingested: Int!
+	skipped: Int!
+	partial: Int!
+	merged: Int!
+	summaries: Int!
+	queued: Int!
+	denied: Int!
+	capped: Int!
+	moderated: Int!
+	embeddingsReused: Int!
+	embeddingsComputed: Int!
+	cancelled: Boolean!
+	truncated: Boolean!
+	droppedLinks: Int!
+}
+`
+
+// defaultSearchLimit matches the number of chunks chat retrieves.
+const defaultSearchLimit = 8
+
+// GraphQLHandler serves POST /graphql with the same authentication and namespace
+// rules as the REST routes.
+func GraphQLHandler() http.HandlerFunc {
+	schema := graphql.MustParseSchema(graphqlSchema, &gqlResolver{}, graphql.UseFieldResolvers(), graphql.MaxDepth(6))
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query         string         `json:"query"`
+			OperationName string         `json:"operationName"`
+			Variables     map[string]any `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		resp := schema.Exec(r.Context(), req.Query, req.OperationName, req.Variables)
+		for _, e := range resp.Errors {
+			if e.Extensions == nil {
+				continue
+			}
+			if status, _ := e.Extensions["status"].(int); status >= http.StatusInternalServerError {
+				log.Printf("%s %s error: %v", r.Method, r.URL.Path, e.Message)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// gqlError carries the HTTP status the REST route would have answered with in
+// the "status" extension of a GraphQL error, and the running operation of a
+// conflict in "operation".
+type gqlError struct {
+	err       error
+	status    int
+	operation *rag.CorpusOperation
+}
+
+func (e gqlError) Error() string { return e.err.Error() }
+
+func (e gqlError) Extensions() map[string]any {
+	ext := map[string]any{"status": e.status}
+	if e.operation != nil {
+		ext["operation"] = e.operation
+	}
+	return ext
+}
+
+// toGQLError maps engine errors to statuses as the REST handlers do.
+func toGQLError(ctx context.Context, err error) error {
+	var conflict *rag.OperationConflictError
+	if errors.As(err, &conflict) {
+		op := visibleOperation(ctx, conflict.Running)
+		return gqlError{err: err, status: http.StatusConflict, operation: &op}
+	}
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errNamespaceForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, rag.ErrModelNotAllowed), errors.Is(err, rag.ErrInvalidTemperature), errors.Is(err, rag.ErrUnsupportedLanguage), errors.Is(err, rag.ErrInvalidChunkCount), errors.Is(err, rag.ErrInvalidSourceWeight):
+		status = http.StatusBadRequest
+	case errors.Is(err, rag.ErrProviderUnavailable):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, rag.ErrQuotaExceeded):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, rag.ErrIngestInProgress):
+		status = http.StatusConflict
+	case errors.Is(err, rag.ErrContentBlocked):
+		return gqlError{err: errors.New(err.Error() + "; try rephrasing the question"), status: http.StatusUnprocessableEntity}
+	case errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusGatewayTimeout
+	}
+	return gqlError{err: err, status: status}
+}
+
+func badRequest(msg string) error {
+	return gqlError{err: errors.New(msg), status: http.StatusBadRequest}
+}
+
+// gqlNamespace resolves an optional namespace argument like requestNamespace.
+func gqlNamespace(ctx context.Context, requested *string) (string, error) {
+	ns, err := resolveNamespace(ctx, deref(requested))
+	if err != nil && !errors.Is(err, errNamespaceForbidden) {
+		return "", badRequest(err.Error())
+	}
+	if err != nil {
+		return "", toGQLError(ctx, err)
+	}
+	return ns, nil
+}
+
+func deref[T any](p *T) T {
+	var zero T
+	if p == nil {
+		return zero
+	}
+	return *p
+}
+
+// gqlPage applies the REST pagination defaults and limits to optional arguments.
+func gqlPage(limit, offset *int32) (int, int, error) {
+	l, o := defaultPageLimit, int(deref(offset))
+	if limit != nil {
+		l = int(*limit)
+	}
+	switch {
+	case l < 0 || o < 0:
+		return 0, 0, badRequest("limit and offset must be non-negative")
+	case l > maxPageLimit:
+		return 0, 0, badRequest(fmt.Sprintf("limit must be at most %d", maxPageLimit))
+	}
+	return l, o, nil
+}
+
+type gqlResolver struct{}
+
+type gqlChatArgs struct {
+	Query           string
+	Namespace       *string
+	IncludeContext  *bool
+	CompletionModel *string
+	EmbeddingModel  *string
+	Temperature     *float64
+	Seed            *int32
+	Language        *string
+	CandidateChunks *int32
+	PromptChunks    *int32
+	SourceWeights   *[]gqlSourceWeight
+	Format          *string
+}
+
+type gqlSourceWeight struct {
+	Source string
+	Weight float64
+}
+
+func (gqlResolver) Chat(ctx context.Context, args gqlChatArgs) (*gqlAnswer, error) {
+	includeContext := deref(args.IncludeContext)
+	if includeContext && !config.GetBool("CHAT_INCLUDE_CONTEXT_ENABLED", true) {
+		return nil, badRequest("includeContext is disabled on this server")
+	}
+	if err := rag.CheckFormat(deref(args.Format)); err != nil {
+		return nil, badRequest(err.Error())
+	}
+	ns, err := gqlNamespace(ctx, args.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	if err := rag.DefaultEngine().CheckQuota(ctx, requestClient(ctx)); err != nil {
+		if errors.Is(err, rag.ErrQuotaExceeded) {
+			return nil, toGQLError(ctx, err)
+		}
+		log.Printf("graphql chat quota check failed: %v", err)
+	}
+	var seed *int64
+	if args.Seed != nil {
+		s := int64(*args.Seed)
+		seed = &s
+	}
+	var weights rag.SourceWeights
+	if args.SourceWeights != nil {
+		weights = rag.SourceWeights{}
+		for _, w := range *args.SourceWeights {
+			weights[w.Source] = w.Weight
+		}
+	}
+	ctx, cancel := getContextWithTimeout(ctx)
+	defer cancel()
+	res, err := rag.DefaultEngine().Answer(ctx, args.Query, nil, rag.AnswerOptions{
+		Namespace:       ns,
+		CompletionModel: deref(args.CompletionModel),
+		EmbeddingModel:  deref(args.EmbeddingModel),
+		IncludeContext:  includeContext,
+		GroupCitations:  true,
+		Language:        deref(args.Language),
+		Temperature:     args.Temperature,
+		Seed:            seed,
+		CandidateChunks: int(deref(args.CandidateChunks)),
+		PromptChunks:    int(deref(args.PromptChunks)),
+		SourceWeights:   weights,
+	})
+	if err != nil {
+		return nil, toGQLError(ctx, err)
+	}
+	rag.DefaultEngine().RecordUsage(requestClient(ctx), ns, res.Usage)
+	res.Answer, _ = rag.FormatAnswer(res.Answer, deref(args.Format))
+	a := &gqlAnswer{
+		Answer:     res.Answer,
+		Confidence: res.Confidence,
+		Citations:  make([]gqlCitation, 0, len(res.Citations)),
+		Sources:    make([]gqlCitationGroup, 0, len(res.Sources)),
+		Degraded:   res.Degraded,
+		Models: gqlModels{
+			CompletionModel:    res.Models.CompletionModel,
+			CompletionProvider: optional(res.Models.CompletionProvider),
+			EmbeddingModel:     res.Models.EmbeddingModel,
+			EmbeddingProvider:  optional(res.Models.EmbeddingProvider),
+			RoutedFrom:         optional(res.Models.RoutedFrom),
+		},
+	}
+	if res.CuratedID != 0 {
+		id := graphql.ID(strconv.FormatInt(res.CuratedID, 10))
+		a.Curated, a.FAQID = true, &id
+	}
+	if res.Seed != nil {
+		s := int32(*res.Seed)
+		a.Seed = &s
+	}
+	if g := res.Grounding; g != nil {
+		a.Grounding = &gqlGrounding{Score: g.Score, Unsupported: append([]string{}, g.Unsupported...), Removed: g.Removed}
+	}
+	for i, c := range res.Citations {
+		a.Citations = append(a.Citations, gqlCitation{
+			Marker: int32(i + 1), Title: c.Title, URL: c.URL, Span: c.Span, Score: c.Score, Cited: c.Cited,
+			PageTitle: optional(c.PageTitle), SectionTitle: optional(c.SectionTitle), Anchor: optional(c.Anchor),
+		})
+	}
+	for _, g := range res.Sources {
+		group := gqlCitationGroup{Title: g.Title, URL: g.URL, Score: g.Score}
+		for _, s := range g.Spans {
+			group.Spans = append(group.Spans, gqlSpan{Span: s.Span, URL: s.URL, Score: s.Score})
+		}
+		a.Sources = append(a.Sources, group)
+	}
+	if includeContext {
+		a.Context = toGQLChunks(res.Context)
+	}
+	return a, nil
+}
+
+type gqlSearchArgs struct {
+	Query     string
+	Namespace *string
+	Limit     *int32
+}
+
+func (gqlResolver) Search(ctx context.Context, args gqlSearchArgs) ([]gqlChunk, error) {
+	k := defaultSearchLimit
+	if args.Limit != nil {
+		k = int(*args.Limit)
+	}
+	if k < 1 || k > maxPageLimit {
+		return nil, badRequest(fmt.Sprintf("limit must be between 1 and %d", maxPageLimit))
+	}
+	ns, err := gqlNamespace(ctx, args.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := getContextWithTimeout(ctx)
+	defer cancel()
+	chunks, err := rag.DefaultEngine().Search(ctx, args.Query, ns, k)
+	if err != nil {
+		return nil, toGQLError(ctx, err)
+	}
+	return *toGQLChunks(chunks), nil
+}
+
+type gqlDocumentsArgs struct {
+	Namespace *string
+	Term      *string
+	URLPrefix *string
+	Limit     *int32
+	Offset    *int32
+}
+
+func (gqlResolver) Documents(ctx context.Context, args gqlDocumentsArgs) (*gqlDocumentPage, error) {
+	limit, offset, err := gqlPage(args.Limit, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+	ns, err := gqlNamespace(ctx, args.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := getContextWithTimeout(ctx)
+	defer cancel()
+	res, err := rag.DefaultEngine().DocumentSearch(ctx, ns, rag.DocumentQuery{
+		Term:      strings.TrimSpace(deref(args.Term)),
+		URLPrefix: strings.TrimSpace(deref(args.URLPrefix)),
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		return nil, toGQLError(ctx, err)
+	}
+	page := &gqlDocumentPage{Total: int32(res.Total), Limit: int32(res.Limit), Offset: int32(res.Offset), Documents: []gqlDocument{}}
+	for _, d := range res.Documents {
+		page.Documents = append(page.Documents, gqlDocument{
+			ID: graphql.ID(strconv.FormatInt(d.ID, 10)), Title: d.Title, URL: d.URL, Matches: int32(d.Matches), Snippet: d.Snippet,
+		})
+	}
+	return page, nil
+}
+
+type gqlNamespaceArgs struct {
+	Namespace *string
+}
+
+func (gqlResolver) Stats(ctx context.Context, args gqlNamespaceArgs) (*gqlStats, error) {
+	ns, err := gqlNamespace(ctx, args.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := getContextWithTimeout(ctx)
+	defer cancel()
+	s, err := rag.DefaultEngine().Stats(ctx, ns)
+	if err != nil {
+		return nil, toGQLError(ctx, err)
+	}
+	return &gqlStats{
+		Namespace:           s.Namespace,
+		Documents:           int32(s.Documents),
+		Embeddings:          int32(s.Embeddings),
+		CompressedDocuments: int32(s.CompressedDocuments),
+		ContentBytes:        float64(s.ContentBytes),
+		RawContentBytes:     float64(s.RawContentBytes),
+		SavedBytes:          float64(s.SavedBytes),
+		QueueDepth:          int32(s.QueueDepth),
+	}, nil
+}
+
+type gqlIngestDocsArgs struct {
+	SeedURLs  *[]string
+	Namespace *string
+}
+
+// IngestDocs runs like POST /v1/ingest/kiali-docs. An interrupted run returns its
+// counts with cancelled set rather than an error.
+func (gqlResolver) IngestDocs(ctx context.Context, args gqlIngestDocsArgs) (*gqlIngestResult, error) {
+	ns, err := gqlNamespace(ctx, args.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := getContextWithTimeout(ctx)
+	defer cancel()
+	req := ingestDocsRequest{SeedURLs: deref(args.SeedURLs)}
+	res, err := rag.DefaultEngine().IngestKialiDocs(ctx, req.seeds(), rag.IngestOptions{Namespace: ns})
+	if err != nil && !res.Cancelled {
+		return nil, toGQLError(ctx, err)
+	}
+	return &gqlIngestResult{
+		Ingested:           int32(res.Ingested),
+		Skipped:            int32(res.Skipped),
+		Partial:            int32(res.Partial),
+		Merged:             int32(res.Merged),
+		Summaries:          int32(res.Summaries),
+		Queued:             int32(res.Queued),
+		Denied:             int32(res.Denied),
+		Capped:             int32(res.Capped),
+		Moderated:          int32(res.Moderated),
+		EmbeddingsReused:   int32(res.EmbeddingsReused),
+		EmbeddingsComputed: int32(res.EmbeddingsComputed),
+		Cancelled:          res.Cancelled,
+		Truncated:          res.Truncated,
+		DroppedLinks:       int32(res.DroppedLinks),
+	}, nil
+}
+
+func (gqlResolver) Clean(ctx context.Context, args gqlNamespaceArgs) (int32, error) {
+	ns, err := gqlNamespace(ctx, args.Namespace)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := getContextWithTimeout(ctx)
+	defer cancel()
+	removed, err := rag.DefaultEngine().Clean(ctx, ns)
+	if err != nil {
+		return 0, toGQLError(ctx, err)
+	}
+	return int32(removed), nil
+}
+
+func (gqlResolver) Deduplicate(ctx context.Context, args gqlNamespaceArgs) (int32, error) {
+	ns, err := gqlNamespace(ctx, args.Namespace)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := getContextWithTimeout(ctx)
+	defer cancel()
+	removed, err := rag.DefaultEngine().Deduplicate(ctx, ns)
+	if err != nil {
+		return 0, toGQLError(ctx, err)
+	}
+	return int32(removed), nil
+}
+
+// GraphQL object types, resolved by field name.
+
+type gqlAnswer struct {
+	Answer     string
+	Confidence float64
+	Citations  []gqlCitation
+	Sources    []gqlCitationGroup
+	Models     gqlModels
+	Context    *[]gqlChunk
+	Curated    bool
+	FAQID      *graphql.ID
+	Seed       *int32
+	Degraded   bool
+	Grounding  *gqlGrounding
+}
+
+type gqlGrounding struct {
+	Score       float64
+	Unsupported []string
+	Removed     bool
+}
+
+type gqlCitation struct {
+	Marker       int32
+	Title        string
+	URL          string
+	Span         string
+	Score        float64
+	Cited        bool
+	PageTitle    *string
+	SectionTitle *string
+	Anchor       *string
+}
+
+type gqlCitationGroup struct {
+	Title string
+	URL   string
+	Score float64
+	Spans []gqlSpan
+}
+
+type gqlSpan struct {
+	Span  string
+	URL   string
+	Score float64
+}
+
+type gqlModels struct {
+	CompletionModel    string
+	CompletionProvider *string
+	EmbeddingModel     string
+	EmbeddingProvider  *string
+	RoutedFrom         *string
+}
+
+type gqlChunk struct {
+	Title string
+	URL   string
+	Text  string
+	Score float64
+}
+
+type gqlDocumentPage struct {
+	Total     int32
+	Limit     int32
+	Offset    int32
+	Documents []gqlDocument
+}
+
+type gqlDocument struct {
+	ID      graphql.ID
+	Title   string
+	URL     string
+	Matches int32
+	Snippet string
+}
+
+type gqlStats struct {
+	Namespace           string
+	Documents           int32
+	Embeddings          int32
+	CompressedDocuments int32
+	ContentBytes        float64
+	RawContentBytes     float64
+	SavedBytes          float64
+	QueueDepth          int32
+}
+
+type gqlIngestResult struct {
+	Ingested           int32
+	Skipped            int32
+	Partial            int32
+	Merged             int32
+	Summaries          int32
+	Queued             int32
+	Denied             int32
+	Capped             int32
+	Moderated          int32
+	EmbeddingsReused   int32
+	EmbeddingsComputed int32
+	Cancelled          bool
+	Truncated          bool
+	DroppedLinks       int32
+}
+
+func toGQLChunks(chunks []rag.ContextChunk) *[]gqlChunk {
+	out := make([]gqlChunk, 0, len(chunks))
+	for _, c := range chunks {
+		out = append(out, gqlChunk{Title: c.Title, URL: c.URL, Text: c.Text, Score: c.Score})
+	}
+	return &out
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/rag"
+)
+
+func TestGQLOperationConflict(t *testing.T) {
+	running := rag.CorpusOperation{ID: "3f9c2a7d1e0b4c58", Kind: "ingest-docs", Namespace: "default"}
+	err := fmt.Errorf("clean: %w", &rag.OperationConflictError{Running: running})
+
+	ext := toGQLError(context.Background(), err).(gqlError).Extensions()
+	op, _ := ext["operation"].(*rag.CorpusOperation)
+	if ext["status"] != http.StatusConflict || op == nil || op.Kind != "ingest-docs" || op.Namespace != "default" {
+		t.Errorf("extensions = %v, want 409 with the running operation", ext)
+	}
+
+	pinned := context.WithValue(context.Background(), namespaceKey, "tenant")
+	ext = toGQLError(pinned, err).(gqlError).Extensions()
+	if op, _ := ext["operation"].(*rag.CorpusOperation); op == nil || op.Namespace != "" {
+		t.Errorf("operation for a pinned key = %+v, want it without namespace", ext["operation"])
+	}
+}
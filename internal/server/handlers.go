@@ -1,10 +1,22 @@
 package server
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
 	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/rag"
 )
 
@@ -17,15 +29,93 @@ func writeJSONError(w http.ResponseWriter, status int, msg string) {
 	})
 }
 
+// writeOperationConflict answers 409, naming the running operation, when err
+// reports that a conflicting corpus operation is in progress.
+func writeOperationConflict(w http.ResponseWriter, r *http.Request, err error) bool {
+	var conflict *rag.OperationConflictError
+	if !errors.As(err, &conflict) {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error":       err.Error(),
+		"status_code": http.StatusConflict,
+		"operation":   visibleOperation(r.Context(), conflict.Running),
+	})
+	return true
+}
+
+// visibleOperation hides the namespace of a running operation from API keys bound
+// to a namespace.
+func visibleOperation(ctx context.Context, op rag.CorpusOperation) rag.CorpusOperation {
+	if _, pinned := ctx.Value(namespaceKey).(string); pinned {
+		op.Namespace = ""
+	}
+	return op
+}
+
+// requestNamespace resolves the namespace a request operates on and writes an
+// error response when it cannot. API keys bound to a namespace pin it; other
+// callers choose one, falling back to rag.DefaultNamespace.
+func requestNamespace(w http.ResponseWriter, r *http.Request, requested string) (string, bool) {
+	ns, err := resolveNamespace(r.Context(), requested)
+	if errors.Is(err, errNamespaceForbidden) {
+		writeJSONError(w, http.StatusForbidden, err.Error())
+		return "", false
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+	return ns, true
+}
+
+var errNamespaceForbidden = errors.New("namespace not permitted for this API key")
+
+// resolveNamespace applies the rules of requestNamespace for callers that report
+// errors themselves.
+func resolveNamespace(ctx context.Context, requested string) (string, error) {
+	ns, err := rag.NormalizeNamespace(requested)
+	if err != nil {
+		return "", err
+	}
+	if pinned, ok := ctx.Value(namespaceKey).(string); ok {
+		if requested != "" && ns != pinned {
+			return "", errNamespaceForbidden
+		}
+		return pinned, nil
+	}
+	return ns, nil
+}
+
 type chatRequest struct {
-	Query   string `json:"query"`
-	Context any    `json:"context,omitempty"`
+	Query           string              `json:"query"`
+	Version         int                 `json:"version,omitempty"`
+	IncludeContext  bool                `json:"include_context,omitempty"`
+	GroupCitations  bool                `json:"group_citations,omitempty"`
+	Language        string              `json:"language,omitempty"`
+	Namespace       string              `json:"namespace,omitempty"`
+	Context         any                 `json:"context,omitempty"`
+	ResponseFormat  *rag.ResponseFormat `json:"response_format,omitempty"`
+	Temperature     *float64            `json:"temperature,omitempty"`
+	Seed            *int64              `json:"seed,omitempty"`
+	CandidateChunks int                 `json:"candidate_chunks,omitempty"`
+	PromptChunks    int                 `json:"prompt_chunks,omitempty"`
+	SourceWeights   rag.SourceWeights   `json:"source_weights,omitempty"`
+	Format          string              `json:"format,omitempty"`
 }
 
+// chatResponse is the v1 chat response. Its fields are frozen; new fields go in
+// chatResponseV2 unless, like context, they only appear on request.
 type chatResponse struct {
 	Answer     string               `json:"answer"`
+	Structured any                  `json:"structured,omitempty"`
+	Confidence float64              `json:"confidence"`
 	Citations  []rag.Citation       `json:"citations"`
 	UsedModels rag.ModelIdentifiers `json:"used_models"`
+	Context    []rag.ContextChunk   `json:"context,omitempty"`
+	Sources    []rag.CitationGroup  `json:"sources,omitempty"`
 }
 
 func ChatHandler(w http.ResponseWriter, r *http.Request) {
@@ -34,43 +124,184 @@ func ChatHandler(w http.ResponseWriter, r *http.Request) {
 		writeJSONError(w, http.StatusBadRequest, "invalid json")
 		return
 	}
+	version, err := responseVersion(r, req.Version)
+	if err != nil {
+		writeJSONError(w, http.StatusNotAcceptable, err.Error())
+		return
+	}
+	if req.ResponseFormat != nil {
+		if err := req.ResponseFormat.Validate(); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.IncludeContext && !config.GetBool("CHAT_INCLUDE_CONTEXT_ENABLED", true) {
+		writeJSONError(w, http.StatusBadRequest, "include_context is disabled on this server")
+		return
+	}
+	if err := rag.CheckFormat(req.Format); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ns, ok := requestNamespace(w, r, req.Namespace)
+	if !ok {
+		return
+	}
+	if !withinQuota(w, r) {
+		return
+	}
 	ctx, cancel := getContextWithTimeout(r.Context())
 	defer cancel()
 
-	answer, citations, models, err := rag.DefaultEngine().Answer(ctx, req.Query, req.Context)
+	opts := rag.AnswerOptions{
+		Namespace:       ns,
+		ResponseFormat:  req.ResponseFormat,
+		CompletionModel: r.Header.Get("X-Completion-Model"),
+		EmbeddingModel:  r.Header.Get("X-Embedding-Model"),
+		IncludeContext:  req.IncludeContext,
+		GroupCitations:  req.GroupCitations,
+		Language:        req.Language,
+		Temperature:     req.Temperature,
+		Seed:            req.Seed,
+		CandidateChunks: req.CandidateChunks,
+		PromptChunks:    req.PromptChunks,
+		SourceWeights:   req.SourceWeights,
+	}
+	res, err := rag.DefaultEngine().Answer(ctx, req.Query, req.Context, opts)
 	if err != nil {
-		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
-		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		status, msg := chatError(r, err)
+		writeJSONError(w, status, msg)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(chatResponse{Answer: answer, Citations: citations, UsedModels: models})
+	rag.DefaultEngine().RecordUsage(requestClient(r.Context()), ns, res.Usage)
+	// Structured answers are JSON, not markdown.
+	if res.Structured == nil {
+		res.Answer, _ = rag.FormatAnswer(res.Answer, req.Format)
+	}
+	writeChatResponse(w, version, res)
+}
+
+// withinQuota writes a 429 with Retry-After when the client has used up one of
+// its API_KEY_QUOTAS. A failed check is logged and lets the request through.
+func withinQuota(w http.ResponseWriter, r *http.Request) bool {
+	err := rag.DefaultEngine().CheckQuota(r.Context(), requestClient(r.Context()))
+	var qe *rag.QuotaError
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &qe):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(qe.ResetAt).Seconds()))))
+		writeJSONError(w, http.StatusTooManyRequests, err.Error())
+		return false
+	}
+	log.Printf("%s %s quota check failed: %v", r.Method, r.URL.Path, err)
+	return true
+}
+
+// chatError maps an Answer error to a status and message, logging the ones that
+// are not the caller's fault.
+func chatError(r *http.Request, err error) (int, string) {
+	switch {
+	case errors.Is(err, rag.ErrModelNotAllowed), errors.Is(err, rag.ErrInvalidTemperature), errors.Is(err, rag.ErrUnsupportedLanguage), errors.Is(err, rag.ErrInvalidChunkCount), errors.Is(err, rag.ErrInvalidSourceWeight):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, rag.ErrProviderUnavailable):
+		return http.StatusServiceUnavailable, err.Error()
+	case errors.Is(err, rag.ErrStageTimeout):
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+		return http.StatusGatewayTimeout, err.Error()
+	case errors.Is(err, rag.ErrContentBlocked):
+		log.Printf("%s %s blocked: %v", r.Method, r.URL.Path, err)
+		return http.StatusUnprocessableEntity, err.Error() + "; try rephrasing the question"
+	}
+	log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+	return http.StatusInternalServerError, err.Error()
 }
 
 type ingestDocsRequest struct {
-	BaseURL string `json:"base_url"`
+	BaseURL   string            `json:"base_url"`
+	SeedURLs  []string          `json:"seed_urls,omitempty"`
+	Namespace string            `json:"namespace,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	CrawlID   string            `json:"crawl_id,omitempty"`
+}
+
+// seeds merges base_url and seed_urls, falling back to the configured defaults.
+func (req ingestDocsRequest) seeds() []string {
+	var seeds []string
+	if req.BaseURL != "" {
+		seeds = append(seeds, req.BaseURL)
+	}
+	for _, s := range req.SeedURLs {
+		if s != "" {
+			seeds = append(seeds, s)
+		}
+	}
+	if len(seeds) == 0 {
+		return rag.DefaultDocsSeeds()
+	}
+	return seeds
+}
+
+// writeIngestResult answers a synchronous ingest. An ingest cut short by the server
+// timeout or a disconnect still reports the documents it committed, flagged
+// "cancelled", with 504.
+func writeIngestResult(w http.ResponseWriter, r *http.Request, res rag.IngestResult, err error) {
+	if errors.Is(err, rag.ErrCrawlNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if writeOperationConflict(w, r, err) {
+		return
+	}
+	if err != nil && !res.Cancelled {
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	status := http.StatusOK
+	var resp struct {
+		rag.IngestResult
+		Error string `json:"error,omitempty"`
+	}
+	resp.IngestResult = res
+	if res.Cancelled {
+		log.Printf("%s %s interrupted after %d ingested: %v", r.Method, r.URL.Path, res.Ingested, err)
+		status, resp.Error = http.StatusGatewayTimeout, err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
 }
 
 func IngestKialiDocsHandler(w http.ResponseWriter, r *http.Request) {
 	var req ingestDocsRequest
 	_ = json.NewDecoder(r.Body).Decode(&req)
-	if req.BaseURL == "" {
-		req.BaseURL = "https://kiali.io/"
+	ns, ok := requestNamespace(w, r, req.Namespace)
+	if !ok {
+		return
 	}
 	ctx, cancel := getContextWithTimeout(r.Context())
 	defer cancel()
-	ingested, skipped, err := rag.DefaultEngine().IngestKialiDocs(ctx, req.BaseURL)
-	if err != nil {
-		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
-		writeJSONError(w, http.StatusInternalServerError, err.Error())
+	res, err := rag.DefaultEngine().IngestKialiDocs(ctx, req.seeds(), rag.IngestOptions{Namespace: ns, Headers: req.Headers, CrawlID: req.CrawlID})
+	writeIngestResult(w, r, res, err)
+}
+
+func IngestKialiDocsStreamHandler(w http.ResponseWriter, r *http.Request) {
+	var req ingestDocsRequest
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	ns, ok := requestNamespace(w, r, req.Namespace)
+	if !ok {
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]any{"ingested": ingested, "skipped": skipped})
+	streamIngest(w, r, func(ctx context.Context, progress func(rag.IngestProgress)) (rag.IngestResult, error) {
+		return rag.DefaultEngine().IngestKialiDocs(ctx, req.seeds(), rag.IngestOptions{Namespace: ns, Headers: req.Headers, CrawlID: req.CrawlID, Progress: progress})
+	})
 }
 
 type ingestYouTubeRequest struct {
-	ChannelOrPlaylistURL string `json:"channel_or_playlist_url"`
+	ChannelOrPlaylistURL string            `json:"channel_or_playlist_url"`
+	Namespace            string            `json:"namespace,omitempty"`
+	Headers              map[string]string `json:"headers,omitempty"`
 }
 
 func IngestYouTubeHandler(w http.ResponseWriter, r *http.Request) {
@@ -79,40 +310,1000 @@ func IngestYouTubeHandler(w http.ResponseWriter, r *http.Request) {
 		writeJSONError(w, http.StatusBadRequest, "channel_or_playlist_url required")
 		return
 	}
+	ns, ok := requestNamespace(w, r, req.Namespace)
+	if !ok {
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	res, err := rag.DefaultEngine().IngestYouTube(ctx, req.ChannelOrPlaylistURL, rag.IngestOptions{Namespace: ns, Headers: req.Headers})
+	writeIngestResult(w, r, res, err)
+}
+
+func IngestYouTubeStreamHandler(w http.ResponseWriter, r *http.Request) {
+	var req ingestYouTubeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChannelOrPlaylistURL == "" {
+		writeJSONError(w, http.StatusBadRequest, "channel_or_playlist_url required")
+		return
+	}
+	ns, ok := requestNamespace(w, r, req.Namespace)
+	if !ok {
+		return
+	}
+	streamIngest(w, r, func(ctx context.Context, progress func(rag.IngestProgress)) (rag.IngestResult, error) {
+		return rag.DefaultEngine().IngestYouTube(ctx, req.ChannelOrPlaylistURL, rag.IngestOptions{Namespace: ns, Headers: req.Headers, Progress: progress})
+	})
+}
+
+type ingestDirectoryRequest struct {
+	Path      string `json:"path"`
+	Glob      string `json:"glob,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+func IngestDirectoryHandler(w http.ResponseWriter, r *http.Request) {
+	var req ingestDirectoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Path == "" {
+		writeJSONError(w, http.StatusBadRequest, "path required")
+		return
+	}
+	ns, ok := requestNamespace(w, r, req.Namespace)
+	if !ok {
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	res, err := rag.DefaultEngine().IngestDirectory(ctx, req.Path, req.Glob, rag.IngestOptions{Namespace: ns})
+	if errors.Is(err, rag.ErrDirectoryNotAllowed) {
+		writeJSONError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	writeIngestResult(w, r, res, err)
+}
+
+func IngestStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireUnpinned(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rag.AutoIngestStatus())
+}
+
+func CleanHandler(w http.ResponseWriter, r *http.Request) {
+	ns, ok := requestNamespace(w, r, r.URL.Query().Get("namespace"))
+	if !ok {
+		return
+	}
 	ctx, cancel := getContextWithTimeout(r.Context())
 	defer cancel()
-	ingested, skipped, err := rag.DefaultEngine().IngestYouTube(ctx, req.ChannelOrPlaylistURL)
+	removed, err := rag.DefaultEngine().Clean(ctx, ns)
+	if writeOperationConflict(w, r, err) {
+		return
+	}
 	if err != nil {
 		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
 		writeJSONError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]any{"ingested": ingested, "skipped": skipped})
+	_ = json.NewEncoder(w).Encode(map[string]any{"namespace": ns, "removed_documents": removed})
 }
 
-func CleanHandler(w http.ResponseWriter, r *http.Request) {
+// Admin listings page through results with ?limit= and ?offset=.
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// pageParams reads the limit and offset query parameters of a paginated listing.
+func pageParams(q url.Values) (limit, offset int, err error) {
+	limit, err = queryInt(q, "limit", defaultPageLimit)
+	if err == nil && limit > maxPageLimit {
+		err = fmt.Errorf("limit must be at most %d", maxPageLimit)
+	}
+	offset, offErr := queryInt(q, "offset", 0)
+	return limit, offset, errors.Join(err, offErr)
+}
+
+// queryInt parses a non-negative integer query parameter, returning def when it is absent.
+func queryInt(q url.Values, name string, def int) (int, error) {
+	v := q.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return n, nil
+}
+
+func DeduplicateHandler(w http.ResponseWriter, r *http.Request) {
+	ns, ok := requestNamespace(w, r, r.URL.Query().Get("namespace"))
+	if !ok {
+		return
+	}
 	ctx, cancel := getContextWithTimeout(r.Context())
 	defer cancel()
-	removed, err := rag.DefaultEngine().Clean(ctx)
+	if q := r.URL.Query(); q.Get("dry_run") == "true" {
+		limit, offset, err := pageParams(q)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		preview, err := rag.DefaultEngine().PreviewDuplicates(ctx, ns, limit, offset)
+		if err != nil {
+			log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"namespace": ns, "dry_run": true, "preview": preview})
+		return
+	}
+	removed, err := rag.DefaultEngine().Deduplicate(ctx, ns)
+	if writeOperationConflict(w, r, err) {
+		return
+	}
 	if err != nil {
 		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
 		writeJSONError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]any{"removed_documents": removed})
+	_ = json.NewEncoder(w).Encode(map[string]any{"namespace": ns, "removed_duplicates": removed})
 }
 
-func DeduplicateHandler(w http.ResponseWriter, r *http.Request) {
+func StatsHandler(w http.ResponseWriter, r *http.Request) {
+	ns, ok := requestNamespace(w, r, r.URL.Query().Get("namespace"))
+	if !ok {
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	stats, err := rag.DefaultEngine().Stats(ctx, ns)
+	if err != nil {
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(stats)
+}
+
+func SourcesHandler(w http.ResponseWriter, r *http.Request) {
+	ns, ok := requestNamespace(w, r, r.URL.Query().Get("namespace"))
+	if !ok {
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	sources, err := rag.DefaultEngine().Sources(ctx, ns)
+	if err != nil {
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"namespace": ns, "sources": sources})
+}
+
+func DocumentSearchHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	ns, ok := requestNamespace(w, r, q.Get("namespace"))
+	if !ok {
+		return
+	}
+	limit, offset, err := pageParams(q)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	res, err := rag.DefaultEngine().DocumentSearch(ctx, ns, rag.DocumentQuery{
+		Term:      strings.TrimSpace(q.Get("q")),
+		URLPrefix: strings.TrimSpace(q.Get("url_prefix")),
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"namespace": ns, "result": res})
+}
+
+// searchResult is a /v1/search result; Embedding is a JSON array of floats or, with
+// embedding_encoding=base64, the little-endian float32 bytes in base64.
+type searchResult struct {
+	Title     string  `json:"title"`
+	URL       string  `json:"url"`
+	Text      string  `json:"text"`
+	Score     float64 `json:"score"`
+	Embedding any     `json:"embedding,omitempty"`
+}
+
+// SearchHandler serves GET /v1/search, the chunks chat would retrieve for query.
+// include_embeddings=true adds each chunk's stored vector when
+// SEARCH_EMBEDDINGS_ENABLED is set, for at most SEARCH_EMBEDDINGS_MAX_RESULTS
+// (default 50) results.
+func SearchHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := q.Get("query")
+	if strings.TrimSpace(query) == "" {
+		writeJSONError(w, http.StatusBadRequest, "query required")
+		return
+	}
+	k, err := queryInt(q, "k", defaultSearchLimit)
+	if err == nil && (k < 1 || k > maxPageLimit) {
+		err = fmt.Errorf("k must be between 1 and %d", maxPageLimit)
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	withVectors := q.Get("include_embeddings") == "true"
+	encoding := q.Get("embedding_encoding")
+	if withVectors {
+		if !config.GetBool("SEARCH_EMBEDDINGS_ENABLED", false) {
+			writeJSONError(w, http.StatusBadRequest, "include_embeddings is disabled on this server")
+			return
+		}
+		if maxK := config.GetInt("SEARCH_EMBEDDINGS_MAX_RESULTS", 50); k > maxK {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("k must be at most %d with include_embeddings", maxK))
+			return
+		}
+		if encoding != "" && encoding != "json" && encoding != "base64" {
+			writeJSONError(w, http.StatusBadRequest, "embedding_encoding must be json or base64")
+			return
+		}
+	}
+	ns, ok := requestNamespace(w, r, q.Get("namespace"))
+	if !ok {
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	chunks, err := rag.DefaultEngine().Search(ctx, query, ns, k)
+	if err != nil {
+		status, msg := chatError(r, err)
+		writeJSONError(w, status, msg)
+		return
+	}
+	results := make([]searchResult, len(chunks))
+	for i, c := range chunks {
+		results[i] = searchResult{Title: c.Title, URL: c.URL, Text: c.Text, Score: c.Score}
+		if withVectors {
+			if encoding == "base64" {
+				results[i].Embedding = encodeVector(c.Vector)
+			} else {
+				results[i].Embedding = c.Vector
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"namespace": ns, "results": results})
+}
+
+// encodeVector returns vec as base64 of its little-endian float32 bytes.
+func encodeVector(vec []float32) string {
+	b := make([]byte, 4*len(vec))
+	for i, f := range vec {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(f))
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+type faqRequest struct {
+	Question  string `json:"question"`
+	Answer    string `json:"answer"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+func AddFAQHandler(w http.ResponseWriter, r *http.Request) {
+	var req faqRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Question) == "" || strings.TrimSpace(req.Answer) == "" {
+		writeJSONError(w, http.StatusBadRequest, "question and answer required")
+		return
+	}
+	ns, ok := requestNamespace(w, r, req.Namespace)
+	if !ok {
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	faq, err := rag.DefaultEngine().AddFAQ(ctx, ns, req.Question, req.Answer)
+	if errors.Is(err, rag.ErrProviderUnavailable) {
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(faq)
+}
+
+func FAQsHandler(w http.ResponseWriter, r *http.Request) {
+	ns, ok := requestNamespace(w, r, r.URL.Query().Get("namespace"))
+	if !ok {
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	faqs, err := rag.DefaultEngine().FAQs(ctx, ns)
+	if err != nil {
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"namespace": ns, "faqs": faqs})
+}
+
+func DeleteFAQHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid faq id")
+		return
+	}
+	ns, ok := requestNamespace(w, r, r.URL.Query().Get("namespace"))
+	if !ok {
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	err = rag.DefaultEngine().DeleteFAQ(ctx, ns, id)
+	if errors.Is(err, rag.ErrFAQNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"namespace": ns, "deleted": id})
+}
+
+type evalCaseRequest struct {
+	Query        string   `json:"query"`
+	RelevantURLs []string `json:"relevant_urls"`
+	Namespace    string   `json:"namespace,omitempty"`
+}
+
+func AddEvalCaseHandler(w http.ResponseWriter, r *http.Request) {
+	var req evalCaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Query) == "" || len(req.RelevantURLs) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "query and relevant_urls required")
+		return
+	}
+	ns, ok := requestNamespace(w, r, req.Namespace)
+	if !ok {
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	c, err := rag.DefaultEngine().AddEvalCase(ctx, ns, req.Query, req.RelevantURLs)
+	if err != nil {
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(c)
+}
+
+func EvalCasesHandler(w http.ResponseWriter, r *http.Request) {
+	ns, ok := requestNamespace(w, r, r.URL.Query().Get("namespace"))
+	if !ok {
+		return
+	}
 	ctx, cancel := getContextWithTimeout(r.Context())
 	defer cancel()
-	removed, err := rag.DefaultEngine().Deduplicate(ctx)
+	cases, err := rag.DefaultEngine().EvalCases(ctx, ns)
 	if err != nil {
 		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
 		writeJSONError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]any{"removed_duplicates": removed})
+	_ = json.NewEncoder(w).Encode(map[string]any{"namespace": ns, "cases": cases})
+}
+
+func DeleteEvalCaseHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid eval case id")
+		return
+	}
+	ns, ok := requestNamespace(w, r, r.URL.Query().Get("namespace"))
+	if !ok {
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	err = rag.DefaultEngine().DeleteEvalCase(ctx, ns, id)
+	if errors.Is(err, rag.ErrEvalCaseNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"namespace": ns, "deleted": id})
+}
+
+// RunEvalHandler scores retrieval against the eval cases of a namespace.
+func RunEvalHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	k, err := queryInt(q, "k", defaultSearchLimit)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ns, ok := requestNamespace(w, r, q.Get("namespace"))
+	if !ok {
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	rep, err := rag.DefaultEngine().RunEval(ctx, ns, k)
+	if errors.Is(err, rag.ErrNoEvalCases) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		status, msg := chatError(r, err)
+		writeJSONError(w, status, msg)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rep)
+}
+
+type apiKeyRequest struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+func AddAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireUnpinned(w, r) {
+		return
+	}
+	var req apiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		writeJSONError(w, http.StatusBadRequest, "name required")
+		return
+	}
+	for _, k := range configuredKeys() {
+		if k.Name == req.Name {
+			writeJSONError(w, http.StatusConflict, "name is used by a configured key")
+			return
+		}
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	key, secret, err := rag.DefaultEngine().AddAPIKey(ctx, req.Name, req.Namespace)
+	if errors.Is(err, rag.ErrAPIKeyExists) {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if errors.Is(err, rag.ErrInvalidAPIKey) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(struct {
+		rag.APIKey
+		Key string `json:"key"`
+	}{key, secret})
+}
+
+func APIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireUnpinned(w, r) {
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	keys, err := rag.DefaultEngine().APIKeys(ctx)
+	if err != nil {
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys, "configured": configuredKeys()})
+}
+
+func RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireUnpinned(w, r) {
+		return
+	}
+	name := chi.URLParam(r, "name")
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	err := rag.DefaultEngine().RevokeAPIKey(ctx, name)
+	if errors.Is(err, rag.ErrAPIKeyNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"revoked": name})
+}
+
+func ModerationEventsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	ns, ok := requestNamespace(w, r, q.Get("namespace"))
+	if !ok {
+		return
+	}
+	limit, err := queryInt(q, "limit", defaultPageLimit)
+	if err == nil && limit > maxPageLimit {
+		err = fmt.Errorf("limit must be at most %d", maxPageLimit)
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	events, err := rag.DefaultEngine().ModerationEvents(ctx, ns, limit)
+	if err != nil {
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"namespace": ns, "events": events})
+}
+
+func CompactHandler(w http.ResponseWriter, r *http.Request) {
+	ns, ok := requestNamespace(w, r, r.URL.Query().Get("namespace"))
+	if !ok {
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	res, err := rag.DefaultEngine().Compact(ctx, ns)
+	if writeOperationConflict(w, r, err) {
+		return
+	}
+	if errors.Is(err, rag.ErrCompactionDisabled) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// ReextractHandler re-extracts and re-embeds the pages of a namespace from their
+// stored HTML.
+func ReextractHandler(w http.ResponseWriter, r *http.Request) {
+	ns, ok := requestNamespace(w, r, r.URL.Query().Get("namespace"))
+	if !ok {
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	res, err := rag.DefaultEngine().Reextract(ctx, ns)
+	if writeOperationConflict(w, r, err) {
+		return
+	}
+	if err != nil && !res.Cancelled {
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// BackfillHashesHandler computes the content hash and normalized URL of the
+// documents of a namespace stored without them, or of all of them with
+// recompute=true. A run cut short by the server timeout reports cancelled; the
+// batches done so far stay stored and the next run continues from there.
+func BackfillHashesHandler(w http.ResponseWriter, r *http.Request) {
+	ns, opts, ok := hashBackfillRequest(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	res, err := rag.DefaultEngine().BackfillHashes(ctx, ns, opts)
+	if writeOperationConflict(w, r, err) {
+		return
+	}
+	if err != nil && !res.Cancelled {
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// BackfillHashesStreamHandler is BackfillHashesHandler reporting a "progress"
+// event per batch; it runs until done or the client disconnects.
+func BackfillHashesStreamHandler(w http.ResponseWriter, r *http.Request) {
+	ns, opts, ok := hashBackfillRequest(w, r)
+	if !ok {
+		return
+	}
+	run := func(ctx context.Context, progress func(rag.HashBackfillProgress)) (rag.HashBackfillResult, error) {
+		opts.Progress = progress
+		return rag.DefaultEngine().BackfillHashes(ctx, ns, opts)
+	}
+	streamJob(w, r, run, func(res rag.HashBackfillResult) string {
+		return fmt.Sprintf("%d of %d documents hashed", res.Processed, res.Total)
+	})
+}
+
+func hashBackfillRequest(w http.ResponseWriter, r *http.Request) (string, rag.HashBackfillOptions, bool) {
+	q := r.URL.Query()
+	ns, ok := requestNamespace(w, r, q.Get("namespace"))
+	if !ok {
+		return "", rag.HashBackfillOptions{}, false
+	}
+	var opts rag.HashBackfillOptions
+	if v := q.Get("recompute"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid recompute")
+			return "", rag.HashBackfillOptions{}, false
+		}
+		opts.Recompute = b
+	}
+	return ns, opts, true
+}
+
+// ReembedHandler starts a background re-embed of a namespace, or of the whole
+// store when none is given, and answers 202 with its initial status; progress is
+// polled with GET and stopped with DELETE. Keys bound to a namespace re-embed
+// theirs.
+func ReembedHandler(w http.ResponseWriter, r *http.Request) {
+	var ns string
+	requested := r.URL.Query().Get("namespace")
+	if _, pinned := r.Context().Value(namespaceKey).(string); requested != "" || pinned {
+		var ok bool
+		if ns, ok = requestNamespace(w, r, requested); !ok {
+			return
+		}
+	}
+	status, err := rag.DefaultEngine().StartReembed(ns)
+	if writeOperationConflict(w, r, err) {
+		return
+	}
+	if errors.Is(err, rag.ErrReembedRunning) || errors.Is(err, rag.ErrReembedLeavesModels) {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+func ReembedStatusHandler(w http.ResponseWriter, r *http.Request) {
+	status := rag.DefaultEngine().ReembedStatus()
+	if !reembedVisible(w, r, status) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+func CancelReembedHandler(w http.ResponseWriter, r *http.Request) {
+	eng := rag.DefaultEngine()
+	if !reembedVisible(w, r, eng.ReembedStatus()) {
+		return
+	}
+	status, err := eng.CancelReembed()
+	if errors.Is(err, rag.ErrNoReembed) {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+// reembedVisible keeps keys bound to a namespace away from another namespace's
+// re-embed and from one of the whole store.
+func reembedVisible(w http.ResponseWriter, r *http.Request, status rag.ReembedStatus) bool {
+	if status.Namespace == "" {
+		return status.State == "idle" || requireUnpinned(w, r)
+	}
+	if _, err := resolveNamespace(r.Context(), status.Namespace); err != nil {
+		writeJSONError(w, http.StatusForbidden, errNamespaceForbidden.Error())
+		return false
+	}
+	return true
+}
+
+func VacuumHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireUnpinned(w, r) {
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	res, err := rag.DefaultEngine().Vacuum(ctx)
+	if writeOperationConflict(w, r, err) {
+		return
+	}
+	if errors.Is(err, rag.ErrIngestInProgress) {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// CleanOrphansHandler deletes embeddings whose document no longer exists.
+func CleanOrphansHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireUnpinned(w, r) {
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	res, err := rag.DefaultEngine().CleanOrphans(ctx)
+	if writeOperationConflict(w, r, err) {
+		return
+	}
+	if errors.Is(err, rag.ErrIngestInProgress) {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func ValidateModelsHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireUnpinned(w, r) {
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	res := rag.DefaultEngine().ValidateModels(ctx)
+	if !res.OK {
+		log.Printf("%s %s: model validation failed", r.Method, r.URL.Path)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// ModelsHandler lists the models requests may select with the model override
+// headers.
+func ModelsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rag.DefaultEngine().Models())
+}
+
+type debugEmbedRequest struct {
+	Text      string `json:"text"`
+	MaxValues int    `json:"max_values,omitempty"`
+}
+
+type debugEmbedResponse struct {
+	rag.EmbedResult
+	DimensionMismatch bool `json:"dimension_mismatch"`
+	Truncated         bool `json:"truncated"`
+}
+
+func DebugEmbedHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireUnpinned(w, r) {
+		return
+	}
+	var req debugEmbedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Text == "" {
+		writeJSONError(w, http.StatusBadRequest, "text required")
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	res, err := rag.DefaultEngine().Embed(ctx, req.Text)
+	if errors.Is(err, rag.ErrProviderUnavailable) {
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	out := debugEmbedResponse{EmbedResult: res, DimensionMismatch: res.Dimension != res.ConfiguredDimension}
+	if req.MaxValues > 0 && len(out.Vector) > req.MaxValues {
+		out.Vector, out.Truncated = out.Vector[:req.MaxValues], true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// debugTraceResponse carries the error of a failed run next to the stages it reached.
+type debugTraceResponse struct {
+	Error string `json:"error,omitempty"`
+	rag.AnswerTrace
+}
+
+// DebugTraceHandler answers a chat request with the trace of its whole pipeline.
+// It takes the chat request body and model override headers.
+func DebugTraceHandler(w http.ResponseWriter, r *http.Request) {
+	var req chatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		writeJSONError(w, http.StatusBadRequest, "query required")
+		return
+	}
+	if req.ResponseFormat != nil {
+		if err := req.ResponseFormat.Validate(); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	ns, ok := requestNamespace(w, r, req.Namespace)
+	if !ok {
+		return
+	}
+	if !withinQuota(w, r) {
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	trace, err := rag.DefaultEngine().Trace(ctx, req.Query, req.Context, rag.AnswerOptions{
+		Namespace:       ns,
+		ResponseFormat:  req.ResponseFormat,
+		CompletionModel: r.Header.Get("X-Completion-Model"),
+		EmbeddingModel:  r.Header.Get("X-Embedding-Model"),
+		Language:        req.Language,
+		Temperature:     req.Temperature,
+		Seed:            req.Seed,
+		CandidateChunks: req.CandidateChunks,
+		PromptChunks:    req.PromptChunks,
+		SourceWeights:   req.SourceWeights,
+	})
+	out := debugTraceResponse{AnswerTrace: trace}
+	w.Header().Set("Content-Type", "application/json")
+	if err == nil {
+		rag.DefaultEngine().RecordUsage(requestClient(r.Context()), ns, trace.Usage)
+	} else {
+		var status int
+		status, out.Error = chatError(r, err)
+		w.WriteHeader(status)
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// UsageHandler reports usage per client and namespace over a period, the current
+// one by default. API keys bound to a namespace only see that namespace.
+func UsageHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := rag.UsageFilter{Period: q.Get("period"), Client: q.Get("client"), Namespace: q.Get("namespace")}
+	if f.Period == "" {
+		f.Period = rag.CurrentUsagePeriod()
+	}
+	if !usageNamespace(w, &f) {
+		return
+	}
+	if pinned, ok := r.Context().Value(namespaceKey).(string); ok {
+		if f.Namespace != "" && f.Namespace != pinned {
+			writeJSONError(w, http.StatusForbidden, errNamespaceForbidden.Error())
+			return
+		}
+		f.Namespace = pinned
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	records, err := rag.DefaultEngine().Usage(ctx, f)
+	if err != nil {
+		usageError(w, r, err)
+		return
+	}
+	total := rag.UsageRecord{}
+	for _, rec := range records {
+		total.Queries += rec.Queries
+		total.PromptTokens += rec.PromptTokens
+		total.CompletionTokens += rec.CompletionTokens
+		total.CachedPromptTokens += rec.CachedPromptTokens
+		total.Cost += rec.Cost
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"period": f.Period,
+		"usage":  records,
+		"total":  map[string]any{"queries": total.Queries, "prompt_tokens": total.PromptTokens, "completion_tokens": total.CompletionTokens, "cached_prompt_tokens": total.CachedPromptTokens, "cost": total.Cost},
+	})
+}
+
+// ResetUsageHandler deletes usage counters by period, or before a period, and
+// optionally client and namespace. One of period and before is required so a
+// bare request cannot wipe all history.
+func ResetUsageHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireUnpinned(w, r) {
+		return
+	}
+	q := r.URL.Query()
+	before := q.Get("before")
+	f := rag.UsageFilter{Period: q.Get("period"), Client: q.Get("client"), Namespace: q.Get("namespace")}
+	if f.Period == "" && before == "" {
+		writeJSONError(w, http.StatusBadRequest, "period or before required")
+		return
+	}
+	if !usageNamespace(w, &f) {
+		return
+	}
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	n, err := rag.DefaultEngine().ResetUsage(ctx, f, before)
+	if err != nil {
+		usageError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"deleted": n})
+}
+
+// usageNamespace validates the optional namespace filter of a usage request.
+func usageNamespace(w http.ResponseWriter, f *rag.UsageFilter) bool {
+	if f.Namespace == "" {
+		return true
+	}
+	ns, err := rag.NormalizeNamespace(f.Namespace)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	f.Namespace = ns
+	return true
+}
+
+func usageError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, rag.ErrInvalidPeriod) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+	writeJSONError(w, http.StatusInternalServerError, err.Error())
 }
@@ -0,0 +1,292 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// The handlers run against ENGINE=mock: in-memory SQLite, word-hash embeddings
+// and a canned completion, so no database or provider is needed.
+const (
+	testAPIKey    = "test-key"
+	testTenantKey = "tenant-key"
+)
+
+var testRouter http.Handler
+
+func TestMain(m *testing.M) {
+	os.Setenv("CONFIG_FILE", filepath.Join(os.TempDir(), "kiali-mcp-no-config.yaml"))
+	os.Setenv("ENGINE", "mock")
+	os.Setenv("API_KEY", testAPIKey)
+	os.Setenv("API_KEY_NAMESPACES", testTenantKey+"=tenant")
+	os.Setenv("BASIC_AUTH_USER", "admin")
+	os.Setenv("BASIC_AUTH_PASS", "secret")
+	os.Setenv("INGEST_DIR_ROOTS", os.TempDir())
+	testRouter = NewRouter()
+	os.Exit(m.Run())
+}
+
+// serve sends a request through the router, authenticated with API_KEY unless
+// headers set other credentials.
+func serve(t *testing.T, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if _, ok := headers["Authorization"]; !ok {
+		req.Header.Set("X-API-Key", testAPIKey)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	return w
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+	var out map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	return out
+}
+
+// writeDocs writes markdown files about Kiali into a fresh directory.
+func writeDocs(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"graph.md":  "# Traffic graph\n\nThe Kiali traffic graph shows how services in the mesh communicate, with request rates and error rates on every edge.",
+		"wizard.md": "# Istio wizards\n\nKiali wizards create Istio routing configuration such as virtual services and destination rules for a service.",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+var seedOnce sync.Once
+
+// seedChat ingests the test docs into the "chat" namespace once.
+func seedChat(t *testing.T) {
+	t.Helper()
+	seedOnce.Do(func() {
+		body, _ := json.Marshal(map[string]string{"path": writeDocs(t), "namespace": "chat"})
+		if w := serve(t, http.MethodPost, "/v1/ingest/directory", string(body), nil); w.Code != http.StatusOK {
+			t.Fatalf("seed: %d %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestIngestDirectory(t *testing.T) {
+	body, _ := json.Marshal(map[string]string{"path": writeDocs(t), "namespace": "ingest"})
+	w := serve(t, http.MethodPost, "/v1/ingest/directory", string(body), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if res := decode(t, w); res["ingested"] != float64(2) || res["skipped"] != float64(0) {
+		t.Errorf("first ingest = %v, want 2 ingested", res)
+	}
+
+	w = serve(t, http.MethodPost, "/v1/ingest/directory", string(body), nil)
+	if res := decode(t, w); res["ingested"] != float64(0) || res["skipped"] != float64(2) {
+		t.Errorf("second ingest = %v, want 2 skipped", res)
+	}
+
+	w = serve(t, http.MethodPost, "/v1/ingest/directory", `{"namespace":"ingest"}`, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("missing path: status %d, want 400", w.Code)
+	}
+}
+
+func TestChatV1(t *testing.T) {
+	seedChat(t)
+	w := serve(t, http.MethodPost, "/v1/chat", `{"query":"How does the traffic graph show services?","namespace":"chat"}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	res := decode(t, w)
+	if res["answer"] != "This is a mock answer [1]." {
+		t.Errorf("answer = %v", res["answer"])
+	}
+	if _, ok := res["version"]; ok {
+		t.Error("v1 response has a version field")
+	}
+	citations, _ := res["citations"].([]any)
+	if len(citations) == 0 {
+		t.Fatalf("no citations: %v", res)
+	}
+	first := citations[0].(map[string]any)
+	if url, _ := first["url"].(string); !strings.HasPrefix(url, "file://") {
+		t.Errorf("first citation url = %v, want an ingested file", first["url"])
+	}
+	if _, ok := res["used_models"].(map[string]any); !ok {
+		t.Errorf("used_models missing: %v", res)
+	}
+}
+
+// TestChatV1Frozen pins the v1 response to the fields it had when v2 was added,
+// even with the options that add fields to v2.
+func TestChatV1Frozen(t *testing.T) {
+	seedChat(t)
+	w := serve(t, http.MethodPost, "/v1/chat", `{"query":"How does the traffic graph show services?","namespace":"chat","seed":42}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	res := decode(t, w)
+	assertKeys(t, "response", res, "answer", "confidence", "citations", "used_models")
+	for _, c := range res["citations"].([]any) {
+		assertKeys(t, "citation", c.(map[string]any), "title", "url", "span")
+	}
+	models := res["used_models"].(map[string]any)
+	for k := range models {
+		if k != "completion_model" && k != "embedding_model" && k != "completion_provider" && k != "embedding_provider" {
+			t.Errorf("used_models has %q: %v", k, models)
+		}
+	}
+}
+
+func assertKeys(t *testing.T, what string, obj map[string]any, keys ...string) {
+	t.Helper()
+	if len(obj) != len(keys) {
+		t.Errorf("%s = %v, want keys %v", what, obj, keys)
+		return
+	}
+	for _, k := range keys {
+		if _, ok := obj[k]; !ok {
+			t.Errorf("%s = %v, want keys %v", what, obj, keys)
+			return
+		}
+	}
+}
+
+func TestChatV2(t *testing.T) {
+	seedChat(t)
+	for name, req := range map[string]struct {
+		body   string
+		accept string
+	}{
+		"accept header": {`{"query":"Which wizards create routing?","namespace":"chat"}`, mediaTypeV2},
+		"version field": {`{"query":"Which wizards create routing?","namespace":"chat","version":2}`, ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := serve(t, http.MethodPost, "/v1/chat", req.body, map[string]string{"Accept": req.accept})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body.String())
+			}
+			if ct := w.Header().Get("Content-Type"); ct != mediaTypeV2 {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			res := decode(t, w)
+			if res["version"] != float64(2) {
+				t.Errorf("version = %v", res["version"])
+			}
+			citations, _ := res["citations"].([]any)
+			if len(citations) == 0 {
+				t.Fatalf("no citations: %v", res)
+			}
+			first := citations[0].(map[string]any)
+			if first["marker"] != float64(1) || first["cited"] != true {
+				t.Errorf("first citation = %v, want cited marker 1", first)
+			}
+			models, _ := res["models"].(map[string]any)
+			if _, ok := models["completion"]; !ok {
+				t.Errorf("models = %v", res["models"])
+			}
+		})
+	}
+	w := serve(t, http.MethodPost, "/v1/chat", `{"query":"graph","version":3}`, nil)
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("version 3: status %d, want 406", w.Code)
+	}
+}
+
+func TestChatFormat(t *testing.T) {
+	seedChat(t)
+	tests := []struct {
+		format string
+		status int
+		answer string
+	}{
+		{"", http.StatusOK, "This is a mock answer [1]."},
+		{"markdown", http.StatusOK, "This is a mock answer [1]."},
+		{"html", http.StatusOK, "<p>This is a mock answer [1].</p>"},
+		{"plain", http.StatusOK, "This is a mock answer [1]."},
+		{"pdf", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]string{"query": "traffic graph", "namespace": "chat", "format": tt.format})
+			w := serve(t, http.MethodPost, "/v1/chat", string(body), nil)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if got := decode(t, w)["answer"]; got != tt.answer {
+				t.Errorf("answer = %q, want %q", got, tt.answer)
+			}
+		})
+	}
+}
+
+func TestChatBadRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"invalid json", `{"query":`, http.StatusBadRequest},
+		{"invalid namespace", `{"query":"graph","namespace":"Not Valid!"}`, http.StatusBadRequest},
+		{"invalid temperature", `{"query":"graph","temperature":5}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(t, http.MethodPost, "/v1/chat", tt.body, nil); w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestReadyzHasNoDetails(t *testing.T) {
+	w := serve(t, http.MethodGet, "/readyz?namespace=chat", "", map[string]string{"Authorization": ""})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if res := decode(t, w); len(res) != 1 || res["status"] != "ready" {
+		t.Errorf("readyz = %v, want only the status", res)
+	}
+	w = serve(t, http.MethodGet, "/v1/admin/health", "", nil)
+	if res := decode(t, w); res["corpus"] == nil || res["providers"] == nil {
+		t.Errorf("health = %v, want corpus and providers", res)
+	}
+}
+
+func TestDebugTraceSourceWeights(t *testing.T) {
+	seedChat(t)
+	// The trace takes the chat body whole, so an invalid weight is rejected as in chat.
+	w := serve(t, http.MethodPost, "/v1/debug/trace", `{"query":"graph","namespace":"chat","source_weights":{"podcast":2}}`, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown source type: status %d, want 400: %s", w.Code, w.Body.String())
+	}
+	w = serve(t, http.MethodPost, "/v1/debug/trace", `{"query":"graph","namespace":"chat","source_weights":{"docs":2}}`, nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("status %d: %s", w.Code, w.Body.String())
+	}
+}
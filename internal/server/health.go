@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/rag"
+)
+
+type readyResponse struct {
+	Status string `json:"status"`
+}
+
+type healthResponse struct {
+	Status    string              `json:"status"`
+	Providers []rag.BreakerStatus `json:"providers"`
+	Corpus    *rag.CorpusHealth   `json:"corpus,omitempty"`
+	Error     string              `json:"error,omitempty"`
+}
+
+// ReadyzHandler is the unauthenticated readiness probe: "ready", or "unavailable"
+// with 503 while every provider's circuit is open or the store cannot be read,
+// since no question could be answered. Details are in HealthHandler.
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	eng := rag.DefaultEngine()
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	res, status := readyResponse{Status: "ready"}, http.StatusOK
+	_, err := eng.CorpusHealth(ctx, rag.DefaultNamespace)
+	if err != nil {
+		log.Printf("readyz: store unavailable: %v", err)
+	}
+	if err != nil || allOpen(eng.ProviderStatus()) {
+		res.Status, status = "unavailable", http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// HealthHandler reports the LLM provider circuit breakers and the corpus of the
+// namespace in ?namespace= (the caller's namespace if absent). Its status follows
+// ReadyzHandler, plus "degraded" with 200 while the corpus is empty or stale, so
+// monitoring can alert while probes keep routing traffic. Store errors are logged,
+// not returned.
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	ns, ok := requestNamespace(w, r, r.URL.Query().Get("namespace"))
+	if !ok {
+		return
+	}
+	eng := rag.DefaultEngine()
+	res := healthResponse{Status: "ready", Providers: eng.ProviderStatus()}
+	status := http.StatusOK
+	ctx, cancel := getContextWithTimeout(r.Context())
+	defer cancel()
+	corpus, err := eng.CorpusHealth(ctx, ns)
+	switch {
+	case err != nil:
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		res.Status, res.Error, status = "unavailable", "store unavailable", http.StatusServiceUnavailable
+	case allOpen(res.Providers):
+		res.Corpus = &corpus
+		res.Status, status = "unavailable", http.StatusServiceUnavailable
+	default:
+		res.Corpus = &corpus
+		if corpus.Empty || corpus.Stale {
+			res.Status = "degraded"
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func allOpen(providers []rag.BreakerStatus) bool {
+	for _, p := range providers {
+		if p.State != rag.BreakerOpen {
+			return false
+		}
+	}
+	return len(providers) > 0
+}
+
+var breakerStateValues = map[string]int{rag.BreakerClosed: 0, rag.BreakerHalfOpen: 1, rag.BreakerOpen: 2}
+
+// MetricsHandler serves circuit breaker state, and the answer event counts when
+// EVENTS_SINK is set, in the Prometheus text format.
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireUnpinned(w, r) {
+		return
+	}
+	providers := rag.DefaultEngine().ProviderStatus()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP kiali_mcp_llm_breaker_state Circuit breaker state per LLM provider (0 closed, 1 half-open, 2 open).")
+	fmt.Fprintln(w, "# TYPE kiali_mcp_llm_breaker_state gauge")
+	for _, p := range providers {
+		fmt.Fprintf(w, "kiali_mcp_llm_breaker_state{provider=%q} %d\n", p.Provider, breakerStateValues[p.State])
+	}
+	fmt.Fprintln(w, "# HELP kiali_mcp_llm_breaker_consecutive_failures Consecutive failed calls per LLM provider.")
+	fmt.Fprintln(w, "# TYPE kiali_mcp_llm_breaker_consecutive_failures gauge")
+	for _, p := range providers {
+		fmt.Fprintf(w, "kiali_mcp_llm_breaker_consecutive_failures{provider=%q} %d\n", p.Provider, p.ConsecutiveFailures)
+	}
+	fmt.Fprintln(w, "# HELP kiali_mcp_llm_breaker_opens_total Times the circuit opened per LLM provider.")
+	fmt.Fprintln(w, "# TYPE kiali_mcp_llm_breaker_opens_total counter")
+	for _, p := range providers {
+		fmt.Fprintf(w, "kiali_mcp_llm_breaker_opens_total{provider=%q} %d\n", p.Provider, p.Opens)
+	}
+	events := rag.DefaultEngine().EventStats()
+	if events.Sink == "" {
+		return
+	}
+	fmt.Fprintln(w, "# HELP kiali_mcp_events_total Answer events by outcome: published, dropped (buffer full) or failed (broker error).")
+	fmt.Fprintln(w, "# TYPE kiali_mcp_events_total counter")
+	fmt.Fprintf(w, "kiali_mcp_events_total{sink=%q,outcome=\"published\"} %d\n", events.Sink, events.Published)
+	fmt.Fprintf(w, "kiali_mcp_events_total{sink=%q,outcome=\"dropped\"} %d\n", events.Sink, events.Dropped)
+	fmt.Fprintf(w, "kiali_mcp_events_total{sink=%q,outcome=\"failed\"} %d\n", events.Sink, events.Failed)
+}
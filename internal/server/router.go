@@ -5,24 +5,27 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/config"
 )
 
 func NewRouter() http.Handler {
+	base := BasePath()
 	r := chi.NewRouter()
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-API-Key"},
+		AllowedMethods:   []string{"GET", "POST", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-API-Key", "X-Completion-Model", "X-Embedding-Model", "Last-Event-ID"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
-	r.Use(AuthMiddleware())
+	r.Use(AuthMiddleware(base+"/healthz", base+"/readyz"))
 	// request logging
 	r.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
@@ -32,20 +35,76 @@ func NewRouter() http.Handler {
 		})
 	})
 
+	if base == "" {
+		mountRoutes(r)
+	} else {
+		r.Route(base, mountRoutes)
+	}
+	return r
+}
+
+func mountRoutes(r chi.Router) {
 	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 	})
+	r.Get("/readyz", ReadyzHandler)
+	r.Get("/metrics", MetricsHandler)
 
 	r.Post("/v1/chat", ChatHandler)
+	r.Get("/v1/chat", ChatStreamHandler)
+	r.Get("/v1/search", SearchHandler)
+	r.Get("/v1/models", ModelsHandler)
 	r.Post("/v1/ingest/kiali-docs", IngestKialiDocsHandler)
 	r.Post("/v1/ingest/youtube", IngestYouTubeHandler)
+	r.Post("/v1/ingest/directory", IngestDirectoryHandler)
+	r.Post("/v1/ingest/kiali-docs/stream", IngestKialiDocsStreamHandler)
+	r.Post("/v1/ingest/youtube/stream", IngestYouTubeStreamHandler)
 	r.Post("/v1/admin/clean", CleanHandler)
 	r.Post("/v1/admin/deduplicate", DeduplicateHandler)
+	r.Post("/v1/admin/vacuum", VacuumHandler)
+	r.Post("/v1/admin/orphans", CleanOrphansHandler)
+	r.Post("/v1/admin/compact", CompactHandler)
+	r.Post("/v1/admin/reextract", ReextractHandler)
+	r.Post("/v1/admin/hashes", BackfillHashesHandler)
+	r.Post("/v1/admin/hashes/stream", BackfillHashesStreamHandler)
+	r.Post("/v1/admin/reembed", ReembedHandler)
+	r.Get("/v1/admin/reembed", ReembedStatusHandler)
+	r.Delete("/v1/admin/reembed", CancelReembedHandler)
+	r.Get("/v1/admin/ingest/status", IngestStatusHandler)
+	r.Get("/v1/admin/health", HealthHandler)
+	r.Get("/v1/admin/stats", StatsHandler)
+	r.Get("/v1/admin/sources", SourcesHandler)
+	r.Get("/v1/admin/usage", UsageHandler)
+	r.Delete("/v1/admin/usage", ResetUsageHandler)
+	r.Get("/v1/admin/documents/search", DocumentSearchHandler)
+	r.Post("/v1/admin/faqs", AddFAQHandler)
+	r.Get("/v1/admin/faqs", FAQsHandler)
+	r.Delete("/v1/admin/faqs/{id}", DeleteFAQHandler)
+	r.Post("/v1/admin/eval/cases", AddEvalCaseHandler)
+	r.Get("/v1/admin/eval/cases", EvalCasesHandler)
+	r.Delete("/v1/admin/eval/cases/{id}", DeleteEvalCaseHandler)
+	r.Post("/v1/admin/eval/run", RunEvalHandler)
+	r.Get("/v1/admin/moderation", ModerationEventsHandler)
+	r.Get("/v1/admin/keys", APIKeysHandler)
+	r.Post("/v1/admin/keys", AddAPIKeyHandler)
+	r.Delete("/v1/admin/keys/{name}", RevokeAPIKeyHandler)
+	r.Post("/v1/admin/models/validate", ValidateModelsHandler)
+	r.Post("/v1/debug/embed", DebugEmbedHandler)
+	r.Post("/v1/debug/trace", DebugTraceHandler)
+	r.Post("/graphql", GraphQLHandler())
 
 	// Tools (none currently)
+}
 
-	return r
+// BasePath returns the normalized BASE_PATH prefix all routes are served under,
+// e.g. "/kiali-mcp", or "" to serve at the root.
+func BasePath() string {
+	base := strings.Trim(strings.TrimSpace(config.Get("BASE_PATH", "")), "/")
+	if base == "" {
+		return ""
+	}
+	return "/" + base
 }
 
 func getEnv(key, def string) string {
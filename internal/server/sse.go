@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/kiali/kiali-ai/kiali_ai_mcp/internal/rag"
+)
+
+type ingestFunc func(ctx context.Context, progress func(rag.IngestProgress)) (rag.IngestResult, error)
+
+// streamIngest runs an ingest and reports it as server-sent events: a "progress"
+// event per page or video, then "done" with the totals or "error". The server
+// timeout does not apply; the ingest stops when the client disconnects.
+func streamIngest(w http.ResponseWriter, r *http.Request, run ingestFunc) {
+	streamJob(w, r, run, func(res rag.IngestResult) string { return fmt.Sprintf("%d ingested", res.Ingested) })
+}
+
+// streamJob reports a long-running operation as server-sent events like
+// streamIngest; stopped describes its partial result when the client disconnects.
+func streamJob[P, R any](w http.ResponseWriter, r *http.Request, run func(context.Context, func(P)) (R, error), stopped func(R) string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keep reverse proxies such as nginx from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	send := func(event string, v any) {
+		b, _ := json.Marshal(v)
+		_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+		flusher.Flush()
+	}
+
+	res, err := run(r.Context(), func(p P) { send("progress", p) })
+	if err != nil {
+		if r.Context().Err() != nil {
+			log.Printf("%s %s client disconnected after %s", r.Method, r.URL.Path, stopped(res))
+			return
+		}
+		log.Printf("%s %s error: %v", r.Method, r.URL.Path, err)
+		var conflict *rag.OperationConflictError
+		if errors.As(err, &conflict) {
+			send("error", map[string]any{"error": err.Error(), "status_code": http.StatusConflict, "operation": visibleOperation(r.Context(), conflict.Running)})
+			return
+		}
+		send("error", map[string]any{"error": err.Error()})
+		return
+	}
+	send("done", res)
+}